@@ -0,0 +1,102 @@
+package cas
+
+import (
+	"strings"
+)
+
+// AttributeTransform modifies the attributes of a validated response. Transforms are set on
+// ServiceTicketValidator.AttributeTransforms and applied in order after parsing, so responses
+// are already normalised when stored or cached.
+type AttributeTransform func(r *AuthenticationResponse)
+
+// RenameAttribute renames the attribute from to to, appending its values to any already
+// named to. For example RenameAttribute("urn:oid:0.9.2342.19200300.100.1.3", "email").
+func RenameAttribute(from, to string) AttributeTransform {
+	return func(r *AuthenticationResponse) {
+		values, ok := r.Attributes[from]
+		if !ok || from == to {
+			return
+		}
+
+		delete(r.Attributes, from)
+		r.Attributes[to] = append(r.Attributes[to], values...)
+
+		for i := range r.orderedAttributes {
+			if r.orderedAttributes[i].Name == from {
+				r.orderedAttributes[i].Name = to
+			}
+		}
+
+		if t, ok := r.attributeTypes[from]; ok {
+			delete(r.attributeTypes, from)
+			if _, ok := r.attributeTypes[to]; !ok {
+				r.attributeTypes[to] = t
+			}
+		}
+	}
+}
+
+// SplitAttribute splits each value of the named attribute on sep into several values,
+// for example SplitAttribute("groups", ";"). Empty values are dropped.
+func SplitAttribute(name, sep string) AttributeTransform {
+	return func(r *AuthenticationResponse) {
+		values, ok := r.Attributes[name]
+		if !ok {
+			return
+		}
+
+		r.Attributes[name] = splitValues(values, sep)
+
+		ordered := make([]Attribute, 0, len(r.orderedAttributes))
+		for _, a := range r.orderedAttributes {
+			if a.Name != name {
+				ordered = append(ordered, a)
+				continue
+			}
+
+			for _, v := range splitValues([]string{a.Value}, sep) {
+				ordered = append(ordered, Attribute{Name: name, Value: v})
+			}
+		}
+		r.orderedAttributes = ordered
+	}
+}
+
+// JoinAttribute joins the values of the named attribute with sep into a single value.
+func JoinAttribute(name, sep string) AttributeTransform {
+	return func(r *AuthenticationResponse) {
+		values, ok := r.Attributes[name]
+		if !ok {
+			return
+		}
+
+		joined := strings.Join(values, sep)
+		r.Attributes[name] = []string{joined}
+
+		ordered := make([]Attribute, 0, len(r.orderedAttributes))
+		seen := false
+		for _, a := range r.orderedAttributes {
+			if a.Name != name {
+				ordered = append(ordered, a)
+			} else if !seen {
+				ordered = append(ordered, Attribute{Name: name, Value: joined})
+				seen = true
+			}
+		}
+		r.orderedAttributes = ordered
+	}
+}
+
+// splitValues splits each of values on sep, dropping empty values.
+func splitValues(values []string, sep string) []string {
+	var split []string
+	for _, v := range values {
+		for _, part := range strings.Split(v, sep) {
+			if part = strings.TrimSpace(part); part != "" {
+				split = append(split, part)
+			}
+		}
+	}
+
+	return split
+}
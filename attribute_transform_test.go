@@ -0,0 +1,71 @@
+package cas
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"testing"
+)
+
+func TestAttributeTransforms(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `<cas:serviceResponse xmlns:cas="http://www.yale.edu/tp/cas">
+  <cas:authenticationSuccess>
+    <cas:user>enoch.root</cas:user>
+    <cas:attributes>
+      <cas:mailAddress>enoch@example.com</cas:mailAddress>
+      <cas:groups>staff;admins</cas:groups>
+      <cas:groups>readers</cas:groups>
+      <cas:givenName>Enoch</cas:givenName>
+      <cas:givenName>R.</cas:givenName>
+    </cas:attributes>
+  </cas:authenticationSuccess>
+</cas:serviceResponse>`)
+	}))
+	defer server.Close()
+
+	casURL, _ := url.Parse(server.URL)
+	validator := NewServiceTicketValidator(server.Client(), casURL)
+	validator.AttributeTransforms = []AttributeTransform{
+		RenameAttribute("mailAddress", "email"),
+		SplitAttribute("groups", ";"),
+		JoinAttribute("givenName", " "),
+	}
+	validator.PrincipalAttribute = "email"
+
+	serviceURL, _ := url.Parse("http://example.com/")
+	success, err := validator.ValidateTicket(serviceURL, "ST-123")
+	if err != nil {
+		t.Fatalf("Expected ValidateTicket to succeed, got error: %v", err)
+	}
+
+	if success.User != "enoch@example.com" {
+		t.Errorf("Expected the renamed attribute to be used as User, got <%s>", success.User)
+	}
+
+	if _, ok := success.Attributes["mailAddress"]; ok {
+		t.Errorf("Expected mailAddress to be renamed")
+	}
+
+	if groups := success.Attributes["groups"]; !reflect.DeepEqual(groups, []string{"staff", "admins", "readers"}) {
+		t.Errorf("Expected groups to be split, got %v", groups)
+	}
+
+	if name := success.Attributes["givenName"]; !reflect.DeepEqual(name, []string{"Enoch R."}) {
+		t.Errorf("Expected givenName to be joined, got %v", name)
+	}
+
+	expected := []Attribute{
+		{"email", "enoch@example.com"},
+		{"groups", "staff"},
+		{"groups", "admins"},
+		{"groups", "readers"},
+		{"givenName", "Enoch R."},
+	}
+
+	if ordered := success.OrderedAttributes(); !reflect.DeepEqual(ordered, expected) {
+		t.Errorf("Expected ordered attributes to be %v, got %v", expected, ordered)
+	}
+}
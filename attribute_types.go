@@ -0,0 +1,116 @@
+package cas
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Attribute type errors
+var (
+	// The response has no value for the attribute
+	ErrAttributeNotFound = errors.New("cas: attribute not found")
+)
+
+// GetBool returns the first value of the named attribute as a boolean. An attribute annotated
+// with an xsi:type other than xsd:boolean is not coerced, and without a type the value is
+// parsed with strconv.ParseBool. ok is false if the attribute is absent or not a boolean.
+func (r *AuthenticationResponse) GetBool(name string) (value bool, ok bool) {
+	v, t, ok := r.typedAttribute(name)
+	if !ok {
+		return false, false
+	}
+
+	switch t {
+	case "boolean":
+		// The lexical forms of xsd:boolean
+		switch v {
+		case "true", "1":
+			return true, true
+		case "false", "0":
+			return false, true
+		}
+
+		return false, false
+	case "":
+		b, err := strconv.ParseBool(v)
+		return b, err == nil
+	default:
+		return false, false
+	}
+}
+
+// GetInt returns the first value of the named attribute as an integer. An attribute annotated
+// with an xsi:type other than one of the xsd integer types is not coerced, and without a type
+// the value is parsed as a decimal. ok is false if the attribute is absent or not an integer.
+func (r *AuthenticationResponse) GetInt(name string) (value int64, ok bool) {
+	v, t, ok := r.typedAttribute(name)
+	if !ok {
+		return 0, false
+	}
+
+	switch t {
+	case "", "integer", "int", "long", "short", "byte",
+		"nonNegativeInteger", "positiveInteger", "nonPositiveInteger", "negativeInteger",
+		"unsignedLong", "unsignedInt", "unsignedShort", "unsignedByte":
+		i, err := strconv.ParseInt(strings.TrimPrefix(v, "+"), 10, 64)
+		return i, err == nil
+	default:
+		return 0, false
+	}
+}
+
+// GetTime returns the first value of the named attribute parsed as a time with the first of the
+// layouts which matches, or time.RFC3339 if none are given, for attributes such as lastLogin or
+// passwordExpiration. ErrAttributeNotFound is returned if the attribute is absent, and the
+// error of the last layout if the value matches none.
+func (r *AuthenticationResponse) GetTime(name string, layouts ...string) (time.Time, error) {
+	v, _, ok := r.typedAttribute(name)
+	if !ok {
+		return time.Time{}, fmt.Errorf("%w: %s", ErrAttributeNotFound, name)
+	}
+
+	if len(layouts) == 0 {
+		layouts = []string{time.RFC3339}
+	}
+
+	var err error
+	for _, layout := range layouts {
+		var t time.Time
+		if t, err = time.Parse(layout, v); err == nil {
+			return t, nil
+		}
+	}
+
+	return time.Time{}, err
+}
+
+// typedAttribute returns the first value of the named attribute and its xsi:type hint.
+func (r *AuthenticationResponse) typedAttribute(name string) (value string, xsiType string, ok bool) {
+	values, ok := r.Attributes[name]
+	if !ok || len(values) == 0 {
+		return "", "", false
+	}
+
+	return strings.TrimSpace(values[0]), r.attributeTypes[name], true
+}
+
+// setAttributeType records the xsi:type hint of the named attribute, such as xsd:boolean,
+// without its namespace prefix.
+func (r *AuthenticationResponse) setAttributeType(name, xsiType string) {
+	if xsiType == "" {
+		return
+	}
+
+	if i := strings.LastIndex(xsiType, ":"); i >= 0 {
+		xsiType = xsiType[i+1:]
+	}
+
+	if r.attributeTypes == nil {
+		r.attributeTypes = make(map[string]string)
+	}
+
+	r.attributeTypes[name] = xsiType
+}
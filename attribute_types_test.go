@@ -0,0 +1,108 @@
+package cas
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestAttributeTypeHints(t *testing.T) {
+	s := `<cas:serviceResponse xmlns:cas="http://www.yale.edu/tp/cas"
+    xmlns:xsi="http://www.w3.org/2001/XMLSchema-instance" xmlns:xs="http://www.w3.org/2001/XMLSchema">
+  <cas:authenticationSuccess>
+    <cas:user>enoch.root</cas:user>
+    <cas:attributes>
+      <cas:admin xsi:type="xs:boolean">1</cas:admin>
+      <cas:loginCount xsi:type="xs:integer">+42</cas:loginCount>
+      <cas:employeeNumber xsi:type="xs:string">0042</cas:employeeNumber>
+      <cas:active>true</cas:active>
+      <cas:uidNumber>1001</cas:uidNumber>
+      <cas:displayName>Enoch Root</cas:displayName>
+    </cas:attributes>
+  </cas:authenticationSuccess>
+</cas:serviceResponse>`
+
+	r, err := ParseServiceResponse([]byte(s))
+	if err != nil {
+		t.Fatalf("Expected ParseServiceResponse to succeed, got error: %v", err)
+	}
+
+	bools := []struct {
+		name     string
+		expected bool
+		ok       bool
+	}{
+		{"admin", true, true},
+		{"active", true, true},
+		{"displayName", false, false},
+		{"loginCount", false, false},
+		{"missing", false, false},
+	}
+
+	for _, c := range bools {
+		if v, ok := r.GetBool(c.name); v != c.expected || ok != c.ok {
+			t.Errorf("Expected GetBool(%q) to be <%v, %v>, got <%v, %v>", c.name, c.expected, c.ok, v, ok)
+		}
+	}
+
+	ints := []struct {
+		name     string
+		expected int64
+		ok       bool
+	}{
+		{"loginCount", 42, true},
+		{"uidNumber", 1001, true},
+		{"employeeNumber", 0, false},
+		{"displayName", 0, false},
+		{"missing", 0, false},
+	}
+
+	for _, c := range ints {
+		if v, ok := r.GetInt(c.name); v != c.expected || ok != c.ok {
+			t.Errorf("Expected GetInt(%q) to be <%v, %v>, got <%v, %v>", c.name, c.expected, c.ok, v, ok)
+		}
+	}
+
+	if v := r.Attributes.Get("employeeNumber"); v != "0042" {
+		t.Errorf("Expected employeeNumber to be <0042>, got <%s>", v)
+	}
+
+	RenameAttribute("loginCount", "logins")(r)
+	if v, ok := r.GetInt("logins"); v != 42 || !ok {
+		t.Errorf("Expected the type hint to follow a renamed attribute, got <%v, %v>", v, ok)
+	}
+}
+
+func TestGetTime(t *testing.T) {
+	r := &AuthenticationResponse{Attributes: UserAttributes{
+		"lastLogin":          {"2024-03-01T09:30:00Z"},
+		"passwordExpiration": {"20240401093000Z"},
+		"displayName":        {"Enoch Root"},
+	}}
+
+	lastLogin, err := r.GetTime("lastLogin")
+	if err != nil {
+		t.Fatalf("Expected lastLogin to parse, got error: %v", err)
+	}
+
+	if expected := time.Date(2024, 3, 1, 9, 30, 0, 0, time.UTC); !lastLogin.Equal(expected) {
+		t.Errorf("Expected lastLogin to be <%v>, got <%v>", expected, lastLogin)
+	}
+
+	expiration, err := r.GetTime("passwordExpiration", time.RFC3339, "20060102150405Z0700")
+	if err != nil {
+		t.Fatalf("Expected passwordExpiration to parse with the generalized time layout, got error: %v", err)
+	}
+
+	if expected := time.Date(2024, 4, 1, 9, 30, 0, 0, time.UTC); !expiration.Equal(expected) {
+		t.Errorf("Expected passwordExpiration to be <%v>, got <%v>", expected, expiration)
+	}
+
+	if _, err := r.GetTime("displayName"); err == nil {
+		t.Errorf("Expected displayName not to parse as a time")
+	}
+
+	if _, err := r.GetTime("missing"); !errors.Is(err, ErrAttributeNotFound) {
+		t.Errorf("Expected error to be <%v>, got <%v>", ErrAttributeNotFound, err)
+	}
+}
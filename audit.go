@@ -0,0 +1,63 @@
+package cas
+
+import (
+	"context"
+	"net/http"
+	"sort"
+	"time"
+)
+
+// AuditRecord describes a ticket validation for the AuditHook of a ServiceTicketValidator. It
+// names the released attributes without their values, so it can be kept in an audit trail
+// without copying personal data.
+type AuditRecord struct {
+	Time       time.Time     // When the validation completed
+	Duration   time.Duration // How long the validation took, including any retries and fallback
+	User       string        // User the ticket was issued to, empty if the validation failed
+	Service    string        // Service parameter sent to the CAS server
+	Endpoint   string        // Validation endpoint contacted last, empty if no request was made for this call
+	Attributes []string      // Names of the released attributes, sorted
+	Err        error         // Error failing the validation, nil if it succeeded
+}
+
+// Succeeded reports whether the validation succeeded
+func (r AuditRecord) Succeeded() bool {
+	return r.Err == nil && r.User != ""
+}
+
+// withAuditEndpoint returns a copy of ctx recording the validation endpoint requested with it
+// in endpoint, see auditEndpoint.
+func withAuditEndpoint(ctx context.Context, endpoint *string) context.Context {
+	return context.WithValue(ctx, auditEndpointKey, endpoint)
+}
+
+// auditEndpoint records the validation endpoint of the request r for the AuditHook, if the
+// validation of its context is audited.
+func auditEndpoint(r *http.Request) {
+	if endpoint, ok := r.Context().Value(auditEndpointKey).(*string); ok {
+		*endpoint = validationEndpoint(r.URL.Path)
+	}
+}
+
+// audit passes the outcome of a validation to the AuditHook.
+func (validator *ServiceTicketValidator) audit(start time.Time, service string, endpoint string, success *AuthenticationResponse, err error) {
+	now := time.Now()
+	record := AuditRecord{
+		Time:     now,
+		Duration: now.Sub(start),
+		Service:  service,
+		Endpoint: endpoint,
+		Err:      err,
+	}
+
+	if success != nil {
+		record.User = success.User
+		for name := range success.Attributes {
+			record.Attributes = append(record.Attributes, name)
+		}
+
+		sort.Strings(record.Attributes)
+	}
+
+	validator.AuditHook(record)
+}
@@ -0,0 +1,64 @@
+package cas
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"testing"
+)
+
+func TestValidateTicketAuditHook(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("ticket") != "ST-123" {
+			fmt.Fprint(w, `<cas:serviceResponse xmlns:cas="http://www.yale.edu/tp/cas">
+  <cas:authenticationFailure code="INVALID_TICKET">Ticket not recognized</cas:authenticationFailure>
+</cas:serviceResponse>`)
+			return
+		}
+
+		fmt.Fprint(w, `<cas:serviceResponse xmlns:cas="http://www.yale.edu/tp/cas">
+  <cas:authenticationSuccess>
+    <cas:user>enoch.root</cas:user>
+    <cas:attributes>
+      <cas:mail>enoch.root@example.com</cas:mail>
+      <cas:displayName>Enoch Root</cas:displayName>
+    </cas:attributes>
+  </cas:authenticationSuccess>
+</cas:serviceResponse>`)
+	}))
+	defer server.Close()
+
+	var records []AuditRecord
+	casURL, _ := url.Parse(server.URL)
+	validator := NewServiceTicketValidator(server.Client(), casURL)
+	validator.AuditHook = func(r AuditRecord) {
+		records = append(records, r)
+	}
+	serviceURL, _ := url.Parse("http://example.com/")
+
+	validator.ValidateTicket(serviceURL, "ST-123")
+	validator.ValidateTicket(serviceURL, "ST-unknown")
+
+	if len(records) != 2 {
+		t.Fatalf("Expected an AuditRecord for each validation, got <%v>", records)
+	}
+
+	r := records[0]
+	if !r.Succeeded() || r.User != "enoch.root" || r.Endpoint != "serviceValidate" || r.Service != "http://example.com/" {
+		t.Errorf("Expected a successful serviceValidate record for <enoch.root>, got <%+v>", r)
+	}
+
+	if expected := []string{"displayName", "mail"}; !reflect.DeepEqual(r.Attributes, expected) {
+		t.Errorf("Expected Attributes to be <%v>, got <%v>", expected, r.Attributes)
+	}
+
+	if r.Time.IsZero() || r.Duration <= 0 {
+		t.Errorf("Expected Time and Duration to be set, got <%v> and <%v>", r.Time, r.Duration)
+	}
+
+	if r := records[1]; r.Succeeded() || r.Err == nil || r.User != "" || r.Attributes != nil {
+		t.Errorf("Expected a failed record without a user, got <%+v>", r)
+	}
+}
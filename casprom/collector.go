@@ -0,0 +1,208 @@
+// Package casprom exposes metrics of the cas package in the Prometheus text exposition format,
+// without a dependency on the Prometheus client library.
+//
+// A Collector is fed by the AuditHook of a ServiceTicketValidator and by wrapping the
+// TicketStore of a Client, and serves the metrics as an http.Handler for Prometheus to scrape:
+//
+//	collector := casprom.NewCollector("cas")
+//	validator.AuditHook = collector.AuditHook
+//	client := cas.NewClient(&cas.Options{URL: casURL, Store: collector.Store(&cas.MemoryStore{})})
+//	http.Handle("/metrics/cas", collector)
+//
+// The metrics, prefixed with the namespace, are:
+//
+//	<namespace>_validations_total{result}              validations by result: success, rejected or error
+//	<namespace>_validation_duration_seconds            histogram of the validation latency
+//	<namespace>_authentication_failures_total{code}    authenticationFailure responses by CAS error code
+//	<namespace>_ticket_store_reads_total{result}       ticket store reads by result: hit or miss
+//
+// The cache hit ratio is the rate of hit reads over the rate of all reads.
+package casprom
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+
+	"github.com/go-rat/cas"
+)
+
+// DefaultBuckets are the upper bounds in seconds of the validation latency histogram
+var DefaultBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// Validation results
+const (
+	resultSuccess  = "success"
+	resultRejected = "rejected"
+	resultError    = "error"
+)
+
+// Collector counts validations and ticket store reads for Prometheus, see the package
+// documentation. It is safe for concurrent use.
+type Collector struct {
+	namespace string
+
+	mu          sync.Mutex
+	validations map[string]uint64
+	failures    map[string]uint64
+	reads       map[string]uint64
+	buckets     []uint64 // cumulative counts of DefaultBuckets
+	sum         float64
+	count       uint64
+}
+
+// NewCollector creates a Collector for metrics prefixed with namespace, "cas" if empty.
+func NewCollector(namespace string) *Collector {
+	if namespace == "" {
+		namespace = "cas"
+	}
+
+	return &Collector{
+		namespace:   namespace,
+		validations: make(map[string]uint64),
+		failures:    make(map[string]uint64),
+		reads:       make(map[string]uint64),
+		buckets:     make([]uint64, len(DefaultBuckets)),
+	}
+}
+
+// AuditHook records a validation, use it as the cas.ServiceTicketValidator.AuditHook.
+func (c *Collector) AuditHook(record cas.AuditRecord) {
+	result := resultSuccess
+	var authErr *cas.AuthenticationError
+	switch {
+	case errors.As(record.Err, &authErr):
+		result = resultRejected
+	case record.Err != nil:
+		result = resultError
+	case !record.Succeeded():
+		result = resultRejected
+	}
+
+	seconds := record.Duration.Seconds()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.validations[result]++
+	if authErr != nil {
+		c.failures[authErr.Code]++
+	}
+
+	for i, bound := range DefaultBuckets {
+		if seconds <= bound {
+			c.buckets[i]++
+		}
+	}
+
+	c.sum += seconds
+	c.count++
+}
+
+// Store wraps the ticket store so its reads are counted as hits or misses.
+func (c *Collector) Store(store cas.TicketStore) cas.TicketStore {
+	return &countingStore{TicketStore: store, c: c}
+}
+
+// countingStore counts the reads of a TicketStore
+type countingStore struct {
+	cas.TicketStore
+	c *Collector
+}
+
+// Read reads the ticket from the wrapped store, counting a hit or a miss
+func (s *countingStore) Read(id string) (*cas.AuthenticationResponse, error) {
+	t, err := s.TicketStore.Read(id)
+
+	result := "hit"
+	if err != nil {
+		result = "miss"
+	}
+
+	s.c.mu.Lock()
+	s.c.reads[result]++
+	s.c.mu.Unlock()
+
+	return t, err
+}
+
+// ServeHTTP writes the metrics in the Prometheus text exposition format.
+func (c *Collector) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	c.WriteTo(w)
+}
+
+// WriteTo writes the metrics to w in the Prometheus text exposition format.
+func (c *Collector) WriteTo(w io.Writer) (int64, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	cw := &countingWriter{w: bufio.NewWriter(w)}
+	ns := c.namespace
+
+	writeHeader(cw, ns+"_validations_total", "counter", "Ticket validations by result.")
+	writeLabelled(cw, ns+"_validations_total", "result", c.validations)
+
+	name := ns + "_validation_duration_seconds"
+	writeHeader(cw, name, "histogram", "Latency of ticket validations.")
+	for i, bound := range DefaultBuckets {
+		fmt.Fprintf(cw, "%s_bucket{le=\"%s\"} %d\n", name, strconv.FormatFloat(bound, 'g', -1, 64), c.buckets[i])
+	}
+	fmt.Fprintf(cw, "%s_bucket{le=\"+Inf\"} %d\n", name, c.count)
+	fmt.Fprintf(cw, "%s_sum %s\n", name, strconv.FormatFloat(c.sum, 'g', -1, 64))
+	fmt.Fprintf(cw, "%s_count %d\n", name, c.count)
+
+	writeHeader(cw, ns+"_authentication_failures_total", "counter", "authenticationFailure responses by CAS error code.")
+	writeLabelled(cw, ns+"_authentication_failures_total", "code", c.failures)
+
+	writeHeader(cw, ns+"_ticket_store_reads_total", "counter", "Ticket store reads by result.")
+	writeLabelled(cw, ns+"_ticket_store_reads_total", "result", c.reads)
+
+	if err := cw.w.Flush(); err != nil && cw.err == nil {
+		cw.err = err
+	}
+
+	return cw.n, cw.err
+}
+
+// writeHeader writes the HELP and TYPE lines of a metric
+func writeHeader(w io.Writer, name, metricType, help string) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, metricType)
+}
+
+// writeLabelled writes a sample of the metric for each label value, sorted
+func writeLabelled(w io.Writer, name, label string, values map[string]uint64) {
+	keys := make([]string, 0, len(values))
+	for k := range values {
+		keys = append(keys, k)
+	}
+
+	sort.Strings(keys)
+	for _, k := range keys {
+		fmt.Fprintf(w, "%s{%s=%s} %d\n", name, label, strconv.Quote(k), values[k])
+	}
+}
+
+// countingWriter counts the bytes written and keeps the first error
+type countingWriter struct {
+	w   *bufio.Writer
+	n   int64
+	err error
+}
+
+// Write writes p unless an earlier write failed
+func (cw *countingWriter) Write(p []byte) (int, error) {
+	if cw.err != nil {
+		return 0, cw.err
+	}
+
+	n, err := cw.w.Write(p)
+	cw.n += int64(n)
+	cw.err = err
+	return n, err
+}
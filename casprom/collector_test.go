@@ -0,0 +1,51 @@
+package casprom
+
+import (
+	"errors"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-rat/cas"
+)
+
+func TestCollector(t *testing.T) {
+	c := NewCollector("")
+
+	c.AuditHook(cas.AuditRecord{User: "enoch.root", Duration: 20 * time.Millisecond})
+	c.AuditHook(cas.AuditRecord{Err: &cas.AuthenticationError{Code: cas.INVALID_TICKET}, Duration: time.Second})
+	c.AuditHook(cas.AuditRecord{Err: errors.New("connection refused"), Duration: 30 * time.Second})
+
+	store := c.Store(&cas.MemoryStore{})
+	store.Write("ST-123", &cas.AuthenticationResponse{User: "enoch.root"})
+	store.Read("ST-123")
+	store.Read("ST-456")
+
+	w := httptest.NewRecorder()
+	c.ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+
+	if ct := w.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/plain; version=0.0.4") {
+		t.Errorf("Expected the text exposition format, got Content-Type <%s>", ct)
+	}
+
+	body := w.Body.String()
+	for _, line := range []string{
+		"# TYPE cas_validations_total counter",
+		`cas_validations_total{result="error"} 1`,
+		`cas_validations_total{result="rejected"} 1`,
+		`cas_validations_total{result="success"} 1`,
+		`cas_validation_duration_seconds_bucket{le="0.025"} 1`,
+		`cas_validation_duration_seconds_bucket{le="1"} 2`,
+		`cas_validation_duration_seconds_bucket{le="+Inf"} 3`,
+		"cas_validation_duration_seconds_sum 31.02",
+		"cas_validation_duration_seconds_count 3",
+		`cas_authentication_failures_total{code="INVALID_TICKET"} 1`,
+		`cas_ticket_store_reads_total{result="hit"} 1`,
+		`cas_ticket_store_reads_total{result="miss"} 1`,
+	} {
+		if !strings.Contains(body, line+"\n") {
+			t.Errorf("Expected the metrics to contain <%s>, got:\n%s", line, body)
+		}
+	}
+}
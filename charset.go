@@ -0,0 +1,127 @@
+package cas
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"mime"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+var (
+	xmlDeclarationEncoding = regexp.MustCompile(`^\s*<\?xml[^>]*\sencoding\s*=\s*["']([A-Za-z0-9._:-]+)["']`)
+)
+
+// windows1252 maps the bytes 0x80 to 0x9F of windows-1252 which differ from ISO-8859-1
+var windows1252 = [32]rune{
+	'€', 0x81, '‚', 'ƒ', '„', '…', '†', '‡', 'ˆ', '‰', 'Š', '‹', 'Œ', 0x8D, 'Ž', 0x8F,
+	0x90, '‘', '’', '“', '”', '•', '–', '—', '˜', '™', 'š', '›', 'œ', 0x9D, 'ž', 'Ÿ',
+}
+
+// DefaultCharsetReader converts input in the named charset to UTF-8. It has the signature of
+// xml.Decoder.CharsetReader and supports UTF-8, US-ASCII, ISO-8859-1 and windows-1252.
+//
+// It is used unless ServiceTicketValidator.CharsetReader is set, whose implementation can fall
+// back to it, for example after handling charsets of golang.org/x/net/html/charset.
+func DefaultCharsetReader(charset string, input io.Reader) (io.Reader, error) {
+	switch strings.ToLower(charset) {
+	case "", "utf-8", "utf8", "us-ascii", "ascii":
+		return input, nil
+	case "iso-8859-1", "iso8859-1", "iso_8859-1", "latin1", "latin-1", "l1":
+		return singleByteReader(input, nil)
+	case "windows-1252", "cp1252", "x-cp1252":
+		return singleByteReader(input, &windows1252)
+	default:
+		return nil, fmt.Errorf("cas: unsupported charset %q", charset)
+	}
+}
+
+// singleByteReader decodes a single byte charset which matches ISO-8859-1 except for the
+// optional replacements of the bytes 0x80 to 0x9F.
+func singleByteReader(input io.Reader, high *[32]rune) (io.Reader, error) {
+	data, err := io.ReadAll(input)
+	if err != nil {
+		return nil, err
+	}
+
+	var b bytes.Buffer
+	b.Grow(len(data))
+
+	buf := make([]byte, utf8.UTFMax)
+	for _, c := range data {
+		r := rune(c)
+		if high != nil && c >= 0x80 && c <= 0x9F {
+			r = high[c-0x80]
+		}
+
+		n := utf8.EncodeRune(buf, r)
+		b.Write(buf[:n])
+	}
+
+	return &b, nil
+}
+
+// passthroughCharsetReader is used once a body has already been converted to UTF-8, so an
+// encoding in the XML declaration is not applied a second time.
+func passthroughCharsetReader(charset string, input io.Reader) (io.Reader, error) {
+	return input, nil
+}
+
+// charsetFromContentType returns the charset parameter of a Content-Type header value.
+func charsetFromContentType(contentType string) string {
+	if contentType == "" {
+		return ""
+	}
+
+	_, params, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return ""
+	}
+
+	return params["charset"]
+}
+
+// charsetFromXMLDeclaration returns the encoding named in the XML declaration of data.
+func charsetFromXMLDeclaration(data []byte) string {
+	if m := xmlDeclarationEncoding.FindSubmatch(data); m != nil {
+		return string(m[1])
+	}
+
+	return ""
+}
+
+// toUTF8 converts data to UTF-8. The charset, usually from the Content-Type header, takes
+// precedence over the XML declaration as in RFC 7303.
+func toUTF8(data []byte, charset string, reader func(string, io.Reader) (io.Reader, error)) ([]byte, error) {
+	if charset == "" {
+		charset = charsetFromXMLDeclaration(data)
+	}
+
+	switch strings.ToLower(charset) {
+	case "", "utf-8", "utf8":
+		return data, nil
+	}
+
+	if reader == nil {
+		reader = DefaultCharsetReader
+	}
+
+	r, err := reader(charset, bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+
+	return io.ReadAll(r)
+}
+
+// unmarshalXML decodes UTF-8 data into v, ignoring the encoding of the XML declaration as
+// toUTF8 has already applied it.
+func unmarshalXML(data []byte, v interface{}) error {
+	d := xml.NewDecoder(bytes.NewReader(data))
+	d.CharsetReader = passthroughCharsetReader
+
+	return d.Decode(v)
+}
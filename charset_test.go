@@ -0,0 +1,123 @@
+package cas
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+// latin1ServiceResponse has the attribute value "José Müller" encoded as ISO-8859-1
+var latin1ServiceResponse = []byte("<cas:serviceResponse xmlns:cas=\"http://www.yale.edu/tp/cas\">\n" +
+	"  <cas:authenticationSuccess>\n" +
+	"    <cas:user>jmuller</cas:user>\n" +
+	"    <cas:attributes>\n" +
+	"      <cas:displayName>Jos\xe9 M\xfcller</cas:displayName>\n" +
+	"    </cas:attributes>\n" +
+	"  </cas:authenticationSuccess>\n" +
+	"</cas:serviceResponse>")
+
+func TestParseServiceResponseLatin1Declaration(t *testing.T) {
+	data := append([]byte("<?xml version=\"1.0\" encoding=\"ISO-8859-1\"?>\n"), latin1ServiceResponse...)
+
+	r, err := ParseServiceResponse(data)
+	if err != nil {
+		t.Fatalf("Expected ParseServiceResponse to succeed, got error: %v", err)
+	}
+
+	if v := r.Attributes.Get("displayName"); v != "José Müller" {
+		t.Errorf("Expected displayName to be <José Müller>, got <%s>", v)
+	}
+}
+
+func TestValidateTicketLatin1ContentType(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/xml; charset=ISO-8859-1")
+		w.Write(latin1ServiceResponse)
+	}))
+	defer server.Close()
+
+	casURL, _ := url.Parse(server.URL)
+	validator := NewServiceTicketValidator(server.Client(), casURL)
+
+	serviceURL, _ := url.Parse("http://example.com/")
+	r, err := validator.ValidateTicket(serviceURL, "ST-123")
+	if err != nil {
+		t.Fatalf("Expected ValidateTicket to succeed, got error: %v", err)
+	}
+
+	if v := r.Attributes.Get("displayName"); v != "José Müller" {
+		t.Errorf("Expected displayName to be <José Müller>, got <%s>", v)
+	}
+}
+
+func TestValidateTicketCharsetReader(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/xml; charset=x-vendor-latin")
+		w.Write(latin1ServiceResponse)
+	}))
+	defer server.Close()
+
+	casURL, _ := url.Parse(server.URL)
+	validator := NewServiceTicketValidator(server.Client(), casURL)
+	serviceURL, _ := url.Parse("http://example.com/")
+
+	if _, err := validator.ValidateTicket(serviceURL, "ST-123"); err == nil {
+		t.Fatalf("Expected ValidateTicket to fail for an unsupported charset")
+	}
+
+	var charsets []string
+	validator.CharsetReader = func(charset string, input io.Reader) (io.Reader, error) {
+		charsets = append(charsets, charset)
+		if charset == "x-vendor-latin" {
+			charset = "iso-8859-1"
+		}
+
+		return DefaultCharsetReader(charset, input)
+	}
+
+	r, err := validator.ValidateTicket(serviceURL, "ST-123")
+	if err != nil {
+		t.Fatalf("Expected ValidateTicket to succeed, got error: %v", err)
+	}
+
+	if v := r.Attributes.Get("displayName"); v != "José Müller" {
+		t.Errorf("Expected displayName to be <José Müller>, got <%s>", v)
+	}
+
+	if len(charsets) != 1 || charsets[0] != "x-vendor-latin" {
+		t.Errorf("Expected CharsetReader to be called for <x-vendor-latin>, got <%v>", charsets)
+	}
+}
+
+func TestToUTF8(t *testing.T) {
+	cases := []struct {
+		data     string
+		charset  string
+		expected string
+	}{
+		{"caf\xe9", "iso-8859-1", "café"},
+		{"\x93quoted\x94 \x80", "windows-1252", "“quoted” €"},
+		{"café", "UTF-8", "café"},
+		{"café", "", "café"},
+		{"<?xml version='1.0' encoding='latin1'?>caf\xe9", "", "<?xml version='1.0' encoding='latin1'?>café"},
+		{"<?xml version='1.0' encoding='latin1'?>café", "utf-8", "<?xml version='1.0' encoding='latin1'?>café"},
+	}
+
+	for _, c := range cases {
+		out, err := toUTF8([]byte(c.data), c.charset, nil)
+		if err != nil {
+			t.Errorf("Expected toUTF8(%q, %q) to succeed, got error: %v", c.data, c.charset, err)
+			continue
+		}
+
+		if string(out) != c.expected {
+			t.Errorf("Expected toUTF8(%q, %q) to be <%s>, got <%s>", c.data, c.charset, c.expected, out)
+		}
+	}
+
+	if _, err := toUTF8([]byte("data"), "shift_jis", nil); err == nil {
+		t.Errorf("Expected an error for an unsupported charset")
+	}
+}
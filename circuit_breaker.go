@@ -0,0 +1,160 @@
+package cas
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Circuit breaker errors
+var (
+	// The circuit of the CAS host is open after consecutive failures, so the validation was not
+	// attempted. It is retried once the CircuitBreaker.Cooldown has passed.
+	ErrCircuitOpen = errors.New("cas: circuit breaker open")
+)
+
+// CircuitBreaker defaults
+const (
+	DefaultCircuitBreakerThreshold = 5
+	DefaultCircuitBreakerCooldown  = 30 * time.Second
+)
+
+// CircuitBreaker short-circuits validations against a CAS host which is failing, so requests
+// fail fast with ErrCircuitOpen instead of each waiting for a timeout during an outage.
+//
+// A circuit is kept per CAS host. After Threshold consecutive failures, transport errors or
+// status codes of 500 and above, it opens for the Cooldown. A single validation is then let
+// through as a probe, closing the circuit if it succeeds and opening it again if it fails. A
+// CircuitBreaker can be shared by several validators.
+type CircuitBreaker struct {
+	Threshold int           // Consecutive failures opening a circuit, DefaultCircuitBreakerThreshold if zero
+	Cooldown  time.Duration // Time a circuit stays open, DefaultCircuitBreakerCooldown if zero
+
+	mu       sync.Mutex
+	circuits map[string]*circuit
+}
+
+// circuit is the state of the CircuitBreaker for one host
+type circuit struct {
+	failures  int
+	openUntil time.Time
+	probing   bool // a probe of the half-open circuit is in flight
+}
+
+// allow returns ErrCircuitOpen if a request to the host must not be sent. Once the circuit
+// is half-open it allows a single request, the probe, whose result must be recorded.
+func (b *CircuitBreaker) allow(host string) error {
+	if b == nil {
+		return nil
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	c := b.circuits[host]
+	if c == nil || c.openUntil.IsZero() {
+		return nil
+	}
+
+	if c.probing || time.Now().Before(c.openUntil) {
+		return fmt.Errorf("%w: %s", ErrCircuitOpen, host)
+	}
+
+	c.probing = true
+	return nil
+}
+
+// record records the result of a request to the host allowed by allow, reporting whether it
+// opened the circuit.
+func (b *CircuitBreaker) record(host string, failed bool) bool {
+	if b == nil {
+		return false
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	c := b.circuits[host]
+	if !failed {
+		delete(b.circuits, host)
+		return false
+	}
+
+	if c == nil {
+		if b.circuits == nil {
+			b.circuits = make(map[string]*circuit)
+		}
+
+		c = &circuit{}
+		b.circuits[host] = c
+	}
+
+	c.failures++
+
+	threshold := b.Threshold
+	if threshold <= 0 {
+		threshold = DefaultCircuitBreakerThreshold
+	}
+
+	if !c.probing && c.failures < threshold {
+		return false
+	}
+
+	cooldown := b.Cooldown
+	if cooldown <= 0 {
+		cooldown = DefaultCircuitBreakerCooldown
+	}
+
+	c.openUntil = time.Now().Add(cooldown)
+	c.probing = false
+	return true
+}
+
+// release ends a request to the host without a result, such as one canceled by the caller, so
+// another probe may be sent.
+func (b *CircuitBreaker) release(host string) {
+	if b == nil {
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if c := b.circuits[host]; c != nil {
+		c.probing = false
+	}
+}
+
+// do sends the request r with the HTTP client of the validator, through its CircuitBreaker,
+// retrying it according to its RetryPolicy.
+func (validator *ServiceTicketValidator) do(r *http.Request) (*http.Response, error) {
+	resp, err := validator.RetryPolicy.do(r, validator.send)
+	observeStatus(r, resp)
+	return resp, err
+}
+
+// send sends the request r once with the HTTP client of the validator, through its
+// CircuitBreaker.
+func (validator *ServiceTicketValidator) send(r *http.Request) (*http.Response, error) {
+	b := validator.CircuitBreaker
+	host := r.URL.Host
+	if err := b.allow(host); err != nil {
+		return nil, err
+	}
+
+	resp, err := validator.client.Do(r)
+	if err != nil && errors.Is(r.Context().Err(), context.Canceled) {
+		b.release(host)
+		return resp, err
+	}
+
+	if b.record(host, err != nil || resp.StatusCode >= 500) {
+		requestLogger(validator.logger(), r.Context()).Warn("cas: circuit breaker opened", slog.String("host", host))
+	}
+
+	return resp, err
+}
@@ -0,0 +1,73 @@
+package cas
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestValidateTicketCircuitBreaker(t *testing.T) {
+	var requests, healthy int32
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		if atomic.LoadInt32(&healthy) == 0 {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+
+		fmt.Fprint(w, `<cas:serviceResponse xmlns:cas="http://www.yale.edu/tp/cas">
+  <cas:authenticationSuccess>
+    <cas:user>enoch.root</cas:user>
+  </cas:authenticationSuccess>
+</cas:serviceResponse>`)
+	}))
+	defer server.Close()
+
+	casURL, _ := url.Parse(server.URL)
+	validator := NewServiceTicketValidator(server.Client(), casURL)
+	validator.Logger = NoopLogger()
+	validator.CircuitBreaker = &CircuitBreaker{Threshold: 2, Cooldown: 50 * time.Millisecond}
+	serviceURL, _ := url.Parse("http://example.com/")
+
+	for i := 0; i < 2; i++ {
+		if _, err := validator.ValidateTicket(serviceURL, "ST-123"); err == nil || errors.Is(err, ErrCircuitOpen) {
+			t.Fatalf("Expected validation %d to fail with the server error, got <%v>", i, err)
+		}
+	}
+
+	if _, err := validator.ValidateTicket(serviceURL, "ST-123"); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("Expected error to be <%v>, got <%v>", ErrCircuitOpen, err)
+	}
+
+	if n := atomic.LoadInt32(&requests); n != 2 {
+		t.Errorf("Expected the open circuit not to send a request, got %d requests", n)
+	}
+
+	time.Sleep(60 * time.Millisecond)
+	if _, err := validator.ValidateTicket(serviceURL, "ST-123"); err == nil || errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("Expected the failing probe to reach the server, got <%v>", err)
+	}
+
+	if _, err := validator.ValidateTicket(serviceURL, "ST-123"); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("Expected a failed probe to open the circuit again, got <%v>", err)
+	}
+
+	atomic.StoreInt32(&healthy, 1)
+	time.Sleep(60 * time.Millisecond)
+
+	for i := 0; i < 2; i++ {
+		success, err := validator.ValidateTicket(serviceURL, "ST-123")
+		if err != nil {
+			t.Fatalf("Expected validation %d to succeed once the server recovered, got error: %v", i, err)
+		}
+
+		if success.User != "enoch.root" {
+			t.Errorf("Expected User to be <enoch.root>, got <%s>", success.User)
+		}
+	}
+}
@@ -2,9 +2,18 @@ package cas
 
 import (
 	"crypto/rand"
+	"errors"
 	"log/slog"
 	"net/http"
 	"net/url"
+	"sync"
+	"time"
+)
+
+// Client errors
+var (
+	// The request has more than one ticket parameter and StrictTicketParameter is set
+	ErrDuplicateTicketParameter = errors.New("cas: request has more than one ticket parameter")
 )
 
 // Options : Client configuration options
@@ -16,6 +25,61 @@ type Options struct {
 	URLScheme    URLScheme    // Custom url scheme, can be used to modify the request urls for the client
 	Cookie       *http.Cookie // http.Cookie options, uses Path, Domain, MaxAge, HttpOnly, & Secure
 	SessionStore SessionStore
+	Logger       *slog.Logger    // Custom logger, if nil slog.Default() will be used
+	Validator    TicketValidator // Custom ticket validator, if nil a ServiceTicketValidator will be used
+	Gateway      bool            // Attempt transparent authentication with gateway=true before serving unauthenticated requests
+
+	// GatewayCookie configures the marker cookie which stops Gateway redirecting an anonymous
+	// user again for its MaxAge, uses Name, Path, Domain, MaxAge, Secure & SameSite. If nil the
+	// cookie is named _cas_gateway with Path /, a MaxAge of 60 seconds, Secure and SameSite Lax.
+	// The cookie is always HttpOnly.
+	GatewayCookie *http.Cookie
+
+	// AllowInsecureCasURL permits ticket validation against a non-https URL, for local development only.
+	AllowInsecureCasURL bool
+
+	// PrincipalMapper normalises each validated response before it is stored, see
+	// ServiceTicketValidator. It is applied by the default validator, or by the Client to the
+	// responses of a custom Validator.
+	PrincipalMapper func(*AuthenticationResponse) error
+
+	// Counters, if set, counts validation events of the default validator, see ExpvarCounters.
+	Counters *ExpvarCounters
+
+	// StrictTicketParameter rejects requests with more than one ticket parameter with
+	// ErrDuplicateTicketParameter and status 400. By default the first ticket is validated.
+	StrictTicketParameter bool
+
+	// TicketParameter names the query parameter the ticket is returned in, such as SAMLart
+	// for some gateways. Defaults to ticket.
+	TicketParameter string
+
+	// NormaliseTrailingSlash canonicalises the trailing slash of the service URL sent to login,
+	// logout and the default validator, see ServiceTicketValidator.
+	NormaliseTrailingSlash bool
+
+	// OnLogout, if set, is called with the service ticket of each single logout request once
+	// its ticket and session have been removed, to clean up state the application keeps for
+	// the session.
+	OnLogout func(serviceTicket string)
+
+	// OnSessionLogout, if set, is called with the session ID registered for the service ticket
+	// of each single logout request, see Client.RegisterSession, to destroy the session in the
+	// session store of the application, which is keyed by its own session ID.
+	OnSessionLogout func(sessionID string)
+
+	// LogoutRequestMaxAge, if set, rejects single logout requests issued longer ago than it,
+	// or that far in the future, and those whose ID was already processed within it, so a
+	// captured logoutRequest can not be replayed. Allow for the clock skew with the CAS server.
+	LogoutRequestMaxAge time.Duration
+
+	// VerifyLogoutSource rejects single logout requests which do not come from an address of
+	// the host of URL. Only enable it when the requests are not relayed by a proxy.
+	VerifyLogoutSource bool
+
+	// RequestIDHeader names a header, such as X-Request-ID, whose value is logged as request_id
+	// with each line about the request. An ID set with WithRequestID takes precedence.
+	RequestIDHeader string
 }
 
 // Client implements the main protocol
@@ -27,13 +91,60 @@ type Client struct {
 
 	sessions    SessionStore
 	sendService bool
+	gateway     bool
+	logger      *slog.Logger
+
+	gatewayCookieTemplate *http.Cookie
+	onLogout              func(serviceTicket string)
+	onSessionLogout       func(sessionID string)
+
+	ticketSessionsMu sync.Mutex
+	ticketSessions   map[string]string // service ticket to session ID, for single logout
+
+	casURL              *url.URL
+	logoutRequestMaxAge time.Duration
+	logoutRequestIDs    *ReplayGuard // IDs of the processed logout requests, nil unless logoutRequestMaxAge is set
+	verifyLogoutSource  bool
+
+	normaliseTrailingSlash bool
+
+	requestIDHeader       string
+	strictTicketParameter bool
+	ticketParameterName   string
+
+	stValidator     *ServiceTicketValidator
+	validator       TicketValidator
+	principalMapper func(*AuthenticationResponse) error // PrincipalMapper of a custom Validator, nil for the default one
+}
 
-	stValidator *ServiceTicketValidator
+// NewCheckedClient creates a Client with the provided Options like NewClient, returning
+// ErrMissingCasURL without a URL, and ErrInsecureCasURL if the URL does not use https unless
+// AllowInsecureCasURL is set, as tickets would be validated in cleartext.
+func NewCheckedClient(options *Options) (*Client, error) {
+	if err := checkCasURL(options.URL, options.AllowInsecureCasURL); err != nil {
+		return nil, err
+	}
+
+	return NewClient(options), nil
 }
 
 // NewClient creates a Client with the provided Options.
+//
+// Without a URL, or with one which does not use https unless AllowInsecureCasURL is set, a
+// warning is logged and ticket validation fails. Use NewCheckedClient to fail setup instead.
 func NewClient(options *Options) *Client {
-	slog.Info("cas: new client with options", slog.Any("options", options))
+	var logger *slog.Logger
+	if options.Logger != nil {
+		logger = options.Logger
+	} else {
+		logger = slog.Default()
+	}
+
+	logger.Info("cas: new client", slog.Any("url", options.URL))
+
+	if err := checkCasURL(options.URL, options.AllowInsecureCasURL); err != nil {
+		logger.Warn("cas: CAS URL is missing or does not use https, ticket validation will fail", slog.Any("url", options.URL))
+	}
 
 	var tickets TicketStore
 	if options.Store != nil {
@@ -60,7 +171,7 @@ func NewClient(options *Options) *Client {
 	if options.Client != nil {
 		client = options.Client
 	} else {
-		client = &http.Client{}
+		client = NewHTTPClient(nil)
 	}
 
 	var cookie *http.Cookie
@@ -75,6 +186,56 @@ func NewClient(options *Options) *Client {
 		}
 	}
 
+	var gatewayCookie *http.Cookie
+	if options.GatewayCookie != nil {
+		copied := *options.GatewayCookie
+		gatewayCookie = &copied
+	} else {
+		gatewayCookie = &http.Cookie{
+			Domain:   cookie.Domain,
+			Secure:   true,
+			SameSite: http.SameSiteLaxMode,
+		}
+	}
+
+	if gatewayCookie.Name == "" {
+		gatewayCookie.Name = gatewayCookieName
+	}
+
+	if gatewayCookie.Path == "" {
+		gatewayCookie.Path = "/"
+	}
+
+	if gatewayCookie.MaxAge == 0 {
+		gatewayCookie.MaxAge = gatewayCookieMaxAge
+	}
+
+	stValidator := NewServiceTicketValidator(client, options.URL)
+	stValidator.Logger = logger
+	stValidator.AllowInsecureCasURL = options.AllowInsecureCasURL
+	stValidator.PrincipalMapper = options.PrincipalMapper
+	stValidator.Counters = options.Counters
+	stValidator.NormaliseTrailingSlash = options.NormaliseTrailingSlash
+
+	ticketParameterName := "ticket"
+	if options.TicketParameter != "" {
+		ticketParameterName = options.TicketParameter
+	}
+
+	var logoutRequestIDs *ReplayGuard
+	if options.LogoutRequestMaxAge > 0 {
+		logoutRequestIDs = NewReplayGuard(options.LogoutRequestMaxAge)
+	}
+
+	var validator TicketValidator
+	var principalMapper func(*AuthenticationResponse) error
+	if options.Validator != nil {
+		validator = options.Validator
+		principalMapper = options.PrincipalMapper
+	} else {
+		validator = stValidator
+	}
+
 	return &Client{
 		tickets:     tickets,
 		client:      client,
@@ -82,7 +243,25 @@ func NewClient(options *Options) *Client {
 		cookie:      cookie,
 		sessions:    sessions,
 		sendService: options.SendService,
-		stValidator: NewServiceTicketValidator(client, options.URL),
+		gateway:     options.Gateway,
+		logger:      logger,
+
+		gatewayCookieTemplate: gatewayCookie,
+		onLogout:              options.OnLogout,
+		onSessionLogout:       options.OnSessionLogout,
+
+		casURL:              options.URL,
+		logoutRequestMaxAge: options.LogoutRequestMaxAge,
+		logoutRequestIDs:    logoutRequestIDs,
+		verifyLogoutSource:  options.VerifyLogoutSource,
+
+		normaliseTrailingSlash: options.NormaliseTrailingSlash,
+		requestIDHeader:        options.RequestIDHeader,
+		strictTicketParameter:  options.StrictTicketParameter,
+		ticketParameterName:    ticketParameterName,
+		stValidator:            stValidator,
+		validator:              validator,
+		principalMapper:        principalMapper,
 	}
 }
 
@@ -101,28 +280,13 @@ func (c *Client) HandleFunc(h func(http.ResponseWriter, *http.Request)) http.Han
 
 // requestURL determines an absolute URL from the http.Request.
 func requestURL(r *http.Request) (*url.URL, error) {
-	u, err := url.Parse(r.URL.String())
-	if err != nil {
-		return nil, err
-	}
-
-	u.Host = r.Host
-	if host := r.Header.Get("X-Forwarded-Host"); host != "" {
-		u.Host = host
-	}
-
-	u.Scheme = "http"
-	if scheme := r.Header.Get("X-Forwarded-Proto"); scheme != "" {
-		u.Scheme = scheme
-	} else if r.TLS != nil {
-		u.Scheme = "https"
-	}
-
-	return u, nil
+	return absoluteURL(r, true), nil
 }
 
 // LoginUrlForRequest determines the CAS login URL for the http.Request.
-func (c *Client) LoginUrlForRequest(r *http.Request) (string, error) {
+//
+// The LoginOptions are applied in order after the service parameter is set.
+func (c *Client) LoginUrlForRequest(r *http.Request, opts ...LoginOption) (string, error) {
 	u, err := c.urlScheme.Login()
 	if err != nil {
 		return "", err
@@ -134,7 +298,10 @@ func (c *Client) LoginUrlForRequest(r *http.Request) (string, error) {
 	}
 
 	q := u.Query()
-	q.Add("service", sanitisedURLString(service))
+	q.Add("service", serviceURLString(service, c.normaliseTrailingSlash))
+	for _, opt := range opts {
+		opt(q)
+	}
 	u.RawQuery = q.Encode()
 
 	return u.String(), nil
@@ -154,7 +321,7 @@ func (c *Client) LogoutUrlForRequest(r *http.Request) (string, error) {
 		}
 
 		q := u.Query()
-		q.Add("service", sanitisedURLString(service))
+		q.Add("service", serviceURLString(service, c.normaliseTrailingSlash))
 		u.RawQuery = q.Encode()
 	}
 
@@ -187,7 +354,7 @@ func (c *Client) RedirectToLogout(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	slog.Info("cas: logging out, redirecting client to", slog.Any("url", u), slog.Any("status", http.StatusFound))
+	requestLogger(c.logger, r.Context()).Info("cas: logging out, redirecting client to", slog.Any("url", u), slog.Any("status", http.StatusFound))
 
 	c.clearSession(w, r)
 	http.Redirect(w, r, u, http.StatusFound)
@@ -201,7 +368,7 @@ func (c *Client) RedirectToLogin(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	slog.Info("cas: redirecting client to", slog.Any("url", u), slog.Any("status", http.StatusFound))
+	requestLogger(c.logger, r.Context()).Info("cas: redirecting client to", slog.Any("url", u), slog.Any("status", http.StatusFound))
 
 	http.Redirect(w, r, u, http.StatusFound)
 }
@@ -213,11 +380,24 @@ func (c *Client) validateTicket(ticket string, service *http.Request) error {
 		return err
 	}
 
-	success, err := c.stValidator.ValidateTicket(serviceURL, ticket)
+	// The service URL the ticket was issued for does not include a custom ticket parameter
+	if c.ticketParameterName != "ticket" {
+		q := serviceURL.Query()
+		q.Del(c.ticketParameterName)
+		serviceURL.RawQuery = q.Encode()
+	}
+
+	success, err := c.validator.ValidateTicketContext(service.Context(), serviceURL, ticket)
 	if err != nil {
 		return err
 	}
 
+	if c.principalMapper != nil && success != nil {
+		if err := c.principalMapper(success); err != nil {
+			return err
+		}
+	}
+
 	if err = c.tickets.Write(ticket, success); err != nil {
 		return err
 	}
@@ -230,46 +410,72 @@ func (c *Client) validateTicket(ticket string, service *http.Request) error {
 // A cookie is set on the response if one is not provided with the request.
 // Validates the ticket if the URL parameter is provided.
 func (c *Client) getSession(w http.ResponseWriter, r *http.Request) {
+	logger := requestLogger(c.logger, r.Context())
 	cookie := c.getCookie(w, r)
 
 	if s, ok := c.sessions.Get(cookie.Value); ok {
 		if t, err := c.tickets.Read(s); err == nil {
-			slog.Info("cas: re-used ticket", slog.Any("ticket", s), slog.Any("user", t.User))
+			logCacheEvent(r.Context(), c.logger, cacheHit, c.tickets, s)
+			logger.Info("cas: re-used ticket", slog.String("ticket", redactedTicket(s)), slog.Any("user", t.User))
 
-			setAuthenticationResponse(r, t)
+			setAuthenticationResponse(r, cachedResponse(t))
 			return
 		} else {
-			slog.Info("cas: ticket not in store", slog.Any("ticket", s), slog.Any("error", err))
+			logCacheEvent(r.Context(), c.logger, cacheMiss, c.tickets, s)
+			logger.Info("cas: ticket not in store", slog.String("ticket", redactedTicket(s)), slog.Any("error", err))
 
-			slog.Info("cas: clearing ticket", slog.Any("ticket", s))
+			logger.Info("cas: clearing ticket", slog.String("ticket", redactedTicket(s)))
 
 			clearCookie(w, cookie)
 		}
 	}
 
-	if ticket := r.URL.Query().Get("ticket"); ticket != "" {
+	if ticket, _ := c.ticketParameter(r); ticket != "" {
 		if err := c.validateTicket(ticket, r); err != nil {
-			slog.Info("cas: error validating ticket", slog.Any("error", err))
+			logger.Info("cas: error validating ticket", slog.Any("error", err))
 			return // allow ServeHTTP()
 		}
 
+		logger.Info("cas: recording session", slog.String("id", redactedTicket(cookie.Value)), slog.String("ticket", redactedTicket(ticket)))
 		c.setSession(cookie.Value, ticket)
 
 		if t, err := c.tickets.Read(ticket); err == nil {
-			slog.Info("cas: validated ticket", slog.Any("ticket", ticket), slog.Any("user", t.User))
+			logger.Info("cas: validated ticket", slog.String("ticket", redactedTicket(ticket)), slog.Any("user", t.User))
 
 			setAuthenticationResponse(r, t)
 			return
 		} else {
-			slog.Info("cas: ticket not in store", slog.Any("ticket", ticket), slog.Any("error", err))
+			logger.Info("cas: ticket not in store", slog.String("ticket", redactedTicket(ticket)), slog.Any("error", err))
 
-			slog.Info("cas: clearing ticket", slog.Any("ticket", ticket))
+			logger.Info("cas: clearing ticket", slog.String("ticket", redactedTicket(ticket)))
 
 			clearCookie(w, cookie)
 		}
 	}
 }
 
+// cachedResponse returns a copy of the stored response t marked FromCache.
+func cachedResponse(t *AuthenticationResponse) *AuthenticationResponse {
+	cached := *t
+	cached.FromCache = true
+	return &cached
+}
+
+// ticketParameter returns the ticket parameter of the request, named by Options.TicketParameter. More than one ticket parameter,
+// from a misbehaving proxy or a parameter pollution attempt, is an error in strict mode.
+func (c *Client) ticketParameter(r *http.Request) (string, error) {
+	tickets := r.URL.Query()[c.ticketParameterName]
+	if len(tickets) == 0 {
+		return "", nil
+	}
+
+	if len(tickets) > 1 && c.strictTicketParameter {
+		return "", ErrDuplicateTicketParameter
+	}
+
+	return tickets[0], nil
+}
+
 // getCookie finds or creates the session cookie on the response.
 func (c *Client) getCookie(w http.ResponseWriter, r *http.Request) *http.Cookie {
 	cookie, err := r.Cookie(sessionCookieName)
@@ -287,7 +493,7 @@ func (c *Client) getCookie(w http.ResponseWriter, r *http.Request) *http.Cookie
 			SameSite: c.cookie.SameSite,
 		}
 
-		slog.Info("cas: setting cookie", slog.Any("name", cookie.Name), slog.Any("value", cookie.Value))
+		requestLogger(c.logger, r.Context()).Info("cas: setting cookie", slog.Any("name", cookie.Name), slog.String("value", redactedTicket(cookie.Value)))
 
 		r.AddCookie(cookie) // so we can find it later if required
 		http.SetCookie(w, cookie)
@@ -319,9 +525,34 @@ func clearCookie(w http.ResponseWriter, c *http.Cookie) {
 
 // setSession stores the session id to ticket mapping in the Client.
 func (c *Client) setSession(id string, ticket string) {
-	slog.Info("cas: recording session", slog.Any("id", id), slog.Any("ticket", ticket))
-
 	c.sessions.Set(id, ticket)
+	c.RegisterSession(ticket, id)
+}
+
+// RegisterSession records that the session of the application with the ID was established
+// with the service ticket, so a single logout request for the ticket destroys the session with
+// OnSessionLogout. The sessions of the Client cookie are registered automatically, call it for
+// sessions the application creates itself, such as after IsAuthenticated.
+func (c *Client) RegisterSession(serviceTicket, sessionID string) {
+	c.ticketSessionsMu.Lock()
+	defer c.ticketSessionsMu.Unlock()
+
+	if c.ticketSessions == nil {
+		c.ticketSessions = make(map[string]string)
+	}
+
+	c.ticketSessions[serviceTicket] = sessionID
+}
+
+// takeSession returns and forgets the session ID registered for the service ticket.
+func (c *Client) takeSession(serviceTicket string) (string, bool) {
+	c.ticketSessionsMu.Lock()
+	defer c.ticketSessionsMu.Unlock()
+
+	sessionID, ok := c.ticketSessions[serviceTicket]
+	delete(c.ticketSessions, serviceTicket)
+
+	return sessionID, ok
 }
 
 // clearSession removes the session from the client and clears the cookie.
@@ -330,9 +561,12 @@ func (c *Client) clearSession(w http.ResponseWriter, r *http.Request) {
 
 	if serviceTicket, ok := c.sessions.Get(cookie.Value); ok {
 		if err := c.tickets.Delete(serviceTicket); err != nil {
-			slog.Info("cas: failed to remove ticket", slog.Any("ticket", cookie.Value), slog.Any("error", err))
+			requestLogger(c.logger, r.Context()).Info("cas: failed to remove ticket", slog.String("ticket", redactedTicket(cookie.Value)), slog.Any("error", err))
+		} else {
+			logCacheEvent(r.Context(), c.logger, cacheEvict, c.tickets, serviceTicket)
 		}
 
+		c.takeSession(serviceTicket)
 		c.deleteSession(cookie.Value)
 	}
 
@@ -1,12 +1,16 @@
 package cas
 
 import (
+	"context"
+	"encoding/xml"
 	"fmt"
 	"net/http"
+	"net/http/cookiejar"
 	"net/http/httptest"
 	"net/url"
 	"strings"
 	"testing"
+	"time"
 )
 
 func TestUnauthenticatedRequestShouldRedirectToCasURL(t *testing.T) {
@@ -69,7 +73,8 @@ func TestInvalidServiceTicket(t *testing.T) {
 
 	url, _ := url.Parse(ts.URL)
 	client := NewClient(&Options{
-		URL: url,
+		URL:                 url,
+		AllowInsecureCasURL: true,
 	})
 
 	handler := client.HandleFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -120,7 +125,8 @@ func TestValidServiceTicket(t *testing.T) {
 
 	url, _ := url.Parse(ts.URL)
 	client := NewClient(&Options{
-		URL: url,
+		URL:                 url,
+		AllowInsecureCasURL: true,
 	})
 
 	message := "You are logged in, welcome client"
@@ -169,7 +175,8 @@ func TestGetUsernameFromServiceTicket(t *testing.T) {
 
 	url, _ := url.Parse(ts.URL)
 	client := NewClient(&Options{
-		URL: url,
+		URL:                 url,
+		AllowInsecureCasURL: true,
 	})
 
 	message := "You are logged in, welcome"
@@ -222,7 +229,8 @@ func TestGetAttributesFromServiceTicket(t *testing.T) {
 
 	url, _ := url.Parse(ts.URL)
 	client := NewClient(&Options{
-		URL: url,
+		URL:                 url,
+		AllowInsecureCasURL: true,
 	})
 
 	message := "You are logged in, welcome %s%s, your account is %s"
@@ -284,7 +292,8 @@ func TestSecondRequestShouldBeCookied(t *testing.T) {
 
 	url, _ := url.Parse(ts.URL)
 	client := NewClient(&Options{
-		URL: url,
+		URL:                 url,
+		AllowInsecureCasURL: true,
 	})
 
 	message := "You are logged in, welcome %s%s, your account is %s"
@@ -357,7 +366,8 @@ func TestLogOut(t *testing.T) {
 
 	u, _ := url.Parse(ts.URL)
 	client := NewClient(&Options{
-		URL: u,
+		URL:                 u,
+		AllowInsecureCasURL: true,
 	})
 
 	handler := client.HandleFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -455,9 +465,19 @@ func TestSingleLogOut(t *testing.T) {
 	ts := httptest.NewServer(server)
 	defer ts.Close()
 
+	var client *Client
+	var loggedOut []string
 	u, _ := url.Parse(ts.URL)
-	client := NewClient(&Options{
-		URL: u,
+	client = NewClient(&Options{
+		URL:                 u,
+		AllowInsecureCasURL: true,
+		OnLogout: func(serviceTicket string) {
+			if _, err := client.tickets.Read(serviceTicket); err != ErrInvalidTicket {
+				t.Errorf("Expected the ticket to be removed before OnLogout, got %v", err)
+			}
+
+			loggedOut = append(loggedOut, serviceTicket)
+		},
 	})
 
 	handler := client.HandleFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -512,4 +532,584 @@ func TestSingleLogOut(t *testing.T) {
 	if _, err := client.tickets.Read(ticket.Name); err != ErrInvalidTicket {
 		t.Errorf("Expected tickets.Read error to be ErrInvalidTicket, got %v", err)
 	}
+
+	if len(loggedOut) != 1 || loggedOut[0] != ticket.Name {
+		t.Errorf("Expected OnLogout to be called with <%s>, got <%v>", ticket.Name, loggedOut)
+	}
+}
+
+func TestSingleLogOutRegisteredSession(t *testing.T) {
+	server := &TestServer{}
+	ticket := server.NewTicket("ST-2c5b0c3e8b11")
+	ticket.Service = "http://example.com/"
+	ticket.Username = "enoch.root"
+	server.AddTicket(ticket)
+	defer server.Close()
+
+	ts := httptest.NewServer(server)
+	defer ts.Close()
+
+	var destroyed []string
+	u, _ := url.Parse(ts.URL)
+	client := NewClient(&Options{
+		URL:                 u,
+		AllowInsecureCasURL: true,
+		OnSessionLogout: func(sessionID string) {
+			destroyed = append(destroyed, sessionID)
+		},
+	})
+
+	handler := client.HandleFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, "OK")
+	})
+
+	client.RegisterSession("ST-unknown", "app-session-1")
+	client.RegisterSession(ticket.Name, "app-session-2")
+
+	logoutRequest, err := xmlLogoutRequest(ticket.Name)
+	if err != nil {
+		t.Fatalf("xmlLogoutRequest returned an error: %v", err)
+	}
+
+	postData := make(url.Values)
+	postData.Set("logoutRequest", string(logoutRequest))
+
+	req := httptest.NewRequest("POST", "http://example.com/", strings.NewReader(postData.Encode()))
+	req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected HTTP response code to be <%v>, got <%v>", http.StatusOK, w.Code)
+	}
+
+	if len(destroyed) != 1 || destroyed[0] != "app-session-2" {
+		t.Errorf("Expected OnSessionLogout to be called with <app-session-2>, got <%v>", destroyed)
+	}
+
+	if _, ok := client.takeSession(ticket.Name); ok {
+		t.Errorf("Expected the session of the ticket to be forgotten")
+	}
+}
+
+func TestLoginUrlWithWarn(t *testing.T) {
+	u, _ := url.Parse("https://cas.example.com/")
+	client := NewClient(&Options{
+		URL:                 u,
+		AllowInsecureCasURL: true,
+	})
+
+	req, err := http.NewRequest("GET", "http://example.com/", nil)
+	if err != nil {
+		t.Error(err)
+	}
+
+	loc, err := client.LoginUrlForRequest(req)
+	if err != nil {
+		t.Fatalf("LoginUrlForRequest returned an error: %v", err)
+	}
+
+	exp := "https://cas.example.com/login?service=http%3A%2F%2Fexample.com%2F"
+	if loc != exp {
+		t.Errorf("Expected login url to be <%s>, got <%s>", exp, loc)
+	}
+
+	loc, err = client.LoginUrlForRequest(req, WithWarn())
+	if err != nil {
+		t.Fatalf("LoginUrlForRequest returned an error: %v", err)
+	}
+
+	exp = "https://cas.example.com/login?service=http%3A%2F%2Fexample.com%2F&warn=true"
+	if loc != exp {
+		t.Errorf("Expected login url to be <%s>, got <%s>", exp, loc)
+	}
+
+	loc, err = client.LoginUrlForRequest(req, WithRenew())
+	if err != nil {
+		t.Fatalf("LoginUrlForRequest returned an error: %v", err)
+	}
+
+	exp = "https://cas.example.com/login?renew=true&service=http%3A%2F%2Fexample.com%2F"
+	if loc != exp {
+		t.Errorf("Expected login url to be <%s>, got <%s>", exp, loc)
+	}
+}
+
+type fakeValidator struct {
+	users map[string]string
+}
+
+func (v *fakeValidator) ValidateTicket(serviceURL *url.URL, ticket string) (*AuthenticationResponse, error) {
+	return v.ValidateTicketContext(context.Background(), serviceURL, ticket)
+}
+
+func (v *fakeValidator) ValidateTicketContext(ctx context.Context, serviceURL *url.URL, ticket string) (*AuthenticationResponse, error) {
+	if user, ok := v.users[ticket]; ok {
+		return &AuthenticationResponse{User: user}, nil
+	}
+
+	return nil, &AuthenticationError{Code: INVALID_TICKET, Message: "ticket not recognized"}
+}
+
+func TestClientWithCustomValidator(t *testing.T) {
+	u, _ := url.Parse("https://cas.example.com/")
+	client := NewClient(&Options{
+		URL:       u,
+		Validator: &fakeValidator{users: map[string]string{"ST-fake": "enoch.root"}},
+	})
+
+	handler := client.HandleFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !IsAuthenticated(r) {
+			RedirectToLogin(w, r)
+			return
+		}
+
+		fmt.Fprintln(w, Username(r))
+	})
+
+	req, err := http.NewRequest("GET", "http://example.com/?ticket=ST-fake", nil)
+	if err != nil {
+		t.Error(err)
+	}
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected HTTP response code to be <%v>, got <%v>", http.StatusOK, w.Code)
+	}
+
+	if body := strings.TrimSpace(w.Body.String()); body != "enoch.root" {
+		t.Errorf("Expected body to be <enoch.root>, got <%s>", body)
+	}
+
+	req, err = http.NewRequest("GET", "http://example.com/?ticket=ST-unknown", nil)
+	if err != nil {
+		t.Error(err)
+	}
+
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+
+	if w.Code != http.StatusFound {
+		t.Errorf("Expected HTTP response code to be <%v>, got <%v>", http.StatusFound, w.Code)
+	}
+}
+
+func TestClientWithCustomValidatorPrincipalMapper(t *testing.T) {
+	u, _ := url.Parse("https://cas.example.com/")
+	client := NewClient(&Options{
+		URL:       u,
+		Logger:    NoopLogger(),
+		Validator: &fakeValidator{users: map[string]string{"ST-fake": "Enoch.Root"}},
+		PrincipalMapper: func(r *AuthenticationResponse) error {
+			r.User = strings.ToLower(r.User)
+			return nil
+		},
+	})
+
+	handler := client.HandleFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, Username(r))
+	})
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("GET", "http://example.com/?ticket=ST-fake", nil))
+
+	if body := strings.TrimSpace(w.Body.String()); body != "enoch.root" {
+		t.Errorf("Expected the PrincipalMapper to apply to the custom Validator, got <%s>", body)
+	}
+
+	restClient := NewRestClient(&RestOptions{
+		CasURL:          u,
+		Logger:          NoopLogger(),
+		Validator:       &fakeValidator{users: map[string]string{"ST-fake": "Enoch.Root"}},
+		PrincipalMapper: func(r *AuthenticationResponse) error { return ErrMissingRequiredAttribute },
+	})
+
+	if _, err := restClient.ValidateServiceTicket("ST-fake"); err != ErrMissingRequiredAttribute {
+		t.Errorf("Expected the error of the PrincipalMapper, got <%v>", err)
+	}
+}
+
+func TestGatewayRedirectsOnce(t *testing.T) {
+	u, _ := url.Parse("https://cas.example.com/")
+	client := NewClient(&Options{
+		URL:     u,
+		Gateway: true,
+	})
+
+	handler := client.HandleFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !IsAuthenticated(r) {
+			fmt.Fprintln(w, "anonymous")
+			return
+		}
+
+		fmt.Fprintln(w, Username(r))
+	})
+
+	req, err := http.NewRequest("GET", "http://example.com/", nil)
+	if err != nil {
+		t.Error(err)
+	}
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+
+	if w.Code != http.StatusFound {
+		t.Fatalf("Expected HTTP response code to be <%v>, got <%v>", http.StatusFound, w.Code)
+	}
+
+	loc := w.Header().Get("Location")
+	exp := "https://cas.example.com/login?gateway=true&service=http%3A%2F%2Fexample.com%2F"
+	if loc != exp {
+		t.Errorf("Expected HTTP redirect to <%s>, got <%s>", exp, loc)
+	}
+
+	// CAS redirects back without a ticket as the user has no SSO session
+	req, err = http.NewRequest("GET", "http://example.com/", nil)
+	if err != nil {
+		t.Error(err)
+	}
+
+	cookies := (&http.Response{Header: w.Header()}).Cookies()
+	for _, cookie := range cookies {
+		req.AddCookie(cookie)
+	}
+
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected HTTP response code to be <%v>, got <%v>", http.StatusOK, w.Code)
+	}
+
+	if body := strings.TrimSpace(w.Body.String()); body != "anonymous" {
+		t.Errorf("Expected body to be <anonymous>, got <%s>", body)
+	}
+
+	for _, cookie := range (&http.Response{Header: w.Header()}).Cookies() {
+		if cookie.Name == gatewayCookieName && cookie.MaxAge < 0 {
+			t.Errorf("Expected the gateway cookie to be kept for the anonymous user")
+		}
+	}
+
+	// The next views of the anonymous user are not redirected to CAS again, with the cookies
+	// kept as a browser would
+	jar, _ := cookiejar.New(nil)
+	jar.SetCookies(req.URL, cookies)
+	jar.SetCookies(req.URL, (&http.Response{Header: w.Header()}).Cookies())
+
+	for i := 0; i < 2; i++ {
+		req, err = http.NewRequest("GET", "http://example.com/other", nil)
+		if err != nil {
+			t.Error(err)
+		}
+
+		for _, cookie := range jar.Cookies(req.URL) {
+			req.AddCookie(cookie)
+		}
+
+		w = httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		jar.SetCookies(req.URL, (&http.Response{Header: w.Header()}).Cookies())
+
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected HTTP response code of anonymous request %d to be <%v>, got <%v>", i, http.StatusOK, w.Code)
+		}
+	}
+}
+
+func TestDuplicateTicketParameter(t *testing.T) {
+	u, _ := url.Parse("https://cas.example.com/")
+	validator := &fakeValidator{users: map[string]string{"ST-fake": "enoch.root"}}
+
+	for _, strict := range []bool{false, true} {
+		client := NewClient(&Options{
+			URL:                   u,
+			Validator:             validator,
+			StrictTicketParameter: strict,
+		})
+
+		handler := client.HandleFunc(func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprintln(w, Username(r))
+		})
+
+		req, err := http.NewRequest("GET", "http://example.com/?ticket=ST-fake&ticket=ST-other", nil)
+		if err != nil {
+			t.Error(err)
+		}
+
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+
+		expected := http.StatusOK
+		if strict {
+			expected = http.StatusBadRequest
+		}
+
+		if w.Code != expected {
+			t.Errorf("Expected HTTP response code with strict <%v> to be <%v>, got <%v>", strict, expected, w.Code)
+		}
+
+		if !strict && strings.TrimSpace(w.Body.String()) != "enoch.root" {
+			t.Errorf("Expected the first ticket to be validated, got <%s>", w.Body.String())
+		}
+	}
+}
+
+type serviceRecordingValidator struct {
+	fakeValidator
+	service string
+}
+
+func (v *serviceRecordingValidator) ValidateTicketContext(ctx context.Context, serviceURL *url.URL, ticket string) (*AuthenticationResponse, error) {
+	v.service = serviceURL.String()
+	return v.fakeValidator.ValidateTicketContext(ctx, serviceURL, ticket)
+}
+
+func TestCustomTicketParameter(t *testing.T) {
+	u, _ := url.Parse("https://cas.example.com/")
+	validator := &serviceRecordingValidator{fakeValidator: fakeValidator{users: map[string]string{"ST-fake": "enoch.root"}}}
+	client := NewClient(&Options{
+		URL:             u,
+		Validator:       validator,
+		TicketParameter: "SAMLart",
+	})
+
+	handler := client.HandleFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, Username(r))
+	})
+
+	req, err := http.NewRequest("GET", "http://example.com/?page=1&SAMLart=ST-fake", nil)
+	if err != nil {
+		t.Error(err)
+	}
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+
+	if body := strings.TrimSpace(w.Body.String()); body != "enoch.root" {
+		t.Errorf("Expected body to be <enoch.root>, got <%s>", body)
+	}
+
+	if validator.service != "http://example.com/?page=1" {
+		t.Errorf("Expected service to be <http://example.com/?page=1>, got <%s>", validator.service)
+	}
+
+	req, err = http.NewRequest("GET", "http://example.com/?ticket=ST-fake", nil)
+	if err != nil {
+		t.Error(err)
+	}
+
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+
+	if body := strings.TrimSpace(w.Body.String()); body != "" {
+		t.Errorf("Expected the ticket parameter to be ignored, got <%s>", body)
+	}
+}
+
+func TestGatewayCookieOptions(t *testing.T) {
+	u, _ := url.Parse("https://cas.example.com/")
+	client := NewClient(&Options{
+		URL:       u,
+		Gateway:   true,
+		Validator: &fakeValidator{users: map[string]string{"ST-fake": "enoch.root"}},
+		GatewayCookie: &http.Cookie{
+			Name:     "app_gateway",
+			Path:     "/app",
+			Secure:   true,
+			SameSite: http.SameSiteStrictMode,
+		},
+	})
+
+	handler := client.HandleFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, Username(r))
+	})
+
+	gatewayCookies := func(w *httptest.ResponseRecorder) []*http.Cookie {
+		var cookies []*http.Cookie
+		resp := http.Response{Header: w.Header()}
+		for _, cookie := range resp.Cookies() {
+			if cookie.Name == "app_gateway" {
+				cookies = append(cookies, cookie)
+			}
+		}
+
+		return cookies
+	}
+
+	req := httptest.NewRequest("GET", "https://example.com/app/", nil)
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+
+	cookies := gatewayCookies(w)
+	if len(cookies) != 1 {
+		t.Fatalf("Expected the gateway cookie to be set, got <%v>", w.Header())
+	}
+
+	cookie := cookies[0]
+	if cookie.Path != "/app" || !cookie.Secure || !cookie.HttpOnly || cookie.SameSite != http.SameSiteStrictMode || cookie.MaxAge != 60 {
+		t.Errorf("Expected the gateway cookie to use the configured options, got <%v>", cookie)
+	}
+
+	// CAS redirects back with a ticket as the user has an SSO session
+	req = httptest.NewRequest("GET", "https://example.com/app/?ticket=ST-fake", nil)
+	req.AddCookie(cookie)
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+
+	if body := strings.TrimSpace(w.Body.String()); body != "enoch.root" {
+		t.Errorf("Expected body to be <enoch.root>, got <%s>", body)
+	}
+
+	cookies = gatewayCookies(w)
+	if len(cookies) != 1 || cookies[0].MaxAge != -1 {
+		t.Errorf("Expected the gateway cookie to be cleared, got <%v>", cookies)
+	}
+
+	// Secure is dropped over plain http, where the browser would not return the cookie
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("GET", "http://example.com/app/", nil))
+
+	if cookies = gatewayCookies(w); len(cookies) != 1 || cookies[0].Secure {
+		t.Errorf("Expected an insecure gateway cookie over http, got <%v>", cookies)
+	}
+}
+
+func TestAuthenticationResponseFromCache(t *testing.T) {
+	u, _ := url.Parse("https://cas.example.com/")
+	client := NewClient(&Options{
+		URL:       u,
+		Validator: &fakeValidator{users: map[string]string{"ST-fake": "enoch.root"}},
+	})
+
+	handler := client.HandleFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, IsFromCache(r))
+	})
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("GET", "http://example.com/?ticket=ST-fake", nil))
+
+	if body := strings.TrimSpace(w.Body.String()); body != "false" {
+		t.Errorf("Expected a freshly validated response not to be FromCache, got <%s>", body)
+	}
+
+	req := httptest.NewRequest("GET", "http://example.com/", nil)
+	resp := http.Response{Header: w.Header()}
+	for _, cookie := range resp.Cookies() {
+		req.AddCookie(cookie)
+	}
+
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+
+	if body := strings.TrimSpace(w.Body.String()); body != "true" {
+		t.Errorf("Expected the response of the session to be FromCache, got <%s>", body)
+	}
+}
+
+func TestRedirectAfterLogin(t *testing.T) {
+	tests := []struct {
+		target   string
+		location string
+	}{
+		{"https://example.com/account?page=2&ticket=ST-123", "/account?page=2"},
+		{"https://example.com/login?service=%2Faccount%3Fpage%3D2&ticket=ST-123", "/account?page=2"},
+		{"https://example.com/login?service=https%3A%2F%2Fevil.example.net%2F&ticket=ST-123", "/home"},
+		{"https://example.com/login?service=%2F%2Fevil.example.net%2F&ticket=ST-123", "/home"},
+		{"https://example.com/account", "/home"},
+	}
+
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		RedirectAfterLogin(w, httptest.NewRequest("GET", tt.target, nil), "/home")
+
+		if w.Code != http.StatusFound {
+			t.Errorf("Expected status code to be <%d> for %s, got <%d>", http.StatusFound, tt.target, w.Code)
+		}
+
+		if location := w.Header().Get("Location"); location != tt.location {
+			t.Errorf("Expected Location to be <%s> for %s, got <%s>", tt.location, tt.target, location)
+		}
+	}
+}
+
+func TestSingleLogOutReplay(t *testing.T) {
+	u, _ := url.Parse("https://127.0.0.1/cas/")
+	client := NewClient(&Options{
+		URL:                 u,
+		Logger:              NoopLogger(),
+		LogoutRequestMaxAge: 5 * time.Minute,
+	})
+
+	handler := client.HandleFunc(func(w http.ResponseWriter, r *http.Request) {})
+
+	logout := func(id string, issued time.Time) int {
+		l := &logoutRequest{
+			Version:      "2.0",
+			IssueInstant: issued,
+			ID:           id,
+			NameID:       "@NOT_USED@",
+			SessionIndex: "ST-123",
+		}
+		l.RawIssueInstant = l.IssueInstant.Format(time.RFC1123Z)
+		body, _ := xml.Marshal(l)
+
+		postData := make(url.Values)
+		postData.Set("logoutRequest", string(body))
+		req := httptest.NewRequest("POST", "http://example.com/", strings.NewReader(postData.Encode()))
+		req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	if code := logout("LR-stale", time.Now().Add(-time.Hour)); code != http.StatusBadRequest {
+		t.Errorf("Expected a stale logout request to be answered with <%v>, got <%v>", http.StatusBadRequest, code)
+	}
+
+	if code := logout("LR-1", time.Now()); code != http.StatusOK {
+		t.Errorf("Expected a fresh logout request to be answered with <%v>, got <%v>", http.StatusOK, code)
+	}
+
+	if code := logout("LR-1", time.Now()); code != http.StatusBadRequest {
+		t.Errorf("Expected a duplicate logout request to be answered with <%v>, got <%v>", http.StatusBadRequest, code)
+	}
+
+	if code := logout("LR-2", time.Now()); code != http.StatusOK {
+		t.Errorf("Expected another logout request to be answered with <%v>, got <%v>", http.StatusOK, code)
+	}
+}
+
+func TestSingleLogOutVerifySource(t *testing.T) {
+	u, _ := url.Parse("https://127.0.0.1/cas/")
+	client := NewClient(&Options{
+		URL:                u,
+		Logger:             NoopLogger(),
+		VerifyLogoutSource: true,
+	})
+
+	handler := client.HandleFunc(func(w http.ResponseWriter, r *http.Request) {})
+	logoutRequest, _ := xmlLogoutRequest("ST-123")
+
+	for remote, expected := range map[string]int{
+		"127.0.0.1:51234": http.StatusOK,
+		"192.0.2.1:51234": http.StatusForbidden,
+	} {
+		postData := make(url.Values)
+		postData.Set("logoutRequest", string(logoutRequest))
+		req := httptest.NewRequest("POST", "http://example.com/", strings.NewReader(postData.Encode()))
+		req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+		req.RemoteAddr = remote
+
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+
+		if w.Code != expected {
+			t.Errorf("Expected a logout request from %s to be answered with <%v>, got <%v>", remote, expected, w.Code)
+		}
+	}
 }
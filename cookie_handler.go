@@ -0,0 +1,254 @@
+package cas
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultSessionCookieName names the cookie of a CookieHandler without a CookieName
+const DefaultSessionCookieName = "_cas_auth"
+
+// DefaultSessionTTL is how long the session of a CookieHandler without a TTL lasts
+const DefaultSessionTTL = 8 * time.Hour
+
+// Session cookie errors
+var (
+	// The session cookie was not signed by any of the Keys, or is malformed
+	ErrInvalidSessionCookie = errors.New("cas: invalid session cookie")
+
+	// The session cookie is older than the TTL
+	ErrSessionExpired = errors.New("cas: session expired")
+
+	// The CookieHandler has no Keys to sign the session cookie with
+	ErrNoSessionKeys = errors.New("cas: no session cookie keys")
+)
+
+// CookieHandler authenticates browser requests with a signed session cookie, validating the
+// service ticket of the first request only. Once the ticket is validated, the response is
+// stored in Store under a new session ID and the cookie, carrying the ID and its expiry signed
+// with HMAC-SHA256, is set. Later requests with the cookie load the response from Store.
+//
+// Requests are always passed to Handler, use IsAuthenticated and the other helpers to read the
+// authenticated user, as with Client.Handle. Requests with a ticket which does not validate are
+// passed on unauthenticated.
+//
+// Validator and Keys are required, the other fields have defaults.
+type CookieHandler struct {
+	Validator *ServiceTicketValidator // Validates the ticket of requests without a session
+	Handler   http.Handler            // Handler the requests are passed to
+
+	// Keys sign the cookie with the first key and verify it with any of them, so a key can be
+	// rotated by prepending its replacement and removing it once its sessions have expired.
+	Keys [][]byte
+
+	Store          TicketStore   // Where the sessions are kept, a MemoryStore if nil
+	CookieName     string        // Name of the cookie, DefaultSessionCookieName if empty
+	TTL            time.Duration // Lifetime of a session, DefaultSessionTTL if zero
+	TrustForwarded bool          // Whether the service URL is read from X-Forwarded headers, see ServiceURLFromRequest
+
+	// Cookie configures the session cookie, uses Path, Domain, Secure & SameSite. If nil the
+	// cookie has Path / and SameSite Lax. The cookie is always HttpOnly.
+	Cookie *http.Cookie
+
+	Logger *slog.Logger // Logger of the handler, the logger of the Validator if nil
+
+	storeOnce sync.Once
+}
+
+// ServeHTTP authenticates the request from its session cookie or its ticket and passes it to
+// the Handler.
+func (ch *CookieHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	logger := requestLogger(ch.logger(), r.Context())
+
+	if cookie, err := r.Cookie(ch.cookieName()); err == nil {
+		success, err := ch.session(cookie.Value)
+		if err == nil {
+			setAuthenticationResponse(r, cachedResponse(success))
+			ch.Handler.ServeHTTP(w, r)
+			return
+		}
+
+		logger.Info("cas: clearing session cookie", slog.Any("error", err))
+		http.SetCookie(w, ch.cookie("", -1))
+	}
+
+	if ticket := r.URL.Query().Get("ticket"); ticket != "" {
+		success, err := ch.Validator.ValidateTicketContext(r.Context(), ServiceURLFromRequest(r, ch.TrustForwarded), ticket)
+		if err != nil {
+			logger.Info("cas: error validating ticket", slog.Any("error", err))
+		} else if err := ch.startSession(w, success); err != nil {
+			logger.Warn("cas: error storing session", slog.Any("error", err))
+		} else {
+			setAuthenticationResponse(r, success)
+		}
+	}
+
+	ch.Handler.ServeHTTP(w, r)
+}
+
+// EndSession removes the session of the request from Store and clears its cookie, for the
+// logout route of the application.
+func (ch *CookieHandler) EndSession(w http.ResponseWriter, r *http.Request) {
+	cookie, err := r.Cookie(ch.cookieName())
+	if err != nil {
+		return
+	}
+
+	if id, _, err := ch.verify(cookie.Value); err == nil {
+		ch.store().Delete(id)
+	}
+
+	http.SetCookie(w, ch.cookie("", -1))
+}
+
+// startSession stores the response under a new session ID and sets the cookie of the session.
+func (ch *CookieHandler) startSession(w http.ResponseWriter, success *AuthenticationResponse) error {
+	if len(ch.Keys) == 0 {
+		return ErrNoSessionKeys
+	}
+
+	id := newSessionID()
+	if err := ch.store().Write(id, success); err != nil {
+		return err
+	}
+
+	ttl := ch.ttl()
+	http.SetCookie(w, ch.cookie(ch.sign(id, time.Now().Add(ttl)), int(ttl/time.Second)))
+	return nil
+}
+
+// session returns the stored response of the session of the cookie value, removing it once
+// expired.
+func (ch *CookieHandler) session(value string) (*AuthenticationResponse, error) {
+	id, expires, err := ch.verify(value)
+	if err != nil {
+		return nil, err
+	}
+
+	if !time.Now().Before(expires) {
+		ch.store().Delete(id)
+		return nil, ErrSessionExpired
+	}
+
+	return ch.store().Read(id)
+}
+
+// sign returns the cookie value of the session, its ID and expiry followed by their MAC with
+// the first of the Keys.
+func (ch *CookieHandler) sign(id string, expires time.Time) string {
+	payload := id + "." + strconv.FormatInt(expires.Unix(), 10)
+	return payload + "." + base64.RawURLEncoding.EncodeToString(sessionMAC(ch.Keys[0], payload))
+}
+
+// verify returns the session ID and expiry of a cookie value signed by any of the Keys.
+func (ch *CookieHandler) verify(value string) (string, time.Time, error) {
+	i := strings.LastIndexByte(value, '.')
+	if i < 0 {
+		return "", time.Time{}, ErrInvalidSessionCookie
+	}
+
+	payload := value[:i]
+	mac, err := base64.RawURLEncoding.DecodeString(value[i+1:])
+	if err != nil {
+		return "", time.Time{}, ErrInvalidSessionCookie
+	}
+
+	for _, key := range ch.Keys {
+		if !hmac.Equal(mac, sessionMAC(key, payload)) {
+			continue
+		}
+
+		id, expires := payload, ""
+		if j := strings.LastIndexByte(payload, '.'); j >= 0 {
+			id, expires = payload[:j], payload[j+1:]
+		}
+
+		unix, err := strconv.ParseInt(expires, 10, 64)
+		if err != nil || id == "" {
+			return "", time.Time{}, ErrInvalidSessionCookie
+		}
+
+		return id, time.Unix(unix, 0), nil
+	}
+
+	return "", time.Time{}, ErrInvalidSessionCookie
+}
+
+// sessionMAC returns the HMAC-SHA256 of the payload with key.
+func sessionMAC(key []byte, payload string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(payload))
+	return mac.Sum(nil)
+}
+
+// cookie returns the session cookie with the value and MaxAge.
+func (ch *CookieHandler) cookie(value string, maxAge int) *http.Cookie {
+	cookie := &http.Cookie{
+		Name:     ch.cookieName(),
+		Value:    value,
+		Path:     "/",
+		MaxAge:   maxAge,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	}
+
+	if ch.Cookie != nil {
+		cookie.Domain = ch.Cookie.Domain
+		cookie.Secure = ch.Cookie.Secure
+		if ch.Cookie.Path != "" {
+			cookie.Path = ch.Cookie.Path
+		}
+
+		if ch.Cookie.SameSite != 0 {
+			cookie.SameSite = ch.Cookie.SameSite
+		}
+	}
+
+	return cookie
+}
+
+// store returns the Store, creating a MemoryStore on first use if it is nil.
+func (ch *CookieHandler) store() TicketStore {
+	ch.storeOnce.Do(func() {
+		if ch.Store == nil {
+			ch.Store = &MemoryStore{}
+		}
+	})
+
+	return ch.Store
+}
+
+// cookieName returns the CookieName, or DefaultSessionCookieName if empty.
+func (ch *CookieHandler) cookieName() string {
+	if ch.CookieName != "" {
+		return ch.CookieName
+	}
+
+	return DefaultSessionCookieName
+}
+
+// ttl returns the TTL, or DefaultSessionTTL if zero.
+func (ch *CookieHandler) ttl() time.Duration {
+	if ch.TTL > 0 {
+		return ch.TTL
+	}
+
+	return DefaultSessionTTL
+}
+
+// logger returns the Logger, or the logger of the Validator if nil.
+func (ch *CookieHandler) logger() *slog.Logger {
+	if ch.Logger != nil {
+		return ch.Logger
+	}
+
+	return ch.Validator.logger()
+}
@@ -0,0 +1,164 @@
+package cas
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestCookieHandler(validations *int) (*CookieHandler, func()) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		*validations++
+		fmt.Fprint(w, `<cas:serviceResponse xmlns:cas="http://www.yale.edu/tp/cas">
+  <cas:authenticationSuccess>
+    <cas:user>enoch.root</cas:user>
+  </cas:authenticationSuccess>
+</cas:serviceResponse>`)
+	}))
+
+	casURL, _ := url.Parse(server.URL)
+	validator := NewServiceTicketValidator(server.Client(), casURL)
+	validator.Logger = NoopLogger()
+
+	ch := &CookieHandler{
+		Validator: validator,
+		Keys:      [][]byte{[]byte("secret")},
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprint(w, Username(r))
+		}),
+	}
+
+	return ch, server.Close
+}
+
+func TestCookieHandler(t *testing.T) {
+	var validations int
+	ch, done := newTestCookieHandler(&validations)
+	defer done()
+
+	w := httptest.NewRecorder()
+	ch.ServeHTTP(w, httptest.NewRequest("GET", "/app?ticket=ST-123", nil))
+
+	if body := w.Body.String(); body != "enoch.root" {
+		t.Fatalf("Expected the ticket to authenticate <enoch.root>, got <%s>", body)
+	}
+
+	cookies := w.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].Name != DefaultSessionCookieName || !cookies[0].HttpOnly {
+		t.Fatalf("Expected an HttpOnly %s cookie, got %v", DefaultSessionCookieName, cookies)
+	}
+
+	if cookies[0].MaxAge != int(DefaultSessionTTL/time.Second) {
+		t.Errorf("Expected MaxAge to be <%v>, got <%v>", int(DefaultSessionTTL/time.Second), cookies[0].MaxAge)
+	}
+
+	r := httptest.NewRequest("GET", "/app", nil)
+	r.AddCookie(cookies[0])
+	w = httptest.NewRecorder()
+	ch.ServeHTTP(w, r)
+
+	if body := w.Body.String(); body != "enoch.root" {
+		t.Errorf("Expected the cookie to authenticate <enoch.root>, got <%s>", body)
+	}
+
+	if validations != 1 {
+		t.Errorf("Expected the ticket to be validated once, got %d validations", validations)
+	}
+
+	// A cookie signed with a key which was rotated out is rejected
+	ch.Keys = [][]byte{[]byte("rotated")}
+	r = httptest.NewRequest("GET", "/app", nil)
+	r.AddCookie(cookies[0])
+	w = httptest.NewRecorder()
+	ch.ServeHTTP(w, r)
+
+	if body := w.Body.String(); body != "" {
+		t.Errorf("Expected the cookie to be rejected after key rotation, got <%s>", body)
+	}
+
+	if cleared := w.Result().Cookies(); len(cleared) != 1 || cleared[0].MaxAge >= 0 {
+		t.Errorf("Expected the rejected cookie to be cleared, got %v", cleared)
+	}
+}
+
+func TestCookieHandlerKeyRotation(t *testing.T) {
+	var validations int
+	ch, done := newTestCookieHandler(&validations)
+	defer done()
+
+	w := httptest.NewRecorder()
+	ch.ServeHTTP(w, httptest.NewRequest("GET", "/app?ticket=ST-123", nil))
+	cookie := w.Result().Cookies()[0]
+
+	ch.Keys = [][]byte{[]byte("new"), []byte("secret")}
+	r := httptest.NewRequest("GET", "/app", nil)
+	r.AddCookie(cookie)
+	w = httptest.NewRecorder()
+	ch.ServeHTTP(w, r)
+
+	if body := w.Body.String(); body != "enoch.root" {
+		t.Errorf("Expected the cookie to verify with the previous key, got <%s>", body)
+	}
+}
+
+func TestCookieHandlerRejectsTamperedCookie(t *testing.T) {
+	var validations int
+	ch, done := newTestCookieHandler(&validations)
+	defer done()
+
+	w := httptest.NewRecorder()
+	ch.ServeHTTP(w, httptest.NewRequest("GET", "/app?ticket=ST-123", nil))
+	cookie := w.Result().Cookies()[0]
+
+	// Extend the expiry without re-signing
+	parts := strings.Split(cookie.Value, ".")
+	parts[1] = fmt.Sprint(time.Now().Add(time.Hour * 24 * 365).Unix())
+	if _, _, err := ch.verify(strings.Join(parts, ".")); err != ErrInvalidSessionCookie {
+		t.Errorf("Expected a tampered cookie to be <%v>, got <%v>", ErrInvalidSessionCookie, err)
+	}
+}
+
+func TestCookieHandlerExpiredSession(t *testing.T) {
+	var validations int
+	ch, done := newTestCookieHandler(&validations)
+	defer done()
+
+	store := &MemoryStore{}
+	ch.Store = store
+	store.Write("session", &AuthenticationResponse{User: "enoch.root"})
+
+	if _, err := ch.session(ch.sign("session", time.Now().Add(-time.Second))); err != ErrSessionExpired {
+		t.Errorf("Expected an expired session to be <%v>, got <%v>", ErrSessionExpired, err)
+	}
+
+	if store.Len() != 0 {
+		t.Errorf("Expected the expired session to be removed from the store")
+	}
+}
+
+func TestCookieHandlerEndSession(t *testing.T) {
+	var validations int
+	ch, done := newTestCookieHandler(&validations)
+	defer done()
+
+	w := httptest.NewRecorder()
+	ch.ServeHTTP(w, httptest.NewRequest("GET", "/app?ticket=ST-123", nil))
+	cookie := w.Result().Cookies()[0]
+
+	r := httptest.NewRequest("GET", "/logout", nil)
+	r.AddCookie(cookie)
+	ch.EndSession(httptest.NewRecorder(), r)
+
+	r = httptest.NewRequest("GET", "/app", nil)
+	r.AddCookie(cookie)
+	w = httptest.NewRecorder()
+	ch.ServeHTTP(w, r)
+
+	if body := w.Body.String(); body != "" {
+		t.Errorf("Expected the ended session to be unauthenticated, got <%s>", body)
+	}
+}
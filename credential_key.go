@@ -0,0 +1,47 @@
+package cas
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"sync"
+)
+
+var (
+	processCredentialHash     func(username, password string) string
+	processCredentialHashOnce sync.Once
+)
+
+// NewHMACCredentialHash returns a CredentialHash of RestOptions computing the HMAC-SHA256 of
+// the credentials with key. The same key must be used by every process sharing a cache keyed on
+// the hash, and kept as secret as the cache contents.
+func NewHMACCredentialHash(key []byte) func(username, password string) string {
+	key = append([]byte(nil), key...)
+
+	return func(username, password string) string {
+		mac := hmac.New(sha256.New, key)
+
+		// Length prefix the username so ("ab", "c") and ("a", "bc") differ
+		var n [8]byte
+		binary.BigEndian.PutUint64(n[:], uint64(len(username)))
+		mac.Write(n[:])
+		mac.Write([]byte(username))
+		mac.Write([]byte(password))
+
+		return hex.EncodeToString(mac.Sum(nil))
+	}
+}
+
+// defaultCredentialHash hashes credentials with a random key generated once per process, so
+// the hashes are useless outside it.
+func defaultCredentialHash(username, password string) string {
+	processCredentialHashOnce.Do(func() {
+		key := make([]byte, 32)
+		rand.Read(key)
+		processCredentialHash = NewHMACCredentialHash(key)
+	})
+
+	return processCredentialHash(username, password)
+}
@@ -0,0 +1,52 @@
+package cas
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestDefaultCredentialHash(t *testing.T) {
+	key := defaultCredentialHash("arthur", "dont-panic-42")
+
+	if strings.Contains(key, "dont-panic-42") || strings.Contains(key, "arthur") {
+		t.Errorf("Expected the key not to contain the credentials, got <%s>", key)
+	}
+
+	if other := defaultCredentialHash("arthur", "dont-panic-42"); other != key {
+		t.Errorf("Expected the key to be stable within the process, got <%s> and <%s>", key, other)
+	}
+
+	if other := defaultCredentialHash("arthu", "rdont-panic-42"); other == key {
+		t.Errorf("Expected different credentials to have different keys, got <%s> twice", key)
+	}
+}
+
+func TestNewHMACCredentialHash(t *testing.T) {
+	a := NewHMACCredentialHash([]byte("key-a"))
+	b := NewHMACCredentialHash([]byte("key-b"))
+
+	if a("arthur", "dent") != NewHMACCredentialHash([]byte("key-a"))("arthur", "dent") {
+		t.Errorf("Expected the same key to give the same hash")
+	}
+
+	if a("arthur", "dent") == b("arthur", "dent") {
+		t.Errorf("Expected different keys to give different hashes")
+	}
+}
+
+func TestRestClientCredentialHash(t *testing.T) {
+	var calls int
+	casURL, _ := url.Parse("https://cas.example.com/cas/")
+	restClient := NewRestClient(&RestOptions{
+		CasURL: casURL,
+		CredentialHash: func(username, password string) string {
+			calls++
+			return "custom:" + username
+		},
+	})
+
+	if key := restClient.credentialHash("arthur", "dent"); key != "custom:arthur" || calls != 1 {
+		t.Errorf("Expected the configured CredentialHash to be used, got <%s>", key)
+	}
+}
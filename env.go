@@ -0,0 +1,115 @@
+package cas
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Environment errors
+var (
+	// An environment variable read by NewFromEnv is missing or has an invalid value
+	ErrInvalidEnvironment = errors.New("cas: invalid environment configuration")
+)
+
+// NewFromEnv creates a ServiceTicketValidator configured by environment variables, for twelve
+// factor applications. CAS_URL is required, the others are optional:
+//
+//	CAS_URL                   URL of the CAS server, such as https://cas.example.com/cas/
+//	CAS_PROTOCOL_VERSION      1, 2 or 3, see ServiceTicketValidator.ProtocolVersion
+//	CAS_RENEW                 true to require a new login, see RequireFreshLogin
+//	CAS_STRICT_PARSING        true to fail on malformed JSON attributes, see StrictParsing
+//	CAS_LENIENT_PARSING       true to recover malformed XML responses, see LenientParsing
+//	CAS_ALLOW_INSECURE_URL    true to permit an http CAS_URL, see AllowInsecureCasURL
+//	CAS_INSECURE_SKIP_VERIFY  true to skip verifying the TLS certificate, for development only
+//	CAS_TIMEOUT               request timeout such as 10s, see HTTPClientOptions.Timeout
+//
+// An error wrapping ErrInvalidEnvironment names the variable which is missing or invalid, including
+// an http CAS_URL without CAS_ALLOW_INSECURE_URL.
+func NewFromEnv() (*ServiceTicketValidator, error) {
+	return newFromEnv(os.LookupEnv)
+}
+
+// newFromEnv is NewFromEnv reading the variables with lookup.
+func newFromEnv(lookup func(key string) (string, bool)) (*ServiceTicketValidator, error) {
+	raw, ok := lookup("CAS_URL")
+	if !ok || strings.TrimSpace(raw) == "" {
+		return nil, fmt.Errorf("%w: CAS_URL is required", ErrInvalidEnvironment)
+	}
+
+	casURL, err := url.Parse(strings.TrimSpace(raw))
+	if err != nil || casURL.Scheme == "" || casURL.Host == "" {
+		return nil, fmt.Errorf("%w: CAS_URL %q is not an absolute URL", ErrInvalidEnvironment, raw)
+	}
+
+	var options HTTPClientOptions
+	if v, ok := lookup("CAS_TIMEOUT"); ok && v != "" {
+		if options.Timeout, err = time.ParseDuration(v); err != nil || options.Timeout <= 0 {
+			return nil, fmt.Errorf("%w: CAS_TIMEOUT %q is not a positive duration", ErrInvalidEnvironment, v)
+		}
+	}
+
+	insecureSkipVerify, err := envBool(lookup, "CAS_INSECURE_SKIP_VERIFY")
+	if err != nil {
+		return nil, err
+	}
+
+	client := NewHTTPClient(&options)
+	if insecureSkipVerify {
+		client.Transport.(*http.Transport).TLSClientConfig.InsecureSkipVerify = true
+	}
+
+	validator := NewServiceTicketValidator(client, casURL)
+	for _, b := range []struct {
+		key   string
+		field *bool
+	}{
+		{"CAS_RENEW", &validator.RequireFreshLogin},
+		{"CAS_STRICT_PARSING", &validator.StrictParsing},
+		{"CAS_LENIENT_PARSING", &validator.LenientParsing},
+		{"CAS_ALLOW_INSECURE_URL", &validator.AllowInsecureCasURL},
+	} {
+		if *b.field, err = envBool(lookup, b.key); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := checkCasURL(casURL, validator.AllowInsecureCasURL); err != nil {
+		return nil, fmt.Errorf("%w: CAS_URL %q does not use https, set CAS_ALLOW_INSECURE_URL for development", ErrInvalidEnvironment, raw)
+	}
+
+	if v, ok := lookup("CAS_PROTOCOL_VERSION"); ok && v != "" {
+		switch strings.TrimSuffix(v, ".0") {
+		case "1":
+			validator.ProtocolVersion = ProtocolVersion1
+		case "2":
+			validator.ProtocolVersion = ProtocolVersion2
+		case "3":
+			validator.ProtocolVersion = ProtocolVersion3
+		default:
+			return nil, fmt.Errorf("%w: CAS_PROTOCOL_VERSION %q is not 1, 2 or 3", ErrInvalidEnvironment, v)
+		}
+	}
+
+	return validator, nil
+}
+
+// envBool returns the boolean value of the environment variable, false if it is unset or empty.
+func envBool(lookup func(key string) (string, bool), key string) (bool, error) {
+	v, ok := lookup(key)
+	if !ok || v == "" {
+		return false, nil
+	}
+
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		return false, fmt.Errorf("%w: %s %q is not a boolean", ErrInvalidEnvironment, key, v)
+	}
+
+	return b, nil
+}
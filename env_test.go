@@ -0,0 +1,101 @@
+package cas
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNewFromEnv(t *testing.T) {
+	t.Setenv("CAS_URL", "https://cas.example.com/cas/")
+	t.Setenv("CAS_PROTOCOL_VERSION", "3.0")
+	t.Setenv("CAS_RENEW", "true")
+	t.Setenv("CAS_INSECURE_SKIP_VERIFY", "1")
+	t.Setenv("CAS_TIMEOUT", "10s")
+
+	validator, err := NewFromEnv()
+	if err != nil {
+		t.Fatalf("Expected NewFromEnv to succeed, got error: %v", err)
+	}
+
+	if u := validator.currentCasURL().String(); u != "https://cas.example.com/cas/" {
+		t.Errorf("Expected CAS URL to be <https://cas.example.com/cas/>, got <%s>", u)
+	}
+
+	if validator.ProtocolVersion != ProtocolVersion3 {
+		t.Errorf("Expected ProtocolVersion to be <%v>, got <%v>", ProtocolVersion3, validator.ProtocolVersion)
+	}
+
+	if !validator.RequireFreshLogin || validator.StrictParsing {
+		t.Errorf("Expected only RequireFreshLogin to be set, got RequireFreshLogin <%v> and StrictParsing <%v>",
+			validator.RequireFreshLogin, validator.StrictParsing)
+	}
+
+	if !validator.client.Transport.(*http.Transport).TLSClientConfig.InsecureSkipVerify {
+		t.Errorf("Expected InsecureSkipVerify to be set")
+	}
+
+	if validator.client.Timeout != 10*time.Second {
+		t.Errorf("Expected Timeout to be <10s>, got <%v>", validator.client.Timeout)
+	}
+}
+
+func TestNewFromEnvInvalid(t *testing.T) {
+	cases := []map[string]string{
+		{},
+		{"CAS_URL": "cas.example.com"},
+		{"CAS_URL": "https://cas.example.com/", "CAS_PROTOCOL_VERSION": "4"},
+		{"CAS_URL": "https://cas.example.com/", "CAS_RENEW": "sometimes"},
+		{"CAS_URL": "https://cas.example.com/", "CAS_TIMEOUT": "10"},
+		{"CAS_URL": "http://cas.example.com/"},
+		{"CAS_URL": "http://cas.example.com/", "CAS_ALLOW_INSECURE_URL": "false"},
+	}
+
+	for _, env := range cases {
+		lookup := func(key string) (string, bool) {
+			v, ok := env[key]
+			return v, ok
+		}
+
+		if _, err := newFromEnv(lookup); !errors.Is(err, ErrInvalidEnvironment) {
+			t.Errorf("Expected error for <%v> to be <%v>, got <%v>", env, ErrInvalidEnvironment, err)
+		}
+	}
+}
+
+func TestNewFromEnvAllowInsecureURL(t *testing.T) {
+	env := map[string]string{"CAS_URL": "http://localhost:8443/cas/", "CAS_ALLOW_INSECURE_URL": "true"}
+	validator, err := newFromEnv(func(key string) (string, bool) {
+		v, ok := env[key]
+		return v, ok
+	})
+	if err != nil {
+		t.Fatalf("Expected NewFromEnv to accept an http CAS_URL with CAS_ALLOW_INSECURE_URL, got error: %v", err)
+	}
+
+	if !validator.AllowInsecureCasURL {
+		t.Errorf("Expected AllowInsecureCasURL to be set")
+	}
+}
+
+func TestNewFromEnvFirstInvalidBool(t *testing.T) {
+	env := map[string]string{
+		"CAS_URL":                "https://cas.example.com/",
+		"CAS_RENEW":              "sometimes",
+		"CAS_STRICT_PARSING":     "maybe",
+		"CAS_LENIENT_PARSING":    "perhaps",
+		"CAS_ALLOW_INSECURE_URL": "never",
+	}
+
+	for i := 0; i < 20; i++ {
+		_, err := newFromEnv(func(key string) (string, bool) {
+			v, ok := env[key]
+			return v, ok
+		})
+		if err == nil || !strings.Contains(err.Error(), "CAS_RENEW") {
+			t.Fatalf("Expected the error to name CAS_RENEW, got <%v>", err)
+		}
+	}
+}
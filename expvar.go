@@ -0,0 +1,54 @@
+package cas
+
+import (
+	"expvar"
+)
+
+// Counter names of ExpvarCounters
+const (
+	CounterValidationsAttempted         = "validations_attempted"
+	CounterValidationsSucceeded         = "validations_succeeded"
+	CounterValidationsFailed            = "validations_failed"
+	CounterCas1Fallbacks                = "cas1_fallbacks"
+	CounterProtocolCacheHits            = "protocol_cache_hits"
+	CounterRestAuthenticationsAttempted = "rest_authentications_attempted"
+	CounterRestAuthenticationsFailed    = "rest_authentications_failed"
+)
+
+// ExpvarCounters counts validation events in an expvar.Map, so they are served by the
+// /debug/vars handler of the expvar package. A nil *ExpvarCounters counts nothing.
+type ExpvarCounters struct {
+	m *expvar.Map
+}
+
+// NewExpvarCounters publishes the counters as an expvar.Map named namespace. Counters
+// created with the same namespace share the map, so several validators can be summed.
+// Like expvar.Publish, it panics if namespace is already used by a variable which is not
+// an expvar.Map.
+func NewExpvarCounters(namespace string) *ExpvarCounters {
+	if v := expvar.Get(namespace); v != nil {
+		if m, ok := v.(*expvar.Map); ok {
+			return &ExpvarCounters{m: m}
+		}
+	}
+
+	return &ExpvarCounters{m: expvar.NewMap(namespace)}
+}
+
+// Map returns the underlying expvar.Map
+func (c *ExpvarCounters) Map() *expvar.Map {
+	if c == nil {
+		return nil
+	}
+
+	return c.m
+}
+
+// add increments the named counter
+func (c *ExpvarCounters) add(name string) {
+	if c == nil {
+		return
+	}
+
+	c.m.Add(name, 1)
+}
@@ -0,0 +1,49 @@
+package cas
+
+import (
+	"net/url"
+	"testing"
+)
+
+func TestExpvarCounters(t *testing.T) {
+	var probes int32
+	server := newCas1Server(&probes)
+	defer server.Close()
+
+	counters := NewExpvarCounters("cas_test_validation")
+	if NewExpvarCounters("cas_test_validation").Map() != counters.Map() {
+		t.Errorf("Expected counters with the same namespace to share the expvar.Map")
+	}
+
+	casURL, _ := url.Parse(server.URL)
+	validator := NewServiceTicketValidator(server.Client(), casURL)
+	validator.Counters = counters
+	serviceURL, _ := url.Parse("http://example.com/")
+
+	for i := 0; i < 2; i++ {
+		if _, err := validator.ValidateTicket(serviceURL, "ST-123"); err != nil {
+			t.Fatalf("Expected ValidateTicket to succeed, got error: %v", err)
+		}
+	}
+
+	expected := map[string]string{
+		CounterValidationsAttempted: "2",
+		CounterValidationsSucceeded: "2",
+		CounterCas1Fallbacks:        "1",
+		CounterProtocolCacheHits:    "1",
+	}
+
+	for name, value := range expected {
+		v := counters.Map().Get(name)
+		if v == nil || v.String() != value {
+			t.Errorf("Expected counter %s to be <%s>, got <%v>", name, value, v)
+		}
+	}
+
+	if v := counters.Map().Get(CounterValidationsFailed); v != nil {
+		t.Errorf("Expected no failed validations, got <%v>", v)
+	}
+
+	var disabled *ExpvarCounters
+	disabled.add(CounterValidationsAttempted)
+}
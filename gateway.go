@@ -0,0 +1,81 @@
+package cas
+
+import (
+	"log/slog"
+	"net/http"
+	"net/url"
+)
+
+const (
+	gatewayCookieName   = "_cas_gateway"
+	gatewayCookieMaxAge = 60
+)
+
+// WithGateway requests that CAS does not prompt the user for credentials. CAS redirects
+// back to the service with a ticket if the user has an SSO session, or without one if not.
+func WithGateway() LoginOption {
+	return func(q url.Values) {
+		q.Set("gateway", "true")
+	}
+}
+
+// attemptGateway redirects an unauthenticated request to CAS with gateway=true, returning
+// true if the response has been written.
+//
+// A marker cookie is set before redirecting and kept for its MaxAge, so the request which
+// comes back without a ticket, and the later requests of the anonymous user, proceed
+// unauthenticated instead of being redirected again. It is cleared once the user is
+// authenticated, see completeGateway.
+func (c *Client) attemptGateway(w http.ResponseWriter, r *http.Request) bool {
+	if r.Method != "GET" && r.Method != "HEAD" {
+		return false
+	}
+
+	if _, err := r.Cookie(c.gatewayCookieTemplate.Name); err == nil {
+		requestLogger(c.logger, r.Context()).Debug("cas: gateway already attempted", slog.String("url", redactedURL(r.URL)))
+		return false
+	}
+
+	u, err := c.LoginUrlForRequest(r, WithGateway())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return true
+	}
+
+	http.SetCookie(w, c.gatewayCookie(r, c.gatewayCookieTemplate.MaxAge))
+
+	requestLogger(c.logger, r.Context()).Info("cas: attempting gateway, redirecting client to", slog.Any("url", u), slog.Any("status", http.StatusFound))
+
+	http.Redirect(w, r, u, http.StatusFound)
+	return true
+}
+
+// completeGateway clears the gateway marker cookie once the request is authenticated.
+func (c *Client) completeGateway(w http.ResponseWriter, r *http.Request) {
+	if _, err := r.Cookie(c.gatewayCookieTemplate.Name); err == nil {
+		c.clearGatewayCookie(w, r)
+	}
+}
+
+// clearGatewayCookie removes the gateway marker cookie from the client.
+func (c *Client) clearGatewayCookie(w http.ResponseWriter, r *http.Request) {
+	http.SetCookie(w, c.gatewayCookie(r, -1))
+}
+
+// gatewayCookie creates the gateway marker cookie with the given max age from the GatewayCookie
+// options. Secure is dropped for requests over plain http, where the browser would discard the
+// cookie and the gateway redirect would repeat.
+func (c *Client) gatewayCookie(r *http.Request, maxAge int) *http.Cookie {
+	options := c.gatewayCookieTemplate
+
+	return &http.Cookie{
+		Name:     options.Name,
+		Value:    "1",
+		Path:     options.Path,
+		Domain:   options.Domain,
+		MaxAge:   maxAge,
+		HttpOnly: true,
+		Secure:   options.Secure && absoluteURL(r, true).Scheme == "https",
+		SameSite: options.SameSite,
+	}
+}
@@ -1,8 +1,13 @@
 module github.com/go-rat/cas
 
-go 1.12
+go 1.24
 
 require (
 	github.com/stretchr/testify v1.10.0
 	gopkg.in/yaml.v3 v3.0.1
 )
+
+require (
+	github.com/davecgh/go-spew v1.1.1 // indirect
+	github.com/pmezard/go-difflib v1.0.0 // indirect
+)
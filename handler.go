@@ -1,6 +1,7 @@
 package cas
 
 import (
+	"errors"
 	"fmt"
 	"log/slog"
 	"net/http"
@@ -19,7 +20,8 @@ type clientHandler struct {
 // ServeHTTP handles HTTP requests, processes CAS requests
 // and passes requests up to its child http.Handler.
 func (ch *clientHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	slog.Info("cas: handling request", slog.Any("method", r.Method), slog.Any("url", r.URL))
+	setRequestID(r, ch.c.requestIDHeader)
+	requestLogger(ch.c.logger, r.Context()).Info("cas: handling request", slog.Any("method", r.Method), slog.String("url", redactedURL(r.URL)))
 
 	setClient(r, ch.c)
 
@@ -28,7 +30,22 @@ func (ch *clientHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if _, err := ch.c.ticketParameter(r); err != nil {
+		requestLogger(ch.c.logger, r.Context()).Info("cas: rejecting request", slog.Any("error", err))
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
 	ch.c.getSession(w, r)
+
+	if ch.c.gateway {
+		if IsAuthenticated(r) {
+			ch.c.completeGateway(w, r)
+		} else if ch.c.attemptGateway(w, r) {
+			return
+		}
+	}
+
 	ch.h.ServeHTTP(w, r)
 	return
 }
@@ -59,7 +76,19 @@ func (ch *clientHandler) performSingleLogout(w http.ResponseWriter, r *http.Requ
 	logoutRequest, err := parseLogoutRequest([]byte(rawXML))
 
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := ch.c.checkLogoutRequest(r, logoutRequest); err != nil {
+		requestLogger(ch.c.logger, r.Context()).Warn("cas: rejecting single logout request", slog.Any("id", logoutRequest.ID), slog.Any("error", err))
+
+		status := http.StatusBadRequest
+		if errors.Is(err, ErrLogoutRequestSource) {
+			status = http.StatusForbidden
+		}
+
+		http.Error(w, err.Error(), status)
 		return
 	}
 
@@ -68,8 +97,21 @@ func (ch *clientHandler) performSingleLogout(w http.ResponseWriter, r *http.Requ
 		return
 	}
 
+	logCacheEvent(r.Context(), ch.c.logger, cacheEvict, ch.c.tickets, logoutRequest.SessionIndex)
 	ch.c.deleteSession(logoutRequest.SessionIndex)
 
+	if sessionID, ok := ch.c.takeSession(logoutRequest.SessionIndex); ok {
+		ch.c.deleteSession(sessionID)
+
+		if ch.c.onSessionLogout != nil {
+			ch.c.onSessionLogout(sessionID)
+		}
+	}
+
+	if ch.c.onLogout != nil {
+		ch.c.onLogout(logoutRequest.SessionIndex)
+	}
+
 	w.WriteHeader(http.StatusOK)
 	fmt.Fprintln(w, "OK")
 }
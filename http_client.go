@@ -0,0 +1,131 @@
+package cas
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"errors"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// HTTP client errors
+var (
+	// The certificate of the CAS server matches none of HTTPClientOptions.PinnedCertSHA256
+	ErrCertificatePinMismatch = errors.New("cas: certificate of the CAS server does not match a pinned SHA-256 hash")
+)
+
+// Default timeouts used by NewHTTPClient
+const (
+	DefaultDialTimeout = 5 * time.Second
+	DefaultTimeout     = 30 * time.Second
+)
+
+// HTTPClientOptions configure the *http.Client created by NewHTTPClient
+type HTTPClientOptions struct {
+	DialTimeout time.Duration // Timeout for establishing a connection, DefaultDialTimeout when zero
+	Timeout     time.Duration // Timeout for the whole request including reading the body, DefaultTimeout when zero
+
+	// ProxyURL routes requests through a forward HTTP proxy. Credentials in the URL's userinfo are
+	// sent to the proxy as Basic Proxy-Authorization. When nil the proxy environment variables apply.
+	ProxyURL *url.URL
+
+	// TLSServerName overrides the name sent with SNI and checked against the certificate of the
+	// CAS server, for when the dialed host, such as an internal IP, differs from its certificate.
+	TLSServerName string
+
+	// MinTLSVersion is the minimum TLS version accepted from the CAS server, such as
+	// tls.VersionTLS13. Defaults to tls.VersionTLS12, refusing TLS 1.0 and 1.1.
+	MinTLSVersion uint16
+
+	// PinnedCertSHA256, if set, are the SHA-256 hashes of which the leaf certificate of the CAS
+	// server, or its SubjectPublicKeyInfo, must match one, failing the connection with
+	// ErrCertificatePinMismatch otherwise. The pins are checked in addition to the usual
+	// verification of the certificate chain, and on resumed TLS sessions too.
+	PinnedCertSHA256 [][32]byte
+}
+
+// NewHTTPClient creates a *http.Client for talking to the CAS server.
+//
+// Connecting is bounded separately from the overall request, so an unreachable
+// server fails fast while a reachable but slow server is given longer to respond.
+// A nil options uses the defaults. NewClient and NewRestClient use such a client
+// when no Client is configured.
+func NewHTTPClient(options *HTTPClientOptions) *http.Client {
+	if options == nil {
+		options = &HTTPClientOptions{}
+	}
+
+	dialTimeout := options.DialTimeout
+	if dialTimeout == 0 {
+		dialTimeout = DefaultDialTimeout
+	}
+
+	timeout := options.Timeout
+	if timeout == 0 {
+		timeout = DefaultTimeout
+	}
+
+	dialer := &net.Dialer{
+		Timeout:   dialTimeout,
+		KeepAlive: 30 * time.Second,
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = dialer.DialContext
+
+	if options.ProxyURL != nil {
+		transport.Proxy = http.ProxyURL(options.ProxyURL)
+	}
+
+	if transport.TLSClientConfig == nil {
+		transport.TLSClientConfig = &tls.Config{}
+	}
+
+	transport.TLSClientConfig.MinVersion = tls.VersionTLS12
+	if options.MinTLSVersion != 0 {
+		transport.TLSClientConfig.MinVersion = options.MinTLSVersion
+	}
+
+	if options.TLSServerName != "" {
+		transport.TLSClientConfig.ServerName = options.TLSServerName
+	}
+
+	if len(options.PinnedCertSHA256) > 0 {
+		pins := append([][32]byte(nil), options.PinnedCertSHA256...)
+		transport.TLSClientConfig.VerifyConnection = func(cs tls.ConnectionState) error {
+			return verifyPinnedCertificate(cs, pins)
+		}
+	}
+
+	return &http.Client{
+		Transport: transport,
+		Timeout:   timeout,
+	}
+}
+
+// verifyPinnedCertificate checks that the leaf certificate of the connection, or its
+// SubjectPublicKeyInfo, matches one of the pins.
+func verifyPinnedCertificate(cs tls.ConnectionState, pins [][32]byte) error {
+	if len(cs.PeerCertificates) == 0 {
+		return ErrCertificatePinMismatch
+	}
+
+	leaf := cs.PeerCertificates[0]
+	cert, spki := sha256.Sum256(leaf.Raw), sha256.Sum256(leaf.RawSubjectPublicKeyInfo)
+	for _, pin := range pins {
+		if pin == cert || pin == spki {
+			return nil
+		}
+	}
+
+	return ErrCertificatePinMismatch
+}
+
+// setDefaultHeaders sets the headers h on the request, replacing any of the same name.
+func setDefaultHeaders(r *http.Request, h http.Header) {
+	for name, values := range h {
+		r.Header[http.CanonicalHeaderKey(name)] = append([]string(nil), values...)
+	}
+}
@@ -0,0 +1,186 @@
+package cas
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestNewHTTPClientDefaults(t *testing.T) {
+	client := NewHTTPClient(nil)
+
+	if client.Timeout != DefaultTimeout {
+		t.Errorf("Expected Timeout to be <%v>, got <%v>", DefaultTimeout, client.Timeout)
+	}
+
+	transport, ok := client.Transport.(*http.Transport)
+	if !ok {
+		t.Fatalf("Expected Transport to be a *http.Transport, got %T", client.Transport)
+	}
+
+	if transport.DialContext == nil {
+		t.Errorf("Expected DialContext to be set")
+	}
+}
+
+func TestNewHTTPClientTimeout(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(200 * time.Millisecond)
+	}))
+	defer server.Close()
+
+	client := NewHTTPClient(&HTTPClientOptions{
+		DialTimeout: time.Second,
+		Timeout:     50 * time.Millisecond,
+	})
+
+	if _, err := client.Get(server.URL); err == nil {
+		t.Errorf("Expected request to a slow server to time out")
+	}
+
+	client = NewHTTPClient(&HTTPClientOptions{
+		DialTimeout: 50 * time.Millisecond,
+		Timeout:     time.Second,
+	})
+
+	resp, err := client.Get(server.URL)
+	if err != nil {
+		t.Fatalf("Expected a reachable slow server to respond within the overall timeout, got error: %v", err)
+	}
+	resp.Body.Close()
+}
+
+func TestNewHTTPClientProxy(t *testing.T) {
+	var proxied, authorization string
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		proxied = r.URL.String()
+		authorization = r.Header.Get("Proxy-Authorization")
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer proxy.Close()
+
+	proxyURL, _ := url.Parse(proxy.URL)
+	proxyURL.User = url.UserPassword("arthur", "dent")
+
+	client := NewHTTPClient(&HTTPClientOptions{
+		ProxyURL: proxyURL,
+	})
+
+	resp, err := client.Get("http://cas.example.com/cas/serviceValidate")
+	if err != nil {
+		t.Fatalf("Expected request through the proxy to succeed, got error: %v", err)
+	}
+	resp.Body.Close()
+
+	if proxied != "http://cas.example.com/cas/serviceValidate" {
+		t.Errorf("Expected proxy to receive the CAS url, got <%s>", proxied)
+	}
+
+	expected := "Basic " + base64.StdEncoding.EncodeToString([]byte("arthur:dent"))
+	if authorization != expected {
+		t.Errorf("Expected Proxy-Authorization to be <%s>, got <%s>", expected, authorization)
+	}
+}
+
+func TestNewHTTPClientTLSServerName(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(200)
+	}))
+	defer server.Close()
+
+	rootCAs := server.Client().Transport.(*http.Transport).TLSClientConfig.RootCAs
+	get := func(serverName string) error {
+		client := NewHTTPClient(&HTTPClientOptions{TLSServerName: serverName})
+		client.Transport.(*http.Transport).TLSClientConfig.RootCAs = rootCAs
+
+		resp, err := client.Get(server.URL)
+		if err == nil {
+			resp.Body.Close()
+		}
+
+		return err
+	}
+
+	// The test certificate is valid for example.com
+	if err := get("example.com"); err != nil {
+		t.Errorf("Expected the request to succeed with a matching server name, got error: %v", err)
+	}
+
+	if err := get("cas.internal.example.com"); err == nil {
+		t.Errorf("Expected the certificate to be checked against the configured server name")
+	}
+}
+
+func TestNewHTTPClientMinTLSVersion(t *testing.T) {
+	if v := NewHTTPClient(nil).Transport.(*http.Transport).TLSClientConfig.MinVersion; v != tls.VersionTLS12 {
+		t.Errorf("Expected the default MinVersion to be <%v>, got <%v>", tls.VersionTLS12, v)
+	}
+
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(200)
+	}))
+	server.TLS = &tls.Config{MaxVersion: tls.VersionTLS12}
+	server.StartTLS()
+	defer server.Close()
+
+	rootCAs := server.Client().Transport.(*http.Transport).TLSClientConfig.RootCAs
+	get := func(version uint16) error {
+		client := NewHTTPClient(&HTTPClientOptions{MinTLSVersion: version})
+		client.Transport.(*http.Transport).TLSClientConfig.RootCAs = rootCAs
+
+		resp, err := client.Get(server.URL)
+		if err == nil {
+			resp.Body.Close()
+		}
+
+		return err
+	}
+
+	if err := get(0); err != nil {
+		t.Errorf("Expected the request to succeed over TLS 1.2 by default, got error: %v", err)
+	}
+
+	if err := get(tls.VersionTLS13); err == nil {
+		t.Errorf("Expected the request to fail when the server only supports TLS 1.2")
+	}
+}
+
+func TestNewHTTPClientPinnedCertSHA256(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(200)
+	}))
+	defer server.Close()
+
+	leaf := server.Certificate()
+	rootCAs := server.Client().Transport.(*http.Transport).TLSClientConfig.RootCAs
+	get := func(pins ...[32]byte) error {
+		client := NewHTTPClient(&HTTPClientOptions{PinnedCertSHA256: pins})
+		client.Transport.(*http.Transport).TLSClientConfig.RootCAs = rootCAs
+
+		resp, err := client.Get(server.URL)
+		if err == nil {
+			resp.Body.Close()
+		}
+
+		return err
+	}
+
+	other := sha256.Sum256([]byte("another certificate"))
+	if err := get(other, sha256.Sum256(leaf.Raw)); err != nil {
+		t.Errorf("Expected the request to succeed with the certificate pinned, got error: %v", err)
+	}
+
+	if err := get(sha256.Sum256(leaf.RawSubjectPublicKeyInfo)); err != nil {
+		t.Errorf("Expected the request to succeed with the public key pinned, got error: %v", err)
+	}
+
+	if err := get(other); !errors.Is(err, ErrCertificatePinMismatch) {
+		t.Errorf("Expected error to be <%v>, got <%v>", ErrCertificatePinMismatch, err)
+	}
+}
@@ -3,6 +3,8 @@ package cas
 import (
 	"context"
 	"net/http"
+	"net/url"
+	"strings"
 	"time"
 )
 
@@ -11,6 +13,13 @@ type key int
 const ( // emulating enums is actually pretty ugly in go.
 	clientKey key = iota
 	authenticationResponseKey
+	requestIDKey
+	rawResponseKey
+	serviceStringKey
+	debugLoggingKey
+	auditEndpointKey
+	replayCheckedKey
+	observationKey
 )
 
 // setClient associates a Client with a http.Request.
@@ -55,6 +64,49 @@ func RedirectToLogout(w http.ResponseWriter, r *http.Request) {
 	c.RedirectToLogout(w, r)
 }
 
+// RedirectAfterLogin redirects the request, once its ticket has been validated, to the URL the
+// user originally requested, which is the request URL without the ticket. A relative service
+// parameter of the request, as sent by apps with a dedicated login route, is preferred. The
+// request is redirected to fallback when neither is present, or the service is not local to
+// the application, so users can not be sent to another site.
+func RedirectAfterLogin(w http.ResponseWriter, r *http.Request, fallback string) {
+	http.Redirect(w, r, afterLoginURL(r, fallback), http.StatusFound)
+}
+
+// afterLoginURL determines the redirect target of RedirectAfterLogin.
+func afterLoginURL(r *http.Request, fallback string) string {
+	ticketParameter := "ticket"
+	if c := getClient(r); c != nil {
+		ticketParameter = c.ticketParameterName
+	}
+
+	q := r.URL.Query()
+	if service := q.Get("service"); service != "" {
+		if u, err := url.Parse(service); err == nil && isLocalURL(u) {
+			return sanitisedURL(u).RequestURI()
+		}
+
+		return fallback
+	}
+
+	if q.Get(ticketParameter) == "" {
+		return fallback // redirecting to the request URL would loop
+	}
+
+	q.Del(ticketParameter)
+	u := *r.URL
+	u.RawQuery = q.Encode()
+
+	return sanitisedURL(&u).RequestURI()
+}
+
+// isLocalURL reports whether u is an absolute path without a host, which browsers resolve
+// against the current origin.
+func isLocalURL(u *url.URL) bool {
+	return u.Scheme == "" && u.Host == "" && u.User == nil &&
+		strings.HasPrefix(u.Path, "/") && !strings.HasPrefix(u.Path, "//") && !strings.HasPrefix(u.Path, "/\\")
+}
+
 // setAuthenticationResponse associates an AuthenticationResponse with
 // a http.Request.
 func setAuthenticationResponse(r *http.Request, a *AuthenticationResponse) {
@@ -128,6 +180,16 @@ func IsNewLogin(r *http.Request) bool {
 	return false
 }
 
+// IsFromCache indicates whether the authentication of the request was read back
+// from the session rather than validated with the CAS server for this request.
+func IsFromCache(r *http.Request) bool {
+	if a := getAuthenticationResponse(r); a != nil {
+		return a.FromCache
+	}
+
+	return false
+}
+
 // IsRememberedLogin indicates whether the CAS service ticket was granted by the
 // presence of a long term authentication token.
 //
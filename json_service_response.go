@@ -0,0 +1,190 @@
+package cas
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+)
+
+type jsonServiceResponse struct {
+	ServiceResponse struct {
+		Failure *jsonAuthenticationFailure `json:"authenticationFailure"`
+		Success *jsonAuthenticationSuccess `json:"authenticationSuccess"`
+	} `json:"serviceResponse"`
+}
+
+type jsonAuthenticationFailure struct {
+	Code        string `json:"code"`
+	Description string `json:"description"`
+}
+
+type jsonAuthenticationSuccess struct {
+	User                string     `json:"user"`
+	Service             string     `json:"service"`
+	ProxyGrantingTicket string     `json:"proxyGrantingTicket"`
+	Proxies             []string   `json:"proxies"`
+	Attributes          jsonObject `json:"attributes"`
+}
+
+// parseJSONServiceResponse parses a CAS 3.0 JSON service response
+func parseJSONServiceResponse(data []byte, opts parseOptions) (*AuthenticationResponse, error) {
+	if len(bytes.TrimSpace(data)) == 0 {
+		return nil, ErrEmptyResponse
+	}
+
+	data, err := toUTF8(data, opts.charset, opts.charsetReader)
+	if err != nil {
+		return nil, err
+	}
+
+	var x jsonServiceResponse
+
+	if err := json.Unmarshal(data, &x); err != nil {
+		return nil, err
+	}
+
+	var failure *AuthenticationError
+	if f := x.ServiceResponse.Failure; f != nil {
+		failure = &AuthenticationError{Code: f.Code, Message: strings.TrimSpace(f.Description)}
+	}
+
+	s := x.ServiceResponse.Success
+	if s == nil && failure != nil {
+		return nil, failure
+	}
+
+	if s == nil {
+		return nil, fmt.Errorf("cas: service response: no authenticationSuccess or authenticationFailure")
+	}
+
+	r := &AuthenticationResponse{
+		User:                opts.trim(s.User),
+		Service:             strings.TrimSpace(s.Service),
+		ProxyGrantingTicket: strings.TrimSpace(s.ProxyGrantingTicket),
+		Proxies:             s.Proxies,
+		Attributes:          make(UserAttributes),
+	}
+
+	for _, member := range s.Attributes {
+		name := member.Name
+		values, err := jsonAttributeValues(member.Value)
+		if err != nil {
+			if opts.strict {
+				return nil, err
+			}
+
+			opts.logger.Warn("cas: service response: skipping malformed attribute", slog.Any("element", name), slog.Any("error", err))
+			continue
+		}
+
+		switch name {
+		case "authenticationDate":
+			if len(values) > 0 {
+				r.AuthenticationDate, _ = parseJSONDate(values[0])
+			}
+		case "isFromNewLogin":
+			r.IsNewLogin = len(values) > 0 && values[0] == "true"
+		case "longTermAuthenticationRequestTokenUsed":
+			r.IsRememberedLogin = len(values) > 0 && values[0] == "true"
+		case "memberOf":
+			r.MemberOf = append(r.MemberOf, values...)
+		default:
+			for _, v := range values {
+				r.addAttribute(name, opts.trim(v))
+			}
+		}
+	}
+
+	if failure != nil {
+		r.addFailureWarning(failure, opts.logger)
+	}
+
+	return r, nil
+}
+
+// jsonObject is a JSON object decoded with the order of its members kept
+type jsonObject []jsonMember
+
+type jsonMember struct {
+	Name  string
+	Value json.RawMessage
+}
+
+// UnmarshalJSON decodes the members of a JSON object in order
+func (o *jsonObject) UnmarshalJSON(data []byte) error {
+	dec := json.NewDecoder(bytes.NewReader(data))
+
+	t, err := dec.Token()
+	if err != nil {
+		return err
+	}
+
+	if t == nil {
+		*o = nil
+		return nil
+	}
+
+	if d, ok := t.(json.Delim); !ok || d != '{' {
+		return fmt.Errorf("cas: service response: attributes is not an object")
+	}
+
+	members := jsonObject{}
+	for dec.More() {
+		t, err := dec.Token()
+		if err != nil {
+			return err
+		}
+
+		var m jsonMember
+		m.Name, _ = t.(string)
+		if err := dec.Decode(&m.Value); err != nil {
+			return err
+		}
+
+		members = append(members, m)
+	}
+
+	*o = members
+	return nil
+}
+
+// jsonAttributeValues decodes a JSON attribute, which may be a scalar or a list of scalars.
+func jsonAttributeValues(raw json.RawMessage) ([]string, error) {
+	var list []interface{}
+	if err := json.Unmarshal(raw, &list); err != nil {
+		var scalar interface{}
+		if err := json.Unmarshal(raw, &scalar); err != nil {
+			return nil, err
+		}
+
+		list = []interface{}{scalar}
+	}
+
+	values := make([]string, 0, len(list))
+	for _, v := range list {
+		switch t := v.(type) {
+		case nil:
+			continue
+		case string:
+			values = append(values, t)
+		case map[string]interface{}, []interface{}:
+			return nil, fmt.Errorf("cas: service response: unsupported nested attribute value")
+		default:
+			values = append(values, fmt.Sprint(t))
+		}
+	}
+
+	return values, nil
+}
+
+// parseJSONDate parses an authentication date, ignoring any trailing Java zone id such as [UTC].
+func parseJSONDate(raw string) (time.Time, error) {
+	if i := strings.IndexByte(raw, '['); i >= 0 {
+		raw = raw[:i]
+	}
+
+	return time.Parse(time.RFC3339Nano, raw)
+}
@@ -0,0 +1,286 @@
+package cas
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/hmac"
+	"crypto/rsa"
+	_ "crypto/sha256" // register SHA-256 for crypto.Hash
+	_ "crypto/sha512" // register SHA-384 and SHA-512 for crypto.Hash
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"math/big"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+// JWT validation errors
+var (
+	// The JWT is malformed, uses an unsupported algorithm or has an invalid signature
+	ErrInvalidJWT = errors.New("cas: jwt: invalid token")
+
+	// The JWT has expired or is not yet valid
+	ErrJWTExpired = errors.New("cas: jwt: token expired or not yet valid")
+)
+
+// JWTKeyFunc returns the key used to verify a JWT signed with the algorithm alg.
+// kid is the key id from the JWT header and may be empty.
+//
+// HS* algorithms expect a []byte, RS* algorithms a *rsa.PublicKey and ES*
+// algorithms a *ecdsa.PublicKey.
+type JWTKeyFunc func(alg, kid string) (interface{}, error)
+
+// jwtRegisteredClaims are the claims which are not mapped into UserAttributes.
+var jwtRegisteredClaims = map[string]bool{
+	"sub": true,
+	"aud": true,
+	"iss": true,
+	"exp": true,
+	"nbf": true,
+	"iat": true,
+	"jti": true,
+}
+
+// ValidateJWTTicket validates a service ticket issued by CAS as a signed JWT.
+//
+// No request is made to the CAS server. The signature is verified with the key
+// returned by keyFunc, the exp and nbf claims are checked against the current time
+// and, when present, the aud claim must match the service. The sub claim becomes
+// the User and the remaining non-registered claims become Attributes.
+func (validator *ServiceTicketValidator) ValidateJWTTicket(ctx context.Context, serviceURL *url.URL, ticket string, keyFunc JWTKeyFunc) (*AuthenticationResponse, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	claims, err := verifyJWT(ticket, keyFunc)
+	if err != nil {
+		validator.logger().Info("cas: jwt ticket rejected", slog.Any("error", err))
+		return nil, err
+	}
+
+	now := time.Now()
+	if exp, ok := jwtNumericDate(claims, "exp"); ok && !now.Before(exp) {
+		return nil, ErrJWTExpired
+	}
+
+	if nbf, ok := jwtNumericDate(claims, "nbf"); ok && now.Before(nbf) {
+		return nil, ErrJWTExpired
+	}
+
+	if aud, ok := claims["aud"]; ok && !jwtAudienceContains(aud, validator.serviceParameter(ctx, serviceURL)) {
+		return nil, ErrServiceMismatch
+	}
+
+	user, _ := claims["sub"].(string)
+	if user == "" {
+		return nil, fmt.Errorf("%w: missing sub claim", ErrInvalidJWT)
+	}
+
+	success := &AuthenticationResponse{
+		User:       user,
+		Attributes: make(UserAttributes),
+	}
+
+	if iat, ok := jwtNumericDate(claims, "iat"); ok {
+		success.AuthenticationDate = iat.UTC()
+	}
+
+	names := make([]string, 0, len(claims))
+	for name := range claims {
+		if !jwtRegisteredClaims[name] {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		addJWTClaim(success, name, claims[name])
+	}
+
+	validator.logger().Info("cas: validated jwt ticket", slog.Any("user", success.User))
+
+	return success, nil
+}
+
+// verifyJWT checks the signature of a compact serialised JWS and returns its claims.
+func verifyJWT(token string, keyFunc JWTKeyFunc) (map[string]interface{}, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("%w: expected 3 segments, got %d", ErrInvalidJWT, len(parts))
+	}
+
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+
+	if err := decodeJWTSegment(parts[0], &header); err != nil {
+		return nil, err
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidJWT, err)
+	}
+
+	key, err := keyFunc(header.Alg, header.Kid)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := verifyJWTSignature(header.Alg, key, parts[0]+"."+parts[1], signature); err != nil {
+		return nil, err
+	}
+
+	var claims map[string]interface{}
+	if err := decodeJWTSegment(parts[1], &claims); err != nil {
+		return nil, err
+	}
+
+	return claims, nil
+}
+
+// decodeJWTSegment decodes a base64url encoded JSON JWT segment into v.
+func decodeJWTSegment(segment string, v interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidJWT, err)
+	}
+
+	// Numbers are kept as json.Number, as a float64 loses the digits of large integer claims
+	d := json.NewDecoder(bytes.NewReader(data))
+	d.UseNumber()
+	if err := d.Decode(v); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidJWT, err)
+	}
+
+	if _, err := d.Token(); err != io.EOF {
+		return fmt.Errorf("%w: trailing data after segment", ErrInvalidJWT)
+	}
+
+	return nil
+}
+
+// jwtNumericDate returns the time of the NumericDate claim, false if it is absent or not a
+// number.
+func jwtNumericDate(claims map[string]interface{}, name string) (time.Time, bool) {
+	n, ok := claims[name].(json.Number)
+	if !ok {
+		return time.Time{}, false
+	}
+
+	seconds, err := n.Float64()
+	if err != nil {
+		return time.Time{}, false
+	}
+
+	return time.Unix(int64(seconds), 0), true
+}
+
+// verifyJWTSignature verifies the signature of signed with key according to alg.
+func verifyJWTSignature(alg string, key interface{}, signed string, signature []byte) error {
+	if len(alg) != 5 {
+		return fmt.Errorf("%w: unsupported algorithm %q", ErrInvalidJWT, alg)
+	}
+
+	var hash crypto.Hash
+	switch alg[2:] {
+	case "256":
+		hash = crypto.SHA256
+	case "384":
+		hash = crypto.SHA384
+	case "512":
+		hash = crypto.SHA512
+	default:
+		return fmt.Errorf("%w: unsupported algorithm %q", ErrInvalidJWT, alg)
+	}
+
+	h := hash.New()
+	h.Write([]byte(signed))
+	digest := h.Sum(nil)
+
+	switch {
+	case strings.HasPrefix(alg, "HS"):
+		secret, ok := key.([]byte)
+		if !ok {
+			return fmt.Errorf("%w: %s requires a []byte key", ErrInvalidJWT, alg)
+		}
+
+		mac := hmac.New(hash.New, secret)
+		mac.Write([]byte(signed))
+		if !hmac.Equal(mac.Sum(nil), signature) {
+			return fmt.Errorf("%w: signature mismatch", ErrInvalidJWT)
+		}
+	case strings.HasPrefix(alg, "RS"):
+		pub, ok := key.(*rsa.PublicKey)
+		if !ok {
+			return fmt.Errorf("%w: %s requires a *rsa.PublicKey", ErrInvalidJWT, alg)
+		}
+
+		if err := rsa.VerifyPKCS1v15(pub, hash, digest, signature); err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalidJWT, err)
+		}
+	case strings.HasPrefix(alg, "ES"):
+		pub, ok := key.(*ecdsa.PublicKey)
+		if !ok {
+			return fmt.Errorf("%w: %s requires a *ecdsa.PublicKey", ErrInvalidJWT, alg)
+		}
+
+		size := (pub.Curve.Params().BitSize + 7) / 8
+		if len(signature) != 2*size {
+			return fmt.Errorf("%w: signature mismatch", ErrInvalidJWT)
+		}
+
+		r := new(big.Int).SetBytes(signature[:size])
+		s := new(big.Int).SetBytes(signature[size:])
+		if !ecdsa.Verify(pub, digest, r, s) {
+			return fmt.Errorf("%w: signature mismatch", ErrInvalidJWT)
+		}
+	default:
+		return fmt.Errorf("%w: unsupported algorithm %q", ErrInvalidJWT, alg)
+	}
+
+	return nil
+}
+
+// jwtAudienceContains reports whether the aud claim, a string or list of strings, contains service.
+func jwtAudienceContains(aud interface{}, service string) bool {
+	switch v := aud.(type) {
+	case string:
+		return v == service
+	case []interface{}:
+		for _, a := range v {
+			if s, ok := a.(string); ok && s == service {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// addJWTClaim adds a claim value, or each element of a list claim, as attributes.
+func addJWTClaim(r *AuthenticationResponse, name string, value interface{}) {
+	switch v := value.(type) {
+	case nil:
+		return
+	case string:
+		r.addAttribute(name, v)
+	case json.Number:
+		r.addAttribute(name, v.String())
+	case []interface{}:
+		for _, e := range v {
+			addJWTClaim(r, name, e)
+		}
+	default:
+		r.addAttribute(name, fmt.Sprint(v))
+	}
+}
@@ -0,0 +1,199 @@
+package cas
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func signTestJWT(t *testing.T, alg string, key interface{}, claims map[string]interface{}) string {
+	header, _ := json.Marshal(map[string]string{"alg": alg, "typ": "JWT"})
+	payload, _ := json.Marshal(claims)
+	signed := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+
+	var signature []byte
+	switch k := key.(type) {
+	case []byte:
+		mac := hmac.New(sha256.New, k)
+		mac.Write([]byte(signed))
+		signature = mac.Sum(nil)
+	case *ecdsa.PrivateKey:
+		digest := sha256.Sum256([]byte(signed))
+		r, s, err := ecdsa.Sign(rand.Reader, k, digest[:])
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		signature = make([]byte, 64)
+		r.FillBytes(signature[:32])
+		s.FillBytes(signature[32:])
+	}
+
+	return signed + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+func TestValidateJWTTicket(t *testing.T) {
+	casURL, _ := url.Parse("https://cas.example.com/cas")
+	serviceURL, _ := url.Parse("https://app.example.com/")
+	validator := NewServiceTicketValidator(nil, casURL)
+
+	secret := []byte("hitchhiker")
+	keyFunc := func(alg, kid string) (interface{}, error) {
+		return secret, nil
+	}
+
+	claims := map[string]interface{}{
+		"sub":   "enoch.root",
+		"aud":   "https://app.example.com/",
+		"exp":   time.Now().Add(time.Minute).Unix(),
+		"email": "enoch@example.com",
+		"groups": []string{
+			"staff",
+			"faculty",
+		},
+	}
+
+	success, err := validator.ValidateJWTTicket(context.Background(), serviceURL, signTestJWT(t, "HS256", secret, claims), keyFunc)
+	if err != nil {
+		t.Fatalf("Expected ValidateJWTTicket to succeed, got error: %v", err)
+	}
+
+	if success.User != "enoch.root" {
+		t.Errorf("Expected User to be <enoch.root>, got <%s>", success.User)
+	}
+
+	if v := success.Attributes.Get("email"); v != "enoch@example.com" {
+		t.Errorf("Expected email attribute to be <enoch@example.com>, got <%s>", v)
+	}
+
+	if v := success.Attributes["groups"]; len(v) != 2 || v[1] != "faculty" {
+		t.Errorf("Expected groups attribute to be [staff faculty], got %v", v)
+	}
+
+	if _, ok := success.Attributes["exp"]; ok {
+		t.Errorf("Expected registered claims to be excluded from attributes")
+	}
+
+	token := signTestJWT(t, "HS256", []byte("wrong"), claims)
+	if _, err := validator.ValidateJWTTicket(context.Background(), serviceURL, token, keyFunc); !errors.Is(err, ErrInvalidJWT) {
+		t.Errorf("Expected ErrInvalidJWT for a bad signature, got %v", err)
+	}
+
+	claims["exp"] = time.Now().Add(-time.Minute).Unix()
+	token = signTestJWT(t, "HS256", secret, claims)
+	if _, err := validator.ValidateJWTTicket(context.Background(), serviceURL, token, keyFunc); err != ErrJWTExpired {
+		t.Errorf("Expected ErrJWTExpired, got %v", err)
+	}
+
+	claims["exp"] = time.Now().Add(time.Minute).Unix()
+	claims["aud"] = "https://other.example.com/"
+	token = signTestJWT(t, "HS256", secret, claims)
+	if _, err := validator.ValidateJWTTicket(context.Background(), serviceURL, token, keyFunc); err != ErrServiceMismatch {
+		t.Errorf("Expected ErrServiceMismatch, got %v", err)
+	}
+
+	if _, err := validator.ValidateJWTTicket(context.Background(), serviceURL, "not-a-jwt", keyFunc); !errors.Is(err, ErrInvalidJWT) {
+		t.Errorf("Expected ErrInvalidJWT for a malformed token, got %v", err)
+	}
+}
+
+func TestValidateJWTTicketNormaliseTrailingSlash(t *testing.T) {
+	casURL, _ := url.Parse("https://cas.example.com/cas")
+	serviceURL, _ := url.Parse("https://app.example.com/orders/")
+	validator := NewServiceTicketValidator(nil, casURL)
+	validator.NormaliseTrailingSlash = true
+
+	secret := []byte("hitchhiker")
+	keyFunc := func(alg, kid string) (interface{}, error) {
+		return secret, nil
+	}
+
+	token := signTestJWT(t, "HS256", secret, map[string]interface{}{
+		"sub": "enoch.root",
+		"aud": "https://app.example.com/orders",
+		"exp": time.Now().Add(time.Minute).Unix(),
+	})
+
+	if _, err := validator.ValidateJWTTicket(context.Background(), serviceURL, token, keyFunc); err != nil {
+		t.Errorf("Expected the normalised service to match the aud claim, got error: %v", err)
+	}
+}
+
+func TestValidateJWTTicketECDSA(t *testing.T) {
+	casURL, _ := url.Parse("https://cas.example.com/cas")
+	serviceURL, _ := url.Parse("https://app.example.com/")
+	validator := NewServiceTicketValidator(nil, casURL)
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keyFunc := func(alg, kid string) (interface{}, error) {
+		if alg != "ES256" {
+			return nil, errors.New("unexpected algorithm")
+		}
+
+		return key.Public().(*ecdsa.PublicKey), nil
+	}
+
+	token := signTestJWT(t, "ES256", key, map[string]interface{}{
+		"sub": "enoch.root",
+		"aud": []string{"https://app.example.com/"},
+	})
+
+	success, err := validator.ValidateJWTTicket(context.Background(), serviceURL, token, keyFunc)
+	if err != nil {
+		t.Fatalf("Expected ValidateJWTTicket to succeed, got error: %v", err)
+	}
+
+	if success.User != "enoch.root" {
+		t.Errorf("Expected User to be <enoch.root>, got <%s>", success.User)
+	}
+}
+
+func TestValidateJWTTicketNumericClaims(t *testing.T) {
+	casURL, _ := url.Parse("https://cas.example.com/cas")
+	serviceURL, _ := url.Parse("https://app.example.com/")
+	validator := NewServiceTicketValidator(nil, casURL)
+
+	secret := []byte("hitchhiker")
+	keyFunc := func(alg, kid string) (interface{}, error) {
+		return secret, nil
+	}
+
+	claims := map[string]interface{}{
+		"sub":        "enoch.root",
+		"aud":        "https://app.example.com/",
+		"exp":        time.Now().Add(time.Minute).Unix(),
+		"lastLogin":  1700000000,
+		"employeeId": 9007199254740993,
+		"quota":      2.5,
+	}
+
+	success, err := validator.ValidateJWTTicket(context.Background(), serviceURL, signTestJWT(t, "HS256", secret, claims), keyFunc)
+	if err != nil {
+		t.Fatalf("Expected ValidateJWTTicket to succeed, got error: %v", err)
+	}
+
+	if v := success.Attributes.Get("lastLogin"); v != "1700000000" {
+		t.Errorf("Expected lastLogin attribute to be <1700000000>, got <%s>", v)
+	}
+
+	if v := success.Attributes.Get("employeeId"); v != "9007199254740993" {
+		t.Errorf("Expected employeeId attribute to be <9007199254740993>, got <%s>", v)
+	}
+
+	if v := success.Attributes.Get("quota"); v != "2.5" {
+		t.Errorf("Expected quota attribute to be <2.5>, got <%s>", v)
+	}
+}
@@ -0,0 +1,127 @@
+package cas
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"log/slog"
+	"net/http"
+	"strings"
+)
+
+// Cache events logged at Debug level by the Client for its ticket store
+const (
+	cacheHit   = "cache_hit"
+	cacheMiss  = "cache_miss"
+	cacheEvict = "cache_evict"
+)
+
+// NoopLogger returns a logger which discards all output.
+//
+// Pass it as the Logger of Options or RestOptions, or set it on a
+// ServiceTicketValidator, to silence the package entirely. Equivalent to
+// slog.New(slog.DiscardHandler).
+func NoopLogger() *slog.Logger {
+	return slog.New(slog.DiscardHandler)
+}
+
+// WithRequestID returns a copy of ctx carrying the request ID. Log lines emitted while
+// validating a ticket with the context include it as the request_id attribute.
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey, id)
+}
+
+// RequestIDFromContext returns the request ID of ctx, or an empty string if it has none.
+func RequestIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey).(string)
+	return id
+}
+
+// WithDebugLogging returns a copy of ctx for which the package logs at Debug level, whatever the
+// level of the logger, so the ticket and response details of a single failing validation can
+// be seen in production without enabling Debug for all of them.
+func WithDebugLogging(ctx context.Context) context.Context {
+	return context.WithValue(ctx, debugLoggingKey, true)
+}
+
+// requestLogger returns logger with the request ID of ctx, if any, as an attribute, logging at
+// Debug level if requested with WithDebugLogging.
+func requestLogger(logger *slog.Logger, ctx context.Context) *slog.Logger {
+	if debug, _ := ctx.Value(debugLoggingKey).(bool); debug {
+		if _, ok := logger.Handler().(debugHandler); !ok {
+			logger = slog.New(debugHandler{logger.Handler()})
+		}
+	}
+
+	if id := RequestIDFromContext(ctx); id != "" {
+		return logger.With(slog.String("request_id", id))
+	}
+
+	return logger
+}
+
+// debugHandler enables Debug records for a handler which may be configured with a higher level
+type debugHandler struct {
+	slog.Handler
+}
+
+// Enabled reports whether the handler handles records of the level
+func (h debugHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return level >= slog.LevelDebug || h.Handler.Enabled(ctx, level)
+}
+
+// WithAttrs returns a debugHandler of the handler with the attributes
+func (h debugHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return debugHandler{h.Handler.WithAttrs(attrs)}
+}
+
+// WithGroup returns a debugHandler of the handler with the group
+func (h debugHandler) WithGroup(name string) slog.Handler {
+	return debugHandler{h.Handler.WithGroup(name)}
+}
+
+// setRequestID copies the request ID from the named header to the context of r,
+// unless the context already carries one.
+func setRequestID(r *http.Request, header string) {
+	if header == "" || RequestIDFromContext(r.Context()) != "" {
+		return
+	}
+
+	if id := r.Header.Get(header); id != "" {
+		*r = *r.WithContext(WithRequestID(r.Context(), id))
+	}
+}
+
+// logCacheEvent logs a cache event for the ticket store key at Debug level. The key is a
+// ticket, so only a hash of it is logged. The size is included when the store reports it,
+// see MemoryStore.Len. Nothing is computed unless the logger has Debug enabled.
+func logCacheEvent(ctx context.Context, logger *slog.Logger, event string, store TicketStore, key string) {
+	logger = requestLogger(logger, ctx)
+	if !logger.Enabled(ctx, slog.LevelDebug) {
+		return
+	}
+
+	attrs := []slog.Attr{slog.String("event", event), slog.String("key_hash", cacheKeyHash(key))}
+	if s, ok := store.(interface{ Len() int }); ok {
+		attrs = append(attrs, slog.Int("size", s.Len()))
+	}
+
+	logger.LogAttrs(ctx, slog.LevelDebug, "cas: ticket store "+event, attrs...)
+}
+
+// redactedTicket identifies a ticket, or another secret such as a session ID, in logs by its
+// type prefix, like ST or PGT, and a hash, without revealing it.
+func redactedTicket(ticket string) string {
+	prefix := ""
+	if i := strings.IndexByte(ticket, '-'); i > 0 && i <= 8 {
+		prefix = ticket[:i+1]
+	}
+
+	return prefix + cacheKeyHash(ticket)
+}
+
+// cacheKeyHash returns a short, stable hash of key which identifies it in logs without revealing it
+func cacheKeyHash(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:8])
+}
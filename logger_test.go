@@ -0,0 +1,224 @@
+package cas
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestNoopLoggerSilencesPackage(t *testing.T) {
+	var buf bytes.Buffer
+	previous := slog.Default()
+	slog.SetDefault(slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug})))
+	defer slog.SetDefault(previous)
+
+	server := &TestServer{}
+	ticket := server.NewTicket("ST-l8d6b51d8e9c4569345a30e2f904626a1066384db8694784a60b515d62f6c")
+	ticket.Service = "http://example.com/"
+	ticket.Username = "enoch.root"
+	ticket.AttributesStyle = RubyCasAttributesStyle
+	ticket.Attributes.Add("admin", "--- !ruby/object {}")
+	ticket.Attributes.Add("account", "testing")
+	server.AddTicket(ticket)
+	defer server.Close()
+
+	ts := httptest.NewServer(server)
+	defer ts.Close()
+
+	u, _ := url.Parse(ts.URL)
+	client := NewClient(&Options{
+		URL:                 u,
+		Logger:              NoopLogger(),
+		AllowInsecureCasURL: true,
+	})
+
+	handler := client.HandleFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !IsAuthenticated(r) {
+			RedirectToLogin(w, r)
+			return
+		}
+
+		fmt.Fprintln(w, "Welcome, you are logged in")
+	})
+
+	for _, target := range []string{"http://example.com/", "http://example.com/?ticket=" + ticket.Name, "http://example.com/?ticket=ST-unknown"} {
+		req, err := http.NewRequest("GET", target, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	restClient := NewRestClient(&RestOptions{
+		CasURL:              u,
+		Client:              ts.Client(),
+		Logger:              NoopLogger(),
+		AllowInsecureCasURL: true,
+	})
+
+	restHandler := restClient.HandleFunc(func(w http.ResponseWriter, r *http.Request) {})
+	req, err := http.NewRequest("GET", "http://example.com/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req.SetBasicAuth("enoch.root", "secret")
+	restHandler.ServeHTTP(httptest.NewRecorder(), req)
+
+	if out := strings.TrimSpace(buf.String()); out != "" {
+		t.Errorf("Expected no output on the default logger, got:\n%s", out)
+	}
+}
+
+func TestRequestIDLogged(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&buf, nil))
+
+	server := &TestServer{}
+	ticket := server.NewTicket("ST-l8d6b51d8e9c4569345a30e2f904626a1066384db8694784a60b515d62f6c")
+	ticket.Service = "http://example.com/"
+	ticket.Username = "enoch.root"
+	server.AddTicket(ticket)
+	defer server.Close()
+
+	ts := httptest.NewServer(server)
+	defer ts.Close()
+
+	u, _ := url.Parse(ts.URL)
+	client := NewClient(&Options{
+		URL:                 u,
+		Logger:              logger,
+		AllowInsecureCasURL: true,
+		RequestIDHeader:     "X-Request-ID",
+	})
+
+	handler := client.HandleFunc(func(w http.ResponseWriter, r *http.Request) {})
+
+	req, err := http.NewRequest("GET", "http://example.com/?ticket="+ticket.Name, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req.Header.Set("X-Request-ID", "req-42")
+	buf.Reset()
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	for _, line := range lines {
+		if !strings.Contains(line, "request_id=req-42") {
+			t.Errorf("Expected log line to include the request ID, got:\n%s", line)
+		}
+	}
+
+	if !strings.Contains(buf.String(), "cas: validating ticket") {
+		t.Errorf("Expected the validation to be logged, got:\n%s", buf.String())
+	}
+
+	ctx := WithRequestID(req.Context(), "req-43")
+	if id := RequestIDFromContext(ctx); id != "req-43" {
+		t.Errorf("Expected RequestIDFromContext to be <req-43>, got <%s>", id)
+	}
+
+	if id := RequestIDFromContext(httptest.NewRequest("GET", "/", nil).Context()); id != "" {
+		t.Errorf("Expected no request ID by default, got <%s>", id)
+	}
+}
+
+func TestLogCacheEvent(t *testing.T) {
+	store := &MemoryStore{}
+	store.Write("ST-secret", &AuthenticationResponse{User: "enoch.root"})
+
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	logCacheEvent(context.Background(), logger, cacheHit, store, "ST-secret")
+
+	out := buf.String()
+	for _, want := range []string{"event=cache_hit", "key_hash=" + cacheKeyHash("ST-secret"), "size=1"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("Expected log to contain <%v>, got <%v>", want, out)
+		}
+	}
+
+	if strings.Contains(out, "ST-secret") {
+		t.Errorf("Expected log not to contain the raw key, got <%v>", out)
+	}
+
+	buf.Reset()
+	logger = slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{Level: slog.LevelInfo}))
+	logCacheEvent(context.Background(), logger, cacheMiss, store, "ST-secret")
+
+	if buf.Len() != 0 {
+		t.Errorf("Expected nothing to be logged above Debug level, got <%v>", buf.String())
+	}
+}
+
+func TestWithDebugLogging(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{Level: slog.LevelInfo}))
+
+	requestLogger(logger, context.Background()).Debug("cas: hidden")
+	if buf.Len() != 0 {
+		t.Errorf("Expected Debug to be disabled by default, got <%v>", buf.String())
+	}
+
+	ctx := WithDebugLogging(WithRequestID(context.Background(), "req-42"))
+	requestLogger(requestLogger(logger, ctx), ctx).Debug("cas: shown", slog.String("ticket", "ST-123"))
+
+	out := buf.String()
+	if !strings.Contains(out, "cas: shown") || !strings.Contains(out, "request_id=req-42") {
+		t.Errorf("Expected the Debug line with the request ID to be logged, got <%v>", out)
+	}
+}
+
+func TestTicketsNotLoggedAtInfo(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&buf, nil))
+
+	server := &TestServer{}
+	ticket := server.NewTicket("ST-l8d6b51d8e9c4569345a30e2f904626a1066384db8694784a60b515d62f6c")
+	ticket.Service = "http://example.com/"
+	ticket.Username = "enoch.root"
+	ticket.Attributes.Add("mail", "enoch@example.com")
+	server.AddTicket(ticket)
+	defer server.Close()
+
+	ts := httptest.NewServer(server)
+	defer ts.Close()
+
+	u, _ := url.Parse(ts.URL)
+	client := NewClient(&Options{
+		URL:                 u,
+		Logger:              logger,
+		AllowInsecureCasURL: true,
+	})
+
+	w := httptest.NewRecorder()
+	client.HandleFunc(func(w http.ResponseWriter, r *http.Request) {}).ServeHTTP(w, httptest.NewRequest("GET", "http://example.com/?ticket="+ticket.Name, nil))
+
+	out := buf.String()
+	if !strings.Contains(out, "cas: validating ticket") {
+		t.Fatalf("Expected the validation to be logged, got:\n%s", out)
+	}
+
+	secrets := []string{ticket.Name, "enoch@example.com"}
+	for _, c := range w.Result().Cookies() {
+		secrets = append(secrets, c.Value)
+	}
+
+	for _, secret := range secrets {
+		if strings.Contains(out, secret) {
+			t.Errorf("Expected <%s> not to be logged at Info, got:\n%s", secret, out)
+		}
+	}
+
+	if id := redactedTicket(ticket.Name); !strings.HasPrefix(id, "ST-") || !strings.Contains(out, id) {
+		t.Errorf("Expected the ticket to be logged as <%s>, got:\n%s", id, out)
+	}
+}
@@ -0,0 +1,25 @@
+package cas
+
+import (
+	"net/url"
+)
+
+// LoginOption modifies the query parameters of the CAS login URL.
+type LoginOption func(q url.Values)
+
+// WithWarn requests that CAS prompts the user before transparently
+// authenticating them to the service with an existing SSO session.
+func WithWarn() LoginOption {
+	return func(q url.Values) {
+		q.Set("warn", "true")
+	}
+}
+
+// WithRenew requests that CAS performs a primary authentication of the user, rather than
+// using an existing SSO session, such as for step up authentication. Validate the ticket
+// with RequireFreshLogin set to check that it was issued following a new login.
+func WithRenew() LoginOption {
+	return func(q url.Values) {
+		q.Set("renew", "true")
+	}
+}
@@ -3,10 +3,52 @@ package cas
 import (
 	"crypto/rand"
 	"encoding/xml"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
 	"strings"
 	"time"
 )
 
+// Single logout request errors
+var (
+	// The logoutRequest was issued outside the LogoutRequestMaxAge of the Client
+	ErrLogoutRequestExpired = errors.New("cas: logout request: issued outside the accepted window")
+
+	// The ID of the logoutRequest was already processed within the LogoutRequestMaxAge
+	ErrLogoutRequestReplay = errors.New("cas: logout request: replayed")
+
+	// The logoutRequest does not come from the CAS server and VerifyLogoutSource is set
+	ErrLogoutRequestSource = errors.New("cas: logout request: not sent by the CAS server")
+
+	// The logoutRequest is not a SAML LogoutRequest with a SessionIndex
+	ErrMalformedLogoutRequest = errors.New("cas: logout request: malformed")
+)
+
+// LogoutRequest is the single logout request the CAS server posts to the service as the
+// logoutRequest form parameter when the SSO session of the user ends.
+type LogoutRequest struct {
+	ID           string    // Identifier of the request
+	IssueInstant time.Time // When the CAS server issued the request
+	SessionIndex string    // Service ticket whose session ended
+}
+
+// ParseLogoutRequest parses the samlp:LogoutRequest XML of a single logout request. An error
+// wrapping ErrMalformedLogoutRequest is returned if it can not be parsed or has no SessionIndex.
+func ParseLogoutRequest(data []byte) (*LogoutRequest, error) {
+	l, err := parseLogoutRequest(data)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrMalformedLogoutRequest, err)
+	}
+
+	if l.SessionIndex == "" {
+		return nil, fmt.Errorf("%w: no SessionIndex", ErrMalformedLogoutRequest)
+	}
+
+	return &LogoutRequest{ID: l.ID, IssueInstant: l.IssueInstant, SessionIndex: l.SessionIndex}, nil
+}
+
 // Represents the XML CAS Single Log Out Request data
 type logoutRequest struct {
 	XMLName         xml.Name  `xml:"urn:oasis:names:tc:SAML:2.0:protocol LogoutRequest"`
@@ -36,6 +78,61 @@ func parseLogoutRequest(data []byte) (*logoutRequest, error) {
 	return l, nil
 }
 
+// checkLogoutRequest rejects a single logout request from another host than the CAS server when
+// VerifyLogoutSource is set, and a stale or replayed one when LogoutRequestMaxAge is set.
+func (c *Client) checkLogoutRequest(r *http.Request, l *logoutRequest) error {
+	if c.verifyLogoutSource {
+		if err := c.checkLogoutSource(r); err != nil {
+			return err
+		}
+	}
+
+	if c.logoutRequestIDs == nil {
+		return nil
+	}
+
+	if age := time.Since(l.IssueInstant); age > c.logoutRequestMaxAge || age < -c.logoutRequestMaxAge {
+		return fmt.Errorf("%w: issued at %v", ErrLogoutRequestExpired, l.IssueInstant)
+	}
+
+	if l.ID == "" {
+		return fmt.Errorf("%w: no ID", ErrLogoutRequestReplay)
+	}
+
+	if err := c.logoutRequestIDs.Check(l.ID); err != nil {
+		return fmt.Errorf("%w: ID %s", ErrLogoutRequestReplay, l.ID)
+	}
+
+	return nil
+}
+
+// checkLogoutSource reports whether the request comes from one of the addresses the host of the
+// CAS URL resolves to.
+func (c *Client) checkLogoutSource(r *http.Request) error {
+	if c.casURL == nil {
+		return fmt.Errorf("%w: no CAS URL to verify against", ErrLogoutRequestSource)
+	}
+
+	remote, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		remote = r.RemoteAddr
+	}
+
+	remoteIP := net.ParseIP(remote)
+	addrs, err := net.DefaultResolver.LookupHost(r.Context(), c.casURL.Hostname())
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrLogoutRequestSource, err)
+	}
+
+	for _, addr := range addrs {
+		if ip := net.ParseIP(addr); ip != nil && ip.Equal(remoteIP) {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("%w: from %s", ErrLogoutRequestSource, remote)
+}
+
 func parseDate(raw string) (time.Time, error) {
 	t, err := time.Parse(time.RFC1123Z, raw)
 	if err != nil {
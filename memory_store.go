@@ -51,6 +51,13 @@ func (s *MemoryStore) Delete(id string) error {
 	return nil
 }
 
+// Len returns the number of tickets stored
+func (s *MemoryStore) Len() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return len(s.store)
+}
+
 // Clear removes all ticket data
 func (s *MemoryStore) Clear() error {
 	s.mu.Lock()
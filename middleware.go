@@ -9,7 +9,8 @@ import (
 // If the user pass the authenticated check, it will call the h's ServeHTTP method
 func (c *Client) Handler(h http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		slog.Info("cas: handling request", slog.Any("method", r.Method), slog.Any("url", r.URL))
+		setRequestID(r, c.requestIDHeader)
+		requestLogger(c.logger, r.Context()).Info("cas: handling request", slog.Any("method", r.Method), slog.String("url", redactedURL(r.URL)))
 
 		setClient(r, c)
 
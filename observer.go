@@ -0,0 +1,50 @@
+package cas
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// Observer is notified of each ticket validation of a ServiceTicketValidator, for metrics such
+// as success rates and the latency of the CAS server. Its methods are called synchronously by
+// the validating goroutine, so they must be quick and safe for concurrent use.
+type Observer interface {
+	// ValidationStarted is called before the ticket for serviceURL is validated.
+	ValidationStarted(serviceURL *url.URL)
+
+	// ValidationCompleted is called once the validation succeeded or failed.
+	ValidationCompleted(o ValidationObservation)
+}
+
+// ValidationObservation describes a completed ticket validation for an Observer
+type ValidationObservation struct {
+	Duration     time.Duration           // How long the validation took, including any retries and fallback
+	Response     *AuthenticationResponse // Validated response, nil if the validation failed
+	Err          error                   // Error failing the validation, nil if it succeeded
+	StatusCode   int                     // Status code of the last response of the CAS server, zero if none was received
+	Cas1Fallback bool                    // Whether serviceValidate was not found and the CAS 1 validate endpoint was used
+}
+
+// withObservation returns a copy of ctx recording the status code and fallback of the
+// validation requested with it in o, see observeStatus and observeFallback.
+func withObservation(ctx context.Context, o *ValidationObservation) context.Context {
+	return context.WithValue(ctx, observationKey, o)
+}
+
+// observeStatus records the status code of the response to r for the Observer, if the
+// validation of its context is observed.
+func observeStatus(r *http.Request, resp *http.Response) {
+	if o, ok := r.Context().Value(observationKey).(*ValidationObservation); ok && resp != nil {
+		o.StatusCode = resp.StatusCode
+	}
+}
+
+// observeFallback records the CAS 1 fallback of the validation of ctx for the Observer, if it
+// is observed.
+func observeFallback(ctx context.Context) {
+	if o, ok := ctx.Value(observationKey).(*ValidationObservation); ok {
+		o.Cas1Fallback = true
+	}
+}
@@ -0,0 +1,101 @@
+package cas
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// recordingObserver records the observations of the validations
+type recordingObserver struct {
+	mu           sync.Mutex
+	started      []string
+	observations []ValidationObservation
+}
+
+func (o *recordingObserver) ValidationStarted(serviceURL *url.URL) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	o.started = append(o.started, serviceURL.String())
+}
+
+func (o *recordingObserver) ValidationCompleted(observation ValidationObservation) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	o.observations = append(o.observations, observation)
+}
+
+func TestValidatorObserver(t *testing.T) {
+	var cas1 bool
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case cas1 && strings.HasSuffix(r.URL.Path, "/serviceValidate"):
+			w.WriteHeader(http.StatusNotFound)
+		case cas1:
+			fmt.Fprint(w, "yes\nenoch.root\n")
+		case r.URL.Query().Get("ticket") == "ST-bad":
+			w.WriteHeader(http.StatusBadGateway)
+		default:
+			fmt.Fprint(w, `<cas:serviceResponse xmlns:cas="http://www.yale.edu/tp/cas">
+  <cas:authenticationSuccess>
+    <cas:user>enoch.root</cas:user>
+  </cas:authenticationSuccess>
+</cas:serviceResponse>`)
+		}
+	}))
+	defer server.Close()
+
+	observer := &recordingObserver{}
+	casURL, _ := url.Parse(server.URL)
+	validator := NewServiceTicketValidator(server.Client(), casURL)
+	validator.Logger = NoopLogger()
+	validator.ProtocolCacheTTL = -1
+	validator.Observer = observer
+
+	serviceURL, _ := url.Parse("https://example.com/")
+	if _, err := validator.ValidateTicket(serviceURL, "ST-123"); err != nil {
+		t.Fatalf("Expected ValidateTicket to succeed, got error: %v", err)
+	}
+
+	if _, err := validator.ValidateTicket(serviceURL, "ST-bad"); err == nil {
+		t.Fatalf("Expected ValidateTicket to fail")
+	}
+
+	cas1 = true
+	if _, err := validator.ValidateTicket(serviceURL, "ST-124"); err != nil {
+		t.Fatalf("Expected the CAS 1 fallback to succeed, got error: %v", err)
+	}
+
+	if len(observer.started) != 3 || observer.started[0] != "https://example.com/" {
+		t.Fatalf("Expected 3 validations of <https://example.com/> to start, got %v", observer.started)
+	}
+
+	if len(observer.observations) != 3 {
+		t.Fatalf("Expected 3 observations, got %d", len(observer.observations))
+	}
+
+	success, failure, fallback := observer.observations[0], observer.observations[1], observer.observations[2]
+	if success.Err != nil || success.Response == nil || success.StatusCode != http.StatusOK || success.Cas1Fallback {
+		t.Errorf("Expected a successful serviceValidate observation, got %+v", success)
+	}
+
+	if success.Duration <= 0 {
+		t.Errorf("Expected Duration to be positive, got %v", success.Duration)
+	}
+
+	var validationErr *ValidationError
+	if !errors.As(failure.Err, &validationErr) || failure.Response != nil || failure.StatusCode != http.StatusBadGateway {
+		t.Errorf("Expected a failed observation with status 502, got %+v", failure)
+	}
+
+	if fallback.Err != nil || !fallback.Cas1Fallback || fallback.StatusCode != http.StatusOK {
+		t.Errorf("Expected a CAS 1 fallback observation with status 200, got %+v", fallback)
+	}
+}
@@ -0,0 +1,117 @@
+package cas
+
+import (
+	"net/http"
+	"sync"
+	"time"
+)
+
+// DefaultProxyGrantingTicketTTL is how long a MemoryProxyGrantingTicketStore created with a zero
+// TTL keeps a proxy granting ticket which was not read
+const DefaultProxyGrantingTicketTTL = time.Minute
+
+// ProxyGrantingTicketStore keeps the proxy granting tickets the CAS server delivers to the proxy
+// callback, by their IOU, until the validation response carrying the IOU is read. Read consumes
+// the entry, so a proxy granting ticket is handed out once.
+//
+// Use a store shared by all instances, such as one backed by a key value store, when the proxy
+// callback may be served by another instance than the one validating the ticket.
+type ProxyGrantingTicketStore interface {
+	// Write stores the proxy granting ticket pgt under its IOU.
+	Write(iou, pgt string) error
+
+	// Read returns and removes the proxy granting ticket of the IOU. ok is false if the IOU is
+	// unknown or has expired.
+	Read(iou string) (pgt string, ok bool)
+}
+
+// MemoryProxyGrantingTicketStore is a ProxyGrantingTicketStore in memory, whose proxy granting
+// tickets expire after a TTL if they are not read.
+type MemoryProxyGrantingTicketStore struct {
+	ttl time.Duration
+
+	mu      sync.Mutex
+	tickets map[string]proxyGrantingTicket
+	now     func() time.Time
+}
+
+// proxyGrantingTicket is an entry of a MemoryProxyGrantingTicketStore
+type proxyGrantingTicket struct {
+	pgt     string
+	expires time.Time
+}
+
+// NewMemoryProxyGrantingTicketStore creates a MemoryProxyGrantingTicketStore keeping proxy
+// granting tickets for ttl, DefaultProxyGrantingTicketTTL if zero.
+func NewMemoryProxyGrantingTicketStore(ttl time.Duration) *MemoryProxyGrantingTicketStore {
+	if ttl <= 0 {
+		ttl = DefaultProxyGrantingTicketTTL
+	}
+
+	return &MemoryProxyGrantingTicketStore{
+		ttl:     ttl,
+		tickets: make(map[string]proxyGrantingTicket),
+		now:     time.Now,
+	}
+}
+
+// Write stores the proxy granting ticket under its IOU, removing those which expired.
+func (s *MemoryProxyGrantingTicketStore) Write(iou, pgt string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	for k, t := range s.tickets {
+		if !now.Before(t.expires) {
+			delete(s.tickets, k)
+		}
+	}
+
+	s.tickets[iou] = proxyGrantingTicket{pgt: pgt, expires: now.Add(s.ttl)}
+	return nil
+}
+
+// Read returns and removes the proxy granting ticket of the IOU, unless it has expired.
+func (s *MemoryProxyGrantingTicketStore) Read(iou string) (string, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	t, ok := s.tickets[iou]
+	delete(s.tickets, iou)
+
+	if !ok || !s.now().Before(t.expires) {
+		return "", false
+	}
+
+	return t.pgt, true
+}
+
+// NewProxyCallbackHandler returns the handler of the ProxyCallbackURL, which stores the proxy
+// granting tickets delivered by the CAS server as the pgtId and pgtIou parameters. Requests
+// without them, such as the check of the callback CAS makes first, are answered with 200 too.
+func NewProxyCallbackHandler(store ProxyGrantingTicketStore) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		iou, pgt := r.FormValue("pgtIou"), r.FormValue("pgtId")
+		if iou != "" && pgt != "" {
+			if err := store.Write(iou, pgt); err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+		}
+
+		w.WriteHeader(http.StatusOK)
+	})
+}
+
+// resolveProxyGrantingTicket sets the PGT of the response from the ProxyGrantingTickets of the
+// validator, if both are set, with the IOU of the response.
+func (validator *ServiceTicketValidator) resolveProxyGrantingTicket(success *AuthenticationResponse) bool {
+	iou := success.PGTIOU()
+	if validator.ProxyGrantingTickets == nil || iou == "" {
+		return true
+	}
+
+	pgt, ok := validator.ProxyGrantingTickets.Read(iou)
+	success.PGT = pgt
+	return ok
+}
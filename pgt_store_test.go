@@ -0,0 +1,83 @@
+package cas
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestMemoryProxyGrantingTicketStore(t *testing.T) {
+	store := NewMemoryProxyGrantingTicketStore(time.Minute)
+	now := time.Now()
+	store.now = func() time.Time { return now }
+
+	store.Write("PGTIOU-1", "PGT-1")
+	store.Write("PGTIOU-2", "PGT-2")
+
+	if pgt, ok := store.Read("PGTIOU-1"); !ok || pgt != "PGT-1" {
+		t.Errorf("Expected PGTIOU-1 to read <PGT-1>, got <%s> and <%v>", pgt, ok)
+	}
+
+	if _, ok := store.Read("PGTIOU-1"); ok {
+		t.Errorf("Expected a second read of PGTIOU-1 to fail")
+	}
+
+	now = now.Add(2 * time.Minute)
+	if _, ok := store.Read("PGTIOU-2"); ok {
+		t.Errorf("Expected PGTIOU-2 to have expired")
+	}
+
+	store.Write("PGTIOU-3", "PGT-3")
+	if n := len(store.tickets); n != 1 {
+		t.Errorf("Expected expired entries to be removed, got %d entries", n)
+	}
+}
+
+func TestValidateTicketProxyGrantingTickets(t *testing.T) {
+	store := NewMemoryProxyGrantingTicketStore(0)
+	callback := httptest.NewServer(NewProxyCallbackHandler(store))
+	defer callback.Close()
+
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("pgtUrl") == "" {
+			t.Errorf("Expected the pgtUrl parameter to be sent")
+		}
+
+		// CAS delivers the PGT to the callback before responding
+		resp, err := http.Get(callback.URL + "?pgtIou=PGTIOU-123&pgtId=PGT-123")
+		if err != nil {
+			t.Fatalf("Expected the callback to succeed, got error: %v", err)
+		}
+		resp.Body.Close()
+
+		fmt.Fprint(w, `<cas:serviceResponse xmlns:cas="http://www.yale.edu/tp/cas">
+  <cas:authenticationSuccess>
+    <cas:user>enoch.root</cas:user>
+    <cas:proxyGrantingTicket>PGTIOU-123</cas:proxyGrantingTicket>
+  </cas:authenticationSuccess>
+</cas:serviceResponse>`)
+	}))
+	defer server.Close()
+
+	casURL, _ := url.Parse(server.URL)
+	validator := NewServiceTicketValidator(server.Client(), casURL)
+	validator.ProxyCallbackURL, _ = url.Parse("https://example.com/pgtCallback")
+	validator.ProxyGrantingTickets = store
+	serviceURL, _ := url.Parse("http://example.com/")
+
+	success, err := validator.ValidateTicket(serviceURL, "ST-123")
+	if err != nil {
+		t.Fatalf("Expected ValidateTicket to succeed, got error: %v", err)
+	}
+
+	if success.PGTIOU() != "PGTIOU-123" || success.PGT != "PGT-123" {
+		t.Errorf("Expected the IOU to resolve to <PGT-123>, got <%s> for <%s>", success.PGT, success.PGTIOU())
+	}
+
+	if _, ok := store.Read("PGTIOU-123"); ok {
+		t.Errorf("Expected the validation to consume the proxy granting ticket")
+	}
+}
@@ -0,0 +1,81 @@
+package cas
+
+import "strings"
+
+// PrincipalMapping names the attributes from which a Principal is read. Each list is tried
+// in order, and an empty list uses the names of DefaultPrincipalMapping.
+type PrincipalMapping struct {
+	DisplayName []string // Attributes holding the display name of the user
+	Email       []string // Attributes holding the email address of the user
+	Groups      []string // Attributes holding groups, in addition to MemberOf
+}
+
+// DefaultPrincipalMapping is used for the fields of a PrincipalMapping which are empty, and
+// when ServiceTicketValidator.PrincipalMapping is nil.
+var DefaultPrincipalMapping = PrincipalMapping{
+	DisplayName: []string{"displayName", "cn", "name"},
+	Email:       []string{"mail", "email"},
+	Groups:      []string{"groups"},
+}
+
+// Principal is the authenticated user of an AuthenticationResponse, with its common identity
+// attributes read through a PrincipalMapping. The raw Attributes remain on the response.
+type Principal struct {
+	r       *AuthenticationResponse
+	mapping *PrincipalMapping
+}
+
+// Principal returns the authenticated user of the response, read with the PrincipalMapping
+// of the validator which validated the ticket, or the DefaultPrincipalMapping.
+func (r *AuthenticationResponse) Principal() Principal {
+	return Principal{r: r, mapping: r.principalMapping}
+}
+
+// ID returns the identifier of the user, the User of the response.
+func (p Principal) ID() string {
+	return p.r.User
+}
+
+// DisplayName returns the display name of the user, or an empty string.
+func (p Principal) DisplayName() string {
+	return p.first(p.names(func(m *PrincipalMapping) []string { return m.DisplayName }))
+}
+
+// Email returns the email address of the user, or an empty string.
+func (p Principal) Email() string {
+	return p.first(p.names(func(m *PrincipalMapping) []string { return m.Email }))
+}
+
+// Groups returns the MemberOf groups of the user followed by those of the group attributes,
+// without duplicates.
+func (p Principal) Groups() []string {
+	groups := append([]string(nil), p.r.MemberOf...)
+	for _, name := range p.names(func(m *PrincipalMapping) []string { return m.Groups }) {
+		groups = append(groups, p.r.Attributes[name]...)
+	}
+
+	return uniqueStrings(groups)
+}
+
+// names returns the attribute names of the field of the mapping, or of the default mapping
+// when it is empty.
+func (p Principal) names(field func(m *PrincipalMapping) []string) []string {
+	if p.mapping != nil {
+		if names := field(p.mapping); len(names) > 0 {
+			return names
+		}
+	}
+
+	return field(&DefaultPrincipalMapping)
+}
+
+// first returns the first non-empty value of the named attributes.
+func (p Principal) first(names []string) string {
+	for _, name := range names {
+		if v := strings.TrimSpace(p.r.Attributes.Get(name)); v != "" {
+			return v
+		}
+	}
+
+	return ""
+}
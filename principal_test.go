@@ -0,0 +1,43 @@
+package cas
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+func TestAuthenticationResponsePrincipal(t *testing.T) {
+	r := &AuthenticationResponse{
+		User:     "enoch.root",
+		MemberOf: []string{"staff"},
+		Attributes: UserAttributes{
+			"cn":        {"Enoch Root"},
+			"givenName": {"Enoch"},
+			"mail":      {"enoch@example.com"},
+			"groups":    {"staff", "admin"},
+		},
+	}
+
+	p := r.Principal()
+	if p.ID() != "enoch.root" || p.DisplayName() != "Enoch Root" || p.Email() != "enoch@example.com" {
+		t.Errorf("Expected the default mapping to be used, got <%s>, <%s> and <%s>", p.ID(), p.DisplayName(), p.Email())
+	}
+
+	if groups := p.Groups(); !reflect.DeepEqual(groups, []string{"staff", "admin"}) {
+		t.Errorf("Expected Groups to be <[staff admin]>, got %v", groups)
+	}
+
+	validator := &ServiceTicketValidator{PrincipalMapping: &PrincipalMapping{DisplayName: []string{"givenName"}}}
+	if err := validator.processResponse(context.Background(), nil, r); err != nil {
+		t.Fatalf("Expected processResponse to succeed, got error: %v", err)
+	}
+
+	p = r.Principal()
+	if p.DisplayName() != "Enoch" || p.Email() != "enoch@example.com" {
+		t.Errorf("Expected the mapping of the validator to be used, got <%s> and <%s>", p.DisplayName(), p.Email())
+	}
+
+	if empty := (&AuthenticationResponse{User: "someone"}).Principal(); empty.DisplayName() != "" || len(empty.Groups()) != 0 {
+		t.Errorf("Expected a response without attributes to have no display name or groups")
+	}
+}
@@ -0,0 +1,106 @@
+package cas
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// Probe errors
+var (
+	// DetectProtocol found none of the validation endpoints on the CAS server.
+	ErrNoValidationEndpoint = errors.New("cas: detect protocol: no validation endpoint found")
+)
+
+// protocolEndpoints are the validation endpoints probed by DetectProtocol, newest first
+var protocolEndpoints = []struct {
+	endpoint string
+	version  ProtocolVersion
+}{
+	{"p3/serviceValidate", ProtocolVersion3},
+	{"serviceValidate", ProtocolVersion2},
+	{"validate", ProtocolVersion1},
+}
+
+// DetectProtocol determines the newest version of the CAS protocol the server supports, by
+// checking which validation endpoints exist. No ticket is sent, so the CAS server does not
+// look up or log a dummy ticket.
+//
+// The endpoints are probed with HEAD requests, falling back to GET for a server which does not
+// support HEAD. An endpoint exists unless it responds with 404 Not Found or 410 Gone. A CAS 1
+// only result is cached like one determined by a validation, see ProtocolCacheTTL.
+func (validator *ServiceTicketValidator) DetectProtocol(ctx context.Context) (ProtocolVersion, error) {
+	for _, p := range protocolEndpoints {
+		status, err := validator.probe(ctx, p.endpoint)
+		if err != nil {
+			return ProtocolVersionUnknown, err
+		}
+
+		if status == http.StatusNotFound || status == http.StatusGone {
+			continue
+		}
+
+		if p.version == ProtocolVersion1 {
+			validator.cacheProtocolVersion(ProtocolVersion1)
+		}
+
+		return p.version, nil
+	}
+
+	return ProtocolVersionUnknown, ErrNoValidationEndpoint
+}
+
+// Ping checks that the CAS server is reachable and serves its login page, for health checks.
+// Like DetectProtocol it sends a HEAD request, falling back to GET if HEAD is not supported.
+func (validator *ServiceTicketValidator) Ping(ctx context.Context) error {
+	status, err := validator.probe(ctx, "login")
+	if err != nil {
+		return err
+	}
+
+	if status >= 400 {
+		u := joinURLPath(validator.currentCasURL(), "login")
+		return newValidationError(u, status, fmt.Errorf("unexpected status code %d", status))
+	}
+
+	return nil
+}
+
+// probe returns the status code of a HEAD request to the endpoint relative to the CAS URL, or
+// of a GET request if the server responds to HEAD with 405 Method Not Allowed or 501 Not
+// Implemented. A status code of 500 or above, other than those, is returned as an error.
+func (validator *ServiceTicketValidator) probe(ctx context.Context, endpoint string) (int, error) {
+	u := joinURLPath(validator.currentCasURL(), endpoint)
+
+	var status int
+	for _, method := range []string{"HEAD", "GET"} {
+		r, err := http.NewRequestWithContext(ctx, method, u.String(), nil)
+		if err != nil {
+			return 0, err
+		}
+
+		r.Header.Add("User-Agent", validator.userAgent())
+		setDefaultHeaders(r, validator.DefaultHeaders)
+
+		resp, err := validator.client.Do(r)
+		if err != nil {
+			return 0, requestError(r, err)
+		}
+
+		io.Copy(io.Discard, io.LimitReader(resp.Body, 1<<16))
+		resp.Body.Close()
+
+		status = resp.StatusCode
+		if status != http.StatusMethodNotAllowed && status != http.StatusNotImplemented {
+			break
+		}
+	}
+
+	if status >= 500 {
+		return 0, newValidationError(u, status, fmt.Errorf("unexpected status code %d", status))
+	}
+
+	return status, nil
+}
@@ -0,0 +1,117 @@
+package cas
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"sync/atomic"
+	"testing"
+)
+
+func TestDetectProtocol(t *testing.T) {
+	var requests []string
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.Method+" "+r.URL.Path)
+		if r.URL.RawQuery != "" {
+			t.Errorf("Expected no query to be sent, got <%s>", r.URL.RawQuery)
+		}
+
+		switch {
+		case r.URL.Path == "/serviceValidate" && r.Method == "HEAD":
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		case r.URL.Path == "/serviceValidate":
+			w.WriteHeader(http.StatusOK)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	casURL, _ := url.Parse(server.URL)
+	validator := NewServiceTicketValidator(server.Client(), casURL)
+
+	version, err := validator.DetectProtocol(context.Background())
+	if err != nil {
+		t.Fatalf("Expected DetectProtocol to succeed, got error: %v", err)
+	}
+
+	if version != ProtocolVersion2 {
+		t.Errorf("Expected version to be <%v>, got <%v>", ProtocolVersion2, version)
+	}
+
+	expected := []string{"HEAD /p3/serviceValidate", "HEAD /serviceValidate", "GET /serviceValidate"}
+	if !reflect.DeepEqual(requests, expected) {
+		t.Errorf("Expected requests to be <%v>, got <%v>", expected, requests)
+	}
+}
+
+func TestDetectProtocolCas1(t *testing.T) {
+	var probes int32
+	server := newCas1Server(&probes)
+	defer server.Close()
+
+	casURL, _ := url.Parse(server.URL)
+	validator := NewServiceTicketValidator(server.Client(), casURL)
+
+	version, err := validator.DetectProtocol(context.Background())
+	if err != nil {
+		t.Fatalf("Expected DetectProtocol to succeed, got error: %v", err)
+	}
+
+	if version != ProtocolVersion1 {
+		t.Errorf("Expected version to be <%v>, got <%v>", ProtocolVersion1, version)
+	}
+
+	serviceURL, _ := url.Parse("http://example.com/")
+	if _, err := validator.ValidateTicket(serviceURL, "ST-123"); err != nil {
+		t.Fatalf("Expected ValidateTicket to succeed, got error: %v", err)
+	}
+
+	if n := atomic.LoadInt32(&probes); n != 1 {
+		t.Errorf("Expected serviceValidate to be probed once by DetectProtocol only, got %d", n)
+	}
+}
+
+func TestDetectProtocolNoEndpoint(t *testing.T) {
+	server := httptest.NewTLSServer(http.NotFoundHandler())
+	defer server.Close()
+
+	casURL, _ := url.Parse(server.URL)
+	validator := NewServiceTicketValidator(server.Client(), casURL)
+
+	if _, err := validator.DetectProtocol(context.Background()); !errors.Is(err, ErrNoValidationEndpoint) {
+		t.Errorf("Expected error to be <%v>, got <%v>", ErrNoValidationEndpoint, err)
+	}
+}
+
+func TestPing(t *testing.T) {
+	var methods []string
+	status := http.StatusOK
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		methods = append(methods, r.Method)
+		w.WriteHeader(status)
+	}))
+	defer server.Close()
+
+	casURL, _ := url.Parse(server.URL)
+	validator := NewServiceTicketValidator(server.Client(), casURL)
+
+	if err := validator.Ping(context.Background()); err != nil {
+		t.Errorf("Expected Ping to succeed, got error: %v", err)
+	}
+
+	if !reflect.DeepEqual(methods, []string{"HEAD"}) {
+		t.Errorf("Expected a single HEAD request, got <%v>", methods)
+	}
+
+	status = http.StatusServiceUnavailable
+	err := validator.Ping(context.Background())
+
+	var validationErr *ValidationError
+	if !errors.As(err, &validationErr) || validationErr.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("Expected a ValidationError with status code 503, got <%v>", err)
+	}
+}
@@ -0,0 +1,120 @@
+package cas
+
+import (
+	"fmt"
+	"time"
+)
+
+// ProtocolVersion identifies a version of the CAS protocol
+type ProtocolVersion int
+
+// ProtocolVersion values
+const (
+	ProtocolVersionUnknown ProtocolVersion = iota
+	ProtocolVersion1
+	ProtocolVersion2
+	ProtocolVersion3
+)
+
+// String returns the name of the ProtocolVersion
+func (v ProtocolVersion) String() string {
+	switch v {
+	case ProtocolVersionUnknown:
+		return "unknown"
+	case ProtocolVersion1:
+		return "CAS 1.0"
+	case ProtocolVersion2:
+		return "CAS 2.0"
+	case ProtocolVersion3:
+		return "CAS 3.0"
+	default:
+		return fmt.Sprintf("ProtocolVersion(%d)", int(v))
+	}
+}
+
+// DefaultProtocolCacheTTL is how long a CAS 1 only determination is cached when
+// ServiceTicketValidator.ProtocolCacheTTL is zero.
+const DefaultProtocolCacheTTL = time.Hour
+
+// InvalidateProtocolCache forgets the cached protocol version, so the next validation
+// probes the serviceValidate endpoint again. Use it after upgrading the CAS server rather
+// than waiting for the ProtocolCacheTTL to expire. StoreProtocolVersion, if set, is called
+// with ProtocolVersionUnknown to clear the persisted version as well.
+func (validator *ServiceTicketValidator) InvalidateProtocolCache() {
+	validator.mu.Lock()
+	validator.protocolVersion = ProtocolVersionUnknown
+	validator.protocolExpires = time.Time{}
+	validator.mu.Unlock()
+
+	if validator.StoreProtocolVersion != nil {
+		validator.StoreProtocolVersion(ProtocolVersionUnknown)
+	}
+}
+
+// protocolCacheTTL returns the effective ProtocolCacheTTL, negative when caching is disabled.
+func (validator *ServiceTicketValidator) protocolCacheTTL() time.Duration {
+	if validator.ProtocolCacheTTL == 0 {
+		return DefaultProtocolCacheTTL
+	}
+
+	return validator.ProtocolCacheTTL
+}
+
+// cachedProtocolVersion returns the cached protocol version, or ProtocolVersionUnknown if
+// nothing is cached or the cached value has expired.
+func (validator *ServiceTicketValidator) cachedProtocolVersion() ProtocolVersion {
+	validator.loadProtocolVersion()
+
+	validator.mu.Lock()
+	defer validator.mu.Unlock()
+
+	if validator.protocolVersion != ProtocolVersionUnknown && time.Now().After(validator.protocolExpires) {
+		validator.protocolVersion = ProtocolVersionUnknown
+	}
+
+	return validator.protocolVersion
+}
+
+// loadProtocolVersion restores the persisted protocol version with LoadProtocolVersion. It is
+// only called once, for the first validation of the validator.
+func (validator *ServiceTicketValidator) loadProtocolVersion() {
+	if validator.LoadProtocolVersion == nil || validator.protocolCacheTTL() < 0 {
+		return
+	}
+
+	validator.mu.Lock()
+	loaded := validator.protocolLoaded
+	validator.protocolLoaded = true
+	validator.mu.Unlock()
+
+	if loaded {
+		return
+	}
+
+	if version, ok := validator.LoadProtocolVersion(); ok && version != ProtocolVersionUnknown {
+		validator.setProtocolVersion(version, validator.protocolCacheTTL())
+	}
+}
+
+// cacheProtocolVersion records the protocol version determined for the CAS server and
+// persists it with StoreProtocolVersion, if set.
+func (validator *ServiceTicketValidator) cacheProtocolVersion(version ProtocolVersion) {
+	ttl := validator.protocolCacheTTL()
+	if ttl < 0 {
+		return
+	}
+
+	validator.setProtocolVersion(version, ttl)
+
+	if validator.StoreProtocolVersion != nil {
+		validator.StoreProtocolVersion(version)
+	}
+}
+
+// setProtocolVersion caches version in memory for ttl.
+func (validator *ServiceTicketValidator) setProtocolVersion(version ProtocolVersion, ttl time.Duration) {
+	validator.mu.Lock()
+	validator.protocolVersion = version
+	validator.protocolExpires = time.Now().Add(ttl)
+	validator.mu.Unlock()
+}
@@ -0,0 +1,277 @@
+package cas
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func newCas1Server(probes *int32) *httptest.Server {
+	return httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/serviceValidate":
+			atomic.AddInt32(probes, 1)
+			http.NotFound(w, r)
+		case "/validate":
+			fmt.Fprint(w, "yes\nenoch.root\n")
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+}
+
+func TestProtocolVersionCache(t *testing.T) {
+	var probes int32
+	server := newCas1Server(&probes)
+	defer server.Close()
+
+	casURL, _ := url.Parse(server.URL)
+	validator := NewServiceTicketValidator(server.Client(), casURL)
+	serviceURL, _ := url.Parse("http://example.com/")
+
+	for i := 0; i < 3; i++ {
+		success, err := validator.ValidateTicket(serviceURL, "ST-123")
+		if err != nil {
+			t.Fatalf("Expected ValidateTicket to succeed, got error: %v", err)
+		}
+
+		if success.User != "enoch.root" {
+			t.Errorf("Expected User to be <enoch.root>, got <%s>", success.User)
+		}
+	}
+
+	if n := atomic.LoadInt32(&probes); n != 1 {
+		t.Errorf("Expected serviceValidate to be probed once, got %d", n)
+	}
+
+	validator.InvalidateProtocolCache()
+	if _, err := validator.ValidateTicket(serviceURL, "ST-123"); err != nil {
+		t.Fatalf("Expected ValidateTicket to succeed, got error: %v", err)
+	}
+
+	if n := atomic.LoadInt32(&probes); n != 2 {
+		t.Errorf("Expected serviceValidate to be probed again after invalidation, got %d", n)
+	}
+}
+
+func TestProtocolVersionCacheTTL(t *testing.T) {
+	var probes int32
+	server := newCas1Server(&probes)
+	defer server.Close()
+
+	casURL, _ := url.Parse(server.URL)
+	validator := NewServiceTicketValidator(server.Client(), casURL)
+	validator.ProtocolCacheTTL = 20 * time.Millisecond
+	serviceURL, _ := url.Parse("http://example.com/")
+
+	validator.ValidateTicket(serviceURL, "ST-123")
+	validator.ValidateTicket(serviceURL, "ST-123")
+	time.Sleep(30 * time.Millisecond)
+	validator.ValidateTicket(serviceURL, "ST-123")
+
+	if n := atomic.LoadInt32(&probes); n != 2 {
+		t.Errorf("Expected serviceValidate to be probed again after the TTL, got %d", n)
+	}
+
+	validator.ProtocolCacheTTL = -1
+	validator.InvalidateProtocolCache()
+	validator.ValidateTicket(serviceURL, "ST-123")
+	validator.ValidateTicket(serviceURL, "ST-123")
+
+	if n := atomic.LoadInt32(&probes); n != 4 {
+		t.Errorf("Expected every validation to probe with the cache disabled, got %d", n)
+	}
+}
+
+func TestProtocolVersionPersistence(t *testing.T) {
+	var probes int32
+	server := newCas1Server(&probes)
+	defer server.Close()
+
+	casURL, _ := url.Parse(server.URL)
+	serviceURL, _ := url.Parse("http://example.com/")
+
+	stored := ProtocolVersionUnknown
+	store := func(v ProtocolVersion) { stored = v }
+
+	// A cold start with nothing persisted probes and stores the version
+	validator := NewServiceTicketValidator(server.Client(), casURL)
+	validator.LoadProtocolVersion = func() (ProtocolVersion, bool) { return stored, stored != ProtocolVersionUnknown }
+	validator.StoreProtocolVersion = store
+
+	if _, err := validator.ValidateTicket(serviceURL, "ST-123"); err != nil {
+		t.Fatalf("Expected ValidateTicket to succeed, got error: %v", err)
+	}
+
+	if stored != ProtocolVersion1 {
+		t.Errorf("Expected <%v> to be stored, got <%v>", ProtocolVersion1, stored)
+	}
+
+	// The next cold start restores the version without probing
+	loads := 0
+	validator = NewServiceTicketValidator(server.Client(), casURL)
+	validator.LoadProtocolVersion = func() (ProtocolVersion, bool) {
+		loads++
+		return stored, stored != ProtocolVersionUnknown
+	}
+	validator.StoreProtocolVersion = store
+
+	for i := 0; i < 2; i++ {
+		if _, err := validator.ValidateTicket(serviceURL, "ST-123"); err != nil {
+			t.Fatalf("Expected ValidateTicket to succeed, got error: %v", err)
+		}
+	}
+
+	if n := atomic.LoadInt32(&probes); n != 1 {
+		t.Errorf("Expected serviceValidate to be probed once across both starts, got %d", n)
+	}
+
+	if loads != 1 {
+		t.Errorf("Expected LoadProtocolVersion to be called once, got %d", loads)
+	}
+
+	validator.InvalidateProtocolCache()
+	if stored != ProtocolVersionUnknown {
+		t.Errorf("Expected invalidation to clear the stored version, got <%v>", stored)
+	}
+}
+
+func TestRequireAttributesWithCas1(t *testing.T) {
+	var probes int32
+	server := newCas1Server(&probes)
+	defer server.Close()
+
+	casURL, _ := url.Parse(server.URL)
+	validator := NewServiceTicketValidator(server.Client(), casURL)
+	serviceURL, _ := url.Parse("http://example.com/")
+
+	success, err := validator.ValidateTicket(serviceURL, "ST-123")
+	if err != nil {
+		t.Fatalf("Expected ValidateTicket to succeed, got error: %v", err)
+	}
+
+	if success.ProtocolVersion != ProtocolVersion1 {
+		t.Errorf("Expected ProtocolVersion to be <%v>, got <%v>", ProtocolVersion1, success.ProtocolVersion)
+	}
+
+	validator.RequireAttributes = true
+	if _, err := validator.ValidateTicket(serviceURL, "ST-123"); err != ErrAttributesUnavailable {
+		t.Errorf("Expected error with a cached protocol version to be <%v>, got <%v>", ErrAttributesUnavailable, err)
+	}
+
+	validator.InvalidateProtocolCache()
+	if _, err := validator.ValidateTicket(serviceURL, "ST-123"); err != ErrAttributesUnavailable {
+		t.Errorf("Expected error after the fallback to be <%v>, got <%v>", ErrAttributesUnavailable, err)
+	}
+}
+
+func TestSetCasURL(t *testing.T) {
+	var probes int32
+	old := newCas1Server(&probes)
+	defer old.Close()
+
+	upgraded := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/serviceValidate" {
+			http.NotFound(w, r)
+			return
+		}
+
+		fmt.Fprint(w, `<cas:serviceResponse xmlns:cas="http://www.yale.edu/tp/cas">
+  <cas:authenticationSuccess>
+    <cas:user>upgraded.root</cas:user>
+  </cas:authenticationSuccess>
+</cas:serviceResponse>`)
+	}))
+	defer upgraded.Close()
+
+	casURL, _ := url.Parse(old.URL)
+	validator := NewServiceTicketValidator(old.Client(), casURL)
+	serviceURL, _ := url.Parse("http://example.com/")
+
+	if _, err := validator.ValidateTicket(serviceURL, "ST-123"); err != nil {
+		t.Fatalf("Expected ValidateTicket to succeed, got error: %v", err)
+	}
+
+	if v := validator.cachedProtocolVersion(); v != ProtocolVersion1 {
+		t.Fatalf("Expected the protocol version to be cached as <%v>, got <%v>", ProtocolVersion1, v)
+	}
+
+	newURL, _ := url.Parse(upgraded.URL)
+	validator.SetCasURL(newURL)
+
+	success, err := validator.ValidateTicket(serviceURL, "ST-456")
+	if err != nil {
+		t.Fatalf("Expected ValidateTicket to succeed against the new server, got error: %v", err)
+	}
+
+	if success.User != "upgraded.root" {
+		t.Errorf("Expected User to be <upgraded.root>, got <%s>", success.User)
+	}
+}
+
+func TestValidateTicketProtocolVersion(t *testing.T) {
+	var paths []string
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.URL.Path)
+
+		switch r.URL.Path {
+		case "/p3/serviceValidate":
+			fmt.Fprint(w, `<cas:serviceResponse xmlns:cas="http://www.yale.edu/tp/cas">
+  <cas:authenticationSuccess>
+    <cas:user>enoch.root</cas:user>
+    <cas:attributes><cas:mail>enoch@example.com</cas:mail></cas:attributes>
+  </cas:authenticationSuccess>
+</cas:serviceResponse>`)
+		case "/validate":
+			fmt.Fprint(w, "yes\nenoch.root\n")
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	casURL, _ := url.Parse(server.URL)
+	serviceURL, _ := url.Parse("https://example.com/")
+
+	for _, tc := range []struct {
+		version ProtocolVersion
+		paths   []string
+		mail    string
+		err     error
+	}{
+		{ProtocolVersion3, []string{"/p3/serviceValidate"}, "enoch@example.com", nil},
+		{ProtocolVersion2, []string{"/serviceValidate"}, "", ErrProtocolVersionUnsupported},
+		{ProtocolVersion1, []string{"/validate"}, "", nil},
+		{ProtocolVersionUnknown, []string{"/serviceValidate", "/validate"}, "", nil},
+	} {
+		paths = nil
+		validator := New(casURL, WithHTTPClient(server.Client()), WithLogger(NoopLogger()), WithProtocolVersion(tc.version))
+
+		success, err := validator.ValidateTicket(serviceURL, "ST-123")
+		if !errors.Is(err, tc.err) {
+			t.Errorf("Expected %v error to be <%v>, got <%v>", tc.version, tc.err, err)
+		}
+
+		if !reflect.DeepEqual(paths, tc.paths) {
+			t.Errorf("Expected %v to request %v, got %v", tc.version, tc.paths, paths)
+		}
+
+		if tc.err == nil && (success == nil || success.Attributes.Get("mail") != tc.mail) {
+			t.Errorf("Expected %v to release mail <%s>, got %+v", tc.version, tc.mail, success)
+		}
+	}
+
+	validator := NewServiceTicketValidator(server.Client(), casURL)
+	validator.ProtocolVersion = ProtocolVersion3
+	u, _ := validator.ServiceValidateUrl(serviceURL, "ST-123")
+	if !strings.HasPrefix(u, server.URL+"/p3/serviceValidate?") {
+		t.Errorf("Expected ServiceValidateUrl to use p3/serviceValidate, got <%s>", u)
+	}
+}
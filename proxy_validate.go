@@ -0,0 +1,189 @@
+package cas
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync/atomic"
+)
+
+// ProxyValidateUrl creates the proxy ticket validation url for the cas >= 2 protocol.
+func (validator *ServiceTicketValidator) ProxyValidateUrl(serviceURL *url.URL, ticket string) (string, error) {
+	return validator.validationURL("proxyValidate", validator.serviceString(serviceURL), ticket)
+}
+
+// P3ProxyValidateUrl creates the proxy ticket validation url for the cas 3 protocol, whose
+// response includes the attributes of the user as well as the proxies.
+func (validator *ServiceTicketValidator) P3ProxyValidateUrl(serviceURL *url.URL, ticket string) (string, error) {
+	return validator.validationURL("p3/proxyValidate", validator.serviceString(serviceURL), ticket)
+}
+
+// ProxyUrl creates the url of the proxy endpoint, which issues a proxy ticket for the target
+// service with the proxy granting ticket. The target service is encoded as the service of a
+// validation, so a proxy ticket validated by the target service matches.
+func (validator *ServiceTicketValidator) ProxyUrl(pgt string, targetService string) (string, error) {
+	target, err := url.Parse(targetService)
+	if err != nil {
+		return "", err
+	}
+
+	u, err := validator.endpointURL("proxy", pgt)
+	if err != nil {
+		return "", err
+	}
+
+	q := u.Query()
+	q.Add("pgt", pgt)
+	q.Add("targetService", validator.serviceString(target))
+	u.RawQuery = q.Encode()
+
+	return u.String(), nil
+}
+
+// ValidateProxyTicket validates a proxy ticket, or a service ticket, presented to a proxied
+// back-end service. The Proxies of the response list the proxy chain, nearest first.
+//
+// p3/proxyValidate is used when the ProtocolVersion of the validator is ProtocolVersion3, and
+// proxyValidate otherwise. Unlike ValidateTicket there is no CAS 1 fallback.
+func (validator *ServiceTicketValidator) ValidateProxyTicket(serviceURL *url.URL, ticket string) (*AuthenticationResponse, error) {
+	return validator.ValidateProxyTicketContext(context.Background(), serviceURL, ticket)
+}
+
+// ValidateProxyTicketContext is ValidateProxyTicket with the request to the CAS server bound to ctx.
+func (validator *ServiceTicketValidator) ValidateProxyTicketContext(ctx context.Context, serviceURL *url.URL, ticket string) (*AuthenticationResponse, error) {
+	if atomic.LoadInt32(&validator.draining) != 0 {
+		return nil, ErrDraining
+	}
+
+	return validator.validate(ctx, serviceURL, ticket, validator.validateProxyTicket)
+}
+
+// validateProxyTicket performs the request against the proxyValidate endpoint of the protocol version.
+func (validator *ServiceTicketValidator) validateProxyTicket(ctx context.Context, serviceURL *url.URL, ticket string) (*AuthenticationResponse, error) {
+	logger := requestLogger(validator.logger(), ctx)
+
+	endpoint := "proxyValidate"
+	if validator.ProtocolVersion == ProtocolVersion3 {
+		endpoint = "p3/proxyValidate"
+	}
+
+	u, err := validator.validationURL(endpoint, validator.serviceParameter(ctx, serviceURL), ticket)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := validator.requestValidation(ctx, logger, u)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode == http.StatusNotFound {
+		resp.Body.Close()
+		return nil, newValidationError(resp.Request.URL, resp.StatusCode, ErrProxyValidationUnsupported)
+	}
+
+	success, err := validator.readServiceResponse(logger, resp)
+	if err != nil {
+		return nil, err
+	}
+
+	if validator.MaxProxyDepth > 0 && success != nil && len(success.Proxies) > validator.MaxProxyDepth {
+		return nil, fmt.Errorf("%w: %d proxies, at most %d allowed", ErrProxyChainTooDeep, len(success.Proxies), validator.MaxProxyDepth)
+	}
+
+	return success, nil
+}
+
+// xmlProxyResponse is the response of the proxy endpoint
+type xmlProxyResponse struct {
+	XMLName xml.Name `xml:"http://www.yale.edu/tp/cas serviceResponse"`
+
+	Success *struct {
+		ProxyTicket string `xml:"proxyTicket"`
+	} `xml:"proxySuccess"`
+
+	Failure *struct {
+		Code    string `xml:"code,attr"`
+		Message string `xml:",innerxml"`
+	} `xml:"proxyFailure"`
+}
+
+// RequestProxyTicket requests a proxy ticket for the target service from the proxy endpoint with
+// the proxy granting ticket pgt, such as the PGT of a response validated with a
+// ProxyCallbackURL. The target service validates the proxy ticket with ValidateProxyTicket, and
+// can itself obtain a proxy granting ticket, extending the proxy chain.
+//
+// A proxyFailure response, such as for an expired proxy granting ticket, is returned as an
+// *AuthenticationError.
+func (validator *ServiceTicketValidator) RequestProxyTicket(ctx context.Context, pgt string, targetService string) (string, error) {
+	logger := requestLogger(validator.logger(), ctx)
+
+	u, err := validator.ProxyUrl(pgt, targetService)
+	if err != nil {
+		return "", err
+	}
+
+	r, err := http.NewRequestWithContext(ctx, "GET", u, nil)
+	if err != nil {
+		return "", err
+	}
+
+	if err := requireHTTPS(r.URL, validator.AllowInsecureCasURL); err != nil {
+		return "", err
+	}
+
+	r.Header.Add("User-Agent", validator.userAgent())
+	setDefaultHeaders(r, validator.DefaultHeaders)
+
+	// The URL is not logged, its pgt parameter grants tickets for the user
+	logger.Info("cas: requesting proxy ticket", slog.Any("targetService", targetService))
+
+	resp, err := validator.do(r)
+	if err != nil {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return "", ctxErr
+		}
+
+		return "", proxyError(0, err)
+	}
+
+	body, err := io.ReadAll(validator.responseBody(resp))
+	resp.Body.Close()
+	if err != nil {
+		return "", proxyError(resp.StatusCode, err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return "", proxyError(resp.StatusCode, fmt.Errorf("unexpected status code %d: %s", resp.StatusCode, body))
+	}
+
+	var x xmlProxyResponse
+	if err := xml.Unmarshal(body, &x); err != nil {
+		return "", proxyError(resp.StatusCode, err)
+	}
+
+	if x.Failure != nil {
+		return "", &AuthenticationError{Code: strings.TrimSpace(x.Failure.Code), Message: strings.TrimSpace(x.Failure.Message)}
+	}
+
+	if x.Success == nil || strings.TrimSpace(x.Success.ProxyTicket) == "" {
+		return "", proxyError(resp.StatusCode, ErrNoProxyTicket)
+	}
+
+	return strings.TrimSpace(x.Success.ProxyTicket), nil
+}
+
+// proxyError returns a ValidationError for the proxy endpoint, without its URL as it holds the
+// proxy granting ticket.
+func proxyError(statusCode int, err error) *ValidationError {
+	if urlErr, ok := err.(*url.Error); ok {
+		err = urlErr.Err
+	}
+
+	return &ValidationError{Endpoint: "proxy", StatusCode: statusCode, Err: err}
+}
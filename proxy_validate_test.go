@@ -0,0 +1,191 @@
+package cas
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"testing"
+)
+
+func TestValidateProxyTicket(t *testing.T) {
+	var paths []string
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.URL.Path)
+
+		attributes := ""
+		if r.URL.Path == "/cas/p3/proxyValidate" {
+			attributes = "<cas:attributes><cas:mail>enoch@example.com</cas:mail></cas:attributes>"
+		}
+
+		fmt.Fprintf(w, `<cas:serviceResponse xmlns:cas="http://www.yale.edu/tp/cas">
+  <cas:authenticationSuccess>
+    <cas:user>enoch.root</cas:user>
+    %s
+    <cas:proxies>
+      <cas:proxy>https://front.example.com/pgtCallback</cas:proxy>
+      <cas:proxy>https://portal.example.com/pgtCallback</cas:proxy>
+    </cas:proxies>
+  </cas:authenticationSuccess>
+</cas:serviceResponse>`, attributes)
+	}))
+	defer server.Close()
+
+	casURL, _ := url.Parse(server.URL + "/cas/")
+	validator := NewServiceTicketValidator(server.Client(), casURL)
+	serviceURL, _ := url.Parse("https://api.example.com/")
+
+	for _, version := range []ProtocolVersion{ProtocolVersion2, ProtocolVersion3} {
+		validator.ProtocolVersion = version
+
+		success, err := validator.ValidateProxyTicket(serviceURL, "PT-123")
+		if err != nil {
+			t.Fatalf("Expected ValidateProxyTicket to succeed, got error: %v", err)
+		}
+
+		expected := []string{"https://front.example.com/pgtCallback", "https://portal.example.com/pgtCallback"}
+		if !reflect.DeepEqual(success.Proxies, expected) {
+			t.Errorf("Expected Proxies to be %v, got %v", expected, success.Proxies)
+		}
+
+		mail := success.Attributes.Get("mail")
+		if version == ProtocolVersion3 && mail != "enoch@example.com" {
+			t.Errorf("Expected p3 attributes to be parsed, got <%s>", mail)
+		}
+	}
+
+	expected := []string{"/cas/proxyValidate", "/cas/p3/proxyValidate"}
+	if !reflect.DeepEqual(paths, expected) {
+		t.Errorf("Expected requests to %v, got %v", expected, paths)
+	}
+}
+
+func TestValidateProxyTicketMaxProxyDepth(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `<cas:serviceResponse xmlns:cas="http://www.yale.edu/tp/cas">
+  <cas:authenticationSuccess>
+    <cas:user>enoch.root</cas:user>
+    <cas:proxies>
+      <cas:proxy>https://front.example.com/pgtCallback</cas:proxy>
+      <cas:proxy>https://portal.example.com/pgtCallback</cas:proxy>
+    </cas:proxies>
+  </cas:authenticationSuccess>
+</cas:serviceResponse>`)
+	}))
+	defer server.Close()
+
+	casURL, _ := url.Parse(server.URL + "/cas/")
+	validator := NewServiceTicketValidator(server.Client(), casURL)
+	serviceURL, _ := url.Parse("https://api.example.com/")
+
+	validator.MaxProxyDepth = 2
+	if _, err := validator.ValidateProxyTicket(serviceURL, "PT-123"); err != nil {
+		t.Errorf("Expected a chain of two proxies to be accepted, got error: %v", err)
+	}
+
+	validator.MaxProxyDepth = 1
+	if _, err := validator.ValidateProxyTicket(serviceURL, "PT-123"); !errors.Is(err, ErrProxyChainTooDeep) {
+		t.Errorf("Expected error to be <%v>, got <%v>", ErrProxyChainTooDeep, err)
+	}
+}
+
+func TestProxyUrl(t *testing.T) {
+	casURL, _ := url.Parse("https://cas.example.com/cas/")
+	validator := NewServiceTicketValidator(http.DefaultClient, casURL)
+
+	targets := map[string]string{
+		"https://api.example.com/":                   "https://api.example.com/",
+		"https://api.example.com/search?q=a+b&x=1":   "https://api.example.com/search?q=a+b&x=1",
+		"https://api.example.com/?ticket=ST-1&x=%2F": "https://api.example.com/?x=%2F",
+	}
+
+	for target, service := range targets {
+		s, err := validator.ProxyUrl("PGT-123", target)
+		if err != nil {
+			t.Fatalf("Expected ProxyUrl to succeed for %s, got error: %v", target, err)
+		}
+
+		u, _ := url.Parse(s)
+		if u.Path != "/cas/proxy" {
+			t.Errorf("Expected the proxy endpoint for %s, got <%s>", target, u.Path)
+		}
+
+		q := u.Query()
+		if q.Get("pgt") != "PGT-123" {
+			t.Errorf("Expected pgt to be <PGT-123>, got <%s>", q.Get("pgt"))
+		}
+
+		if got := q.Get("targetService"); got != service {
+			t.Errorf("Expected targetService for %s to be <%s>, got <%s>", target, service, got)
+		}
+
+		serviceURL, _ := url.Parse(target)
+		if got := q.Get("targetService"); got != sanitisedURLString(serviceURL) {
+			t.Errorf("Expected targetService for %s to be encoded as the service, got <%s>", target, got)
+		}
+	}
+}
+
+func TestValidateProxyTicketUnsupported(t *testing.T) {
+	var paths []string
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.URL.Path)
+		http.NotFound(w, r)
+	}))
+	defer server.Close()
+
+	casURL, _ := url.Parse(server.URL + "/cas/")
+	validator := NewServiceTicketValidator(server.Client(), casURL)
+	validator.Logger = NoopLogger()
+	serviceURL, _ := url.Parse("https://api.example.com/")
+
+	_, err := validator.ValidateProxyTicket(serviceURL, "PT-123")
+	if !errors.Is(err, ErrProxyValidationUnsupported) {
+		t.Errorf("Expected error to be <%v>, got <%v>", ErrProxyValidationUnsupported, err)
+	}
+
+	if !reflect.DeepEqual(paths, []string{"/cas/proxyValidate"}) {
+		t.Errorf("Expected no fallback to CAS 1, got requests to %v", paths)
+	}
+}
+
+func TestRequestProxyTicket(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		if r.URL.Path != "/cas/proxy" || q.Get("targetService") != "https://api.example.com/" {
+			t.Errorf("Unexpected proxy request %s", r.URL)
+		}
+
+		if q.Get("pgt") != "PGT-123" {
+			fmt.Fprint(w, `<cas:serviceResponse xmlns:cas="http://www.yale.edu/tp/cas">
+  <cas:proxyFailure code="INVALID_TICKET">pgt PGT-456 not recognized</cas:proxyFailure>
+</cas:serviceResponse>`)
+			return
+		}
+
+		fmt.Fprint(w, `<cas:serviceResponse xmlns:cas="http://www.yale.edu/tp/cas">
+  <cas:proxySuccess>
+    <cas:proxyTicket>PT-957-ZuucXqTZ1YcJw81T3dxf</cas:proxyTicket>
+  </cas:proxySuccess>
+</cas:serviceResponse>`)
+	}))
+	defer server.Close()
+
+	casURL, _ := url.Parse(server.URL + "/cas/")
+	validator := NewServiceTicketValidator(server.Client(), casURL)
+	validator.Logger = NoopLogger()
+
+	pt, err := validator.RequestProxyTicket(context.Background(), "PGT-123", "https://api.example.com/")
+	if err != nil || pt != "PT-957-ZuucXqTZ1YcJw81T3dxf" {
+		t.Errorf("Expected proxy ticket <PT-957-ZuucXqTZ1YcJw81T3dxf>, got <%s> and error <%v>", pt, err)
+	}
+
+	_, err = validator.RequestProxyTicket(context.Background(), "PGT-456", "https://api.example.com/")
+	var authErr *AuthenticationError
+	if !errors.As(err, &authErr) || authErr.Code != INVALID_TICKET {
+		t.Errorf("Expected an INVALID_TICKET AuthenticationError, got <%v>", err)
+	}
+}
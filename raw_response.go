@@ -0,0 +1,41 @@
+package cas
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+)
+
+// ValidateTicketRaw is ValidateTicketContext also returning the body of the validation response
+// exactly as the CAS server sent it, for applications which must retain the authoritative
+// response of each authentication. The body is returned with an authentication failure too,
+// and is nil if no response was read, such as when DeduplicateValidations shares the result
+// of a validation made by another caller.
+func (validator *ServiceTicketValidator) ValidateTicketRaw(ctx context.Context, serviceURL *url.URL, ticket string) (*AuthenticationResponse, []byte, error) {
+	var raw []byte
+	ctx = context.WithValue(ctx, rawResponseKey, &raw)
+
+	success, err := validator.ValidateTicketContext(ctx, serviceURL, ticket)
+	return success, raw, err
+}
+
+// captureRequested reports whether the validation of resp was started by ValidateTicketRaw.
+func captureRequested(resp *http.Response) bool {
+	if resp.Request == nil {
+		return false
+	}
+
+	_, ok := resp.Request.Context().Value(rawResponseKey).(*[]byte)
+	return ok
+}
+
+// captureResponse records body for ValidateTicketRaw, if it started the validation of resp.
+func captureResponse(resp *http.Response, body []byte) {
+	if resp.Request == nil {
+		return
+	}
+
+	if raw, ok := resp.Request.Context().Value(rawResponseKey).(*[]byte); ok {
+		*raw = body
+	}
+}
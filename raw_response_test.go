@@ -0,0 +1,59 @@
+package cas
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+func TestValidateTicketRaw(t *testing.T) {
+	success := "<cas:serviceResponse xmlns:cas=\"http://www.yale.edu/tp/cas\">\n" +
+		"  <cas:authenticationSuccess>\n" +
+		"    <cas:user>enoch.root</cas:user>\n" +
+		"  </cas:authenticationSuccess>\n" +
+		"</cas:serviceResponse>\n"
+	failure := "<cas:serviceResponse xmlns:cas=\"http://www.yale.edu/tp/cas\">\n" +
+		"  <cas:authenticationFailure code=\"INVALID_TICKET\">Ticket ST-unknown not recognized</cas:authenticationFailure>\n" +
+		"</cas:serviceResponse>\n"
+
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/xml")
+		if r.URL.Query().Get("ticket") == "ST-123" {
+			w.Write([]byte(success))
+		} else {
+			w.Write([]byte(failure))
+		}
+	}))
+	defer server.Close()
+
+	casURL, _ := url.Parse(server.URL)
+	validator := NewServiceTicketValidator(server.Client(), casURL)
+	validator.StrictParsing = true
+	serviceURL, _ := url.Parse("http://example.com/")
+
+	r, raw, err := validator.ValidateTicketRaw(context.Background(), serviceURL, "ST-123")
+	if err != nil {
+		t.Fatalf("Expected ValidateTicketRaw to succeed, got error: %v", err)
+	}
+
+	if r.User != "enoch.root" {
+		t.Errorf("Expected User to be <enoch.root>, got <%s>", r.User)
+	}
+
+	if string(raw) != success {
+		t.Errorf("Expected raw response to be <%s>, got <%s>", success, raw)
+	}
+
+	_, raw, err = validator.ValidateTicketRaw(context.Background(), serviceURL, "ST-unknown")
+	var authErr *AuthenticationError
+	if !errors.As(err, &authErr) {
+		t.Errorf("Expected an authentication error, got <%v>", err)
+	}
+
+	if string(raw) != failure {
+		t.Errorf("Expected raw response to be <%s>, got <%s>", failure, raw)
+	}
+}
@@ -0,0 +1,61 @@
+package cas
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// ReplayGuard errors
+var (
+	// The ticket was already presented for validation within the ReplayGuard window
+	ErrTicketReplay = errors.New("cas: validate ticket: ticket replayed")
+)
+
+// DefaultReplayWindow is the window of a ReplayGuard created with a zero TTL
+const DefaultReplayWindow = 5 * time.Minute
+
+// ReplayGuard records the tickets presented for validation and rejects a ticket presented again
+// within the TTL with ErrTicketReplay, without a request to the CAS server. CAS tickets are
+// single use, so this does not change which validations succeed, but a retried request fails
+// locally and clearly instead of with an INVALID_TICKET error from the server.
+type ReplayGuard struct {
+	ttl time.Duration
+
+	mu      sync.Mutex
+	tickets map[string]time.Time
+	now     func() time.Time
+}
+
+// NewReplayGuard creates a ReplayGuard remembering tickets for ttl, DefaultReplayWindow if zero.
+func NewReplayGuard(ttl time.Duration) *ReplayGuard {
+	if ttl <= 0 {
+		ttl = DefaultReplayWindow
+	}
+
+	return &ReplayGuard{
+		ttl:     ttl,
+		tickets: make(map[string]time.Time),
+		now:     time.Now,
+	}
+}
+
+// Check records the ticket, returning ErrTicketReplay if it was already recorded within the TTL.
+func (g *ReplayGuard) Check(ticket string) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	now := g.now()
+	for t, expires := range g.tickets {
+		if !now.Before(expires) {
+			delete(g.tickets, t)
+		}
+	}
+
+	if _, ok := g.tickets[ticket]; ok {
+		return ErrTicketReplay
+	}
+
+	g.tickets[ticket] = now.Add(g.ttl)
+	return nil
+}
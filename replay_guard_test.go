@@ -0,0 +1,65 @@
+package cas
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestReplayGuard(t *testing.T) {
+	var requests int32
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		w.Write([]byte(`<cas:serviceResponse xmlns:cas="http://www.yale.edu/tp/cas">
+  <cas:authenticationSuccess>
+    <cas:user>enoch.root</cas:user>
+  </cas:authenticationSuccess>
+</cas:serviceResponse>`))
+	}))
+	defer server.Close()
+
+	casURL, _ := url.Parse(server.URL)
+	validator := NewServiceTicketValidator(server.Client(), casURL)
+	validator.ReplayGuard = NewReplayGuard(time.Minute)
+
+	serviceURL, _ := url.Parse("https://example.com/")
+	if _, err := validator.ValidateTicket(serviceURL, "ST-1"); err != nil {
+		t.Fatalf("Expected ValidateTicket to succeed, got error: %v", err)
+	}
+
+	if _, err := validator.ValidateTicket(serviceURL, "ST-1"); !errors.Is(err, ErrTicketReplay) {
+		t.Errorf("Expected error to be <%v>, got <%v>", ErrTicketReplay, err)
+	}
+
+	if n := atomic.LoadInt32(&requests); n != 1 {
+		t.Errorf("Expected the CAS server to be called <1> time, got <%d>", n)
+	}
+
+	if _, err := validator.ValidateTicket(serviceURL, "ST-2"); err != nil {
+		t.Errorf("Expected another ticket to be validated, got error: %v", err)
+	}
+}
+
+func TestReplayGuardExpiry(t *testing.T) {
+	now := time.Now()
+	guard := NewReplayGuard(time.Minute)
+	guard.now = func() time.Time { return now }
+
+	if err := guard.Check("ST-1"); err != nil {
+		t.Fatalf("Expected the first check to succeed, got error: %v", err)
+	}
+
+	now = now.Add(30 * time.Second)
+	if err := guard.Check("ST-1"); err != ErrTicketReplay {
+		t.Errorf("Expected error within the window to be <%v>, got <%v>", ErrTicketReplay, err)
+	}
+
+	now = now.Add(time.Minute)
+	if err := guard.Check("ST-1"); err != nil {
+		t.Errorf("Expected the ticket to be forgotten after the window, got error: %v", err)
+	}
+}
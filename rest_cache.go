@@ -0,0 +1,78 @@
+package cas
+
+import (
+	"sync"
+	"time"
+)
+
+// authenticationCache keeps the responses of successful REST authentications by the hash of
+// their credentials for a TTL, so a client sending the same credentials with each request is
+// authenticated against the CAS server once per TTL.
+type authenticationCache struct {
+	ttl time.Duration
+
+	mu        sync.Mutex
+	responses map[string]cachedAuthentication
+	now       func() time.Time
+}
+
+// cachedAuthentication is an entry of an authenticationCache
+type cachedAuthentication struct {
+	response *AuthenticationResponse
+	expires  time.Time
+}
+
+// newAuthenticationCache creates an authenticationCache keeping responses for ttl, or returns
+// nil, which caches nothing, if ttl is not positive.
+func newAuthenticationCache(ttl time.Duration) *authenticationCache {
+	if ttl <= 0 {
+		return nil
+	}
+
+	return &authenticationCache{
+		ttl:       ttl,
+		responses: make(map[string]cachedAuthentication),
+		now:       time.Now,
+	}
+}
+
+// get returns a copy marked FromCache of the response cached for the key, unless it expired.
+func (c *authenticationCache) get(key string) (*AuthenticationResponse, bool) {
+	if c == nil {
+		return nil, false
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, ok := c.responses[key]
+	if !ok {
+		return nil, false
+	}
+
+	if !c.now().Before(entry.expires) {
+		delete(c.responses, key)
+		return nil, false
+	}
+
+	return cachedResponse(entry.response), true
+}
+
+// put caches the response for the key, removing the entries which expired.
+func (c *authenticationCache) put(key string, response *AuthenticationResponse) {
+	if c == nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := c.now()
+	for k, entry := range c.responses {
+		if !now.Before(entry.expires) {
+			delete(c.responses, k)
+		}
+	}
+
+	c.responses[key] = cachedAuthentication{response: response, expires: now.Add(c.ttl)}
+}
@@ -1,12 +1,39 @@
 package cas
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"io"
 	"log/slog"
 	"net/http"
 	"net/url"
 	"path"
+	"strings"
+	"time"
+)
+
+// RestClient errors
+var (
+	// The AuthenticationTimeout was exhausted before the REST authentication chain completed
+	ErrRestAuthenticationTimeout = errors.New("cas: rest authentication: deadline exceeded")
+
+	// The CAS server rejected the username and password
+	ErrInvalidCredentials = errors.New("cas: rest: invalid credentials")
+
+	// The request has no HTTP Basic Authentication credentials
+	ErrMissingCredentials = errors.New("cas: rest: missing credentials")
+
+	// The request has an Authorization header which is not valid HTTP Basic Authentication.
+	// It wraps ErrMissingCredentials, as the request is handled like one without credentials.
+	ErrMalformedCredentials = fmt.Errorf("%w: malformed authorization header", ErrMissingCredentials)
+
+	// The TGT is unknown to the CAS server, answered with 404 or 410, usually because it expired,
+	// and the caller must request a new one with the user's credentials
+	ErrTicketGrantingTicketExpired = errors.New("cas: rest: ticket granting ticket expired")
+
+	// A service ticket was requested without a service URL, neither passed nor in RestOptions
+	ErrMissingServiceURL = errors.New("cas: rest: no service URL")
 )
 
 // https://apereo.github.io/cas/4.2.x/protocol/REST-Protocol.html
@@ -17,31 +44,171 @@ type TicketGrantingTicket string
 // ServiceTicket stands for the access granted by the CAS server to an application for a specific user, also known as ST
 type ServiceTicket string
 
+// RestTicketClient requests and validates tickets with the CAS REST protocol on behalf of the
+// handler of a RestClient. *RestClient is the default implementation, alternatives can be
+// supplied to RestOptions, for example to fake the CAS server in handler tests.
+type RestTicketClient interface {
+	// RequestGrantingTicketContext exchanges the credentials of a user for a TGT.
+	RequestGrantingTicketContext(ctx context.Context, username string, password string) (TicketGrantingTicket, error)
+
+	// RequestServiceTicketContext requests a service ticket for the service with the TGT.
+	RequestServiceTicketContext(ctx context.Context, tgt TicketGrantingTicket) (ServiceTicket, error)
+
+	// ValidateServiceTicketContext validates the service ticket for the service.
+	ValidateServiceTicketContext(ctx context.Context, st ServiceTicket) (*AuthenticationResponse, error)
+}
+
 // RestOptions provide options for the RestClient
 type RestOptions struct {
 	CasURL     *url.URL
 	ServiceURL *url.URL
 	Client     *http.Client
 	URLScheme  URLScheme
+	Logger     *slog.Logger    // Custom logger, if nil slog.Default() will be used
+	Validator  TicketValidator // Custom ticket validator, if nil a ServiceTicketValidator will be used
+
+	// TicketClient, if set, performs the TGT, ST and validation requests of Handle in place of
+	// the RestClient, which then only provides the handler.
+	TicketClient RestTicketClient
+
+	// AllowInsecureCasURL permits requests to a non-https URL, for local development only.
+	// Credentials and tickets are sent in cleartext.
+	AllowInsecureCasURL bool
+
+	// PrincipalMapper normalises each validated response, see ServiceTicketValidator. It is
+	// applied by the default validator, or by the RestClient to the responses of a custom Validator.
+	PrincipalMapper func(*AuthenticationResponse) error
+
+	// AuthenticationTimeout bounds the whole TGT, ST and validation chain performed by Handle
+	// for each request. Zero means only the timeouts of the http.Client apply.
+	AuthenticationTimeout time.Duration
+
+	// ServiceTicketRetries is how many times Handle requests a new service ticket with the same
+	// TGT when validation fails with INVALID_TICKET, as the ticket can expire between being
+	// issued and validated under latency or clock skew. Zero retries once and a negative value
+	// disables retrying.
+	ServiceTicketRetries int
+
+	// OnAuthFailure, if set, writes the response to a request which is not authenticated,
+	// with ErrMissingCredentials or the error rejecting the credentials, instead of the default
+	// 401 with a WWW-Authenticate challenge. Browsers can be redirected to a login page or shown
+	// a branded error this way.
+	OnAuthFailure func(w http.ResponseWriter, r *http.Request, err error)
+
+	// OnMissingCredentials, if set, replaces OnAuthFailure for a request without credentials, with
+	// ErrMissingCredentials or ErrMalformedCredentials, for example to answer the latter with 400.
+	OnMissingCredentials func(w http.ResponseWriter, r *http.Request, err error)
+
+	// OnInvalidCredentials, if set, replaces OnAuthFailure for a request whose credentials were
+	// rejected by the CAS server, for example to answer with a JSON error body.
+	OnInvalidCredentials func(w http.ResponseWriter, r *http.Request, err error)
+
+	// CredentialHash derives the key identifying the credentials of a request to Handle, such as
+	// in a cache, so the password is never kept or compared as is. If nil, an HMAC-SHA256 with a random
+	// key of the process is used, see NewHMACCredentialHash for a key of your own.
+	CredentialHash func(username, password string) string
+
+	// AuthenticationCacheTTL, if set, is how long Handle keeps the response of a successful
+	// authentication and reuses it for requests with the same credentials, instead of
+	// requesting a TGT, a service ticket and validating it for each request. Entries are keyed
+	// by the CredentialHash and expire on the wall clock, so revoking or changing a password
+	// takes effect within the TTL. Failed authentications are never cached. Zero disables the
+	// cache, 60 seconds suits most deployments.
+	AuthenticationCacheTTL time.Duration
+
+	// CacheGrantingTickets keeps the TGT requested by Handle or RequestServiceTicketForCredentials
+	// for the credentials of a user, keyed by the CredentialHash, and requests the service tickets
+	// of later requests with it instead of a new TGT. A TGT the CAS server no longer knows is
+	// replaced once, transparently. TGTs are kept for the GrantingTicketTTL.
+	CacheGrantingTickets bool
+
+	// GrantingTicketTTL is how long a TGT is kept with CacheGrantingTickets, counted from when it
+	// was requested, DefaultGrantingTicketTTL if zero. Set it below the TGT timeout of the CAS
+	// server, so unused TGTs are dropped rather than kept for the life of the process.
+	GrantingTicketTTL time.Duration
+
+	// Counters, if set, counts REST authentications and is passed to the default validator.
+	Counters *ExpvarCounters
+
+	// RequestIDHeader names a header whose value is logged as request_id, see Options.
+	RequestIDHeader string
+
+	// DefaultHeaders are sent with every request to the CAS server, and passed to the default
+	// validator, see ServiceTicketValidator.
+	DefaultHeaders http.Header
+
+	// UserAgent and RetryPolicy configure the requests to the CAS server, and are passed to the
+	// default validator, see ServiceTicketValidator.
+	UserAgent   string
+	RetryPolicy *RetryPolicy
+
+	// Observer, if set, is passed to the default validator, which notifies it of the validation
+	// of each service ticket, see ServiceTicketValidator.
+	Observer Observer
 }
 
 // RestClient uses the rest protocol provided by cas
 type RestClient struct {
-	urlScheme   URLScheme
-	serviceURL  *url.URL
-	client      *http.Client
-	stValidator *ServiceTicketValidator
+	urlScheme  URLScheme
+	serviceURL *url.URL
+	client     *http.Client
+	logger     *slog.Logger
+	validator  TicketValidator
+	tickets    RestTicketClient
+
+	principalMapper func(*AuthenticationResponse) error // PrincipalMapper of a custom Validator, nil for the default one
+
+	counters *ExpvarCounters
+
+	allowInsecureCasURL   bool
+	authenticationTimeout time.Duration
+	serviceTicketRetries  int
+	onAuthFailure         func(w http.ResponseWriter, r *http.Request, err error)
+	onMissingCredentials  func(w http.ResponseWriter, r *http.Request, err error)
+	onInvalidCredentials  func(w http.ResponseWriter, r *http.Request, err error)
+	requestIDHeader       string
+	credentialHash        func(username, password string) string
+	defaultHeaders        http.Header
+	userAgent             string
+	retryPolicy           *RetryPolicy
+	authentications       *authenticationCache // nil unless AuthenticationCacheTTL is set
+	grantingTickets       *grantingTicketCache // nil unless CacheGrantingTickets is set
+}
+
+// NewCheckedRestClient creates a new client for the cas rest protocol like NewRestClient,
+// returning ErrMissingCasURL without a CasURL, and ErrInsecureCasURL if the CasURL does not use
+// https unless AllowInsecureCasURL is set, as credentials would be sent in cleartext.
+func NewCheckedRestClient(options *RestOptions) (*RestClient, error) {
+	if err := checkCasURL(options.CasURL, options.AllowInsecureCasURL); err != nil {
+		return nil, err
+	}
+
+	return NewRestClient(options), nil
 }
 
 // NewRestClient creates a new client for the cas rest protocol with the provided options
+//
+// Without a CasURL, or with one which does not use https unless AllowInsecureCasURL is set, a
+// warning is logged and requests fail. Use NewCheckedRestClient to fail setup instead.
 func NewRestClient(options *RestOptions) *RestClient {
-	slog.Info("cas: new rest client with options", slog.Any("options", options))
+	var logger *slog.Logger
+	if options.Logger != nil {
+		logger = options.Logger
+	} else {
+		logger = slog.Default()
+	}
+
+	logger.Info("cas: new rest client", slog.Any("url", options.CasURL))
+
+	if err := checkCasURL(options.CasURL, options.AllowInsecureCasURL); err != nil {
+		logger.Warn("cas: CAS URL is missing or does not use https, rest requests will fail", slog.Any("url", options.CasURL))
+	}
 
 	var client *http.Client
 	if options.Client != nil {
 		client = options.Client
 	} else {
-		client = &http.Client{}
+		client = NewHTTPClient(nil)
 	}
 
 	var urlScheme URLScheme
@@ -51,12 +218,68 @@ func NewRestClient(options *RestOptions) *RestClient {
 		urlScheme = NewDefaultURLScheme(options.CasURL)
 	}
 
-	return &RestClient{
-		urlScheme:   urlScheme,
-		serviceURL:  options.ServiceURL,
-		client:      client,
-		stValidator: NewServiceTicketValidator(client, options.CasURL),
+	var validator TicketValidator
+	var principalMapper func(*AuthenticationResponse) error
+	if options.Validator != nil {
+		validator = options.Validator
+		principalMapper = options.PrincipalMapper
+	} else {
+		stValidator := NewServiceTicketValidator(client, options.CasURL)
+		stValidator.Logger = logger
+		stValidator.AllowInsecureCasURL = options.AllowInsecureCasURL
+		stValidator.PrincipalMapper = options.PrincipalMapper
+		stValidator.Counters = options.Counters
+		stValidator.DefaultHeaders = options.DefaultHeaders
+		stValidator.UserAgent = options.UserAgent
+		stValidator.RetryPolicy = options.RetryPolicy
+		stValidator.Observer = options.Observer
+		validator = stValidator
 	}
+
+	serviceTicketRetries := options.ServiceTicketRetries
+	if serviceTicketRetries == 0 {
+		serviceTicketRetries = 1
+	} else if serviceTicketRetries < 0 {
+		serviceTicketRetries = 0
+	}
+
+	credentialHash := options.CredentialHash
+	if credentialHash == nil {
+		credentialHash = defaultCredentialHash
+	}
+
+	c := &RestClient{
+		urlScheme:  urlScheme,
+		serviceURL: options.ServiceURL,
+		client:     client,
+		logger:     logger,
+		validator:  validator,
+		counters:   options.Counters,
+
+		principalMapper: principalMapper,
+
+		allowInsecureCasURL:   options.AllowInsecureCasURL,
+		authenticationTimeout: options.AuthenticationTimeout,
+		serviceTicketRetries:  serviceTicketRetries,
+		onAuthFailure:         options.OnAuthFailure,
+		onMissingCredentials:  options.OnMissingCredentials,
+		onInvalidCredentials:  options.OnInvalidCredentials,
+		requestIDHeader:       options.RequestIDHeader,
+		credentialHash:        credentialHash,
+		defaultHeaders:        options.DefaultHeaders,
+		userAgent:             options.UserAgent,
+		retryPolicy:           options.RetryPolicy,
+		authentications:       newAuthenticationCache(options.AuthenticationCacheTTL),
+		grantingTickets:       newGrantingTicketCache(options.CacheGrantingTickets, options.GrantingTicketTTL),
+	}
+
+	if options.TicketClient != nil {
+		c.tickets = options.TicketClient
+	} else {
+		c.tickets = c
+	}
+
+	return c
 }
 
 // Handle wraps a http.Handler to provide CAS Rest authentication for the handler.
@@ -72,8 +295,14 @@ func (c *RestClient) HandleFunc(h func(http.ResponseWriter, *http.Request)) http
 	return c.Handle(http.HandlerFunc(h))
 }
 
-// RequestGrantingTicket returns a new TGT, if the username and password authentication was successful
+// RequestGrantingTicket returns a new TGT, if the username and password authentication was successful.
+// The TGT can be kept and passed to RequestServiceTicketWithTGT until it expires.
 func (c *RestClient) RequestGrantingTicket(username string, password string) (TicketGrantingTicket, error) {
+	return c.RequestGrantingTicketContext(context.Background(), username, password)
+}
+
+// RequestGrantingTicketContext is RequestGrantingTicket with the request bound to ctx
+func (c *RestClient) RequestGrantingTicketContext(ctx context.Context, username string, password string) (TicketGrantingTicket, error) {
 	// request:
 	// POST /cas/v1/tickets HTTP/1.0
 	// username=battags&password=password&additionalParam1=paramvalue
@@ -83,20 +312,30 @@ func (c *RestClient) RequestGrantingTicket(username string, password string) (Ti
 		return "", err
 	}
 
+	if err := requireHTTPS(endpoint, c.allowInsecureCasURL); err != nil {
+		return "", err
+	}
+
 	values := url.Values{}
 	values.Set("username", username)
 	values.Set("password", password)
 
-	resp, err := c.client.PostForm(endpoint.String(), values)
+	resp, err := c.postForm(ctx, endpoint, values)
 	if err != nil {
 		return "", err
 	}
+	defer resp.Body.Close()
 
 	// response:
 	// 201 Created
 	// Location: http://www.whatever.com/cas/v1/tickets/{TGT id}
 
-	if resp.StatusCode != 201 {
+	// CAS 5 and later reply 401 to a failed authentication, earlier versions 400
+	switch resp.StatusCode {
+	case 201:
+	case 400, 401, 403:
+		return "", fmt.Errorf("%w: ticket endpoint returned status code %v", ErrInvalidCredentials, resp.StatusCode)
+	default:
 		return "", fmt.Errorf("ticket endoint returned status code %v", resp.StatusCode)
 	}
 
@@ -110,32 +349,71 @@ func (c *RestClient) RequestGrantingTicket(username string, password string) (Ti
 
 // RequestServiceTicket requests a service ticket with the TGT for the configured service url
 func (c *RestClient) RequestServiceTicket(tgt TicketGrantingTicket) (ServiceTicket, error) {
+	return c.RequestServiceTicketContext(context.Background(), tgt)
+}
+
+// RequestServiceTicketContext is RequestServiceTicket with the request bound to ctx
+func (c *RestClient) RequestServiceTicketContext(ctx context.Context, tgt TicketGrantingTicket) (ServiceTicket, error) {
+	return c.requestServiceTicket(ctx, tgt, c.serviceURL)
+}
+
+// RequestServiceTicketWithTGT requests a service ticket for service with a TGT kept from an
+// earlier RequestGrantingTicket, avoiding sending the credentials again. When the CAS server
+// no longer knows the TGT, ErrTicketGrantingTicketExpired is returned and the caller should
+// discard it and authenticate again.
+func (c *RestClient) RequestServiceTicketWithTGT(tgt TicketGrantingTicket, service *url.URL) (ServiceTicket, error) {
+	return c.RequestServiceTicketWithTGTContext(context.Background(), tgt, service)
+}
+
+// RequestServiceTicketWithTGTContext is RequestServiceTicketWithTGT with the request bound to ctx
+func (c *RestClient) RequestServiceTicketWithTGTContext(ctx context.Context, tgt TicketGrantingTicket, service *url.URL) (ServiceTicket, error) {
+	return c.requestServiceTicket(ctx, tgt, service)
+}
+
+// TicketGrantingTicketURL returns the location of the TGT on the CAS server, as returned in the
+// Location header by RequestGrantingTicket.
+func (c *RestClient) TicketGrantingTicketURL(tgt TicketGrantingTicket) (*url.URL, error) {
+	return c.urlScheme.RestServiceTicket(string(tgt))
+}
+
+func (c *RestClient) requestServiceTicket(ctx context.Context, tgt TicketGrantingTicket, service *url.URL) (ServiceTicket, error) {
 	// request:
 	// POST /cas/v1/tickets/{TGT id} HTTP/1.0
 	// service={form encoded parameter for the service url}
-	endpoint, err := c.urlScheme.RestServiceTicket(string(tgt))
+	if service == nil {
+		return "", ErrMissingServiceURL
+	}
+
+	endpoint, err := c.TicketGrantingTicketURL(tgt)
 	if err != nil {
 		return "", err
 	}
 
+	if err := requireHTTPS(endpoint, c.allowInsecureCasURL); err != nil {
+		return "", err
+	}
+
 	values := url.Values{}
-	values.Set("service", c.serviceURL.String())
+	values.Set("service", service.String())
 
-	resp, err := c.client.PostForm(endpoint.String(), values)
+	resp, err := c.postForm(ctx, endpoint, values)
 	if err != nil {
 		return "", err
 	}
+	defer resp.Body.Close()
 
 	// response:
 	// 200 OK
 	// ST-1-FFDFHDSJKHSDFJKSDHFJKRUEYREWUIFSD2132
 
+	if resp.StatusCode == 404 || resp.StatusCode == 410 {
+		return "", ErrTicketGrantingTicketExpired
+	}
+
 	if resp.StatusCode != 200 {
 		return "", fmt.Errorf("service ticket endoint returned status code %v", resp.StatusCode)
 	}
 
-	defer resp.Body.Close()
-
 	data, err := io.ReadAll(resp.Body)
 	if err != nil {
 		return "", err
@@ -146,26 +424,53 @@ func (c *RestClient) RequestServiceTicket(tgt TicketGrantingTicket) (ServiceTick
 
 // ValidateServiceTicket validates the service ticket and returns an AuthenticationResponse
 func (c *RestClient) ValidateServiceTicket(st ServiceTicket) (*AuthenticationResponse, error) {
-	return c.stValidator.ValidateTicket(c.serviceURL, string(st))
+	return c.ValidateServiceTicketContext(context.Background(), st)
+}
+
+// ValidateServiceTicketContext is ValidateServiceTicket with the request bound to ctx
+func (c *RestClient) ValidateServiceTicketContext(ctx context.Context, st ServiceTicket) (*AuthenticationResponse, error) {
+	success, err := c.validator.ValidateTicketContext(ctx, c.serviceURL, string(st))
+	if err != nil || success == nil || c.principalMapper == nil {
+		return success, err
+	}
+
+	if err := c.principalMapper(success); err != nil {
+		return nil, err
+	}
+
+	return success, nil
 }
 
 // Logout destroys the given granting ticket
 func (c *RestClient) Logout(tgt TicketGrantingTicket) error {
+	return c.LogoutContext(context.Background(), tgt)
+}
+
+// LogoutContext is Logout with the request to the CAS server bound to ctx.
+func (c *RestClient) LogoutContext(ctx context.Context, tgt TicketGrantingTicket) error {
 	// DELETE /cas/v1/tickets/TGT-fdsjfsdfjkalfewrihfdhfaie HTTP/1.0
 	endpoint, err := c.urlScheme.RestLogout(string(tgt))
 	if err != nil {
 		return err
 	}
 
-	req, err := http.NewRequest("DELETE", endpoint.String(), nil)
+	if err := requireHTTPS(endpoint, c.allowInsecureCasURL); err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "DELETE", endpoint.String(), nil)
 	if err != nil {
 		return err
 	}
 
-	resp, err := c.client.Do(req)
+	req.Header.Set("User-Agent", c.userAgentHeader())
+	setDefaultHeaders(req, c.defaultHeaders)
+
+	resp, err := c.do(req)
 	if err != nil {
 		return err
 	}
+	defer resp.Body.Close()
 
 	if resp.StatusCode != 200 && resp.StatusCode != 204 {
 		return fmt.Errorf("could not destroy granting ticket %v, server returned %v", tgt, resp.StatusCode)
@@ -173,3 +478,41 @@ func (c *RestClient) Logout(tgt TicketGrantingTicket) error {
 
 	return nil
 }
+
+// postForm posts the form encoded values to endpoint with the request bound to ctx
+func (c *RestClient) postForm(ctx context.Context, endpoint *url.URL, values url.Values) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, "POST", endpoint.String(), strings.NewReader(values.Encode()))
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("User-Agent", c.userAgentHeader())
+	setDefaultHeaders(req, c.defaultHeaders)
+
+	return c.do(req)
+}
+
+// do sends the request, retrying it according to the RetryPolicy, and returns the error of its
+// context unchanged if it was cancelled or its deadline passed.
+func (c *RestClient) do(req *http.Request) (*http.Response, error) {
+	resp, err := c.retryPolicy.do(req, c.client.Do)
+	if err != nil {
+		if ctxErr := req.Context().Err(); ctxErr != nil {
+			return nil, ctxErr
+		}
+
+		return nil, err
+	}
+
+	return resp, nil
+}
+
+// userAgentHeader returns the UserAgent of the options, or DefaultUserAgent if empty.
+func (c *RestClient) userAgentHeader() string {
+	if c.userAgent != "" {
+		return c.userAgent
+	}
+
+	return DefaultUserAgent
+}
@@ -1,14 +1,19 @@
 package cas
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
+	"sync/atomic"
 	"testing"
+	"time"
 )
 
 func TestRequestGrantingTicket(t *testing.T) {
-	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		if r.URL.Path != "/cas/v1/tickets" || r.Method != "POST" {
 			w.WriteHeader(404)
 			return
@@ -55,7 +60,7 @@ func TestRequestGrantingTicket(t *testing.T) {
 }
 
 func TestRequestServiceTicket(t *testing.T) {
-	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		if r.URL.Path != "/cas/v1/tickets/TGT-abc" || r.Method != "POST" {
 			w.WriteHeader(404)
 			return
@@ -124,7 +129,7 @@ func TestRequestServiceTicket(t *testing.T) {
 }
 
 func TestValidateService(t *testing.T) {
-	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		if r.URL.Path != "/cas/v1/tickets/TGT-abc" || r.Method != "DELETE" {
 			w.WriteHeader(404)
 			return
@@ -156,7 +161,7 @@ func TestValidateService(t *testing.T) {
 }
 
 func TestLogout(t *testing.T) {
-	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		if r.URL.Path != "/cas/v1/tickets/TGT-abc" || r.Method != "DELETE" {
 			w.WriteHeader(404)
 			return
@@ -186,3 +191,580 @@ func TestLogout(t *testing.T) {
 		t.Errorf("logout should failed for this TGT")
 	}
 }
+
+func TestRestClientDefaultHeaders(t *testing.T) {
+	var methods []string
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Api-Key") != "secret" {
+			w.WriteHeader(403)
+			return
+		}
+
+		methods = append(methods, r.Method)
+		if r.Method == "DELETE" {
+			w.WriteHeader(200)
+			return
+		}
+
+		w.Header().Set("Location", "/cas/v1/tickets/TGT-abc")
+		w.WriteHeader(201)
+	}))
+	defer server.Close()
+
+	casURL, _ := url.Parse(server.URL + "/cas/")
+	restClient := NewRestClient(&RestOptions{
+		CasURL:         casURL,
+		Client:         server.Client(),
+		DefaultHeaders: http.Header{"X-Api-Key": {"secret"}},
+	})
+
+	tgt, err := restClient.RequestGrantingTicket("user", "pass")
+	if err != nil {
+		t.Fatalf("Expected RequestGrantingTicket to succeed, got error: %v", err)
+	}
+
+	if err := restClient.Logout(tgt); err != nil {
+		t.Fatalf("Expected Logout to succeed, got error: %v", err)
+	}
+
+	if len(methods) != 2 || methods[0] != "POST" || methods[1] != "DELETE" {
+		t.Errorf("Expected POST and DELETE to carry the header, got <%v>", methods)
+	}
+}
+
+func TestRestAuthenticationTimeout(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/cas/v1/tickets":
+			w.Header().Set("Location", "/cas/v1/tickets/TGT-abc")
+			w.WriteHeader(201)
+		case "/cas/v1/tickets/TGT-abc":
+			select {
+			case <-r.Context().Done():
+			case <-time.After(time.Second):
+			}
+			w.Write([]byte("ST-123"))
+		default:
+			w.WriteHeader(404)
+		}
+	}))
+	defer server.Close()
+
+	casURL, _ := url.Parse(server.URL + "/cas/")
+	serviceURL, _ := url.Parse("https://hitchhiker.com/heartOfGold")
+
+	restClient := NewRestClient(&RestOptions{
+		CasURL:                casURL,
+		ServiceURL:            serviceURL,
+		Client:                server.Client(),
+		AuthenticationTimeout: 50 * time.Millisecond,
+	})
+
+	ch := &restClientHandler{c: restClient}
+	start := time.Now()
+	if _, err := ch.authenticate(context.Background(), "tricia", "hitchhiker"); err != ErrRestAuthenticationTimeout {
+		t.Errorf("Expected ErrRestAuthenticationTimeout, got %v", err)
+	}
+
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("Expected the chain to be cut short by the deadline, took %v", elapsed)
+	}
+
+	handler := restClient.HandleFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("Expected the handler not to be called")
+	})
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.SetBasicAuth("tricia", "hitchhiker")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+
+	if w.Code != 503 {
+		t.Errorf("Expected status code 503, got %d", w.Code)
+	}
+}
+
+func TestRequestServiceTicketWithTGT(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/cas/v1/tickets/TGT-abc" || r.Method != "POST" {
+			w.WriteHeader(404)
+			return
+		}
+
+		if r.FormValue("service") != "https://hitchhiker.com/restaurant" {
+			w.WriteHeader(400)
+			return
+		}
+
+		w.Write([]byte("ST-456"))
+	}))
+	defer server.Close()
+
+	casURL, _ := url.Parse(server.URL + "/cas/")
+	restClient := NewRestClient(&RestOptions{
+		CasURL: casURL,
+		Client: server.Client(),
+	})
+
+	tgtURL, err := restClient.TicketGrantingTicketURL("TGT-abc")
+	if err != nil {
+		t.Fatalf("Expected TicketGrantingTicketURL to succeed, got error: %v", err)
+	}
+
+	if expected := server.URL + "/cas/v1/tickets/TGT-abc"; tgtURL.String() != expected {
+		t.Errorf("Expected TGT URL to be <%s>, got <%s>", expected, tgtURL)
+	}
+
+	service, _ := url.Parse("https://hitchhiker.com/restaurant")
+	st, err := restClient.RequestServiceTicketWithTGT("TGT-abc", service)
+	if err != nil {
+		t.Errorf("Expected RequestServiceTicketWithTGT to succeed, got error: %v", err)
+	}
+
+	if st != "ST-456" {
+		t.Errorf("Expected service ticket to be <ST-456>, got <%s>", st)
+	}
+
+	if _, err := restClient.RequestServiceTicketWithTGT("TGT-expired", service); err != ErrTicketGrantingTicketExpired {
+		t.Errorf("Expected ErrTicketGrantingTicketExpired, got %v", err)
+	}
+}
+
+func TestRestHandlerErrorStatus(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.FormValue("username") != "tricia" {
+			w.WriteHeader(401)
+			return
+		}
+
+		w.WriteHeader(500)
+	}))
+	defer server.Close()
+
+	casURL, _ := url.Parse(server.URL + "/cas/")
+	serviceURL, _ := url.Parse("https://hitchhiker.com/heartOfGold")
+
+	restClient := NewRestClient(&RestOptions{
+		CasURL:     casURL,
+		ServiceURL: serviceURL,
+		Client:     server.Client(),
+	})
+
+	handler := restClient.HandleFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("Expected the handler not to be called")
+	})
+
+	serve := func(username string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.SetBasicAuth(username, "hitchhiker")
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		return w
+	}
+
+	// The CAS server rejects the credentials
+	if w := serve("arthur"); w.Code != 401 || w.Header().Get("WWW-Authenticate") == "" {
+		t.Errorf("Expected status code 401 with a challenge, got %d", w.Code)
+	}
+
+	if _, err := restClient.RequestGrantingTicket("arthur", "dent"); !errors.Is(err, ErrInvalidCredentials) {
+		t.Errorf("Expected error to be <%v>, got <%v>", ErrInvalidCredentials, err)
+	}
+
+	// The CAS server fails
+	if w := serve("tricia"); w.Code != 503 {
+		t.Errorf("Expected status code 503 when CAS fails, got %d", w.Code)
+	}
+
+	// The CAS server can not be reached
+	server.Close()
+	if w := serve("tricia"); w.Code != 503 {
+		t.Errorf("Expected status code 503 when CAS is unreachable, got %d", w.Code)
+	}
+}
+
+// failingValidator fails every validation with its error
+type failingValidator struct {
+	err error
+}
+
+func (v *failingValidator) ValidateTicket(serviceURL *url.URL, ticket string) (*AuthenticationResponse, error) {
+	return nil, v.err
+}
+
+func (v *failingValidator) ValidateTicketContext(ctx context.Context, serviceURL *url.URL, ticket string) (*AuthenticationResponse, error) {
+	return nil, v.err
+}
+
+func TestRestHandlerValidationFailureStatus(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/cas/v1/tickets":
+			w.Header().Set("Location", "/cas/v1/tickets/TGT-abc")
+			w.WriteHeader(201)
+		default:
+			fmt.Fprint(w, "ST-1")
+		}
+	}))
+	defer server.Close()
+
+	casURL, _ := url.Parse(server.URL + "/cas/")
+	serviceURL, _ := url.Parse("https://hitchhiker.com/heartOfGold")
+
+	cases := []struct {
+		code     string
+		expected int
+	}{
+		{INVALID_TICKET, 401},
+		{INVALID_SERVICE, 503},
+		{INTERNAL_ERROR, 503},
+	}
+
+	for _, c := range cases {
+		restClient := NewRestClient(&RestOptions{
+			CasURL:               casURL,
+			ServiceURL:           serviceURL,
+			Client:               server.Client(),
+			Logger:               NoopLogger(),
+			Validator:            &failingValidator{err: &AuthenticationError{Code: c.code}},
+			ServiceTicketRetries: -1,
+		})
+
+		handler := restClient.HandleFunc(func(w http.ResponseWriter, r *http.Request) {
+			t.Errorf("Expected the handler not to be called")
+		})
+
+		req := httptest.NewRequest("GET", "/", nil)
+		req.SetBasicAuth("tricia", "hitchhiker")
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+
+		if w.Code != c.expected {
+			t.Errorf("Expected status code for %s to be <%d>, got <%d>", c.code, c.expected, w.Code)
+		}
+	}
+}
+
+func TestRestServiceTicketRetry(t *testing.T) {
+	var minted int32
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/cas/v1/tickets":
+			w.Header().Set("Location", "/cas/v1/tickets/TGT-abc")
+			w.WriteHeader(201)
+		case "/cas/v1/tickets/TGT-abc":
+			fmt.Fprintf(w, "ST-%d", atomic.AddInt32(&minted, 1))
+		default:
+			w.WriteHeader(404)
+		}
+	}))
+	defer server.Close()
+
+	casURL, _ := url.Parse(server.URL + "/cas/")
+	serviceURL, _ := url.Parse("https://hitchhiker.com/heartOfGold")
+
+	// The first service ticket expires before it is validated
+	validator := &fakeValidator{users: map[string]string{"ST-2": "tricia"}}
+
+	for _, retries := range []int{0, -1} {
+		atomic.StoreInt32(&minted, 0)
+		restClient := NewRestClient(&RestOptions{
+			CasURL:               casURL,
+			ServiceURL:           serviceURL,
+			Client:               server.Client(),
+			Validator:            validator,
+			ServiceTicketRetries: retries,
+		})
+
+		ch := &restClientHandler{c: restClient}
+		success, err := ch.authenticate(context.Background(), "tricia", "hitchhiker")
+
+		if retries == 0 {
+			if err != nil {
+				t.Fatalf("Expected the authentication to succeed with a new service ticket, got error: %v", err)
+			}
+
+			if success.User != "tricia" {
+				t.Errorf("Expected User to be <tricia>, got <%s>", success.User)
+			}
+
+			if n := atomic.LoadInt32(&minted); n != 2 {
+				t.Errorf("Expected <2> service tickets to be requested, got <%d>", n)
+			}
+		} else {
+			if !isInvalidTicket(err) {
+				t.Errorf("Expected an INVALID_TICKET error without retries, got <%v>", err)
+			}
+
+			if n := atomic.LoadInt32(&minted); n != 1 {
+				t.Errorf("Expected <1> service ticket to be requested without retries, got <%d>", n)
+			}
+		}
+	}
+}
+
+func TestRestHandlerOnAuthFailure(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(401)
+	}))
+	defer server.Close()
+
+	casURL, _ := url.Parse(server.URL + "/cas/")
+	serviceURL, _ := url.Parse("https://hitchhiker.com/heartOfGold")
+
+	var failures []error
+	restClient := NewRestClient(&RestOptions{
+		CasURL:     casURL,
+		ServiceURL: serviceURL,
+		Client:     server.Client(),
+		OnAuthFailure: func(w http.ResponseWriter, r *http.Request, err error) {
+			failures = append(failures, err)
+			http.Redirect(w, r, "/login", http.StatusFound)
+		},
+	})
+
+	handler := restClient.HandleFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("Expected the handler not to be called")
+	})
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.SetBasicAuth("arthur", "dent")
+	handler.ServeHTTP(w, req)
+
+	if w.Code != http.StatusFound || w.Header().Get("WWW-Authenticate") != "" {
+		t.Errorf("Expected the OnAuthFailure response, got status code %d", w.Code)
+	}
+
+	if len(failures) != 2 || failures[0] != ErrMissingCredentials || !errors.Is(failures[1], ErrInvalidCredentials) {
+		t.Errorf("Expected OnAuthFailure to be called with the missing and invalid credentials, got <%v>", failures)
+	}
+}
+
+func TestRestHandlerCredentialHooks(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(401)
+	}))
+	defer server.Close()
+
+	casURL, _ := url.Parse(server.URL + "/cas/")
+	serviceURL, _ := url.Parse("https://hitchhiker.com/heartOfGold")
+
+	var missing, invalid []error
+	restClient := NewRestClient(&RestOptions{
+		CasURL:     casURL,
+		ServiceURL: serviceURL,
+		Client:     server.Client(),
+		OnMissingCredentials: func(w http.ResponseWriter, r *http.Request, err error) {
+			missing = append(missing, err)
+			w.WriteHeader(http.StatusBadRequest)
+		},
+		OnInvalidCredentials: func(w http.ResponseWriter, r *http.Request, err error) {
+			invalid = append(invalid, err)
+			w.WriteHeader(http.StatusUnauthorized)
+		},
+	})
+
+	handler := restClient.HandleFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("Expected the handler not to be called")
+	})
+
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("Authorization", "Basic !!!")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status code to be <%d>, got <%d>", http.StatusBadRequest, w.Code)
+	}
+
+	req = httptest.NewRequest("GET", "/", nil)
+	req.SetBasicAuth("arthur", "dent")
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	if len(missing) != 2 || missing[0] != ErrMissingCredentials || missing[1] != ErrMalformedCredentials {
+		t.Errorf("Expected OnMissingCredentials to be called with the missing and malformed credentials, got <%v>", missing)
+	}
+
+	if len(invalid) != 1 || !errors.Is(invalid[0], ErrInvalidCredentials) {
+		t.Errorf("Expected OnInvalidCredentials to be called with the invalid credentials, got <%v>", invalid)
+	}
+}
+
+// fakeTicketClient grants tickets to the users with the password "secret"
+type fakeTicketClient struct{}
+
+func (fakeTicketClient) RequestGrantingTicketContext(ctx context.Context, username string, password string) (TicketGrantingTicket, error) {
+	if password != "secret" {
+		return "", ErrInvalidCredentials
+	}
+
+	return TicketGrantingTicket("TGT-" + username), nil
+}
+
+func (fakeTicketClient) RequestServiceTicketContext(ctx context.Context, tgt TicketGrantingTicket) (ServiceTicket, error) {
+	return ServiceTicket("ST-" + string(tgt)[len("TGT-"):]), nil
+}
+
+func (fakeTicketClient) ValidateServiceTicketContext(ctx context.Context, st ServiceTicket) (*AuthenticationResponse, error) {
+	return &AuthenticationResponse{User: string(st)[len("ST-"):]}, nil
+}
+
+func TestRestHandlerTicketClient(t *testing.T) {
+	casURL, _ := url.Parse("https://cas.invalid/cas/")
+	restClient := NewRestClient(&RestOptions{
+		CasURL:       casURL,
+		TicketClient: fakeTicketClient{},
+	})
+
+	handler := restClient.HandleFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, Username(r))
+	})
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.SetBasicAuth("arthur", "secret")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK || w.Body.String() != "arthur" {
+		t.Errorf("Expected the fake to authenticate <arthur>, got status code %d and body <%s>", w.Code, w.Body.String())
+	}
+
+	req = httptest.NewRequest("GET", "/", nil)
+	req.SetBasicAuth("arthur", "dent")
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected status code to be <%d>, got <%d>", http.StatusUnauthorized, w.Code)
+	}
+}
+
+// countingTicketClient counts the TGTs requested from a fakeTicketClient
+type countingTicketClient struct {
+	fakeTicketClient
+	grants *int
+}
+
+func (c countingTicketClient) RequestGrantingTicketContext(ctx context.Context, username string, password string) (TicketGrantingTicket, error) {
+	*c.grants++
+	return c.fakeTicketClient.RequestGrantingTicketContext(ctx, username, password)
+}
+
+func TestRestHandlerAuthenticationCache(t *testing.T) {
+	var grants int
+	casURL, _ := url.Parse("https://cas.invalid/cas/")
+	restClient := NewRestClient(&RestOptions{
+		CasURL:                 casURL,
+		Logger:                 NoopLogger(),
+		TicketClient:           countingTicketClient{grants: &grants},
+		AuthenticationCacheTTL: time.Minute,
+	})
+
+	now := time.Now()
+	restClient.authentications.now = func() time.Time { return now }
+
+	handler := restClient.HandleFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, "%s %v", Username(r), IsFromCache(r))
+	})
+
+	serve := func(password string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.SetBasicAuth("arthur", password)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		return w
+	}
+
+	if w := serve("secret"); w.Body.String() != "arthur false" {
+		t.Errorf("Expected the first request to authenticate, got <%s>", w.Body.String())
+	}
+
+	if w := serve("secret"); w.Body.String() != "arthur true" || grants != 1 {
+		t.Errorf("Expected the second request to be served from the cache, got <%s> after %d TGT requests", w.Body.String(), grants)
+	}
+
+	serve("dent")
+	serve("dent")
+	if grants != 3 {
+		t.Errorf("Expected failed authentications not to be cached, got %d TGT requests", grants)
+	}
+
+	now = now.Add(time.Minute)
+	if w := serve("secret"); w.Body.String() != "arthur false" || grants != 4 {
+		t.Errorf("Expected the expired entry to be authenticated again, got <%s> after %d TGT requests", w.Body.String(), grants)
+	}
+}
+
+func TestRestHandlerAuthenticationCacheDisabled(t *testing.T) {
+	var grants int
+	casURL, _ := url.Parse("https://cas.invalid/cas/")
+	restClient := NewRestClient(&RestOptions{
+		CasURL:       casURL,
+		Logger:       NoopLogger(),
+		TicketClient: countingTicketClient{grants: &grants},
+	})
+
+	handler := restClient.HandleFunc(func(w http.ResponseWriter, r *http.Request) {})
+	for i := 0; i < 2; i++ {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.SetBasicAuth("arthur", "secret")
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	if grants != 2 {
+		t.Errorf("Expected each request to be authenticated without a TTL, got %d TGT requests", grants)
+	}
+}
+
+func TestRestClientContextCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	release := make(chan struct{})
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		cancel()
+		select {
+		case <-r.Context().Done():
+		case <-release:
+		}
+	}))
+	defer server.Close()
+	defer close(release) // runs before Close, which waits for the handlers
+
+	casURL, _ := url.Parse(server.URL + "/cas/")
+	serviceURL, _ := url.Parse("https://api.example.com/")
+	restClient := NewRestClient(&RestOptions{
+		CasURL:     casURL,
+		ServiceURL: serviceURL,
+		Client:     server.Client(),
+		Logger:     NoopLogger(),
+	})
+
+	if _, err := restClient.RequestGrantingTicketContext(ctx, "arthur", "secret"); err != context.Canceled {
+		t.Errorf("Expected error to be <%v> unchanged, got <%v>", context.Canceled, err)
+	}
+
+	if _, err := restClient.RequestServiceTicketContext(ctx, "TGT-123"); err != context.Canceled {
+		t.Errorf("Expected error to be <%v> unchanged, got <%v>", context.Canceled, err)
+	}
+
+	if _, err := restClient.RequestServiceTicketWithTGTContext(ctx, "TGT-123", serviceURL); err != context.Canceled {
+		t.Errorf("Expected error to be <%v> unchanged, got <%v>", context.Canceled, err)
+	}
+
+	if err := restClient.LogoutContext(ctx, "TGT-123"); err != context.Canceled {
+		t.Errorf("Expected error to be <%v> unchanged, got <%v>", context.Canceled, err)
+	}
+}
+
+func TestRequestServiceTicketWithoutServiceURL(t *testing.T) {
+	casURL, _ := url.Parse("https://cas.invalid/cas/")
+	restClient := NewRestClient(&RestOptions{CasURL: casURL, Logger: NoopLogger()})
+
+	if _, err := restClient.RequestServiceTicket("TGT-123"); err != ErrMissingServiceURL {
+		t.Errorf("Expected error to be <%v>, got <%v>", ErrMissingServiceURL, err)
+	}
+}
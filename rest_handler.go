@@ -1,6 +1,8 @@
 package cas
 
 import (
+	"context"
+	"errors"
 	"log/slog"
 	"net/http"
 )
@@ -13,42 +15,139 @@ type restClientHandler struct {
 
 // ServeHTTP handles HTTP requests, processes HTTP Basic Authentication over CAS Rest api
 // and passes requests up to its child http.Handler.
+//
+// Credentials rejected by the CAS server are answered with 401, while a CAS server which can
+// not be reached or replies unexpectedly is answered with 503, so monitoring can tell an
+// outage from users mistyping their password.
 func (ch *restClientHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	slog.Info("cas: handling request", slog.Any("method", r.Method), slog.Any("url", r.URL))
+	setRequestID(r, ch.c.requestIDHeader)
+	logger := requestLogger(ch.c.logger, r.Context())
+	logger.Info("cas: handling request", slog.Any("method", r.Method), slog.String("url", redactedURL(r.URL)))
 
 	username, password, ok := r.BasicAuth()
 	if !ok {
-		w.Header().Set("WWW-Authenticate", "Basic realm=\"CAS Protected Area\"")
-		w.WriteHeader(401)
+		err := ErrMissingCredentials
+		if r.Header.Get("Authorization") != "" {
+			err = ErrMalformedCredentials
+		}
+
+		ch.authFailure(w, r, err)
 		return
 	}
 
-	// TODO we should implement a short cache to avoid hitting cas server on every request
-	// the cache could use the authorization header as key and the authenticationResponse as value
+	// The cache is keyed on the credential hash, never the authorization header, so the
+	// password is not kept in memory
+	var key string
+	if ch.c.authentications != nil {
+		key = ch.c.credentialHash(username, password)
+		if success, ok := ch.c.authentications.get(key); ok {
+			logger.Debug("cas: rest authentication cached", slog.Any("user", success.User))
+
+			setAuthenticationResponse(r, success)
+			ch.h.ServeHTTP(w, r)
+			return
+		}
+	}
+
+	ch.c.counters.add(CounterRestAuthenticationsAttempted)
 
-	success, err := ch.authenticate(username, password)
+	success, err := ch.authenticate(r.Context(), username, password)
 	if err != nil {
-		slog.Info("cas: rest authentication failed", slog.Any("error", err))
-		w.Header().Set("WWW-Authenticate", "Basic realm=\"CAS Protected Area\"")
-		w.WriteHeader(401)
+		ch.c.counters.add(CounterRestAuthenticationsFailed)
+
+		if !isCredentialRejection(err) {
+			logger.Warn("cas: rest authentication failed, CAS unavailable", slog.Any("error", err))
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+
+		logger.Info("cas: rest authentication failed", slog.Any("error", err))
+		ch.authFailure(w, r, err)
 		return
 	}
 
+	ch.c.authentications.put(key, success)
+
 	setAuthenticationResponse(r, success)
 	ch.h.ServeHTTP(w, r)
 	return
 }
 
-func (ch *restClientHandler) authenticate(username string, password string) (*AuthenticationResponse, error) {
-	tgt, err := ch.c.RequestGrantingTicket(username, password)
-	if err != nil {
-		return nil, err
+// authFailure responds to an unauthenticated request with the OnMissingCredentials or
+// OnInvalidCredentials of the client, depending on err, else with its OnAuthFailure, or with
+// 401 and a challenge for HTTP Basic Authentication.
+func (ch *restClientHandler) authFailure(w http.ResponseWriter, r *http.Request, err error) {
+	hook := ch.c.onInvalidCredentials
+	if errors.Is(err, ErrMissingCredentials) {
+		hook = ch.c.onMissingCredentials
 	}
 
-	st, err := ch.c.RequestServiceTicket(tgt)
-	if err != nil {
-		return nil, err
+	if hook == nil {
+		hook = ch.c.onAuthFailure
+	}
+
+	if hook != nil {
+		hook(w, r, err)
+		return
+	}
+
+	w.Header().Set("WWW-Authenticate", "Basic realm=\"CAS Protected Area\"")
+	w.WriteHeader(401)
+}
+
+// authenticate performs the TGT, ST and validation requests, bounded by the AuthenticationTimeout
+// of the client. The chain is cut short between requests once the deadline has passed. A service
+// ticket rejected as INVALID_TICKET is replaced from the same TGT up to ServiceTicketRetries times.
+// With CacheGrantingTickets the TGT of a previous request with the credentials is used.
+func (ch *restClientHandler) authenticate(ctx context.Context, username string, password string) (*AuthenticationResponse, error) {
+	if ch.c.authenticationTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, ch.c.authenticationTimeout)
+		defer cancel()
+	}
+
+	st, tgt, err := ch.c.credentialServiceTicket(ctx, username, password)
+	for retries := ch.c.serviceTicketRetries; ; retries-- {
+		if err != nil {
+			return nil, deadlineError(ctx, err)
+		}
+
+		if err := deadlineError(ctx, nil); err != nil {
+			return nil, err
+		}
+
+		success, err := ch.c.tickets.ValidateServiceTicketContext(ctx, st)
+		if err == nil {
+			return success, nil
+		}
+
+		if retries <= 0 || !isInvalidTicket(err) {
+			return nil, deadlineError(ctx, err)
+		}
+
+		requestLogger(ch.c.logger, ctx).Info("cas: service ticket rejected, requesting another", slog.Any("error", err))
+		st, err = ch.c.tickets.RequestServiceTicketContext(ctx, tgt)
+	}
+}
+
+// isInvalidTicket reports whether err is an INVALID_TICKET authentication failure.
+func isInvalidTicket(err error) bool {
+	var authErr *AuthenticationError
+	return errors.As(err, &authErr) && authErr.Code == INVALID_TICKET
+}
+
+// isCredentialRejection reports whether the REST authentication failed because the CAS server
+// rejected the user or the ticket issued for them, rather than because it could not be reached
+// or failed, such as with an INTERNAL_ERROR or INVALID_SERVICE authentication failure.
+func isCredentialRejection(err error) bool {
+	return errors.Is(err, ErrInvalidCredentials) || isInvalidTicket(err)
+}
+
+// deadlineError returns ErrRestAuthenticationTimeout if the deadline of ctx has passed, else err.
+func deadlineError(ctx context.Context, err error) error {
+	if ctx.Err() == context.DeadlineExceeded {
+		return ErrRestAuthenticationTimeout
 	}
 
-	return ch.c.ValidateServiceTicket(st)
+	return err
 }
@@ -0,0 +1,156 @@
+package cas
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// DefaultGrantingTicketTTL is how long a cached TGT is kept without a GrantingTicketTTL, the
+// default idle timeout of TGTs on the CAS server
+const DefaultGrantingTicketTTL = 2 * time.Hour
+
+// grantingTicketCache keeps the TGT of each user by the hash of their credentials for a TTL, so
+// service tickets are requested with the same TGT until it expires or the CAS server no longer
+// knows it, instead of sending the password to the CAS server for each of them. Expired entries
+// are removed, so credentials which are no longer used, such as after a password change, do not
+// keep their TGT for the life of the process.
+type grantingTicketCache struct {
+	ttl time.Duration
+
+	mu      sync.Mutex
+	tickets map[string]cachedGrantingTicket
+	now     func() time.Time
+}
+
+// cachedGrantingTicket is an entry of a grantingTicketCache
+type cachedGrantingTicket struct {
+	tgt     TicketGrantingTicket
+	expires time.Time
+}
+
+// newGrantingTicketCache creates a grantingTicketCache keeping TGTs for ttl, DefaultGrantingTicketTTL
+// if not positive, or returns nil, which caches nothing, if not enabled.
+func newGrantingTicketCache(enabled bool, ttl time.Duration) *grantingTicketCache {
+	if !enabled {
+		return nil
+	}
+
+	if ttl <= 0 {
+		ttl = DefaultGrantingTicketTTL
+	}
+
+	return &grantingTicketCache{
+		ttl:     ttl,
+		tickets: make(map[string]cachedGrantingTicket),
+		now:     time.Now,
+	}
+}
+
+// get returns the TGT cached for the key, unless it expired.
+func (c *grantingTicketCache) get(key string) (TicketGrantingTicket, bool) {
+	if c == nil {
+		return "", false
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, ok := c.tickets[key]
+	if !ok {
+		return "", false
+	}
+
+	if !c.now().Before(entry.expires) {
+		delete(c.tickets, key)
+		return "", false
+	}
+
+	return entry.tgt, true
+}
+
+// put caches the TGT for the key, removing the entries which expired.
+func (c *grantingTicketCache) put(key string, tgt TicketGrantingTicket) {
+	if c == nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := c.now()
+	for k, entry := range c.tickets {
+		if !now.Before(entry.expires) {
+			delete(c.tickets, k)
+		}
+	}
+
+	c.tickets[key] = cachedGrantingTicket{tgt: tgt, expires: now.Add(c.ttl)}
+}
+
+// remove removes the TGT cached for the key, unless a concurrent request already replaced it.
+func (c *grantingTicketCache) remove(key string, tgt TicketGrantingTicket) {
+	if c == nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.tickets[key].tgt == tgt {
+		delete(c.tickets, key)
+	}
+}
+
+// RequestServiceTicketForCredentials requests a service ticket for the ServiceURL of the options
+// with the credentials of a user. With CacheGrantingTickets the TGT of the credentials is kept and
+// reused, otherwise a TGT is requested for each service ticket.
+func (c *RestClient) RequestServiceTicketForCredentials(username string, password string) (ServiceTicket, error) {
+	return c.RequestServiceTicketForCredentialsContext(context.Background(), username, password)
+}
+
+// RequestServiceTicketForCredentialsContext is RequestServiceTicketForCredentials with the
+// requests to the CAS server bound to ctx
+func (c *RestClient) RequestServiceTicketForCredentialsContext(ctx context.Context, username string, password string) (ServiceTicket, error) {
+	st, _, err := c.credentialServiceTicket(ctx, username, password)
+	return st, err
+}
+
+// credentialServiceTicket requests a service ticket with the TGT of the credentials, which is
+// returned for further service tickets. A cached TGT the CAS server no longer knows is replaced
+// by a new one once, and the service ticket requested again with it.
+func (c *RestClient) credentialServiceTicket(ctx context.Context, username string, password string) (ServiceTicket, TicketGrantingTicket, error) {
+	var key string
+	if c.grantingTickets != nil {
+		key = c.credentialHash(username, password)
+
+		if tgt, ok := c.grantingTickets.get(key); ok {
+			st, err := c.tickets.RequestServiceTicketContext(ctx, tgt)
+			if !errors.Is(err, ErrTicketGrantingTicketExpired) {
+				return st, tgt, err
+			}
+
+			requestLogger(c.logger, ctx).Info("cas: cached granting ticket expired, requesting another")
+			c.grantingTickets.remove(key, tgt)
+		}
+	}
+
+	tgt, err := c.tickets.RequestGrantingTicketContext(ctx, username, password)
+	if err != nil {
+		return "", "", err
+	}
+
+	c.grantingTickets.put(key, tgt)
+
+	if err := ctx.Err(); err != nil {
+		return "", "", err
+	}
+
+	st, err := c.tickets.RequestServiceTicketContext(ctx, tgt)
+	if errors.Is(err, ErrTicketGrantingTicketExpired) {
+		c.grantingTickets.remove(key, tgt)
+	}
+
+	return st, tgt, err
+}
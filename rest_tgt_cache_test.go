@@ -0,0 +1,187 @@
+package cas
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// expiringTicketClient issues numbered TGTs and rejects the TGTs issued before expireBefore
+type expiringTicketClient struct {
+	fakeTicketClient
+
+	mu             sync.Mutex
+	grants         int
+	serviceTickets int
+	expireBefore   int
+}
+
+func (c *expiringTicketClient) RequestGrantingTicketContext(ctx context.Context, username string, password string) (TicketGrantingTicket, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.grants++
+	return TicketGrantingTicket("TGT-" + strconv.Itoa(c.grants) + "-" + username), nil
+}
+
+func (c *expiringTicketClient) RequestServiceTicketContext(ctx context.Context, tgt TicketGrantingTicket) (ServiceTicket, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.serviceTickets++
+
+	parts := strings.SplitN(string(tgt), "-", 3) // TGT-<n>-<username>
+	n, _ := strconv.Atoi(parts[1])
+	if n < c.expireBefore {
+		return "", ErrTicketGrantingTicketExpired
+	}
+
+	return ServiceTicket("ST-" + parts[2]), nil
+}
+
+func (c *expiringTicketClient) counts() (int, int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.grants, c.serviceTickets
+}
+
+func TestRestHandlerCacheGrantingTickets(t *testing.T) {
+	tickets := &expiringTicketClient{}
+	casURL, _ := url.Parse("https://cas.invalid/cas/")
+	restClient := NewRestClient(&RestOptions{
+		CasURL:               casURL,
+		Logger:               NoopLogger(),
+		TicketClient:         tickets,
+		CacheGrantingTickets: true,
+	})
+
+	handler := restClient.HandleFunc(func(w http.ResponseWriter, r *http.Request) {})
+	serve := func() int {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.SetBasicAuth("arthur", "secret")
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	for i := 0; i < 3; i++ {
+		if code := serve(); code != http.StatusOK {
+			t.Fatalf("Expected request %d to be authenticated, got status code %d", i, code)
+		}
+	}
+
+	if grants, sts := tickets.counts(); grants != 1 || sts != 3 {
+		t.Errorf("Expected 1 TGT and 3 service tickets, got %d and %d", grants, sts)
+	}
+
+	tickets.mu.Lock()
+	tickets.expireBefore = 2
+	tickets.mu.Unlock()
+
+	if code := serve(); code != http.StatusOK {
+		t.Fatalf("Expected the expired TGT to be replaced transparently, got status code %d", code)
+	}
+
+	if grants, sts := tickets.counts(); grants != 2 || sts != 5 {
+		t.Errorf("Expected exactly one new TGT and service ticket request, got %d TGTs and %d service tickets", grants, sts)
+	}
+
+	tickets.mu.Lock()
+	tickets.expireBefore = 100
+	tickets.mu.Unlock()
+
+	if _, err := restClient.RequestServiceTicketForCredentials("arthur", "secret"); err != ErrTicketGrantingTicketExpired {
+		t.Errorf("Expected ErrTicketGrantingTicketExpired, got %v", err)
+	}
+
+	if grants, sts := tickets.counts(); grants != 3 || sts != 7 {
+		t.Errorf("Expected one re-request rather than a retry loop, got %d TGTs and %d service tickets", grants, sts)
+	}
+}
+
+func TestRestHandlerCacheGrantingTicketsConcurrent(t *testing.T) {
+	tickets := &expiringTicketClient{}
+	casURL, _ := url.Parse("https://cas.invalid/cas/")
+	restClient := NewRestClient(&RestOptions{
+		CasURL:               casURL,
+		Logger:               NoopLogger(),
+		TicketClient:         tickets,
+		CacheGrantingTickets: true,
+	})
+
+	if _, err := restClient.RequestServiceTicketForCredentials("arthur", "secret"); err != nil {
+		t.Fatalf("Expected RequestServiceTicketForCredentials to succeed, got error: %v", err)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 16; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := restClient.RequestServiceTicketForCredentials("arthur", "secret"); err != nil {
+				t.Errorf("Expected RequestServiceTicketForCredentials to succeed, got error: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if grants, _ := tickets.counts(); grants != 1 {
+		t.Errorf("Expected the cached TGT to be shared, got %d TGT requests", grants)
+	}
+}
+
+func TestRestHandlerGrantingTicketsNotCached(t *testing.T) {
+	tickets := &expiringTicketClient{}
+	casURL, _ := url.Parse("https://cas.invalid/cas/")
+	restClient := NewRestClient(&RestOptions{
+		CasURL:       casURL,
+		Logger:       NoopLogger(),
+		TicketClient: tickets,
+	})
+
+	for i := 0; i < 2; i++ {
+		if _, err := restClient.RequestServiceTicketForCredentials("arthur", "secret"); err != nil {
+			t.Fatalf("Expected RequestServiceTicketForCredentials to succeed, got error: %v", err)
+		}
+	}
+
+	if grants, _ := tickets.counts(); grants != 2 {
+		t.Errorf("Expected a TGT per service ticket without CacheGrantingTickets, got %d TGT requests", grants)
+	}
+}
+
+func TestGrantingTicketCacheExpires(t *testing.T) {
+	now := time.Now()
+	cache := newGrantingTicketCache(true, time.Hour)
+	cache.now = func() time.Time { return now }
+
+	cache.put("arthur", "TGT-1-arthur")
+	cache.put("tricia", "TGT-2-tricia")
+
+	now = now.Add(30 * time.Minute)
+	if tgt, ok := cache.get("arthur"); !ok || tgt != "TGT-1-arthur" {
+		t.Errorf("Expected the TGT to be cached within the TTL, got <%s>", tgt)
+	}
+
+	now = now.Add(time.Hour)
+	if _, ok := cache.get("arthur"); ok {
+		t.Errorf("Expected the TGT to expire after the TTL")
+	}
+
+	// Storing another TGT evicts the expired entries of credentials which are not used again
+	cache.put("ford", "TGT-3-ford")
+	if n := len(cache.tickets); n != 1 {
+		t.Errorf("Expected only the new TGT to be kept, got %d entries", n)
+	}
+
+	if c := newGrantingTicketCache(true, 0); c.ttl != DefaultGrantingTicketTTL {
+		t.Errorf("Expected the TTL to default to <%v>, got <%v>", DefaultGrantingTicketTTL, c.ttl)
+	}
+}
@@ -0,0 +1,103 @@
+package cas
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"time"
+)
+
+// DefaultUserAgent is the User-Agent header of requests to the CAS server without a UserAgent
+const DefaultUserAgent = "Golang CAS client gopkg.in/cas"
+
+// RetryPolicy retries requests to the CAS server which fail with a connection error or a 5xx
+// response. Other responses, such as an authenticationFailure or the 404 of a server which
+// only speaks CAS 1, are never retried. No retry is attempted once the context is done, or
+// when its deadline would pass during the backoff.
+type RetryPolicy struct {
+	MaxAttempts int           // Attempts including the first, a value below 2 disables retrying
+	Backoff     time.Duration // Wait before the first retry, doubled before each further retry
+}
+
+// do sends the request with send, retrying it according to p. A nil policy sends it once.
+func (p *RetryPolicy) do(r *http.Request, send func(*http.Request) (*http.Response, error)) (*http.Response, error) {
+	resp, err := send(r)
+	if p == nil {
+		return resp, err
+	}
+
+	backoff := p.Backoff
+	for attempt := 1; attempt < p.MaxAttempts && retryable(r, resp, err); attempt++ {
+		retry, ok := rewoundRequest(r)
+		if !ok || !wait(r.Context(), backoff) {
+			break
+		}
+
+		if resp != nil {
+			io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+		}
+
+		resp, err = send(retry)
+		backoff *= 2
+	}
+
+	return resp, err
+}
+
+// retryable reports whether the result of the request is a transient failure worth retrying.
+func retryable(r *http.Request, resp *http.Response, err error) bool {
+	if r.Context().Err() != nil || errors.Is(err, ErrCircuitOpen) {
+		return false
+	}
+
+	return err != nil || resp.StatusCode >= 500
+}
+
+// rewoundRequest returns a copy of r with its body reset, false if the body can not be reset.
+func rewoundRequest(r *http.Request) (*http.Request, bool) {
+	retry := r.Clone(r.Context())
+	if r.Body == nil || r.Body == http.NoBody {
+		return retry, true
+	}
+
+	if r.GetBody == nil {
+		return nil, false
+	}
+
+	body, err := r.GetBody()
+	if err != nil {
+		return nil, false
+	}
+
+	retry.Body = body
+	return retry, true
+}
+
+// wait waits for d, returning false without waiting if the deadline of ctx would pass first, or
+// as soon as ctx is done.
+func wait(ctx context.Context, d time.Duration) bool {
+	if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < d {
+		return false
+	}
+
+	t := time.NewTimer(d)
+	defer t.Stop()
+
+	select {
+	case <-t.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// userAgent returns the UserAgent, or DefaultUserAgent if empty.
+func (validator *ServiceTicketValidator) userAgent() string {
+	if validator.UserAgent != "" {
+		return validator.UserAgent
+	}
+
+	return DefaultUserAgent
+}
@@ -0,0 +1,190 @@
+package cas
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestValidateTicketRetryPolicy(t *testing.T) {
+	var requests int32
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&requests, 1) < 3 {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+
+		fmt.Fprint(w, `<cas:serviceResponse xmlns:cas="http://www.yale.edu/tp/cas">
+  <cas:authenticationSuccess>
+    <cas:user>enoch.root</cas:user>
+  </cas:authenticationSuccess>
+</cas:serviceResponse>`)
+	}))
+	defer server.Close()
+
+	casURL, _ := url.Parse(server.URL)
+	validator := NewServiceTicketValidator(server.Client(), casURL)
+	validator.Logger = NoopLogger()
+	validator.RetryPolicy = &RetryPolicy{MaxAttempts: 3, Backoff: time.Millisecond}
+
+	serviceURL, _ := url.Parse("https://example.com/")
+	success, err := validator.ValidateTicket(serviceURL, "ST-123")
+	if err != nil {
+		t.Fatalf("Expected ValidateTicket to succeed, got error: %v", err)
+	}
+
+	if success.User != "enoch.root" {
+		t.Errorf("Expected User to be <enoch.root>, got <%s>", success.User)
+	}
+
+	if n := atomic.LoadInt32(&requests); n != 3 {
+		t.Errorf("Expected 3 requests, got %d", n)
+	}
+}
+
+func TestValidateTicketRetryPolicyExhausted(t *testing.T) {
+	var requests int32
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		w.WriteHeader(http.StatusGatewayTimeout)
+	}))
+	defer server.Close()
+
+	casURL, _ := url.Parse(server.URL)
+	validator := NewServiceTicketValidator(server.Client(), casURL)
+	validator.Logger = NoopLogger()
+	validator.RetryPolicy = &RetryPolicy{MaxAttempts: 2, Backoff: time.Millisecond}
+
+	serviceURL, _ := url.Parse("https://example.com/")
+	_, err := validator.ValidateTicket(serviceURL, "ST-123")
+
+	var validationErr *ValidationError
+	if !errors.As(err, &validationErr) || validationErr.StatusCode != http.StatusGatewayTimeout {
+		t.Errorf("Expected a ValidationError with status 504, got %v", err)
+	}
+
+	if n := atomic.LoadInt32(&requests); n != 2 {
+		t.Errorf("Expected 2 requests, got %d", n)
+	}
+}
+
+func TestValidateTicketRetryPolicyNotRetried(t *testing.T) {
+	var requests int32
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		if strings.HasSuffix(r.URL.Path, "/serviceValidate") {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		fmt.Fprint(w, "no\n\n")
+	}))
+	defer server.Close()
+
+	casURL, _ := url.Parse(server.URL)
+	validator := NewServiceTicketValidator(server.Client(), casURL)
+	validator.Logger = NoopLogger()
+	validator.RetryPolicy = &RetryPolicy{MaxAttempts: 3, Backoff: time.Millisecond}
+
+	serviceURL, _ := url.Parse("https://example.com/")
+	if _, err := validator.ValidateTicket(serviceURL, "ST-123"); err != nil {
+		t.Fatalf("Expected the CAS 1 fallback to succeed, got error: %v", err)
+	}
+
+	if n := atomic.LoadInt32(&requests); n != 2 {
+		t.Errorf("Expected the serviceValidate 404 and the validate request only, got %d requests", n)
+	}
+}
+
+func TestValidateTicketRetryPolicyDeadline(t *testing.T) {
+	var requests int32
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer server.Close()
+
+	casURL, _ := url.Parse(server.URL)
+	validator := NewServiceTicketValidator(server.Client(), casURL)
+	validator.Logger = NoopLogger()
+	validator.RetryPolicy = &RetryPolicy{MaxAttempts: 3, Backoff: time.Minute}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	serviceURL, _ := url.Parse("https://example.com/")
+	start := time.Now()
+	if _, err := validator.ValidateTicketContext(ctx, serviceURL, "ST-123"); err == nil {
+		t.Errorf("Expected ValidateTicketContext to fail")
+	}
+
+	if n := atomic.LoadInt32(&requests); n != 1 {
+		t.Errorf("Expected no retry past the deadline, got %d requests", n)
+	}
+
+	if d := time.Since(start); d > time.Second {
+		t.Errorf("Expected the backoff not to be waited past the deadline, took %v", d)
+	}
+}
+
+func TestUserAgent(t *testing.T) {
+	var agents []string
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		agents = append(agents, r.Header.Get("User-Agent"))
+		if strings.HasSuffix(r.URL.Path, "/v1/tickets") {
+			w.Header().Set("Location", "https://cas.example.com/v1/tickets/TGT-123")
+			w.WriteHeader(http.StatusCreated)
+			return
+		}
+
+		fmt.Fprint(w, `<cas:serviceResponse xmlns:cas="http://www.yale.edu/tp/cas">
+  <cas:authenticationSuccess>
+    <cas:user>enoch.root</cas:user>
+  </cas:authenticationSuccess>
+</cas:serviceResponse>`)
+	}))
+	defer server.Close()
+
+	casURL, _ := url.Parse(server.URL)
+	validator := NewServiceTicketValidator(server.Client(), casURL)
+	validator.Logger = NoopLogger()
+
+	serviceURL, _ := url.Parse("https://example.com/")
+	if _, err := validator.ValidateTicket(serviceURL, "ST-123"); err != nil {
+		t.Fatalf("Expected ValidateTicket to succeed, got error: %v", err)
+	}
+
+	validator.UserAgent = "example-fork/2.0"
+	if _, err := validator.ValidateTicket(serviceURL, "ST-124"); err != nil {
+		t.Fatalf("Expected ValidateTicket to succeed, got error: %v", err)
+	}
+
+	rest := NewRestClient(&RestOptions{
+		CasURL:    casURL,
+		Client:    server.Client(),
+		Logger:    NoopLogger(),
+		UserAgent: "example-fork/2.0",
+	})
+
+	if _, err := rest.RequestGrantingTicket("enoch.root", "secret"); err != nil {
+		t.Fatalf("Expected RequestGrantingTicket to succeed, got error: %v", err)
+	}
+
+	expected := []string{DefaultUserAgent, "example-fork/2.0", "example-fork/2.0"}
+	if len(agents) != len(expected) {
+		t.Fatalf("Expected %d requests, got %v", len(expected), agents)
+	}
+
+	for i := range expected {
+		if agents[i] != expected[i] {
+			t.Errorf("Expected User-Agent of request %d to be <%s>, got <%s>", i, expected[i], agents[i])
+		}
+	}
+}
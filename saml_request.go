@@ -0,0 +1,90 @@
+package cas
+
+import (
+	"encoding/xml"
+	"errors"
+	"strings"
+	"time"
+)
+
+// SAML 1.1 validation errors
+var (
+	// The InResponseTo of a samlValidate response does not match the RequestID of the request,
+	// so the response may have been swapped for one issued to another request
+	ErrSAMLCorrelationMismatch = errors.New("cas: saml validate: response does not match request")
+)
+
+// Represents the SOAP envelope of a SAML 1.1 samlValidate request.
+//
+// SAMLTicketValidator POSTs it to the samlValidate endpoint and checks the InResponseTo of the
+// response against its RequestID.
+type samlRequestEnvelope struct {
+	XMLName xml.Name        `xml:"http://schemas.xmlsoap.org/soap/envelope/ Envelope"`
+	Header  struct{}        `xml:"http://schemas.xmlsoap.org/soap/envelope/ Header"`
+	Body    samlRequestBody `xml:"http://schemas.xmlsoap.org/soap/envelope/ Body"`
+}
+
+type samlRequestBody struct {
+	Request samlRequest `xml:"urn:oasis:names:tc:SAML:1.0:protocol Request"`
+}
+
+type samlRequest struct {
+	MajorVersion      int    `xml:"MajorVersion,attr"`
+	MinorVersion      int    `xml:"MinorVersion,attr"`
+	RequestID         string `xml:"RequestID,attr"`
+	IssueInstant      string `xml:"IssueInstant,attr"`
+	AssertionArtifact string `xml:"urn:oasis:names:tc:SAML:1.0:protocol AssertionArtifact"`
+}
+
+// Represents the SOAP envelope of a SAML 1.1 samlValidate response, only as far as needed to
+// correlate it with the request
+type samlResponseEnvelope struct {
+	XMLName xml.Name `xml:"http://schemas.xmlsoap.org/soap/envelope/ Envelope"`
+	Body    struct {
+		Response struct {
+			ResponseID   string `xml:"ResponseID,attr"`
+			InResponseTo string `xml:"InResponseTo,attr"`
+		} `xml:"urn:oasis:names:tc:SAML:1.0:protocol Response"`
+	} `xml:"http://schemas.xmlsoap.org/soap/envelope/ Body"`
+}
+
+// xmlSAMLRequest returns the POST body of a samlValidate request for the ticket and its RequestID,
+// which is unique to the request and echoed by the CAS server as the InResponseTo of the response.
+func xmlSAMLRequest(ticket string) ([]byte, string, error) {
+	// A RequestID is an xsd:ID, which can not start with a digit
+	id := "_" + newLogoutRequestID()[:32]
+
+	e := &samlRequestEnvelope{
+		Body: samlRequestBody{
+			Request: samlRequest{
+				MajorVersion:      1,
+				MinorVersion:      1,
+				RequestID:         id,
+				IssueInstant:      time.Now().UTC().Format("2006-01-02T15:04:05.000Z"),
+				AssertionArtifact: ticket,
+			},
+		},
+	}
+
+	body, err := xml.Marshal(e)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return body, id, nil
+}
+
+// checkSAMLCorrelation returns ErrSAMLCorrelationMismatch unless the samlValidate response body
+// answers the request with the RequestID.
+func checkSAMLCorrelation(body []byte, requestID string) error {
+	var e samlResponseEnvelope
+	if err := xml.Unmarshal(body, &e); err != nil {
+		return err
+	}
+
+	if strings.TrimSpace(e.Body.Response.InResponseTo) != requestID {
+		return ErrSAMLCorrelationMismatch
+	}
+
+	return nil
+}
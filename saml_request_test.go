@@ -0,0 +1,66 @@
+package cas
+
+import (
+	"encoding/xml"
+	"fmt"
+	"testing"
+)
+
+const samlResponseFixture = `<SOAP-ENV:Envelope xmlns:SOAP-ENV="http://schemas.xmlsoap.org/soap/envelope/">
+  <SOAP-ENV:Header/>
+  <SOAP-ENV:Body>
+    <Response xmlns="urn:oasis:names:tc:SAML:1.0:protocol" xmlns:saml="urn:oasis:names:tc:SAML:1.0:assertion"
+      IssueInstant="2008-12-10T14:12:14.817Z" MajorVersion="1" MinorVersion="1"
+      Recipient="https://eiger.iad.vt.edu/dat/home.do"
+      ResponseID="_5c94b5431c540365e5a70b2874b75996" InResponseTo="%s">
+      <Status>
+        <StatusCode Value="samlp:Success"></StatusCode>
+      </Status>
+    </Response>
+  </SOAP-ENV:Body>
+</SOAP-ENV:Envelope>`
+
+func TestXMLSAMLRequest(t *testing.T) {
+	body, id, err := xmlSAMLRequest("ST-1-u4hrm3td92cLxpCvrjylcas.example.com")
+	if err != nil {
+		t.Fatalf("Expected xmlSAMLRequest to succeed, got error: %v", err)
+	}
+
+	var e samlRequestEnvelope
+	if err := xml.Unmarshal(body, &e); err != nil {
+		t.Fatalf("Expected the request to unmarshal, got error: %v", err)
+	}
+
+	r := e.Body.Request
+	if r.RequestID != id || id == "" || id[0] != '_' {
+		t.Errorf("Expected RequestID to be <%s>, got <%s>", id, r.RequestID)
+	}
+
+	if r.AssertionArtifact != "ST-1-u4hrm3td92cLxpCvrjylcas.example.com" {
+		t.Errorf("Expected AssertionArtifact to be the ticket, got <%s>", r.AssertionArtifact)
+	}
+
+	if r.IssueInstant == "" {
+		t.Errorf("Expected IssueInstant to be set")
+	}
+
+	if _, other, _ := xmlSAMLRequest("ST-1-u4hrm3td92cLxpCvrjylcas.example.com"); other == id {
+		t.Errorf("Expected each request to have a unique RequestID, got <%s> twice", id)
+	}
+}
+
+func TestCheckSAMLCorrelation(t *testing.T) {
+	_, id, err := xmlSAMLRequest("ST-1-u4hrm3td92cLxpCvrjylcas.example.com")
+	if err != nil {
+		t.Fatalf("Expected xmlSAMLRequest to succeed, got error: %v", err)
+	}
+
+	if err := checkSAMLCorrelation([]byte(fmt.Sprintf(samlResponseFixture, id)), id); err != nil {
+		t.Errorf("Expected the response to the request to be accepted, got error: %v", err)
+	}
+
+	mismatched := fmt.Sprintf(samlResponseFixture, "_192.168.16.51.1024506224022")
+	if err := checkSAMLCorrelation([]byte(mismatched), id); err != ErrSAMLCorrelationMismatch {
+		t.Errorf("Expected error to be <%v>, got <%v>", ErrSAMLCorrelationMismatch, err)
+	}
+}
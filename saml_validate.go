@@ -0,0 +1,239 @@
+package cas
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// SAMLTicketValidator validates service tickets with the SAML 1.1 samlValidate endpoint, which
+// CAS servers offer to Java clients, instead of serviceValidate. The ticket is POSTed as the
+// AssertionArtifact of a SOAP request, with the service URL as the TARGET parameter.
+//
+// The settings of the embedded ServiceTicketValidator, such as the Logger, DefaultHeaders,
+// CircuitBreaker, PrincipalMapper and AuditHook, apply to samlValidate validations as well. Its
+// other methods still use the CAS protocol endpoints.
+type SAMLTicketValidator struct {
+	*ServiceTicketValidator
+}
+
+// NewSAMLTicketValidator creates a SAMLTicketValidator for the CAS server at casURL.
+func NewSAMLTicketValidator(client *http.Client, casURL *url.URL) *SAMLTicketValidator {
+	return &SAMLTicketValidator{ServiceTicketValidator: NewServiceTicketValidator(client, casURL)}
+}
+
+// SAMLValidateUrl creates the url of the samlValidate endpoint for the service.
+func (validator *SAMLTicketValidator) SAMLValidateUrl(serviceURL *url.URL, ticket string) (string, error) {
+	return validator.samlValidationURL(validator.serviceString(serviceURL), ticket)
+}
+
+// ValidateTicket validates the service ticket for the service with samlValidate. A ticket the
+// CAS server does not accept fails with an *AuthenticationError with the INVALID_TICKET code,
+// as SAML 1.1 does not tell an unknown ticket from a service mismatch.
+func (validator *SAMLTicketValidator) ValidateTicket(serviceURL *url.URL, ticket string) (*AuthenticationResponse, error) {
+	return validator.ValidateTicketContext(context.Background(), serviceURL, ticket)
+}
+
+// ValidateTicketContext is ValidateTicket with the request to the CAS server bound to ctx.
+func (validator *SAMLTicketValidator) ValidateTicketContext(ctx context.Context, serviceURL *url.URL, ticket string) (*AuthenticationResponse, error) {
+	if atomic.LoadInt32(&validator.draining) != 0 {
+		return nil, ErrDraining
+	}
+
+	return validator.validate(ctx, serviceURL, ticket, validator.validateSAMLTicket)
+}
+
+// samlValidationURL creates the url of the samlValidate endpoint with the service as TARGET.
+func (validator *SAMLTicketValidator) samlValidationURL(service string, ticket string) (string, error) {
+	u, err := validator.endpointURL("samlValidate", ticket)
+	if err != nil {
+		return "", err
+	}
+
+	q := u.Query()
+	q.Set("TARGET", service)
+	u.RawQuery = q.Encode()
+
+	return u.String(), nil
+}
+
+// validateSAMLTicket POSTs the samlValidate request for the ticket and parses its response.
+func (validator *SAMLTicketValidator) validateSAMLTicket(ctx context.Context, serviceURL *url.URL, ticket string) (*AuthenticationResponse, error) {
+	logger := requestLogger(validator.logger(), ctx)
+
+	u, err := validator.samlValidationURL(validator.serviceParameter(ctx, serviceURL), ticket)
+	if err != nil {
+		return nil, err
+	}
+
+	envelope, requestID, err := xmlSAMLRequest(ticket)
+	if err != nil {
+		return nil, err
+	}
+
+	r, err := http.NewRequestWithContext(ctx, "POST", u, bytes.NewReader(envelope))
+	if err != nil {
+		return nil, err
+	}
+
+	if err := requireHTTPS(r.URL, validator.AllowInsecureCasURL); err != nil {
+		return nil, err
+	}
+
+	if validator.HostHeaderOverride != "" {
+		r.Host = validator.HostHeaderOverride
+	}
+
+	r.Header.Add("User-Agent", validator.userAgent())
+	r.Header.Set("Content-Type", "text/xml; charset=utf-8")
+	r.Header.Set("SOAPAction", "http://www.oasis-open.org/committees/security")
+	setDefaultHeaders(r, validator.DefaultHeaders)
+
+	logger.Info("cas: attempting ticket validation", slog.String("url", redactedURL(r.URL)))
+	auditEndpoint(r)
+
+	resp, err := validator.do(r)
+	if err != nil {
+		return nil, requestError(r, err)
+	}
+
+	logger.Info("cas: request returned", slog.Any("method", r.Method), slog.String("url", redactedURL(r.URL)), slog.Any("status", resp.Status))
+
+	body, err := io.ReadAll(validator.responseBody(resp))
+	closeErr := validator.closeBody(logger, resp)
+	if err != nil {
+		return nil, err
+	}
+
+	if validator.inMaintenance(resp.StatusCode, body) {
+		return nil, ErrCASMaintenance
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, statusError(resp, string(body))
+	}
+
+	logger.Info("cas: received authentication response", slog.Int("length", len(body)))
+	logger.Debug("cas: authentication response body", slog.String("response", string(body)))
+
+	if err := checkSAMLCorrelation(body, requestID); err != nil {
+		return nil, err
+	}
+
+	success, err := parseSAMLResponse(body)
+	if err != nil {
+		return nil, err
+	}
+
+	if closeErr != nil {
+		return nil, closeErr
+	}
+
+	logger.Info("cas: parsed service response", slog.String("user", userOf(success)))
+	return success, nil
+}
+
+// Represents the SOAP envelope of a SAML 1.1 samlValidate response
+type samlValidateEnvelope struct {
+	XMLName xml.Name `xml:"http://schemas.xmlsoap.org/soap/envelope/ Envelope"`
+	Body    struct {
+		Response struct {
+			Status struct {
+				StatusCode    samlStatusCode `xml:"urn:oasis:names:tc:SAML:1.0:protocol StatusCode"`
+				StatusMessage string         `xml:"urn:oasis:names:tc:SAML:1.0:protocol StatusMessage"`
+			} `xml:"urn:oasis:names:tc:SAML:1.0:protocol Status"`
+			Assertion *samlAssertion `xml:"urn:oasis:names:tc:SAML:1.0:assertion Assertion"`
+		} `xml:"urn:oasis:names:tc:SAML:1.0:protocol Response"`
+	} `xml:"http://schemas.xmlsoap.org/soap/envelope/ Body"`
+}
+
+// samlStatusCode is a SAML status code, qualified by an optional nested code
+type samlStatusCode struct {
+	Value      string          `xml:"Value,attr"`
+	StatusCode *samlStatusCode `xml:"urn:oasis:names:tc:SAML:1.0:protocol StatusCode"`
+}
+
+type samlAssertion struct {
+	AuthenticationStatement *struct {
+		AuthenticationInstant string      `xml:"AuthenticationInstant,attr"`
+		Subject               samlSubject `xml:"urn:oasis:names:tc:SAML:1.0:assertion Subject"`
+	} `xml:"urn:oasis:names:tc:SAML:1.0:assertion AuthenticationStatement"`
+
+	AttributeStatement *struct {
+		Subject    samlSubject `xml:"urn:oasis:names:tc:SAML:1.0:assertion Subject"`
+		Attributes []struct {
+			Name   string   `xml:"AttributeName,attr"`
+			Values []string `xml:"urn:oasis:names:tc:SAML:1.0:assertion AttributeValue"`
+		} `xml:"urn:oasis:names:tc:SAML:1.0:assertion Attribute"`
+	} `xml:"urn:oasis:names:tc:SAML:1.0:assertion AttributeStatement"`
+}
+
+type samlSubject struct {
+	NameIdentifier string `xml:"urn:oasis:names:tc:SAML:1.0:assertion NameIdentifier"`
+}
+
+// parseSAMLResponse parses the body of a samlValidate response. A status other than Success
+// is returned as an INVALID_TICKET AuthenticationError with the status message.
+func parseSAMLResponse(body []byte) (*AuthenticationResponse, error) {
+	var e samlValidateEnvelope
+	if err := xml.Unmarshal(body, &e); err != nil {
+		return nil, err
+	}
+
+	response := e.Body.Response
+	if status := response.Status.StatusCode; samlLocalName(status.Value) != "Success" {
+		message := strings.TrimSpace(response.Status.StatusMessage)
+		if message == "" {
+			message = status.Value
+			if status.StatusCode != nil {
+				message += " " + status.StatusCode.Value
+			}
+		}
+
+		return nil, &AuthenticationError{Code: INVALID_TICKET, Message: message}
+	}
+
+	a := response.Assertion
+	if a == nil || a.AuthenticationStatement == nil {
+		return nil, ErrEmptyResponse
+	}
+
+	r := &AuthenticationResponse{
+		User:       strings.TrimSpace(a.AuthenticationStatement.Subject.NameIdentifier),
+		Attributes: make(UserAttributes),
+	}
+
+	if t, err := time.Parse(time.RFC3339Nano, strings.TrimSpace(a.AuthenticationStatement.AuthenticationInstant)); err == nil {
+		r.AuthenticationDate = t
+	}
+
+	if s := a.AttributeStatement; s != nil {
+		if r.User == "" {
+			r.User = strings.TrimSpace(s.Subject.NameIdentifier)
+		}
+
+		for _, attribute := range s.Attributes {
+			for _, value := range attribute.Values {
+				r.addAttribute(attribute.Name, strings.TrimSpace(value))
+			}
+		}
+	}
+
+	if r.User == "" {
+		return nil, ErrEmptyResponse
+	}
+
+	return r, nil
+}
+
+// samlLocalName returns the local part of a qualified name such as samlp:Success
+func samlLocalName(qname string) string {
+	return qname[strings.LastIndexByte(qname, ':')+1:]
+}
@@ -0,0 +1,159 @@
+package cas
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+const samlValidateSuccess = `<SOAP-ENV:Envelope xmlns:SOAP-ENV="http://schemas.xmlsoap.org/soap/envelope/">
+  <SOAP-ENV:Header/>
+  <SOAP-ENV:Body>
+    <Response xmlns="urn:oasis:names:tc:SAML:1.0:protocol" xmlns:saml="urn:oasis:names:tc:SAML:1.0:assertion"
+      IssueInstant="2008-12-10T14:12:14.817Z" MajorVersion="1" MinorVersion="1"
+      ResponseID="_5c94b5431c540365e5a70b2874b75996" InResponseTo="%s">
+      <Status>
+        <StatusCode Value="samlp:Success"></StatusCode>
+      </Status>
+      <saml:Assertion AssertionID="_e5c23ff7a3889e12fa01802a47331653" IssueInstant="2008-12-10T14:12:14.817Z"
+        Issuer="localhost" MajorVersion="1" MinorVersion="1">
+        <saml:AttributeStatement>
+          <saml:Subject>
+            <saml:NameIdentifier>enoch.root</saml:NameIdentifier>
+          </saml:Subject>
+          <saml:Attribute AttributeName="memberOf" AttributeNamespace="http://www.ja-sig.org/products/cas/">
+            <saml:AttributeValue>faculty</saml:AttributeValue>
+            <saml:AttributeValue>staff</saml:AttributeValue>
+          </saml:Attribute>
+          <saml:Attribute AttributeName="mail" AttributeNamespace="http://www.ja-sig.org/products/cas/">
+            <saml:AttributeValue>enoch.root@example.com</saml:AttributeValue>
+          </saml:Attribute>
+        </saml:AttributeStatement>
+        <saml:AuthenticationStatement AuthenticationInstant="2008-12-10T14:12:14.741Z"
+          AuthenticationMethod="urn:oasis:names:tc:SAML:1.0:am:password">
+          <saml:Subject>
+            <saml:NameIdentifier>enoch.root</saml:NameIdentifier>
+          </saml:Subject>
+        </saml:AuthenticationStatement>
+      </saml:Assertion>
+    </Response>
+  </SOAP-ENV:Body>
+</SOAP-ENV:Envelope>`
+
+const samlValidateFailure = `<SOAP-ENV:Envelope xmlns:SOAP-ENV="http://schemas.xmlsoap.org/soap/envelope/">
+  <SOAP-ENV:Body>
+    <Response xmlns="urn:oasis:names:tc:SAML:1.0:protocol" InResponseTo="%s">
+      <Status>
+        <StatusCode Value="samlp:Responder"></StatusCode>
+        <StatusMessage>Ticket ST-123 not recognized</StatusMessage>
+      </Status>
+    </Response>
+  </SOAP-ENV:Body>
+</SOAP-ENV:Envelope>`
+
+// samlValidateServer returns a CAS server answering samlValidate requests with the response,
+// checking the request the validator sends.
+func samlValidateServer(t *testing.T, response string) *httptest.Server {
+	return httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" || r.URL.Path != "/samlValidate" {
+			t.Errorf("Expected a POST to /samlValidate, got %s %s", r.Method, r.URL.Path)
+		}
+
+		if target := r.URL.Query().Get("TARGET"); target != "https://example.com/app" {
+			t.Errorf("Expected TARGET to be <https://example.com/app>, got <%s>", target)
+		}
+
+		if ct := r.Header.Get("Content-Type"); ct != "text/xml; charset=utf-8" {
+			t.Errorf("Expected Content-Type to be <text/xml; charset=utf-8>, got <%s>", ct)
+		}
+
+		body, _ := io.ReadAll(r.Body)
+		var e samlRequestEnvelope
+		if err := xml.Unmarshal(body, &e); err != nil {
+			t.Errorf("Expected the request to unmarshal, got error: %v", err)
+		}
+
+		if a := e.Body.Request.AssertionArtifact; a != "ST-123" {
+			t.Errorf("Expected AssertionArtifact to be <ST-123>, got <%s>", a)
+		}
+
+		fmt.Fprintf(w, response, e.Body.Request.RequestID)
+	}))
+}
+
+func TestSAMLValidateTicket(t *testing.T) {
+	server := samlValidateServer(t, samlValidateSuccess)
+	defer server.Close()
+
+	casURL, _ := url.Parse(server.URL)
+	validator := NewSAMLTicketValidator(server.Client(), casURL)
+	validator.Logger = NoopLogger()
+
+	serviceURL, _ := url.Parse("https://example.com/app")
+	success, err := validator.ValidateTicket(serviceURL, "ST-123")
+	if err != nil {
+		t.Fatalf("Expected ValidateTicket to succeed, got error: %v", err)
+	}
+
+	if success.User != "enoch.root" {
+		t.Errorf("Expected User to be <enoch.root>, got <%s>", success.User)
+	}
+
+	if groups := success.Attributes["memberOf"]; len(groups) != 2 || groups[0] != "faculty" || groups[1] != "staff" {
+		t.Errorf("Expected memberOf to be <[faculty staff]>, got <%v>", groups)
+	}
+
+	if mail := success.Attributes.Get("mail"); mail != "enoch.root@example.com" {
+		t.Errorf("Expected mail to be <enoch.root@example.com>, got <%s>", mail)
+	}
+
+	if success.AuthenticationDate.IsZero() {
+		t.Errorf("Expected AuthenticationDate to be set")
+	}
+}
+
+func TestSAMLValidateTicketFailure(t *testing.T) {
+	server := samlValidateServer(t, samlValidateFailure)
+	defer server.Close()
+
+	casURL, _ := url.Parse(server.URL)
+	validator := NewSAMLTicketValidator(server.Client(), casURL)
+	validator.Logger = NoopLogger()
+
+	serviceURL, _ := url.Parse("https://example.com/app")
+	_, err := validator.ValidateTicket(serviceURL, "ST-123")
+
+	var authErr *AuthenticationError
+	if !errors.As(err, &authErr) {
+		t.Fatalf("Expected an *AuthenticationError, got %v", err)
+	}
+
+	if authErr.Code != INVALID_TICKET {
+		t.Errorf("Expected Code to be <%s>, got <%s>", INVALID_TICKET, authErr.Code)
+	}
+
+	if authErr.Message != "Ticket ST-123 not recognized" {
+		t.Errorf("Expected Message to be <Ticket ST-123 not recognized>, got <%s>", authErr.Message)
+	}
+}
+
+func TestSAMLValidateTicketCorrelation(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, samlValidateSuccess, "_0123456789abcdef0123456789abcdef")
+	}))
+	defer server.Close()
+
+	casURL, _ := url.Parse(server.URL)
+	validator := NewSAMLTicketValidator(server.Client(), casURL)
+	validator.Logger = NoopLogger()
+
+	serviceURL, _ := url.Parse("https://example.com/app")
+	if _, err := validator.ValidateTicket(serviceURL, "ST-123"); !errors.Is(err, ErrSAMLCorrelationMismatch) {
+		t.Errorf("Expected ErrSAMLCorrelationMismatch, got %v", err)
+	}
+}
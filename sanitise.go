@@ -2,13 +2,19 @@ package cas
 
 import (
 	"net/url"
+	"strings"
 )
 
 var (
-	urlCleanParameters = []string{"gateway", "renew", "service", "ticket"}
+	urlCleanParameters = []string{"gateway", "renew", "service", "ticket", "warn"}
 )
 
-// sanitisedURL cleans a URL of CAS specific parameters
+// defaultPorts are the ports dropped from service URLs for their scheme
+var defaultPorts = map[string]string{"http": "80", "https": "443"}
+
+// sanitisedURL cleans a URL of CAS specific parameters, and of the port if it is the default
+// port of the scheme, so https://app:443/ and https://app/ are the same service. Browsers and
+// proxies add and remove default ports inconsistently, while CAS compares service strings.
 func sanitisedURL(unclean *url.URL) *url.URL {
 	// Shouldn't be any errors parsing an existing *url.URL
 	u, _ := url.Parse(unclean.String())
@@ -18,6 +24,10 @@ func sanitisedURL(unclean *url.URL) *url.URL {
 		q.Del(param)
 	}
 
+	if port := u.Port(); port != "" && defaultPorts[strings.ToLower(u.Scheme)] == port {
+		u.Host = strings.TrimSuffix(u.Host, ":"+port)
+	}
+
 	u.RawQuery = q.Encode()
 	return u
 }
@@ -26,3 +36,25 @@ func sanitisedURL(unclean *url.URL) *url.URL {
 func sanitisedURLString(unclean *url.URL) string {
 	return sanitisedURL(unclean).String()
 }
+
+// serviceURLString cleans a URL for use as the service parameter, with the trailing slash
+// normalised if normalise is set, see normalisedTrailingSlash.
+func serviceURLString(unclean *url.URL, normalise bool) string {
+	u := sanitisedURL(unclean)
+	if normalise {
+		u.Path, u.RawPath = normalisedTrailingSlash(u.Path), ""
+	}
+
+	return u.String()
+}
+
+// normalisedTrailingSlash returns the canonical form of a service path: an empty path is the
+// root path "/", and any other path has no trailing slash.
+func normalisedTrailingSlash(p string) string {
+	p = strings.TrimRight(p, "/")
+	if p == "" {
+		return "/"
+	}
+
+	return p
+}
@@ -0,0 +1,28 @@
+package cas
+
+import (
+	"net/url"
+	"testing"
+)
+
+func TestSanitisedURLStringDefaultPorts(t *testing.T) {
+	cases := []struct {
+		url      string
+		expected string
+	}{
+		{"https://app:443/", "https://app/"},
+		{"https://app/", "https://app/"},
+		{"HTTPS://app:443/path?ticket=ST-123", "https://app/path"},
+		{"http://app:80/", "http://app/"},
+		{"http://app:443/", "http://app:443/"},
+		{"https://app:8443/", "https://app:8443/"},
+		{"https://[::1]:443/", "https://[::1]/"},
+	}
+
+	for _, c := range cases {
+		u, _ := url.Parse(c.url)
+		if s := sanitisedURLString(u); s != c.expected {
+			t.Errorf("Expected service string of <%s> to be <%s>, got <%s>", c.url, c.expected, s)
+		}
+	}
+}
@@ -0,0 +1,35 @@
+package cas
+
+import (
+	"errors"
+	"net/url"
+)
+
+// CAS URL errors
+var (
+	// ErrInsecureCasURL is returned instead of sending a request to a CAS URL which does not use https
+	ErrInsecureCasURL = errors.New("cas: refusing to send request to CAS over an insecure (non-https) URL")
+
+	// ErrMissingCasURL is the error of a client set up without a CAS URL
+	ErrMissingCasURL = errors.New("cas: no CAS URL")
+)
+
+// requireHTTPS returns ErrInsecureCasURL if u does not use https, unless allowInsecure is set
+// for local development.
+func requireHTTPS(u *url.URL, allowInsecure bool) error {
+	if allowInsecure || u.Scheme == "https" {
+		return nil
+	}
+
+	return ErrInsecureCasURL
+}
+
+// checkCasURL returns the error of a client set up with the CAS URL u, ErrMissingCasURL if it is
+// nil and ErrInsecureCasURL if it does not use https, unless allowInsecure is set.
+func checkCasURL(u *url.URL, allowInsecure bool) error {
+	if u == nil {
+		return ErrMissingCasURL
+	}
+
+	return requireHTTPS(u, allowInsecure)
+}
@@ -0,0 +1,49 @@
+package cas
+
+import (
+	"net/url"
+	"testing"
+)
+
+func TestNewCheckedClientRequiresHTTPS(t *testing.T) {
+	insecure, _ := url.Parse("http://cas.example.com/")
+	secure, _ := url.Parse("https://cas.example.com/")
+
+	cases := []struct {
+		url           *url.URL
+		allowInsecure bool
+		expected      error
+	}{
+		{nil, false, ErrMissingCasURL},
+		{nil, true, ErrMissingCasURL},
+		{insecure, false, ErrInsecureCasURL},
+		{insecure, true, nil},
+		{secure, false, nil},
+	}
+
+	for _, c := range cases {
+		client, err := NewCheckedClient(&Options{URL: c.url, AllowInsecureCasURL: c.allowInsecure, Logger: NoopLogger()})
+		if err != c.expected || (err == nil) != (client != nil) {
+			t.Errorf("Expected NewCheckedClient with <%v> and AllowInsecureCasURL <%v> to fail with <%v>, got <%v>", c.url, c.allowInsecure, c.expected, err)
+		}
+
+		rest, err := NewCheckedRestClient(&RestOptions{CasURL: c.url, AllowInsecureCasURL: c.allowInsecure, Logger: NoopLogger()})
+		if err != c.expected || (err == nil) != (rest != nil) {
+			t.Errorf("Expected NewCheckedRestClient with <%v> and AllowInsecureCasURL <%v> to fail with <%v>, got <%v>", c.url, c.allowInsecure, c.expected, err)
+		}
+
+		// The unchecked constructors keep accepting any URL
+		NewClient(&Options{URL: c.url, AllowInsecureCasURL: c.allowInsecure, Logger: NoopLogger()})
+		NewRestClient(&RestOptions{CasURL: c.url, AllowInsecureCasURL: c.allowInsecure, Logger: NoopLogger()})
+	}
+}
+
+func TestNewClientInsecureURLFailsValidation(t *testing.T) {
+	insecure, _ := url.Parse("http://cas.example.com/")
+	client := NewClient(&Options{URL: insecure, Logger: NoopLogger()})
+
+	service, _ := url.Parse("https://example.com/")
+	if _, err := client.stValidator.ValidateTicket(service, "ST-123"); err != ErrInsecureCasURL {
+		t.Errorf("Expected ErrInsecureCasURL, got %v", err)
+	}
+}
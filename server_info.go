@@ -0,0 +1,98 @@
+package cas
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+// ServerInfoUnknown is reported for the ServerInfo fields which could not be determined
+const ServerInfoUnknown = "unknown"
+
+var (
+	generatorMeta = regexp.MustCompile(`(?i)<meta\s+name=["']generator["']\s+content=["']([^"']+)["']`)
+)
+
+// ServerInfo describes the software of the CAS server, as far as it could be determined
+type ServerInfo struct {
+	Software string // For example "Apereo CAS", ServerInfoUnknown when not detected
+	Version  string // Version of the software, ServerInfoUnknown when not detected
+}
+
+// ServerInfo makes a best effort to detect the software and version of the CAS server, for
+// dashboards and diagnostics. It reads the Spring Boot actuator info endpoint exposed by
+// Apereo CAS, falling back to a generator meta tag of the login page.
+//
+// Fields which can not be determined, for example because the endpoint is not exposed, are
+// ServerInfoUnknown. An error is only returned if the CAS server can not be reached.
+func (validator *ServiceTicketValidator) ServerInfo(ctx context.Context) (ServerInfo, error) {
+	info := ServerInfo{Software: ServerInfoUnknown, Version: ServerInfoUnknown}
+
+	body, err := validator.fetchInfo(ctx, "actuator/info")
+	if err != nil {
+		return info, err
+	}
+
+	var actuator struct {
+		Cas struct {
+			Version string `json:"version"`
+		} `json:"cas"`
+	}
+
+	if body != nil && json.Unmarshal(body, &actuator) == nil && actuator.Cas.Version != "" {
+		info.Software = "Apereo CAS"
+		info.Version = actuator.Cas.Version
+		return info, nil
+	}
+
+	body, err = validator.fetchInfo(ctx, "login")
+	if err != nil {
+		return info, err
+	}
+
+	if m := generatorMeta.FindSubmatch(body); m != nil {
+		generator := strings.TrimSpace(string(m[1]))
+		if i := strings.LastIndexByte(generator, ' '); i > 0 {
+			info.Software, info.Version = generator[:i], generator[i+1:]
+		} else {
+			info.Software = generator
+		}
+	} else if strings.Contains(string(body), "Apereo") {
+		info.Software = "Apereo CAS"
+	}
+
+	return info, nil
+}
+
+// fetchInfo returns the body of the endpoint relative to the CAS URL, or nil if the endpoint
+// does not respond with 200 OK.
+func (validator *ServiceTicketValidator) fetchInfo(ctx context.Context, endpoint string) ([]byte, error) {
+	u := joinURLPath(validator.currentCasURL(), endpoint)
+
+	r, err := http.NewRequestWithContext(ctx, "GET", u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	r.Header.Add("User-Agent", validator.userAgent())
+	setDefaultHeaders(r, validator.DefaultHeaders)
+
+	resp, err := validator.client.Do(r)
+	if err != nil {
+		if ctxErr := r.Context().Err(); ctxErr != nil {
+			return nil, ctxErr
+		}
+
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, nil
+	}
+
+	return io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+}
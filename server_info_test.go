@@ -0,0 +1,66 @@
+package cas
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+func TestServerInfo(t *testing.T) {
+	cases := []struct {
+		name     string
+		handler  http.HandlerFunc
+		expected ServerInfo
+	}{
+		{
+			name: "actuator",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path != "/cas/actuator/info" {
+					http.NotFound(w, r)
+					return
+				}
+
+				fmt.Fprint(w, `{"cas":{"version":"6.6.15","date":"2024-01-10T12:00:00Z"}}`)
+			},
+			expected: ServerInfo{Software: "Apereo CAS", Version: "6.6.15"},
+		},
+		{
+			name: "generator meta",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path != "/cas/login" {
+					http.NotFound(w, r)
+					return
+				}
+
+				fmt.Fprint(w, `<html><head><meta name="generator" content="ExampleCAS 2.1"></head></html>`)
+			},
+			expected: ServerInfo{Software: "ExampleCAS", Version: "2.1"},
+		},
+		{
+			name:     "not exposed",
+			handler:  http.NotFound,
+			expected: ServerInfo{Software: ServerInfoUnknown, Version: ServerInfoUnknown},
+		},
+	}
+
+	for _, c := range cases {
+		server := httptest.NewTLSServer(c.handler)
+
+		casURL, _ := url.Parse(server.URL + "/cas/")
+		validator := NewServiceTicketValidator(server.Client(), casURL)
+
+		info, err := validator.ServerInfo(context.Background())
+		if err != nil {
+			t.Errorf("%s: expected ServerInfo to succeed, got error: %v", c.name, err)
+		}
+
+		if info != c.expected {
+			t.Errorf("%s: expected ServerInfo to be <%+v>, got <%+v>", c.name, c.expected, info)
+		}
+
+		server.Close()
+	}
+}
@@ -1,10 +1,16 @@
 package cas
 
 import (
+	"bytes"
 	"encoding/xml"
+	"errors"
 	"fmt"
+	"io"
 	"log/slog"
+	"mime"
 	"reflect"
+	"sort"
+	"strconv"
 	"strings"
 	"time"
 
@@ -23,7 +29,22 @@ const (
 	INTERNAL_ERROR             = "INTERNAL_ERROR"
 )
 
-// AuthenticationError represents a CAS AuthenticationFailure response
+// Service response errors
+var (
+	// The CAS server returned an HTML page, usually the login form, instead of a validation
+	// response. The CAS URL most likely points at the login page rather than the CAS root.
+	ErrUnexpectedHTMLResponse = errors.New("cas: validation response is HTML, check that the CAS URL is the server root and not the login page")
+
+	// The CAS server returned an empty body, such as a 204 No Content, instead of a validation
+	// response. The endpoint or a proxy in front of it is most likely misconfigured.
+	ErrEmptyResponse = errors.New("cas: validation response is empty")
+
+	// MergeResponses was given responses for different users, which must not be combined.
+	ErrUserMismatch = errors.New("cas: merge responses: users do not match")
+)
+
+// AuthenticationError represents a CAS AuthenticationFailure response. It is returned as a
+// pointer, use errors.As with an *AuthenticationError to read its Code.
 type AuthenticationError struct {
 	Code    string
 	Message string
@@ -39,16 +60,265 @@ func (e AuthenticationError) Error() string {
 	return fmt.Sprintf("%s: %s", e.Code, e.Message)
 }
 
+// ParseError is returned when a service response is not well-formed XML, or does not match the
+// structure of a service response. It is never returned for an authenticationFailure, which is
+// an *AuthenticationError.
+type ParseError struct {
+	Err error // Underlying error of the XML decoder
+}
+
+// Error returns the ParseError as a string
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("cas: service response: malformed XML: %v", e.Err)
+}
+
+// Unwrap returns the underlying error
+func (e *ParseError) Unwrap() error {
+	return e.Err
+}
+
 // AuthenticationResponse captures authenticated user information
 type AuthenticationResponse struct {
 	User                string         // Users login name
-	ProxyGrantingTicket string         // Proxy Granting Ticket
+	Service             string         // Service the ticket was issued for, when echoed by the server
+	ProxyGrantingTicket string         // Proxy Granting Ticket IOU, see PGTIOU
+	PGT                 string         // Proxy Granting Ticket of the IOU, see ServiceTicketValidator.ProxyGrantingTickets
 	Proxies             []string       // List of proxies
 	AuthenticationDate  time.Time      // Time at which authentication was performed
 	IsNewLogin          bool           // Whether new authentication was used to grant the service ticket
 	IsRememberedLogin   bool           // Whether a long term token was used to grant the service ticket
 	MemberOf            []string       // List of groups which the user is a member of
-	Attributes          UserAttributes // Additional information about the user
+	Attributes          UserAttributes // Additional information about the user, empty but not nil without attributes
+
+	// ProtocolVersion is ProtocolVersion1 for a response of the CAS 1 validate endpoint, and
+	// ProtocolVersionUnknown otherwise. CAS 1 never carries attributes, so retrying the
+	// validation or re-reading such a response will not release any.
+	ProtocolVersion ProtocolVersion
+
+	// ClockSkew is the AuthenticationDate minus the local time when the ticket was validated, or
+	// zero without an AuthenticationDate. For a new login, see IsNewLogin, it approximates the
+	// clock difference between the CAS server and this host, positive when CAS is ahead. A
+	// ticket from an existing SSO session has a large negative value, the age of the session.
+	ClockSkew time.Duration
+
+	// SessionExpiresAt is when the CAS session, or the TGT, of the user expires, so a local
+	// session can be sized not to outlive it. The CAS protocol has no such field, it is only set
+	// when the server or a proxy in front of it releases a hint, as a sessionExpiresAt or
+	// expiresAt date attribute, or a maxTimeToLiveInSeconds attribute counted from the
+	// AuthenticationDate. It is zero otherwise, and is best-effort either way.
+	SessionExpiresAt time.Time
+
+	// FromCache is true when the response was read back from a store for a request after the
+	// one which validated the ticket, rather than returned by the CAS server for this request.
+	// Attributes of a cached response are as released at the time of the validation.
+	FromCache bool
+
+	// Warnings are the warning elements of the service response, and an authenticationFailure
+	// co-present with the authenticationSuccess as "CODE: message", which some deployments emit
+	// for a success with caveats. The success is returned, no warning fails the validation.
+	Warnings []string
+
+	orderedAttributes []Attribute       // positions of the attribute values as emitted, the Attributes map is authoritative
+	attributeTypes    map[string]string // xsi:type hints of XML attributes, without the prefix
+	principalMapping  *PrincipalMapping // of the validator, see Principal
+}
+
+// sessionExpiry derives the SessionExpiresAt of r from any expiry hint in its attributes, or
+// returns the zero time.
+func sessionExpiry(r *AuthenticationResponse) time.Time {
+	for _, name := range []string{"sessionExpiresAt", "expiresAt"} {
+		if v := r.Attributes.Get(name); v != "" {
+			if t, err := parseJSONDate(v); err == nil {
+				return t
+			}
+		}
+	}
+
+	if v := r.Attributes.Get("maxTimeToLiveInSeconds"); v != "" && !r.AuthenticationDate.IsZero() {
+		if seconds, err := strconv.ParseInt(v, 10, 64); err == nil && seconds > 0 {
+			return r.AuthenticationDate.Add(time.Duration(seconds) * time.Second)
+		}
+	}
+
+	return time.Time{}
+}
+
+// Attribute is a single attribute value of an AuthenticationResponse
+type Attribute struct {
+	Name  string
+	Value string
+}
+
+// OrderedAttributes returns the attribute values in the order they were emitted by the CAS
+// server. Iterating the Attributes map is unordered, while the values of each attribute keep
+// their order in both. JWT claims are ordered by name, as JSON object members have no order
+// within the signed token that the claims map preserves.
+//
+// The Attributes map is the source of truth, the order recorded while parsing only positions
+// its values. Values removed from the map are left out, and values added to it directly, such
+// as by a PrincipalMapper, follow the others ordered by attribute name.
+func (r *AuthenticationResponse) OrderedAttributes() []Attribute {
+	remaining := make(map[string][]string, len(r.Attributes))
+	count := 0
+	for name, values := range r.Attributes {
+		remaining[name] = values
+		count += len(values)
+	}
+
+	ordered := make([]Attribute, 0, count)
+	for _, a := range r.orderedAttributes {
+		if values := remaining[a.Name]; len(values) > 0 && values[0] == a.Value {
+			ordered = append(ordered, a)
+			remaining[a.Name] = values[1:]
+		}
+	}
+
+	names := make([]string, 0, len(remaining))
+	for name, values := range remaining {
+		if len(values) > 0 {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		for _, value := range remaining[name] {
+			ordered = append(ordered, Attribute{Name: name, Value: value})
+		}
+	}
+
+	return ordered
+}
+
+// addAttribute adds an attribute value to the Attributes map and records its position for
+// OrderedAttributes.
+func (r *AuthenticationResponse) addAttribute(name, value string) {
+	r.Attributes.Add(name, value)
+	r.orderedAttributes = append(r.orderedAttributes, Attribute{Name: name, Value: value})
+}
+
+// PGTIOU returns the proxy granting ticket IOU of a validation with a proxy callback, or an
+// empty string. The CAS server delivers the proxy granting ticket to the callback with the
+// same IOU, which correlates it with this response.
+func (r *AuthenticationResponse) PGTIOU() string {
+	return r.ProxyGrantingTicket
+}
+
+// Merge combines other into r, for example to add the attributes released to a front-end to
+// those of a proxy ticket validated by a back-end.
+//
+// The values of each attribute and of MemberOf are appended to those already in r, duplicates
+// included. User, Service, ProxyGrantingTicket, PGT and AuthenticationDate are kept and only
+// taken from other when empty in r. Proxies, IsNewLogin and IsRememberedLogin describe how the
+// ticket of r was obtained and are never changed.
+func (r *AuthenticationResponse) Merge(other *AuthenticationResponse) {
+	if other == nil {
+		return
+	}
+
+	if r.User == "" {
+		r.User = other.User
+	}
+
+	if r.Service == "" {
+		r.Service = other.Service
+	}
+
+	if r.ProxyGrantingTicket == "" {
+		r.ProxyGrantingTicket = other.ProxyGrantingTicket
+	}
+
+	if r.PGT == "" {
+		r.PGT = other.PGT
+	}
+
+	if r.AuthenticationDate.IsZero() {
+		r.AuthenticationDate = other.AuthenticationDate
+	}
+
+	r.MemberOf = append(r.MemberOf, other.MemberOf...)
+
+	if len(other.Attributes) > 0 && r.Attributes == nil {
+		r.Attributes = make(UserAttributes)
+	}
+
+	for name, values := range other.Attributes {
+		r.Attributes[name] = append(r.Attributes[name], values...)
+	}
+
+	r.orderedAttributes = append(r.orderedAttributes, other.orderedAttributes...)
+
+	for name, t := range other.attributeTypes {
+		if _, ok := r.attributeTypes[name]; !ok {
+			r.setAttributeType(name, t)
+		}
+	}
+}
+
+// MergeResponses combines the responses of the validations along a proxy chain into one, such
+// as for a gateway forwarding the identity accumulated by each hop downstream. All responses
+// must be for the same user, or ErrUserMismatch is returned. Nil responses are skipped, with
+// no others the result is nil.
+//
+// Unlike Merge, the values of each attribute and of MemberOf are a union, without duplicates,
+// in the order first seen. The other fields are taken as described for Merge, with the first
+// response as r. The responses are not modified.
+func MergeResponses(responses ...*AuthenticationResponse) (*AuthenticationResponse, error) {
+	var merged *AuthenticationResponse
+	for _, r := range responses {
+		if r == nil {
+			continue
+		}
+
+		if merged == nil {
+			merged = &AuthenticationResponse{
+				Attributes:        make(UserAttributes),
+				Proxies:           append([]string(nil), r.Proxies...),
+				IsNewLogin:        r.IsNewLogin,
+				IsRememberedLogin: r.IsRememberedLogin,
+				ProtocolVersion:   r.ProtocolVersion,
+			}
+		} else if r.User != merged.User {
+			return nil, fmt.Errorf("%w: %q and %q", ErrUserMismatch, merged.User, r.User)
+		}
+
+		merged.Merge(r)
+	}
+
+	if merged == nil {
+		return nil, nil
+	}
+
+	merged.MemberOf = uniqueStrings(merged.MemberOf)
+	for name, values := range merged.Attributes {
+		merged.Attributes[name] = uniqueStrings(values)
+	}
+
+	seen := make(map[Attribute]bool, len(merged.orderedAttributes))
+	ordered := merged.orderedAttributes[:0]
+	for _, a := range merged.orderedAttributes {
+		if !seen[a] {
+			seen[a] = true
+			ordered = append(ordered, a)
+		}
+	}
+	merged.orderedAttributes = ordered
+
+	return merged, nil
+}
+
+// uniqueStrings removes duplicates from values in place, keeping the first of each.
+func uniqueStrings(values []string) []string {
+	seen := make(map[string]bool, len(values))
+	unique := values[:0]
+	for _, v := range values {
+		if !seen[v] {
+			seen[v] = true
+			unique = append(unique, v)
+		}
+	}
+
+	return unique
 }
 
 // UserAttributes represents additional data about the user
@@ -70,23 +340,129 @@ func (a UserAttributes) Add(name, value string) {
 	a[name] = append(a[name], value)
 }
 
+// parseOptions control how service responses are parsed
+type parseOptions struct {
+	logger             *slog.Logger
+	strict             bool   // fail the whole response when an attribute element is malformed or the root is unexpected
+	lenient            bool   // recover XML responses with malformed attribute elements or an unexpected root, unless strict
+	charset            string // charset of the Content-Type header, overriding the XML declaration
+	preserveWhitespace bool   // keep whitespace around the user and attribute values
+
+	charsetReader func(charset string, input io.Reader) (io.Reader, error) // converts other charsets to UTF-8, DefaultCharsetReader if nil
+}
+
+// trim removes the whitespace around a user or attribute value, unless whitespace is preserved
+func (opts parseOptions) trim(s string) string {
+	if opts.preserveWhitespace {
+		return s
+	}
+
+	return strings.TrimSpace(s)
+}
+
 // ParseServiceResponse returns a successful response or an error
+//
+// An authenticationFailure is returned as an *AuthenticationError, whose Code tells an invalid
+// or expired ticket (INVALID_TICKET) from a service the ticket was not issued for
+// (INVALID_SERVICE), and a body which is not well-formed XML as a *ParseError.
+//
+// The response is decoded strictly, a malformed attribute element or a root element other
+// than cas:serviceResponse fails it. LenientParsing of a ServiceTicketValidator recovers
+// such responses instead.
 func ParseServiceResponse(data []byte) (*AuthenticationResponse, error) {
-	var x xmlServiceResponse
+	return parseServiceResponse(data, parseOptions{logger: slog.Default()})
+}
 
-	if err := xml.Unmarshal(data, &x); err != nil {
+// parseServiceResponse parses the service response according to opts
+func parseServiceResponse(data []byte, opts parseOptions) (*AuthenticationResponse, error) {
+	if len(bytes.TrimSpace(data)) == 0 {
+		return nil, ErrEmptyResponse
+	}
+
+	data, err := toUTF8(data, opts.charset, opts.charsetReader)
+	if err != nil {
 		return nil, err
 	}
 
+	if isHTML(data) {
+		return nil, ErrUnexpectedHTMLResponse
+	}
+
+	var x xmlServiceResponse
+
+	if err := unmarshalXML(data, &x); err != nil {
+		if opts.strict || !opts.lenient {
+			return nil, &ParseError{Err: err}
+		}
+
+		if !recoverServiceResponse(data, &x, opts.logger) {
+			return nil, &ParseError{Err: err}
+		}
+	}
+
+	return authenticationResponse(&x, opts)
+}
+
+// ParseServiceResponseStream is ParseServiceResponse decoding the response incrementally from
+// r, without reading it into memory first, for responses releasing many attributes.
+//
+// Like ParseServiceResponse an attribute element which can not be parsed fails the whole
+// response. It can not be recovered with LenientParsing, as skipping it requires the complete
+// body.
+func ParseServiceResponseStream(r io.Reader) (*AuthenticationResponse, error) {
+	return parseServiceResponseStream(r, parseOptions{logger: slog.Default(), strict: true})
+}
+
+// parseServiceResponseStream decodes the service response from r according to opts
+func parseServiceResponseStream(r io.Reader, opts parseOptions) (*AuthenticationResponse, error) {
+	charsetReader := opts.charsetReader
+	if charsetReader == nil {
+		charsetReader = DefaultCharsetReader
+	}
+
+	if opts.charset != "" {
+		cr, err := charsetReader(opts.charset, r)
+		if err != nil {
+			return nil, err
+		}
+
+		r = cr
+		charsetReader = passthroughCharsetReader
+	}
+
+	d := xml.NewDecoder(r)
+	d.CharsetReader = charsetReader
+
+	var x xmlServiceResponse
+	if err := d.Decode(&x); err == io.EOF {
+		return nil, ErrEmptyResponse
+	} else if err != nil {
+		return nil, &ParseError{Err: err}
+	}
+
+	return authenticationResponse(&x, opts)
+}
+
+// authenticationResponse converts a decoded service response to a successful response or an error
+func authenticationResponse(x *xmlServiceResponse, opts parseOptions) (*AuthenticationResponse, error) {
+	var failure *AuthenticationError
 	if x.Failure != nil {
 		msg := strings.TrimSpace(x.Failure.Message)
-		err := &AuthenticationError{Code: x.Failure.Code, Message: msg}
-		return nil, err
+		failure = &AuthenticationError{Code: strings.TrimSpace(x.Failure.Code), Message: msg}
+	}
+
+	if x.Success == nil && failure != nil {
+		return nil, failure
+	}
+
+	if x.Success == nil {
+		return nil, fmt.Errorf("cas: service response: no authenticationSuccess or authenticationFailure")
 	}
 
 	r := &AuthenticationResponse{
-		User:                x.Success.User,
-		ProxyGrantingTicket: x.Success.ProxyGrantingTicket,
+		User:                opts.trim(x.Success.User),
+		Service:             strings.TrimSpace(x.Success.Service),
+		ProxyGrantingTicket: strings.TrimSpace(x.Success.ProxyGrantingTicket),
 		Attributes:          make(UserAttributes),
 	}
 
@@ -106,48 +482,109 @@ func ParseServiceResponse(data []byte) (*AuthenticationResponse, error) {
 					continue
 				}
 
-				r.Attributes.Add(ua.Name, strings.TrimSpace(ua.Value))
+				r.addAttribute(ua.Name, opts.trim(ua.Value))
+				r.setAttributeType(ua.Name, ua.Type)
 			}
 
 			for _, ea := range a.UserAttributes.AnyAttributes {
-				r.Attributes.Add(ea.XMLName.Local, strings.TrimSpace(ea.Value))
+				r.addAttribute(ea.XMLName.Local, opts.trim(ea.Value))
+				r.setAttributeType(ea.XMLName.Local, ea.Type)
 			}
 		}
 
 		if a.ExtraAttributes != nil {
 			for _, ea := range a.ExtraAttributes {
-				r.Attributes.Add(ea.XMLName.Local, strings.TrimSpace(ea.Value))
+				r.addAttribute(ea.XMLName.Local, opts.trim(ea.Value))
+				r.setAttributeType(ea.XMLName.Local, ea.Type)
 			}
 		}
 	}
 
 	for _, ea := range x.Success.ExtraAttributes {
-		addRubycasAttribute(r.Attributes, ea.XMLName.Local, strings.TrimSpace(ea.Value))
+		addRubycasAttribute(r, ea.XMLName.Local, opts.trim(ea.Value), opts.logger)
+	}
+
+	for _, w := range x.Warnings {
+		if w = strings.TrimSpace(w); w != "" {
+			r.Warnings = append(r.Warnings, w)
+		}
+	}
+
+	if failure != nil {
+		r.addFailureWarning(failure, opts.logger)
 	}
 
 	return r, nil
 }
 
+// addFailureWarning records an authentication failure co-present with the success of r as a
+// warning, rather than discarding it.
+func (r *AuthenticationResponse) addFailureWarning(failure *AuthenticationError, logger *slog.Logger) {
+	logger.Warn("cas: service response: authenticationFailure alongside authenticationSuccess, using the success",
+		slog.String("code", failure.Code), slog.String("message", failure.Message))
+	r.Warnings = append(r.Warnings, failure.Error())
+}
+
+// ParseAuthenticationFailure extracts the code and message of a cas:authenticationFailure
+// from a service response body. ok is false if the body is not a service response
+// or does not contain a failure.
+func ParseAuthenticationFailure(body []byte) (code, message string, ok bool) {
+	body, err := toUTF8(body, "", nil)
+	if err != nil {
+		return "", "", false
+	}
+
+	var x xmlServiceResponse
+
+	if err := unmarshalXML(body, &x); err != nil || x.Failure == nil {
+		return "", "", false
+	}
+
+	return strings.TrimSpace(x.Failure.Code), strings.TrimSpace(x.Failure.Message), true
+}
+
+// isHTML reports whether data starts like an HTML document rather than XML.
+func isHTML(data []byte) bool {
+	data = bytes.TrimSpace(data)
+	if len(data) > 15 {
+		data = data[:15]
+	}
+
+	data = bytes.ToLower(data)
+	return bytes.HasPrefix(data, []byte("<!doctype html")) || bytes.HasPrefix(data, []byte("<html"))
+}
+
+// isHTMLContentType reports whether the Content-Type header value is text/html.
+func isHTMLContentType(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	return err == nil && mediaType == "text/html"
+}
+
 // addRubycasAttribute handles RubyCAS style additional attributes.
-func addRubycasAttribute(attributes UserAttributes, key, value string) {
+func addRubycasAttribute(r *AuthenticationResponse, key, value string, logger *slog.Logger) {
 	if !strings.HasPrefix(value, "---") {
-		attributes.Add(key, value)
+		r.addAttribute(key, value)
 		return
 	}
 
 	if value == "--- true" {
-		attributes.Add(key, "true")
+		r.addAttribute(key, "true")
 		return
 	}
 
 	if value == "--- false" {
-		attributes.Add(key, "false")
+		r.addAttribute(key, "false")
 		return
 	}
 
 	var decoded interface{}
 	if err := yaml.Unmarshal([]byte(value), &decoded); err != nil {
-		attributes.Add(key, err.Error())
+		r.addAttribute(key, err.Error())
+		return
+	}
+
+	if decoded == nil {
+		r.addAttribute(key, "")
 		return
 	}
 
@@ -157,17 +594,20 @@ func addRubycasAttribute(attributes UserAttributes, key, value string) {
 
 		for i := 0; i < s.Len(); i++ {
 			e := s.Index(i).Interface()
+			if e == nil {
+				continue
+			}
 
 			switch reflect.TypeOf(e).Kind() {
 			case reflect.String:
-				attributes.Add(key, e.(string))
+				r.addAttribute(key, e.(string))
 			}
 		}
 	case reflect.String:
 		s := reflect.ValueOf(decoded).Interface()
-		attributes.Add(key, s.(string))
+		r.addAttribute(key, s.(string))
 	default:
-		slog.Warn("cas: service response: unable to parse", slog.Any("key", key), slog.Any("value", decoded))
+		logger.Warn("cas: service response: unable to parse", slog.Any("key", key), slog.Any("value", decoded))
 	}
 
 	return
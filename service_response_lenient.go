@@ -0,0 +1,274 @@
+package cas
+
+import (
+	"bytes"
+	"encoding/xml"
+	"log/slog"
+	"regexp"
+	"strings"
+)
+
+var (
+	attributesStartTag = regexp.MustCompile(`<([A-Za-z_][\w.-]*:)?attributes(\s[^>]*)?>`)
+)
+
+// recoverServiceResponse decodes a service response which failed to unmarshal into x, skipping
+// malformed attributes or else looking past an unexpected root element, for the LenientParsing
+// of a validator. ok is false if neither recovers it.
+func recoverServiceResponse(data []byte, x *xmlServiceResponse, logger *slog.Logger) bool {
+	if recovered, ok := skipMalformedAttributes(data, logger); ok {
+		*x = xmlServiceResponse{}
+		if unmarshalXML(recovered, x) == nil {
+			return true
+		}
+	}
+
+	*x = xmlServiceResponse{}
+	return findAuthenticationElement(data, x, logger)
+}
+
+// findAuthenticationElement decodes the first authenticationSuccess or authenticationFailure
+// element of data into x, wherever it is nested, for responses wrapped in a vendor specific
+// root element rather than cas:serviceResponse. It is only used with LenientParsing.
+func findAuthenticationElement(data []byte, x *xmlServiceResponse, logger *slog.Logger) bool {
+	d := xml.NewDecoder(bytes.NewReader(data))
+	d.CharsetReader = passthroughCharsetReader
+
+	var root xml.Name
+	for {
+		t, err := d.Token()
+		if err != nil {
+			return false
+		}
+
+		se, ok := t.(xml.StartElement)
+		if !ok {
+			continue
+		}
+
+		if root.Local == "" {
+			root = se.Name
+		}
+
+		switch se.Name.Local {
+		case "authenticationSuccess":
+			x.Success = &xmlAuthenticationSuccess{}
+			err = d.DecodeElement(x.Success, &se)
+		case "authenticationFailure":
+			x.Failure = &xmlAuthenticationFailure{}
+			err = d.DecodeElement(x.Failure, &se)
+		default:
+			continue
+		}
+
+		if err != nil {
+			return false
+		}
+
+		logger.Warn("cas: service response: unexpected root element, reading its "+se.Name.Local,
+			slog.String("root", root.Local), slog.String("namespace", root.Space))
+		return true
+	}
+}
+
+// skipMalformedAttributes rebuilds the attributes element of a service response
+// without the child elements which can not be parsed, logging each one skipped.
+//
+// ok is false when the response has no attributes element or nothing was skipped,
+// in which case the original parse error stands.
+func skipMalformedAttributes(data []byte, logger *slog.Logger) ([]byte, bool) {
+	loc := attributesStartTag.FindSubmatchIndex(data)
+	if loc == nil {
+		return nil, false
+	}
+
+	qname := "attributes"
+	if loc[2] >= 0 {
+		qname = string(data[loc[2]:loc[3]]) + qname
+	}
+
+	start := loc[1]
+	end := closingTagIndex(data[start:], qname)
+	if end < 0 {
+		return nil, false
+	}
+	end += start
+
+	inner, skipped := validElements(data[start:end], func(fragment []byte) error {
+		var a xmlAttributes
+		return unmarshalFragment("attributes", fragment, &a)
+	}, logger)
+
+	if skipped == 0 {
+		return nil, false
+	}
+
+	var b bytes.Buffer
+	b.Write(data[:start])
+	b.Write(inner)
+	b.Write(data[end:])
+
+	return b.Bytes(), true
+}
+
+// validElements returns the child elements of inner which pass validate,
+// rebuilding a userAttributes element from its own valid children if needed.
+func validElements(inner []byte, validate func(fragment []byte) error, logger *slog.Logger) ([]byte, int) {
+	var b bytes.Buffer
+	skipped := 0
+
+	for len(inner) > 0 {
+		qname, fragment, rest := nextElement(inner)
+		if fragment == nil {
+			break
+		}
+		inner = rest
+
+		err := validate(fragment)
+		if err == nil {
+			b.Write(fragment)
+			continue
+		}
+
+		if localName(qname) == "userAttributes" {
+			if children, n, ok := validUserAttributes(qname, fragment, logger); ok {
+				b.Write(children)
+				skipped += n
+				continue
+			}
+		}
+
+		logger.Warn("cas: service response: skipping malformed attribute", slog.Any("element", qname), slog.Any("error", err))
+		skipped++
+	}
+
+	return b.Bytes(), skipped
+}
+
+// validUserAttributes rebuilds a userAttributes element from its valid children.
+func validUserAttributes(qname string, fragment []byte, logger *slog.Logger) ([]byte, int, bool) {
+	open := bytes.IndexByte(fragment, '>')
+	end := closingTagIndex(fragment, qname)
+	if open < 0 || end < open {
+		return nil, 0, false
+	}
+
+	children, skipped := validElements(fragment[open+1:end], func(child []byte) error {
+		var ua xmlUserAttributes
+		return unmarshalFragment("userAttributes", child, &ua)
+	}, logger)
+
+	var b bytes.Buffer
+	b.Write(fragment[:open+1])
+	b.Write(children)
+	b.Write(fragment[end:])
+
+	return b.Bytes(), skipped, true
+}
+
+// unmarshalFragment decodes fragment wrapped in an element named parent into v.
+func unmarshalFragment(parent string, fragment []byte, v interface{}) error {
+	var b bytes.Buffer
+	b.WriteString("<" + parent + ">")
+	b.Write(fragment)
+	b.WriteString("</" + parent + ">")
+
+	return unmarshalXML(b.Bytes(), v)
+}
+
+// nextElement finds the next element in data, returning its qualified name, its
+// raw bytes and the remaining data. The element is delimited by its closing tag
+// name alone so that malformed content within it does not affect the scan.
+func nextElement(data []byte) (string, []byte, []byte) {
+	for {
+		i := bytes.IndexByte(data, '<')
+		if i < 0 || i+1 >= len(data) {
+			return "", nil, nil
+		}
+
+		data = data[i:]
+		if !isNameStart(data[1]) {
+			if bytes.HasPrefix(data, []byte("<!--")) {
+				if j := bytes.Index(data, []byte("-->")); j >= 0 {
+					data = data[j+3:]
+					continue
+				}
+
+				return "", nil, nil
+			}
+
+			data = data[1:]
+			continue
+		}
+
+		n := 1
+		for n < len(data) && !isNameEnd(data[n]) {
+			n++
+		}
+		qname := string(data[1:n])
+
+		gt := bytes.IndexByte(data, '>')
+		if gt < 0 {
+			return "", nil, nil
+		}
+
+		if data[gt-1] == '/' {
+			return qname, data[:gt+1], data[gt+1:]
+		}
+
+		end := closingTagIndex(data[gt+1:], qname)
+		if end < 0 {
+			return "", nil, nil
+		}
+		end += gt + 1
+
+		close := bytes.IndexByte(data[end:], '>')
+		if close < 0 {
+			return "", nil, nil
+		}
+		close += end
+
+		return qname, data[:close+1], data[close+1:]
+	}
+}
+
+// closingTagIndex returns the index of the closing tag of qname in data, or -1.
+func closingTagIndex(data []byte, qname string) int {
+	tag := []byte("</" + qname)
+	offset := 0
+
+	for {
+		i := bytes.Index(data[offset:], tag)
+		if i < 0 {
+			return -1
+		}
+		i += offset
+
+		if j := i + len(tag); j < len(data) && (data[j] == '>' || isSpace(data[j])) {
+			return i
+		}
+
+		offset = i + len(tag)
+	}
+}
+
+// localName strips the namespace prefix from a qualified name.
+func localName(qname string) string {
+	if i := strings.IndexByte(qname, ':'); i >= 0 {
+		return qname[i+1:]
+	}
+
+	return qname
+}
+
+func isNameStart(c byte) bool {
+	return c == '_' || c == ':' || ('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z') || c >= 0x80
+}
+
+func isNameEnd(c byte) bool {
+	return c == '>' || c == '/' || isSpace(c)
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r'
+}
@@ -1,7 +1,11 @@
 package cas
 
 import (
+	"bytes"
 	"encoding/xml"
+	"errors"
+	"reflect"
+	"strings"
 	"testing"
 	"time"
 )
@@ -600,3 +604,660 @@ func TestSuccessfulServiceResponseWithRubyCasAttributes(t *testing.T) {
 		t.Errorf("Expected marshalled results to match. Expected:\n%s\nGot:\n%s", expected, s)
 	}
 }
+
+func TestUnmarshalServiceResponseSkipsMalformedAttributes(t *testing.T) {
+	s := "<cas:serviceResponse xmlns:cas=\"http://www.yale.edu/tp/cas\">\n" +
+		"  <cas:authenticationSuccess>\n" +
+		"    <cas:user>username</cas:user>\n" +
+		"    <cas:attributes>\n" +
+		"      <cas:isFromNewLogin>true</cas:isFromNewLogin>\n" +
+		"      <cas:firstname>John</cas:firstname>\n" +
+		"      <cas:broken>\xff\xfe</cas:broken>\n" +
+		"      <cas:stray>Doe<br></cas:stray>\n" +
+		"      <cas:userAttributes>\n" +
+		"        <cas:attribute name=\"email\">jdoe@example.org</cas:attribute>\n" +
+		"        <cas:attribute name=\"title\">\xffMr.</cas:attribute>\n" +
+		"      </cas:userAttributes>\n" +
+		"      <cas:lastname>Doe</cas:lastname>\n" +
+		"    </cas:attributes>\n" +
+		"  </cas:authenticationSuccess>\n" +
+		"</cas:serviceResponse>"
+
+	var parseErr *ParseError
+	if _, err := ParseServiceResponse([]byte(s)); !errors.As(err, &parseErr) {
+		t.Errorf("Expected ParseServiceResponse to fail on a malformed attribute by default, got %v", err)
+	}
+
+	sr, err := parseServiceResponse([]byte(s), parseOptions{logger: NoopLogger(), lenient: true})
+	if err != nil {
+		t.Fatalf("Expected lenient parsing to skip malformed attributes, got error: %v", err)
+	}
+
+	if sr.User != "username" {
+		t.Errorf("Expected User to be <username>, got <%s>", sr.User)
+	}
+
+	if !sr.IsNewLogin {
+		t.Errorf("Expected IsNewLogin to be true")
+	}
+
+	expected := map[string]string{"firstname": "John", "lastname": "Doe", "email": "jdoe@example.org"}
+	for name, value := range expected {
+		if v := sr.Attributes.Get(name); v != value {
+			t.Errorf("Expected attribute %s to be <%s>, got <%s>", name, value, v)
+		}
+	}
+
+	for _, name := range []string{"broken", "stray", "title"} {
+		if _, ok := sr.Attributes[name]; ok {
+			t.Errorf("Expected malformed attribute %s to be skipped", name)
+		}
+	}
+
+	if _, err := parseServiceResponse([]byte(s), parseOptions{logger: NoopLogger(), strict: true}); err == nil {
+		t.Errorf("Expected strict parsing to fail on a malformed attribute")
+	}
+}
+
+func TestParseAuthenticationFailure(t *testing.T) {
+	s := `<cas:serviceResponse xmlns:cas="http://www.yale.edu/tp/cas">
+	<cas:authenticationFailure code="INVALID_SERVICE">
+			Ticket ST-1856339-aA5Yuvrxzpv8Tau1cYQ7 does not match supplied service
+	</cas:authenticationFailure>
+</cas:serviceResponse>`
+
+	code, message, ok := ParseAuthenticationFailure([]byte(s))
+	if !ok {
+		t.Fatalf("Expected ParseAuthenticationFailure to find the failure")
+	}
+
+	if code != INVALID_SERVICE {
+		t.Errorf("Expected code to be <INVALID_SERVICE>, got <%s>", code)
+	}
+
+	expected := "Ticket ST-1856339-aA5Yuvrxzpv8Tau1cYQ7 does not match supplied service"
+	if message != expected {
+		t.Errorf("Expected message to be <%s>, got <%s>", expected, message)
+	}
+
+	success := `<cas:serviceResponse xmlns:cas="http://www.yale.edu/tp/cas">
+  <cas:authenticationSuccess>
+    <cas:user>username</cas:user>
+  </cas:authenticationSuccess>
+</cas:serviceResponse>`
+
+	for _, body := range []string{success, "<html><body>Login</body></html>", ""} {
+		if _, _, ok := ParseAuthenticationFailure([]byte(body)); ok {
+			t.Errorf("Expected ParseAuthenticationFailure to report no failure for <%s>", body)
+		}
+	}
+}
+
+func TestUnmarshalSuccessfulServiceResponseWithEntitiesAndCDATA(t *testing.T) {
+	s := `<cas:serviceResponse xmlns:cas="http://www.yale.edu/tp/cas">
+  <cas:authenticationSuccess>
+    <cas:user><![CDATA[o'brien&co]]></cas:user>
+    <cas:attributes>
+      <cas:displayName>Smith &amp; Sons &lt;Ltd&gt;</cas:displayName>
+      <cas:motto><![CDATA[Fish & <Chips>]]></cas:motto>
+      <cas:userAttributes>
+        <cas:attribute name="company">Procter &amp; Gamble</cas:attribute>
+        <cas:attribute name="note"><![CDATA[a < b && c > d]]></cas:attribute>
+        <cas:attribute name="quote">&quot;Don&apos;t panic&quot; &#x2014; HG2G</cas:attribute>
+      </cas:userAttributes>
+    </cas:attributes>
+  </cas:authenticationSuccess>
+</cas:serviceResponse>`
+
+	sr, err := ParseServiceResponse([]byte(s))
+	if err != nil {
+		t.Fatalf("Unmarshal service response failed: %v", err)
+	}
+
+	if sr.User != "o'brien&co" {
+		t.Errorf("Expected User to be <o'brien&co>, got <%s>", sr.User)
+	}
+
+	expected := map[string]string{
+		"displayName": "Smith & Sons <Ltd>",
+		"motto":       "Fish & <Chips>",
+		"company":     "Procter & Gamble",
+		"note":        "a < b && c > d",
+		"quote":       "\"Don't panic\" — HG2G",
+	}
+
+	for name, value := range expected {
+		if v := sr.Attributes.Get(name); v != value {
+			t.Errorf("Expected attribute %s to be <%s>, got <%s>", name, value, v)
+		}
+	}
+}
+
+func TestUnmarshalFailureServiceResponseWithEntities(t *testing.T) {
+	s := `<cas:serviceResponse xmlns:cas="http://www.yale.edu/tp/cas">
+  <cas:authenticationFailure code="INVALID_SERVICE">Ticket &apos;ST-1&apos; does not match &lt;service&gt;</cas:authenticationFailure>
+</cas:serviceResponse>`
+
+	_, err := ParseServiceResponse([]byte(s))
+	if err == nil {
+		t.Fatalf("Expected ParseServiceResponse to return error, got <nil>")
+	}
+
+	expected := "INVALID_SERVICE: Ticket 'ST-1' does not match <service>"
+	if err.Error() != expected {
+		t.Errorf("Expected err to be <%s>, got <%s>", expected, err.Error())
+	}
+}
+
+func TestParseServiceResponseHTML(t *testing.T) {
+	for _, body := range []string{
+		"\n<!DOCTYPE html>\n<html lang=\"en\"><head><title>CAS - Central Authentication Service</title></head></html>",
+		"<HTML><body>Log In</body></HTML>",
+	} {
+		if _, err := ParseServiceResponse([]byte(body)); err != ErrUnexpectedHTMLResponse {
+			t.Errorf("Expected ErrUnexpectedHTMLResponse for %q, got %v", body, err)
+		}
+	}
+}
+
+func TestAuthenticationResponseMerge(t *testing.T) {
+	r := &AuthenticationResponse{
+		User:       "enoch.root",
+		Attributes: UserAttributes{"role": {"reader"}},
+	}
+
+	other := &AuthenticationResponse{
+		User:       "someone.else",
+		Service:    "https://front.example.com/",
+		MemberOf:   []string{"staff"},
+		Attributes: UserAttributes{"role": {"reader", "editor"}, "mail": {"enoch@example.com"}},
+	}
+
+	r.Merge(other)
+
+	if r.User != "enoch.root" {
+		t.Errorf("Expected User to be kept as <enoch.root>, got <%s>", r.User)
+	}
+
+	if r.Service != other.Service {
+		t.Errorf("Expected empty Service to be taken from other, got <%s>", r.Service)
+	}
+
+	if !reflect.DeepEqual(r.Attributes["role"], []string{"reader", "reader", "editor"}) {
+		t.Errorf("Expected role values to be appended, got %v", r.Attributes["role"])
+	}
+
+	if r.Attributes.Get("mail") != "enoch@example.com" {
+		t.Errorf("Expected mail to be added, got <%s>", r.Attributes.Get("mail"))
+	}
+
+	if !reflect.DeepEqual(r.MemberOf, []string{"staff"}) {
+		t.Errorf("Expected MemberOf to be <[staff]>, got %v", r.MemberOf)
+	}
+
+	empty := &AuthenticationResponse{}
+	empty.Merge(other)
+	if empty.User != "someone.else" || len(empty.Attributes) != 2 {
+		t.Errorf("Expected an empty response to take User and Attributes from other, got %+v", empty)
+	}
+}
+
+func TestMergeResponses(t *testing.T) {
+	front := &AuthenticationResponse{User: "enoch.root", MemberOf: []string{"staff"}}
+	front.Attributes = make(UserAttributes)
+	front.addAttribute("role", "reader")
+	front.addAttribute("mail", "enoch@example.com")
+
+	back := &AuthenticationResponse{
+		User:     "enoch.root",
+		Service:  "https://back.example.com/",
+		Proxies:  []string{"https://front.example.com/"},
+		MemberOf: []string{"staff", "admin"},
+	}
+	back.Attributes = make(UserAttributes)
+	back.addAttribute("role", "reader")
+	back.addAttribute("role", "editor")
+
+	merged, err := MergeResponses(front, nil, back)
+	if err != nil {
+		t.Fatalf("Expected MergeResponses to succeed, got error: %v", err)
+	}
+
+	if merged.User != "enoch.root" || merged.Service != back.Service {
+		t.Errorf("Expected User and Service to be merged, got <%s> and <%s>", merged.User, merged.Service)
+	}
+
+	if !reflect.DeepEqual(merged.Attributes["role"], []string{"reader", "editor"}) {
+		t.Errorf("Expected role values to be a union, got %v", merged.Attributes["role"])
+	}
+
+	if !reflect.DeepEqual(merged.MemberOf, []string{"staff", "admin"}) {
+		t.Errorf("Expected MemberOf to be a union, got %v", merged.MemberOf)
+	}
+
+	if len(merged.Proxies) != 0 {
+		t.Errorf("Expected Proxies to be taken from the first response, got %v", merged.Proxies)
+	}
+
+	if n := len(merged.OrderedAttributes()); n != 3 {
+		t.Errorf("Expected 3 ordered attributes, got <%v>", n)
+	}
+
+	if len(front.Attributes["role"]) != 1 {
+		t.Errorf("Expected the responses not to be modified, got %v", front.Attributes["role"])
+	}
+
+	if merged, err := MergeResponses(nil); merged != nil || err != nil {
+		t.Errorf("Expected no responses to merge to nil, got <%v> and error <%v>", merged, err)
+	}
+}
+
+func TestMergeResponsesUserMismatch(t *testing.T) {
+	_, err := MergeResponses(&AuthenticationResponse{User: "enoch.root"}, &AuthenticationResponse{User: "someone.else"})
+	if !errors.Is(err, ErrUserMismatch) {
+		t.Errorf("Expected error to be <%v>, got <%v>", ErrUserMismatch, err)
+	}
+}
+
+func TestOrderedAttributes(t *testing.T) {
+	xmlBody := `<cas:serviceResponse xmlns:cas="http://www.yale.edu/tp/cas">
+  <cas:authenticationSuccess>
+    <cas:user>enoch.root</cas:user>
+    <cas:attributes>
+      <cas:eduPersonAffiliation>staff</cas:eduPersonAffiliation>
+      <cas:mail>enoch@example.com</cas:mail>
+      <cas:eduPersonAffiliation>member</cas:eduPersonAffiliation>
+      <cas:cn>Enoch Root</cas:cn>
+    </cas:attributes>
+  </cas:authenticationSuccess>
+</cas:serviceResponse>`
+
+	jsonBody := `{"serviceResponse":{"authenticationSuccess":{"user":"enoch.root","attributes":{
+  "eduPersonAffiliation":["staff"],"mail":"enoch@example.com","zone":["member"],"cn":"Enoch Root"}}}}`
+
+	cases := []struct {
+		body     string
+		format   Format
+		expected []Attribute
+	}{
+		{xmlBody, FormatXML, []Attribute{
+			{"eduPersonAffiliation", "staff"},
+			{"mail", "enoch@example.com"},
+			{"eduPersonAffiliation", "member"},
+			{"cn", "Enoch Root"},
+		}},
+		{jsonBody, FormatJSON, []Attribute{
+			{"eduPersonAffiliation", "staff"},
+			{"mail", "enoch@example.com"},
+			{"zone", "member"},
+			{"cn", "Enoch Root"},
+		}},
+	}
+
+	for _, c := range cases {
+		r, err := ParseValidationBody([]byte(c.body), c.format)
+		if err != nil {
+			t.Fatalf("Expected %v response to parse, got error: %v", c.format, err)
+		}
+
+		if got := r.OrderedAttributes(); !reflect.DeepEqual(got, c.expected) {
+			t.Errorf("Expected %v ordered attributes to be %v, got %v", c.format, c.expected, got)
+		}
+	}
+}
+
+func TestParseServiceResponseStream(t *testing.T) {
+	s := `<?xml version="1.0"?>
+<cas:serviceResponse xmlns:cas="http://www.yale.edu/tp/cas">
+  <cas:authenticationSuccess>
+    <cas:user>username</cas:user>
+    <cas:attributes>
+      <cas:authenticationDate>2015-02-10T14:28:42Z</cas:authenticationDate>
+      <cas:memberOf>staff</cas:memberOf>
+      <cas:displayName>Enoch Root</cas:displayName>
+      <cas:mail>enoch.root@example.com</cas:mail>
+    </cas:attributes>
+    <cas:proxyGrantingTicket>PGTIOU-84678-8a9d...</cas:proxyGrantingTicket>
+  </cas:authenticationSuccess>
+</cas:serviceResponse>`
+
+	expected, err := ParseServiceResponse([]byte(s))
+	if err != nil {
+		t.Fatalf("Expected ParseServiceResponse to succeed, got error: %v", err)
+	}
+
+	sr, err := ParseServiceResponseStream(strings.NewReader(s))
+	if err != nil {
+		t.Fatalf("Expected ParseServiceResponseStream to succeed, got error: %v", err)
+	}
+
+	if !reflect.DeepEqual(sr, expected) {
+		t.Errorf("Expected the streamed response to be <%#v>, got <%#v>", expected, sr)
+	}
+
+	latin1 := append([]byte("<?xml version=\"1.0\" encoding=\"ISO-8859-1\"?>\n"), latin1ServiceResponse...)
+	sr, err = ParseServiceResponseStream(bytes.NewReader(latin1))
+	if err != nil {
+		t.Fatalf("Expected ParseServiceResponseStream to succeed for ISO-8859-1, got error: %v", err)
+	}
+
+	if v := sr.Attributes.Get("displayName"); v != "José Müller" {
+		t.Errorf("Expected displayName to be <José Müller>, got <%s>", v)
+	}
+
+	failure := `<cas:serviceResponse xmlns:cas="http://www.yale.edu/tp/cas">
+  <cas:authenticationFailure code="INVALID_TICKET">Ticket not recognized</cas:authenticationFailure>
+</cas:serviceResponse>`
+
+	var authErr *AuthenticationError
+	if _, err := ParseServiceResponseStream(strings.NewReader(failure)); !errors.As(err, &authErr) || authErr.Code != INVALID_TICKET {
+		t.Errorf("Expected an INVALID_TICKET authentication error, got <%v>", err)
+	}
+}
+
+func TestParseServiceResponsePGTIOU(t *testing.T) {
+	attributes := `
+    <cas:attributes>
+      <cas:displayName>Enoch Root</cas:displayName>
+      <cas:memberOf>staff</cas:memberOf>
+    </cas:attributes>`
+	pgt := `
+    <cas:proxyGrantingTicket>
+      PGTIOU-84678-8a9d2sfa23casd
+    </cas:proxyGrantingTicket>`
+
+	responses := map[string]string{
+		"before attributes": pgt + attributes,
+		"after attributes":  attributes + pgt,
+		"malformed attribute": pgt + `
+    <cas:attributes>
+      <cas:displayName>Enoch Root</cas:displayName>
+      <cas:memberOf>staff</cas:memberOf>
+      <cas:authenticationDate>yesterday</cas:authenticationDate>
+    </cas:attributes>`,
+	}
+
+	for name, inner := range responses {
+		s := `<cas:serviceResponse xmlns:cas="http://www.yale.edu/tp/cas">
+  <cas:authenticationSuccess>
+    <cas:user>enoch.root</cas:user>` + inner + `
+  </cas:authenticationSuccess>
+</cas:serviceResponse>`
+
+		sr, err := parseServiceResponse([]byte(s), parseOptions{logger: NoopLogger(), lenient: true})
+		if err != nil {
+			t.Errorf("Expected the response with the PGT %s to parse, got error: %v", name, err)
+			continue
+		}
+
+		if iou := sr.PGTIOU(); iou != "PGTIOU-84678-8a9d2sfa23casd" {
+			t.Errorf("Expected PGTIOU with the PGT %s to be <PGTIOU-84678-8a9d2sfa23casd>, got <%s>", name, iou)
+		}
+
+		if v := sr.Attributes.Get("displayName"); v != "Enoch Root" {
+			t.Errorf("Expected displayName with the PGT %s to be <Enoch Root>, got <%s>", name, v)
+		}
+
+		if !reflect.DeepEqual(sr.MemberOf, []string{"staff"}) {
+			t.Errorf("Expected MemberOf with the PGT %s to be <[staff]>, got <%v>", name, sr.MemberOf)
+		}
+
+		if v := sr.Attributes.Get("proxyGrantingTicket"); v != "" {
+			t.Errorf("Expected the PGT %s not to be an attribute, got <%s>", name, v)
+		}
+	}
+}
+
+func TestParseServiceResponseTrimsWhitespace(t *testing.T) {
+	s := `<cas:serviceResponse xmlns:cas="http://www.yale.edu/tp/cas">
+  <cas:authenticationSuccess>
+    <cas:user>
+      enoch.root
+    </cas:user>
+    <cas:attributes>
+      <cas:email>
+        enoch.root@example.com
+      </cas:email>
+    </cas:attributes>
+  </cas:authenticationSuccess>
+</cas:serviceResponse>`
+
+	sr, err := ParseServiceResponse([]byte(s))
+	if err != nil {
+		t.Fatalf("Expected ParseServiceResponse to succeed, got error: %v", err)
+	}
+
+	if sr.User != "enoch.root" {
+		t.Errorf("Expected User to be <enoch.root>, got %q", sr.User)
+	}
+
+	if v := sr.Attributes.Get("email"); v != "enoch.root@example.com" {
+		t.Errorf("Expected email to be <enoch.root@example.com>, got %q", v)
+	}
+
+	sr, err = parseServiceResponse([]byte(s), parseOptions{logger: NoopLogger(), preserveWhitespace: true})
+	if err != nil {
+		t.Fatalf("Expected parseServiceResponse to succeed, got error: %v", err)
+	}
+
+	if want := "\n      enoch.root\n    "; sr.User != want {
+		t.Errorf("Expected User to be %q with whitespace preserved, got %q", want, sr.User)
+	}
+}
+
+func TestParseServiceResponseVendorRoot(t *testing.T) {
+	s := `<?xml version="1.0" encoding="UTF-8"?>
+<idp:response xmlns:idp="urn:example:idp:1.0" xmlns:cas="http://www.yale.edu/tp/cas" version="4.2">
+  <idp:status>OK</idp:status>
+  <cas:authenticationSuccess>
+    <cas:user>enoch.root</cas:user>
+    <cas:attributes>
+      <cas:mail>enoch.root@example.com</cas:mail>
+    </cas:attributes>
+  </cas:authenticationSuccess>
+</idp:response>`
+
+	var parseErr *ParseError
+	if _, err := ParseServiceResponse([]byte(s)); !errors.As(err, &parseErr) {
+		t.Errorf("Expected ParseServiceResponse to reject the vendor root element by default, got %v", err)
+	}
+
+	sr, err := parseServiceResponse([]byte(s), parseOptions{logger: NoopLogger(), lenient: true})
+	if err != nil {
+		t.Fatalf("Expected the vendor response to parse with LenientParsing, got error: %v", err)
+	}
+
+	if sr.User != "enoch.root" {
+		t.Errorf("Expected User to be <enoch.root>, got <%s>", sr.User)
+	}
+
+	if v := sr.Attributes.Get("mail"); v != "enoch.root@example.com" {
+		t.Errorf("Expected mail to be <enoch.root@example.com>, got <%s>", v)
+	}
+
+	if _, err := parseServiceResponse([]byte(s), parseOptions{logger: NoopLogger(), strict: true, lenient: true}); err == nil {
+		t.Errorf("Expected StrictParsing to reject the vendor root element despite LenientParsing")
+	}
+
+	failure := `<idp:response xmlns:idp="urn:example:idp:1.0" xmlns:cas="http://www.yale.edu/tp/cas">
+  <cas:authenticationFailure code="INVALID_TICKET">Ticket ST-123 not recognized</cas:authenticationFailure>
+</idp:response>`
+
+	_, err = parseServiceResponse([]byte(failure), parseOptions{logger: NoopLogger(), lenient: true})
+	var authErr *AuthenticationError
+	if !errors.As(err, &authErr) || authErr.Code != INVALID_TICKET {
+		t.Errorf("Expected an INVALID_TICKET AuthenticationError, got <%v>", err)
+	}
+
+	if _, err := parseServiceResponse([]byte(`<idp:response xmlns:idp="urn:example:idp:1.0"><idp:status>OK</idp:status></idp:response>`), parseOptions{logger: NoopLogger(), lenient: true}); err == nil {
+		t.Errorf("Expected a vendor response without authenticationSuccess to be rejected")
+	}
+}
+
+func TestParseServiceResponseWarnings(t *testing.T) {
+	s := `<cas:serviceResponse xmlns:cas="http://www.yale.edu/tp/cas">
+  <cas:authenticationSuccess>
+    <cas:user>enoch.root</cas:user>
+  </cas:authenticationSuccess>
+  <cas:authenticationFailure code="INTERNAL_ERROR">Attribute release policy could not be evaluated</cas:authenticationFailure>
+  <cas:warning>
+    Password expires in 3 days
+  </cas:warning>
+</cas:serviceResponse>`
+
+	sr, err := parseServiceResponse([]byte(s), parseOptions{logger: NoopLogger()})
+	if err != nil {
+		t.Fatalf("Expected the success to be preferred, got error: %v", err)
+	}
+
+	if sr.User != "enoch.root" {
+		t.Errorf("Expected User to be <enoch.root>, got <%s>", sr.User)
+	}
+
+	expected := []string{"Password expires in 3 days", "INTERNAL_ERROR: Attribute release policy could not be evaluated"}
+	if !reflect.DeepEqual(sr.Warnings, expected) {
+		t.Errorf("Expected Warnings to be <%q>, got <%q>", expected, sr.Warnings)
+	}
+
+	j := `{"serviceResponse": {
+  "authenticationSuccess": {"user": "enoch.root"},
+  "authenticationFailure": {"code": "INTERNAL_ERROR", "description": "Attribute release policy could not be evaluated"}
+}}`
+
+	sr, err = parseJSONServiceResponse([]byte(j), parseOptions{logger: NoopLogger()})
+	if err != nil {
+		t.Fatalf("Expected the JSON success to be preferred, got error: %v", err)
+	}
+
+	if !reflect.DeepEqual(sr.Warnings, expected[1:]) {
+		t.Errorf("Expected Warnings to be <%q>, got <%q>", expected[1:], sr.Warnings)
+	}
+}
+
+func TestParseServiceResponseWithoutAttributes(t *testing.T) {
+	s := `<cas:serviceResponse xmlns:cas="http://www.yale.edu/tp/cas">
+  <cas:authenticationSuccess>
+    <cas:user>enoch.root</cas:user>
+  </cas:authenticationSuccess>
+</cas:serviceResponse>`
+
+	xmlResponse, err := parseServiceResponse([]byte(s), parseOptions{logger: NoopLogger()})
+	if err != nil {
+		t.Fatalf("Expected the response to parse, got error: %v", err)
+	}
+
+	streamResponse, err := parseServiceResponseStream(strings.NewReader(s), parseOptions{logger: NoopLogger()})
+	if err != nil {
+		t.Fatalf("Expected the response stream to parse, got error: %v", err)
+	}
+
+	jsonResponse, err := parseJSONServiceResponse([]byte(`{"serviceResponse": {"authenticationSuccess": {"user": "enoch.root"}}}`), parseOptions{logger: NoopLogger()})
+	if err != nil {
+		t.Fatalf("Expected the JSON response to parse, got error: %v", err)
+	}
+
+	cas1Response, err := parseCas1Response("yes\nenoch.root\n")
+	if err != nil {
+		t.Fatalf("Expected the CAS 1 response to parse, got error: %v", err)
+	}
+
+	merged, _ := MergeResponses(&AuthenticationResponse{User: "enoch.root"})
+
+	for name, r := range map[string]*AuthenticationResponse{
+		"xml": xmlResponse, "stream": streamResponse, "json": jsonResponse, "cas1": cas1Response, "merged": merged,
+	} {
+		if r.User != "enoch.root" {
+			t.Errorf("Expected %s User to be <enoch.root>, got <%s>", name, r.User)
+		}
+
+		if r.Attributes == nil || len(r.Attributes) != 0 {
+			t.Errorf("Expected %s Attributes to be empty but not nil, got %#v", name, r.Attributes)
+		}
+	}
+}
+
+func TestParseServiceResponseAuthenticationErrorCodes(t *testing.T) {
+	for _, code := range []string{INVALID_TICKET, INVALID_SERVICE} {
+		s := `<cas:serviceResponse xmlns:cas="http://www.yale.edu/tp/cas">
+	<cas:authenticationFailure code="` + code + `">Ticket ST-123 rejected</cas:authenticationFailure>
+</cas:serviceResponse>`
+
+		_, err := ParseServiceResponse([]byte(s))
+
+		var authErr *AuthenticationError
+		if !errors.As(err, &authErr) {
+			t.Fatalf("Expected an *AuthenticationError for %s, got %v", code, err)
+		}
+
+		if authErr.Code != code {
+			t.Errorf("Expected Code to be <%s>, got <%s>", code, authErr.Code)
+		}
+
+		if authErr.Message != "Ticket ST-123 rejected" {
+			t.Errorf("Expected Message to be <Ticket ST-123 rejected>, got <%s>", authErr.Message)
+		}
+
+		var parseErr *ParseError
+		if errors.As(err, &parseErr) {
+			t.Errorf("Expected an authenticationFailure not to be a *ParseError, got %v", err)
+		}
+	}
+}
+
+func TestParseServiceResponseMalformedXML(t *testing.T) {
+	s := `<cas:serviceResponse xmlns:cas="http://www.yale.edu/tp/cas">
+	<cas:authenticationFailure code="INVALID_TICKET">Ticket ST-123 not recognized`
+
+	_, err := ParseServiceResponse([]byte(s))
+
+	var parseErr *ParseError
+	if !errors.As(err, &parseErr) {
+		t.Fatalf("Expected a *ParseError, got %v", err)
+	}
+
+	var syntaxErr *xml.SyntaxError
+	if !errors.As(err, &syntaxErr) {
+		t.Errorf("Expected the *ParseError to wrap the *xml.SyntaxError, got %v", parseErr.Err)
+	}
+
+	var authErr *AuthenticationError
+	if errors.As(err, &authErr) {
+		t.Errorf("Expected malformed XML not to be an *AuthenticationError, got %v", err)
+	}
+}
+
+func TestOrderedAttributesFollowAttributes(t *testing.T) {
+	s := `<cas:serviceResponse xmlns:cas="http://www.yale.edu/tp/cas">
+  <cas:authenticationSuccess>
+    <cas:user>enoch.root</cas:user>
+    <cas:attributes>
+      <cas:eduPersonAffiliation>staff</cas:eduPersonAffiliation>
+      <cas:mail>enoch@example.com</cas:mail>
+      <cas:eduPersonAffiliation>member</cas:eduPersonAffiliation>
+      <cas:cn>Enoch Root</cas:cn>
+    </cas:attributes>
+  </cas:authenticationSuccess>
+</cas:serviceResponse>`
+
+	r, err := ParseServiceResponse([]byte(s))
+	if err != nil {
+		t.Fatalf("Expected ParseServiceResponse to succeed, got error: %v", err)
+	}
+
+	// As a PrincipalMapper might, without going through an AttributeTransform
+	delete(r.Attributes, "mail")
+	r.Attributes["eduPersonAffiliation"] = []string{"staff"}
+	r.Attributes.Add("uid", "eroot")
+	r.Attributes.Add("department", "cryptography")
+
+	expected := []Attribute{
+		{"eduPersonAffiliation", "staff"},
+		{"cn", "Enoch Root"},
+		{"department", "cryptography"},
+		{"uid", "eroot"},
+	}
+
+	if got := r.OrderedAttributes(); !reflect.DeepEqual(got, expected) {
+		t.Errorf("Expected ordered attributes to be %v, got %v", expected, got)
+	}
+}
@@ -0,0 +1,76 @@
+package cas
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// ServiceURLFromRequest reconstructs the externally visible URL of r, without the ticket and
+// other CAS parameters, for use as the service URL.
+//
+// The X-Forwarded-Proto and X-Forwarded-Host headers set by a load balancer or reverse proxy
+// are only honoured when trustForwarded is true, as clients can set them to any value.
+func ServiceURLFromRequest(r *http.Request, trustForwarded bool) *url.URL {
+	return sanitisedURL(absoluteURL(r, trustForwarded))
+}
+
+// AssertServiceMatch reports whether the service URLs used for login and for validation are
+// sent to the CAS server as identical service parameters, which CAS requires. The returned
+// error wraps ErrServiceMismatch and shows both encoded values. It allows integrators to unit
+// test their own URL construction against the encoding of this package. With
+// NormaliseTrailingSlash use the AssertServiceMatch method of the validator instead.
+func AssertServiceMatch(loginService, validateService *url.URL) error {
+	return assertServiceMatch(loginService, validateService, false)
+}
+
+// AssertServiceMatch is the package level AssertServiceMatch encoding the service URLs as the
+// validator sends them, with the trailing slash canonicalised if NormaliseTrailingSlash is set.
+func (validator *ServiceTicketValidator) AssertServiceMatch(loginService, validateService *url.URL) error {
+	return assertServiceMatch(loginService, validateService, validator.NormaliseTrailingSlash)
+}
+
+// assertServiceMatch compares the service parameters of the URLs, see AssertServiceMatch.
+func assertServiceMatch(loginService, validateService *url.URL, normalise bool) error {
+	login := serviceURLString(loginService, normalise)
+	validate := serviceURLString(validateService, normalise)
+
+	if login != validate {
+		return fmt.Errorf("%w: login sends %q, validation sends %q", ErrServiceMismatch, login, validate)
+	}
+
+	return nil
+}
+
+// absoluteURL determines an absolute URL from the http.Request.
+func absoluteURL(r *http.Request, trustForwarded bool) *url.URL {
+	u := *r.URL
+	u.Host = r.Host
+
+	u.Scheme = "http"
+	if r.TLS != nil {
+		u.Scheme = "https"
+	}
+
+	if trustForwarded {
+		if host := forwardedValue(r.Header.Get("X-Forwarded-Host")); host != "" {
+			u.Host = host
+		}
+
+		if scheme := forwardedValue(r.Header.Get("X-Forwarded-Proto")); scheme != "" {
+			u.Scheme = scheme
+		}
+	}
+
+	return &u
+}
+
+// forwardedValue returns the first of the comma separated values added by each proxy.
+func forwardedValue(header string) string {
+	if i := strings.IndexByte(header, ','); i >= 0 {
+		header = header[:i]
+	}
+
+	return strings.TrimSpace(header)
+}
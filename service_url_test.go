@@ -0,0 +1,104 @@
+package cas
+
+import (
+	"crypto/tls"
+	"errors"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+func TestServiceURLFromRequest(t *testing.T) {
+	cases := []struct {
+		name           string
+		target         string
+		tls            bool
+		headers        map[string]string
+		trustForwarded bool
+		expected       string
+	}{
+		{
+			name:     "plain",
+			target:   "http://app.internal:8080/orders?id=4&ticket=ST-123",
+			expected: "http://app.internal:8080/orders?id=4",
+		},
+		{
+			name:     "tls",
+			target:   "https://app.example.com/orders?ticket=ST-123",
+			tls:      true,
+			expected: "https://app.example.com/orders",
+		},
+		{
+			name:           "trusted forwarded headers",
+			target:         "http://app.internal:8080/orders?ticket=ST-123",
+			headers:        map[string]string{"X-Forwarded-Proto": "https", "X-Forwarded-Host": "app.example.com"},
+			trustForwarded: true,
+			expected:       "https://app.example.com/orders",
+		},
+		{
+			name:           "forwarded through several proxies",
+			target:         "http://app.internal:8080/orders",
+			headers:        map[string]string{"X-Forwarded-Proto": "https, http", "X-Forwarded-Host": "app.example.com, lb.internal"},
+			trustForwarded: true,
+			expected:       "https://app.example.com/orders",
+		},
+		{
+			name:     "untrusted forwarded headers",
+			target:   "http://app.internal:8080/orders",
+			headers:  map[string]string{"X-Forwarded-Proto": "https", "X-Forwarded-Host": "evil.example.com"},
+			expected: "http://app.internal:8080/orders",
+		},
+	}
+
+	for _, c := range cases {
+		r := httptest.NewRequest("GET", c.target, nil)
+		if !c.tls {
+			r.TLS = nil
+		} else if r.TLS == nil {
+			r.TLS = &tls.ConnectionState{}
+		}
+
+		for k, v := range c.headers {
+			r.Header.Set(k, v)
+		}
+
+		if u := ServiceURLFromRequest(r, c.trustForwarded); u.String() != c.expected {
+			t.Errorf("%s: expected service URL to be <%s>, got <%s>", c.name, c.expected, u)
+		}
+	}
+}
+
+func TestAssertServiceMatch(t *testing.T) {
+	login, _ := url.Parse("https://app.example.com/orders?id=4&renew=true")
+	validate, _ := url.Parse("https://app.example.com/orders?ticket=ST-123&id=4")
+
+	if err := AssertServiceMatch(login, validate); err != nil {
+		t.Errorf("Expected the service URLs to match, got error: %v", err)
+	}
+
+	validate, _ = url.Parse("https://app.example.com:443/orders?id=4")
+	if err := AssertServiceMatch(login, validate); err != nil {
+		t.Errorf("Expected the default port to be dropped, got error: %v", err)
+	}
+
+	validate, _ = url.Parse("https://app.example.com:8443/orders?id=4")
+	err := AssertServiceMatch(login, validate)
+	if !errors.Is(err, ErrServiceMismatch) {
+		t.Errorf("Expected an ErrServiceMismatch for differing hosts, got %v", err)
+	}
+}
+
+func TestValidatorAssertServiceMatch(t *testing.T) {
+	login, _ := url.Parse("https://app.example.com/orders/")
+	validate, _ := url.Parse("https://app.example.com/orders")
+
+	if err := AssertServiceMatch(login, validate); !errors.Is(err, ErrServiceMismatch) {
+		t.Errorf("Expected an ErrServiceMismatch for differing trailing slashes, got %v", err)
+	}
+
+	validator := NewServiceTicketValidator(nil, login)
+	validator.NormaliseTrailingSlash = true
+	if err := validator.AssertServiceMatch(login, validate); err != nil {
+		t.Errorf("Expected the service URLs to match with NormaliseTrailingSlash, got error: %v", err)
+	}
+}
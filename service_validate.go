@@ -1,144 +1,999 @@
 package cas
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"io"
 	"log/slog"
 	"net/http"
 	"net/url"
-	"path"
+	"sync"
+	"sync/atomic"
+	"time"
 )
 
+// ServiceTicketValidator errors
+var (
+	// The service echoed in the validation response differs from the service sent
+	ErrServiceMismatch = errors.New("cas: validate ticket: service mismatch")
+
+	// The ProxyCallbackURL does not use https, which the CAS server requires
+	ErrInsecureProxyCallbackURL = errors.New("cas: validate ticket: proxy callback URL must use https")
+
+	// Drain was called on the validator, which no longer starts validations
+	ErrDraining = errors.New("cas: validate ticket: validator is draining")
+
+	// RequireAttributes is set and the CAS server only supports CAS 1, which has no attributes
+	ErrAttributesUnavailable = errors.New("cas: validate ticket: attributes required but the server only supports CAS 1")
+
+	// RequireFreshLogin is set and the ticket was not issued following a new login
+	ErrStaleAuthentication = errors.New("cas: validate ticket: ticket not issued following a new login")
+
+	// An attribute listed in RequiredAttributes is absent from the validation response
+	ErrMissingRequiredAttribute = errors.New("cas: validate ticket: required attribute missing")
+
+	// The CAS server answered with its maintenance response, see MaintenanceDetector
+	ErrCASMaintenance = errors.New("cas: validate ticket: CAS server is in maintenance")
+
+	// A proxy ticket was proxied by more than MaxProxyDepth proxies
+	ErrProxyChainTooDeep = errors.New("cas: validate proxy ticket: proxy chain too deep")
+
+	// The CAS server does not serve the validation endpoint of the minimum ProtocolVersion
+	ErrProtocolVersionUnsupported = errors.New("cas: validate ticket: protocol version not supported by the CAS server")
+
+	// The CAS server answered proxyValidate with 404, as servers only serving serviceValidate do
+	ErrProxyValidationUnsupported = errors.New("cas: validate proxy ticket: proxyValidate not served by the CAS server")
+
+	// The response of the proxy endpoint has neither a proxy ticket nor a proxyFailure
+	ErrNoProxyTicket = errors.New("cas: request proxy ticket: no proxy ticket in the response")
+
+	// The validation response is longer than MaxResponseBytes
+	ErrResponseTooLarge = errors.New("cas: validate ticket: response too large")
+)
+
+// TicketValidator validates service tickets. *ServiceTicketValidator is the default implementation,
+// alternatives can be supplied to Options and RestOptions, for example to fake validation in tests.
+type TicketValidator interface {
+	// ValidateTicket validates the ticket for the service.
+	ValidateTicket(serviceURL *url.URL, ticket string) (*AuthenticationResponse, error)
+
+	// ValidateTicketContext validates the ticket for the service, the request is bound to ctx.
+	ValidateTicketContext(ctx context.Context, serviceURL *url.URL, ticket string) (*AuthenticationResponse, error)
+}
+
 // NewServiceTicketValidator create a new *ServiceTicketValidator
 func NewServiceTicketValidator(client *http.Client, casURL *url.URL) *ServiceTicketValidator {
 	return &ServiceTicketValidator{
 		client: client,
-		casURL: casURL,
+		casURL: baseURL(casURL),
 	}
 }
 
+// SetCasURL points the validator at another CAS server, such as during a migration, without
+// restarting. The cached protocol version is invalidated as it describes the old server.
+// Validations already in flight may still complete against the old URL.
+func (validator *ServiceTicketValidator) SetCasURL(casURL *url.URL) {
+	validator.mu.Lock()
+	validator.casURL = baseURL(casURL)
+	validator.endpoints = nil
+	validator.mu.Unlock()
+
+	validator.InvalidateProtocolCache()
+}
+
+// currentCasURL returns the CAS URL, which SetCasURL may change concurrently.
+func (validator *ServiceTicketValidator) currentCasURL() *url.URL {
+	validator.mu.Lock()
+	defer validator.mu.Unlock()
+
+	return validator.casURL
+}
+
 // ServiceTicketValidator is responsible for the validation of a service ticket
 type ServiceTicketValidator struct {
 	client *http.Client
 	casURL *url.URL
+
+	Logger *slog.Logger // Custom logger, if nil slog.Default() will be used
+
+	// StrictParsing fails validation when a JSON attribute is malformed instead of skipping it,
+	// or when the response body fails to close, and decodes XML responses as they are read. XML
+	// responses are decoded strictly by default, a malformed attribute element or an unexpected
+	// root element failing them with a *ParseError. StrictParsing takes precedence over
+	// LenientParsing, which is ignored when both are set.
+	StrictParsing bool
+
+	// LenientParsing recovers XML responses which do not decode, skipping attribute elements
+	// which can not be parsed with a warning, and reading a response whose root element is not
+	// cas:serviceResponse, as sent by some CAS compatible identity providers, from its first
+	// authenticationSuccess or authenticationFailure element. See StrictParsing.
+	LenientParsing bool
+
+	// PreserveAttributeWhitespace keeps the whitespace around the user and attribute values of
+	// responses. By default it is trimmed, as it is almost always the indentation of pretty
+	// printed XML rather than part of the value.
+	PreserveAttributeWhitespace bool
+
+	// CharsetReader, if set, converts responses in a charset other than UTF-8, named by the
+	// Content-Type header or the XML declaration, to UTF-8, replacing DefaultCharsetReader.
+	CharsetReader func(charset string, input io.Reader) (io.Reader, error)
+
+	// AllowInsecureCasURL permits validation against a non-https CAS URL. Tickets are sent in
+	// cleartext, so this should only be used for local development.
+	AllowInsecureCasURL bool
+
+	// AttributeTransforms are applied in order to the attributes of each successfully parsed
+	// response, before the PrincipalAttribute and PrincipalMapper.
+	AttributeTransforms []AttributeTransform
+
+	// PrincipalAttribute names an attribute which, when released, replaces the User of the
+	// response. The cas:user value is kept when empty or the attribute is absent.
+	PrincipalAttribute string
+
+	// PrincipalMapper is invoked with each successfully parsed response before it is returned,
+	// and so before it is stored by a Client, to normalise the User and Attributes in one place.
+	// An error fails the validation.
+	PrincipalMapper func(*AuthenticationResponse) error
+
+	// PrincipalMapping names the attributes read by AuthenticationResponse.Principal for the
+	// responses of the validator, DefaultPrincipalMapping if nil.
+	PrincipalMapping *PrincipalMapping
+
+	// ProtocolCacheTTL is how long the validator remembers that the CAS server only supports
+	// CAS 1, skipping the serviceValidate request which would return 404. Zero uses
+	// DefaultProtocolCacheTTL and a negative value disables the cache.
+	ProtocolCacheTTL time.Duration
+
+	// ResponseTrace, if set, is called with the body of each validation response before it is
+	// parsed. Saving the body captures a real exchange once, so the parsing and mapping of the
+	// response can be replayed with ValidateCapturedResponse:
+	//
+	//	validator.ResponseTrace = func(f cas.Format, body []byte) { os.WriteFile("response.txt", body, 0600) }
+	ResponseTrace func(format Format, body []byte)
+
+	// ResponseTee, if set, is called with each validation response and the body is copied to
+	// the returned writer, if not nil, as it is read and parsed. Unlike ResponseTrace the body
+	// is not held in memory, so streamed responses stay streamed. An error writing fails the
+	// validation.
+	ResponseTee func(resp *http.Response) io.Writer
+
+	// NormaliseTrailingSlash sends the service URL in a canonical form, with an empty path as
+	// "/" and no trailing slash on any other path, so https://app and https://app/, or
+	// https://app/a and https://app/a/, are the same service. Login and validation must agree,
+	// so set Options.NormaliseTrailingSlash when the validator is used by a Client.
+	NormaliseTrailingSlash bool
+
+	// TicketRouter, if set, is called with each ticket and may return the URL of the CAS server
+	// to validate it with instead of the default CAS URL, for clusters without a shared ticket
+	// registry whose tickets must be validated by the node which issued them, such as one named
+	// by a suffix of the ticket. The URL is used when the second result is true.
+	TicketRouter func(ticket string) (casURL *url.URL, ok bool)
+
+	// CircuitBreaker, if set, fails validations fast with ErrCircuitOpen while the CAS host is
+	// failing, instead of waiting for a timeout on every login during an outage.
+	CircuitBreaker *CircuitBreaker
+
+	// AcceptableStatuses are status codes of validation responses which are parsed in addition
+	// to 200, for gateways in front of CAS answering with a 203 for example. A 404 of the
+	// serviceValidate endpoint falls back to CAS 1 whatever the list.
+	AcceptableStatuses []int
+
+	// DefaultHeaders are sent with every request to the CAS server, such as an API gateway key
+	// or a marker header, replacing any header of the same name set by the validator.
+	DefaultHeaders http.Header
+
+	// HostHeaderOverride, if set, is sent as the Host header of validation requests, for
+	// virtual hosted CAS servers reached through an address other than their configured name.
+	// Unlike HTTPClientOptions.TLSServerName it does not affect the TLS handshake.
+	HostHeaderOverride string
+
+	// UserAgent is the User-Agent header of requests to the CAS server, DefaultUserAgent if
+	// empty. A User-Agent in DefaultHeaders takes precedence.
+	UserAgent string
+
+	// RetryPolicy, if set, retries requests to the CAS server which fail with a connection error
+	// or a 5xx response, such as a 502 during a rolling restart of the CAS servers.
+	RetryPolicy *RetryPolicy
+
+	// ProtocolVersion is the version of the CAS protocol spoken by the server. By default
+	// serviceValidate is used, falling back to the CAS 1 validate endpoint when it is not found.
+	// ProtocolVersion1 uses validate directly. ProtocolVersion2 and ProtocolVersion3 are
+	// minimum versions which disable the fallback, ProtocolVersion3 also routing validation
+	// through p3/serviceValidate and p3/proxyValidate, which release attributes.
+	ProtocolVersion ProtocolVersion
+
+	// ResponseFormat selects how a CAS 3.0 JSON response is requested, see FormatNegotiation.
+	// The response is parsed according to its Content-Type, whichever format was requested.
+	ResponseFormat FormatNegotiation
+
+	// DeduplicateValidations shares one CAS request and result between concurrent validations
+	// of the same service and ticket, such as duplicate requests, where all but one would
+	// otherwise fail because the ticket was consumed. The callers which wait are bound to the
+	// context of the one making the request.
+	DeduplicateValidations bool
+
+	// ProxyCallbackURL is sent as the pgtUrl parameter of serviceValidate requests, so the CAS
+	// server issues a proxy granting ticket to the callback. It must use https.
+	ProxyCallbackURL *url.URL
+
+	// ProxyGrantingTickets, if set, resolves the IOU of a response to the proxy granting ticket
+	// delivered to the ProxyCallbackURL, see NewProxyCallbackHandler, as its PGT.
+	ProxyGrantingTickets ProxyGrantingTicketStore
+
+	// LoadProtocolVersion and StoreProtocolVersion persist the protocol version outside the
+	// process, for example in a key value store, so short lived runtimes do not probe the
+	// serviceValidate endpoint after every cold start. LoadProtocolVersion is called once,
+	// before the first validation, and returns false when nothing is stored. Both are
+	// optional, without them the cache is only kept in memory.
+	LoadProtocolVersion  func() (version ProtocolVersion, ok bool)
+	StoreProtocolVersion func(version ProtocolVersion)
+
+	// RequireAttributes fails validations with ErrAttributesUnavailable when the CAS server only
+	// supports CAS 1, instead of returning a response without attributes. The CAS 1 validate
+	// endpoint is not called, so the ticket is not consumed.
+	RequireAttributes bool
+
+	// RequiredAttributes fails validations with ErrMissingRequiredAttribute, naming the first
+	// attribute absent from the response. They are checked after AttributeTransforms, so
+	// renamed attributes are listed by their new name.
+	RequiredAttributes []string
+
+	// RequireFreshLogin fails validations with ErrStaleAuthentication unless the CAS server
+	// reports, with the isFromNewLogin attribute, that the user logged in to obtain the ticket
+	// rather than using an existing SSO session. Redirect to login with WithRenew, so CAS
+	// prompts for credentials, and check the ticket with this option, as the renew parameter
+	// is in the URL and can be removed by the user. CAS 1 responses are always stale.
+	RequireFreshLogin bool
+
+	// OperationTimeout, if positive, bounds each validation as a whole, from connecting to the
+	// CAS server to reading and parsing the response and any CAS 1 fallback, failing it with
+	// context.DeadlineExceeded once exceeded. The timeouts of the http.Client still apply.
+	OperationTimeout time.Duration
+
+	// MaxResponseBytes, if positive, limits the length of validation responses read from the
+	// CAS server. Longer responses fail with ErrResponseTooLarge. The limit is enforced on the
+	// bytes read, as the Content-Length is absent from chunked responses and can be wrong.
+	MaxResponseBytes int64
+
+	// WarnOnEmptyAttributes logs a warning with the user and endpoint when a serviceValidate or
+	// proxyValidate success releases no attributes, which usually means the attribute release
+	// policy of the service is misconfigured. CAS 1 responses never carry attributes.
+	WarnOnEmptyAttributes bool
+
+	// ReplayGuard, if set, rejects a ticket presented again within its window with
+	// ErrTicketReplay, before any request to the CAS server. Duplicates are rejected rather
+	// than shared, so it takes precedence over DeduplicateValidations.
+	ReplayGuard *ReplayGuard
+
+	// MaxProxyDepth, if positive, fails proxy ticket validations with ErrProxyChainTooDeep when
+	// the response lists more Proxies, to limit how far a ticket can be passed between services.
+	MaxProxyDepth int
+
+	// MaintenanceDetector reports whether a validation response, by its status code or a marker
+	// in its body, is the maintenance response of the CAS server. The validation then fails with
+	// ErrCASMaintenance instead of a generic error, so applications can show an "SSO temporarily
+	// unavailable" page rather than blaming the ticket, and back off. There is no standard
+	// maintenance response, if nil a 503 Service Unavailable status is treated as maintenance.
+	MaintenanceDetector func(statusCode int, body []byte) bool
+
+	// AuditHook, if set, is called with an AuditRecord of each validation, whether it succeeded
+	// or failed, for audit trails of which attributes were released to whom.
+	AuditHook func(AuditRecord)
+
+	// Counters, if set, counts validation attempts, results, CAS 1 fallbacks and protocol
+	// cache hits.
+	Counters *ExpvarCounters
+
+	// Observer, if set, is notified of the start and the outcome of each validation, with its
+	// duration, the status code of the CAS server and whether it fell back to CAS 1.
+	Observer Observer
+
+	mu              sync.Mutex
+	protocolVersion ProtocolVersion
+	protocolExpires time.Time
+	protocolLoaded  bool
+	endpoints       map[string]*url.URL // endpoint URLs resolved against casURL, see endpointURL
+
+	inflight validationGroup
+	draining int32
+}
+
+// logger returns the configured logger or the slog default.
+func (validator *ServiceTicketValidator) logger() *slog.Logger {
+	if validator.Logger != nil {
+		return validator.Logger
+	}
+
+	return slog.Default()
+}
+
+// parseOptions returns the options used to parse service responses.
+func (validator *ServiceTicketValidator) parseOptions() parseOptions {
+	return parseOptions{
+		logger:             validator.logger(),
+		strict:             validator.StrictParsing,
+		lenient:            validator.LenientParsing,
+		preserveWhitespace: validator.PreserveAttributeWhitespace,
+		charsetReader:      validator.CharsetReader,
+	}
 }
 
 // ValidateTicket validates the service ticket for the given server. The method will try to use the service validate
 // endpoint of the cas >= 2 protocol, if the service validate endpoint not available, the function will use the cas 1
 // validate endpoint.
+// The endpoints are chosen according to the ProtocolVersion of the validator.
 func (validator *ServiceTicketValidator) ValidateTicket(serviceURL *url.URL, ticket string) (*AuthenticationResponse, error) {
-	slog.Info("cas: validating ticket", slog.Any("ticket", ticket), slog.Any("service", serviceURL))
+	return validator.ValidateTicketContext(context.Background(), serviceURL, ticket)
+}
+
+// ValidateTicketContext is ValidateTicket with the requests to the CAS server bound to ctx.
+func (validator *ServiceTicketValidator) ValidateTicketContext(ctx context.Context, serviceURL *url.URL, ticket string) (*AuthenticationResponse, error) {
+	if atomic.LoadInt32(&validator.draining) != 0 {
+		return nil, ErrDraining
+	}
+
+	return validator.validate(ctx, serviceURL, ticket, validator.validateTicket)
+}
+
+// ValidationResult is the result of a validation started with ValidateTicketAsync
+type ValidationResult struct {
+	Response *AuthenticationResponse
+	Err      error
+}
 
-	u, err := validator.ServiceValidateUrl(serviceURL, ticket)
+// ValidateTicketAsync starts ValidateTicketContext in a goroutine, so other work can be done
+// while the CAS server responds. The channel delivers the single result and is then closed.
+// It is buffered, so a caller which abandons it, such as when ctx is done, leaks nothing: the
+// validation ends with the error of ctx and its result is discarded.
+func (validator *ServiceTicketValidator) ValidateTicketAsync(ctx context.Context, serviceURL *url.URL, ticket string) <-chan ValidationResult {
+	result := make(chan ValidationResult, 1)
+	go func() {
+		defer close(result)
+
+		success, err := validator.ValidateTicketContext(ctx, serviceURL, ticket)
+		result <- ValidationResult{Response: success, Err: err}
+	}()
+
+	return result
+}
+
+// ValidateTicketMulti validates the ticket with each of the candidate service URLs in order,
+// for applications behind several hostnames or CDNs where the URL the ticket was issued for
+// may be any of them. It moves on to the next candidate only when the CAS server rejects the
+// service with INVALID_SERVICE, or echoes another service, and returns the last error if no
+// candidate validates.
+//
+// It is best effort: CAS tickets are single use and most servers consume the ticket on the
+// first attempt, whatever the outcome, so a later candidate only validates with a server which
+// tolerates the repeated attempts. Put the most likely URL first. The ReplayGuard, if set, only
+// checks the ticket once.
+func (validator *ServiceTicketValidator) ValidateTicketMulti(ctx context.Context, candidates []*url.URL, ticket string) (*AuthenticationResponse, error) {
+	err := errors.New("cas: validate ticket: no candidate service URLs")
+	for i, serviceURL := range candidates {
+		if i > 0 {
+			ctx = context.WithValue(ctx, replayCheckedKey, true)
+		}
+
+		var success *AuthenticationResponse
+		if success, err = validator.ValidateTicketContext(ctx, serviceURL, ticket); err == nil || !isServiceRejection(err) {
+			return success, err
+		}
+	}
+
+	return nil, err
+}
+
+// isServiceRejection reports whether err rejects the service URL rather than the ticket.
+func isServiceRejection(err error) bool {
+	var authErr *AuthenticationError
+	return errors.Is(err, ErrServiceMismatch) || errors.As(err, &authErr) && authErr.Code == INVALID_SERVICE
+}
+
+// ValidateTicketWithServiceString is ValidateTicketContext with serviceString sent verbatim as
+// the service parameter, and compared with the service echoed by the CAS server, instead of the
+// sanitised serviceURL. It is an escape hatch for infrastructure, such as a reverse proxy, which
+// produces service URLs the sanitisation does not reproduce.
+//
+// Use it with care: CAS requires the exact service the ticket was issued for, so the string must
+// be what was sent to the login page byte for byte. It is not cleaned of the ticket or other CAS
+// parameters, nor is its trailing slash normalised.
+func (validator *ServiceTicketValidator) ValidateTicketWithServiceString(ctx context.Context, serviceString string, ticket string) (*AuthenticationResponse, error) {
+	serviceURL, err := url.Parse(serviceString)
 	if err != nil {
 		return nil, err
 	}
 
-	r, err := http.NewRequest("GET", u, nil)
-	if err != nil {
+	return validator.ValidateTicketContext(context.WithValue(ctx, serviceStringKey, serviceString), serviceURL, ticket)
+}
+
+// validate runs the validation request fn with the checks, mapping, counters and
+// deduplication shared by service and proxy ticket validation.
+func (validator *ServiceTicketValidator) validate(ctx context.Context, serviceURL *url.URL, ticket string,
+	fn func(context.Context, *url.URL, string) (*AuthenticationResponse, error)) (success *AuthenticationResponse, err error) {
+	if validator.AuditHook != nil {
+		var endpoint string
+		start := time.Now()
+		ctx = withAuditEndpoint(ctx, &endpoint)
+		defer func() {
+			validator.audit(start, validator.serviceParameter(ctx, serviceURL), endpoint, success, err)
+		}()
+	}
+
+	if validator.Observer != nil {
+		observation := &ValidationObservation{}
+		start := time.Now()
+		ctx = withObservation(ctx, observation)
+		validator.Observer.ValidationStarted(serviceURL)
+		defer func() {
+			observation.Duration = time.Since(start)
+			observation.Response, observation.Err = success, err
+			validator.Observer.ValidationCompleted(*observation)
+		}()
+	}
+
+	if checked, _ := ctx.Value(replayCheckedKey).(bool); validator.ReplayGuard != nil && !checked {
+		if err := validator.ReplayGuard.Check(ticket); err != nil {
+			return nil, err
+		}
+	}
+
+	validator.Counters.add(CounterValidationsAttempted)
+
+	if validator.OperationTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, validator.OperationTimeout)
+		defer cancel()
+	}
+
+	validate := func() (*AuthenticationResponse, error) {
+		success, err := fn(ctx, serviceURL, ticket)
+		if err == nil && success != nil {
+			err = validator.processResponse(ctx, serviceURL, success)
+		}
+
+		if validator.OperationTimeout > 0 && ctx.Err() == context.DeadlineExceeded {
+			return nil, context.DeadlineExceeded
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		return success, nil
+	}
+
+	if validator.DeduplicateValidations {
+		success, err = validator.inflight.do(validator.serviceParameter(ctx, serviceURL)+" "+ticket, validate)
+	} else {
+		success, err = validate()
+	}
+
+	if err != nil || success == nil {
+		validator.Counters.add(CounterValidationsFailed)
 		return nil, err
 	}
 
-	r.Header.Add("User-Agent", "Golang CAS client gopkg.in/cas")
+	validator.Counters.add(CounterValidationsSucceeded)
+	return success, nil
+}
+
+// Drain makes subsequent validations fail immediately with ErrDraining, while those already
+// in flight complete. Call it when a graceful shutdown begins, so login traffic fails fast
+// instead of waiting on the CAS server while the load balancer stops routing to the instance.
+func (validator *ServiceTicketValidator) Drain() {
+	atomic.StoreInt32(&validator.draining, 1)
+}
 
-	slog.Info("cas: attempting ticket validation", slog.Any("url", r.URL))
+// processResponse checks and maps a successfully parsed response.
+func (validator *ServiceTicketValidator) processResponse(ctx context.Context, serviceURL *url.URL, success *AuthenticationResponse) error {
+	if err := validator.checkServiceMatch(ctx, serviceURL, success); err != nil {
+		return err
+	}
+
+	if !success.AuthenticationDate.IsZero() {
+		success.ClockSkew = success.AuthenticationDate.Sub(time.Now())
+	}
 
-	resp, err := validator.client.Do(r)
+	success.SessionExpiresAt = sessionExpiry(success)
+	success.principalMapping = validator.PrincipalMapping
+
+	if !validator.resolveProxyGrantingTicket(success) {
+		requestLogger(validator.logger(), ctx).Warn("cas: no proxy granting ticket delivered for the IOU of the response")
+	}
+
+	if validator.RequireFreshLogin && !success.IsNewLogin {
+		return ErrStaleAuthentication
+	}
+
+	for _, transform := range validator.AttributeTransforms {
+		transform(success)
+	}
+
+	for _, name := range validator.RequiredAttributes {
+		if len(success.Attributes[name]) == 0 {
+			return fmt.Errorf("%w: %s", ErrMissingRequiredAttribute, name)
+		}
+	}
+
+	if validator.PrincipalAttribute != "" {
+		if v := success.Attributes.Get(validator.PrincipalAttribute); v != "" {
+			success.User = v
+		}
+	}
+
+	if validator.PrincipalMapper != nil {
+		if err := validator.PrincipalMapper(success); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// validateTicket performs the validation request against the serviceValidate endpoint, falling
+// back to the CAS 1 validate endpoint when it is not available.
+func (validator *ServiceTicketValidator) validateTicket(ctx context.Context, serviceURL *url.URL, ticket string) (*AuthenticationResponse, error) {
+	logger := requestLogger(validator.logger(), ctx)
+	logger.Info("cas: validating ticket", slog.String("ticket", redactedTicket(ticket)), slog.String("service", redactedURL(serviceURL)))
+
+	if validator.ProtocolVersion == ProtocolVersion1 {
+		if validator.RequireAttributes {
+			return nil, ErrAttributesUnavailable
+		}
+
+		return validator.validateTicketCas1(ctx, serviceURL, ticket)
+	}
+
+	if validator.ProtocolVersion == ProtocolVersionUnknown && validator.cachedProtocolVersion() == ProtocolVersion1 {
+		logger.Info("cas: using cached protocol version", slog.Any("version", ProtocolVersion1))
+		validator.Counters.add(CounterProtocolCacheHits)
+		if validator.RequireAttributes {
+			return nil, ErrAttributesUnavailable
+		}
+
+		return validator.validateTicketCas1(ctx, serviceURL, ticket)
+	}
+
+	u, err := validator.validationURL(validator.serviceValidateEndpoint(), validator.serviceParameter(ctx, serviceURL), ticket)
 	if err != nil {
 		return nil, err
 	}
 
-	slog.Info("cas: request returned", slog.Any("method", r.Method), slog.Any("url", r.URL), slog.Any("status", resp.Status))
+	resp, err := validator.requestValidation(ctx, logger, u)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode == http.StatusNotFound && validator.ProtocolVersion != ProtocolVersionUnknown {
+		resp.Body.Close()
+		return nil, newValidationError(resp.Request.URL, resp.StatusCode,
+			fmt.Errorf("%w: %s not found", ErrProtocolVersionUnsupported, validator.ProtocolVersion))
+	}
 
 	if resp.StatusCode == http.StatusNotFound {
-		return validator.validateTicketCas1(serviceURL, ticket)
+		resp.Body.Close()
+		validator.cacheProtocolVersion(ProtocolVersion1)
+		validator.Counters.add(CounterCas1Fallbacks)
+		observeFallback(ctx)
+		if validator.RequireAttributes {
+			return nil, ErrAttributesUnavailable
+		}
+
+		return validator.validateTicketCas1(ctx, serviceURL, ticket)
+	}
+
+	return validator.readServiceResponse(logger, resp)
+}
+
+// requestValidation sends the GET request for the validation URL u.
+func (validator *ServiceTicketValidator) requestValidation(ctx context.Context, logger *slog.Logger, u string) (*http.Response, error) {
+	r, err := http.NewRequestWithContext(ctx, "GET", u, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := requireHTTPS(r.URL, validator.AllowInsecureCasURL); err != nil {
+		return nil, err
+	}
+
+	if validator.HostHeaderOverride != "" {
+		r.Host = validator.HostHeaderOverride
+	}
+
+	r.Header.Add("User-Agent", validator.userAgent())
+	if validator.ResponseFormat.accept() {
+		r.Header.Set("Accept", "application/json")
+	}
+
+	setDefaultHeaders(r, validator.DefaultHeaders)
+
+	logger.Info("cas: attempting ticket validation", slog.String("url", redactedURL(r.URL)))
+	auditEndpoint(r)
+
+	resp, err := validator.do(r)
+	if err != nil {
+		return nil, requestError(r, err)
 	}
 
-	body, err := io.ReadAll(resp.Body)
-	resp.Body.Close()
+	logger.Info("cas: request returned", slog.Any("method", r.Method), slog.String("url", redactedURL(r.URL)), slog.Any("status", resp.Status))
+
+	return resp, nil
+}
+
+// acceptableStatus reports whether a validation response with the status code is parsed, see
+// AcceptableStatuses.
+func (validator *ServiceTicketValidator) acceptableStatus(statusCode int) bool {
+	if statusCode == http.StatusOK {
+		return true
+	}
+
+	for _, status := range validator.AcceptableStatuses {
+		if status == statusCode {
+			return true
+		}
+	}
+
+	return false
+}
+
+// readServiceResponse reads and parses the XML or JSON response of a serviceValidate or
+// proxyValidate request, closing its body.
+//
+// An XML response is decoded as it is read, unless it is needed in full for the ResponseTrace,
+// ValidateTicketRaw or for LenientParsing, that is unless StrictParsing is set.
+func (validator *ServiceTicketValidator) readServiceResponse(logger *slog.Logger, resp *http.Response) (*AuthenticationResponse, error) {
+	contentType := resp.Header.Get("Content-Type")
+	if validator.acceptableStatus(resp.StatusCode) && validator.StrictParsing && validator.ResponseTrace == nil &&
+		validator.MaintenanceDetector == nil && !captureRequested(resp) && hasXMLContentType(contentType) {
+		opts := validator.parseOptions()
+		opts.charset = charsetFromContentType(contentType)
+
+		body := validator.responseBody(resp)
+		success, err := parseServiceResponseStream(body, opts)
+		if err == nil {
+			// Read any trailing whitespace so the ResponseTee receives the whole body
+			_, err = io.Copy(io.Discard, body)
+		}
+
+		closeErr := validator.closeBody(logger, resp)
+		if err != nil {
+			return nil, err
+		}
+
+		if closeErr != nil {
+			return nil, closeErr
+		}
+
+		return validator.parsedServiceResponse(logger, resp, success), nil
+	}
+
+	body, err := io.ReadAll(validator.responseBody(resp))
+	closeErr := validator.closeBody(logger, resp)
 
 	if err != nil {
 		return nil, err
 	}
 
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("cas: validate ticket: %v", string(body))
+	captureResponse(resp, body)
+
+	if validator.inMaintenance(resp.StatusCode, body) {
+		return nil, ErrCASMaintenance
 	}
 
-	slog.Info("cas: received authentication response", slog.Any("response", string(body)))
+	if !validator.acceptableStatus(resp.StatusCode) {
+		return nil, statusError(resp, string(body))
+	}
+
+	if isHTMLContentType(resp.Header.Get("Content-Type")) {
+		return nil, ErrUnexpectedHTMLResponse
+	}
+
+	format := responseFormat(resp.Header.Get("Content-Type"), body)
+	validator.traceResponse(format, body)
 
-	success, err := ParseServiceResponse(body)
+	logger.Info("cas: received authentication response", slog.Any("format", format), slog.Int("length", len(body)))
+	logger.Debug("cas: authentication response body", slog.String("response", string(body)))
+
+	opts := validator.parseOptions()
+	opts.charset = charsetFromContentType(resp.Header.Get("Content-Type"))
+
+	success, err := parseValidationBody(body, format, opts)
 	if err != nil {
 		return nil, err
 	}
 
-	slog.Info("cas: parsed service response", slog.Any("response", success))
+	if closeErr != nil {
+		return nil, closeErr
+	}
+
+	return validator.parsedServiceResponse(logger, resp, success), nil
+}
 
-	return success, nil
+// inMaintenance reports whether the response is the maintenance response of the CAS server,
+// according to the MaintenanceDetector.
+func (validator *ServiceTicketValidator) inMaintenance(statusCode int, body []byte) bool {
+	if validator.MaintenanceDetector != nil {
+		return validator.MaintenanceDetector(statusCode, body)
+	}
+
+	return statusCode == http.StatusServiceUnavailable
+}
+
+// userOf returns the user of the response for logging, without its attributes and tickets, or
+// an empty string for the nil response of a ticket which did not log in.
+func userOf(success *AuthenticationResponse) string {
+	if success == nil {
+		return ""
+	}
+
+	return success.User
+}
+
+// parsedServiceResponse logs a successfully parsed response of resp.
+func (validator *ServiceTicketValidator) parsedServiceResponse(logger *slog.Logger, resp *http.Response, success *AuthenticationResponse) *AuthenticationResponse {
+	logger.Info("cas: parsed service response", slog.String("user", userOf(success)))
+
+	if validator.WarnOnEmptyAttributes && len(success.Attributes) == 0 {
+		var endpoint string
+		if resp.Request != nil {
+			endpoint = baseURL(resp.Request.URL).String()
+		}
+
+		logger.Warn("cas: no attributes released, check the attribute release policy of the service",
+			slog.Any("user", success.User), slog.Any("endpoint", endpoint))
+	}
+
+	return success
+}
+
+// closeBody closes the body of resp, logging an error. A close error can mean the response was
+// truncated, so in strict mode it is returned to fail an otherwise successful validation.
+func (validator *ServiceTicketValidator) closeBody(logger *slog.Logger, resp *http.Response) error {
+	err := resp.Body.Close()
+	if err == nil {
+		return nil
+	}
+
+	logger.Debug("cas: error closing response body", slog.Any("error", err))
+
+	if validator.StrictParsing {
+		return fmt.Errorf("cas: validate ticket: close response body: %w", err)
+	}
+
+	return nil
 }
 
-// ServiceValidateUrl creates the service validation url for the cas >= 2 protocol.
+// responseBody returns the body of resp, limited to MaxResponseBytes and copied to the ResponseTee.
+func (validator *ServiceTicketValidator) responseBody(resp *http.Response) io.Reader {
+	var body io.Reader = resp.Body
+	if validator.MaxResponseBytes > 0 {
+		body = &limitedReader{r: body, n: validator.MaxResponseBytes + 1}
+	}
+
+	if validator.ResponseTee != nil {
+		if w := validator.ResponseTee(resp); w != nil {
+			body = io.TeeReader(body, w)
+		}
+	}
+
+	return body
+}
+
+// limitedReader reads from r until more than the limit, n-1 bytes, has been read and then
+// fails with ErrResponseTooLarge, rather than truncating like io.LimitReader.
+type limitedReader struct {
+	r io.Reader
+	n int64
+}
+
+func (l *limitedReader) Read(p []byte) (int, error) {
+	if l.n <= 0 {
+		return 0, ErrResponseTooLarge
+	}
+
+	if int64(len(p)) > l.n {
+		p = p[:l.n]
+	}
+
+	n, err := l.r.Read(p)
+	l.n -= int64(n)
+	if l.n <= 0 && err == nil {
+		err = ErrResponseTooLarge
+	}
+
+	return n, err
+}
+
+// checkServiceMatch compares the service echoed by the CAS server, if any, to the service
+// which was sent. Servers which do not echo the service are not checked.
+func (validator *ServiceTicketValidator) checkServiceMatch(ctx context.Context, serviceURL *url.URL, success *AuthenticationResponse) error {
+	if success.Service == "" {
+		return nil
+	}
+
+	sent := validator.serviceParameter(ctx, serviceURL)
+	if success.Service != sent {
+		requestLogger(validator.logger(), ctx).Info("cas: service mismatch", slog.Any("sent", sent), slog.Any("received", success.Service))
+		return ErrServiceMismatch
+	}
+
+	return nil
+}
+
+// serviceString returns the service parameter sent for serviceURL.
+func (validator *ServiceTicketValidator) serviceString(serviceURL *url.URL) string {
+	return serviceURLString(serviceURL, validator.NormaliseTrailingSlash)
+}
+
+// serviceParameter returns the service parameter sent for serviceURL during the validation of
+// ctx, which is the verbatim string of ValidateTicketWithServiceString if given.
+func (validator *ServiceTicketValidator) serviceParameter(ctx context.Context, serviceURL *url.URL) string {
+	if s, ok := ctx.Value(serviceStringKey).(string); ok {
+		return s
+	}
+
+	return validator.serviceString(serviceURL)
+}
+
+// traceResponse passes the response body to the ResponseTrace, if set.
+func (validator *ServiceTicketValidator) traceResponse(format Format, body []byte) {
+	if validator.ResponseTrace != nil {
+		validator.ResponseTrace(format, body)
+	}
+}
+
+// ServiceValidateUrl creates the service validation url for the cas >= 2 protocol, of
+// p3/serviceValidate when the ProtocolVersion is ProtocolVersion3.
 // TODO the function is only exposed, because of the clients ServiceValidateUrl function
 func (validator *ServiceTicketValidator) ServiceValidateUrl(serviceURL *url.URL, ticket string) (string, error) {
-	u, err := validator.casURL.Parse(path.Join(validator.casURL.Path, "serviceValidate"))
+	return validator.validationURL(validator.serviceValidateEndpoint(), validator.serviceString(serviceURL), ticket)
+}
+
+// serviceValidateEndpoint returns the service ticket validation endpoint of the ProtocolVersion.
+func (validator *ServiceTicketValidator) serviceValidateEndpoint() string {
+	if validator.ProtocolVersion == ProtocolVersion3 {
+		return "p3/serviceValidate"
+	}
+
+	return "serviceValidate"
+}
+
+// endpointURL resolves the endpoint against the CAS URL for the ticket, the default casURL
+// unless the TicketRouter returns another.
+//
+// Endpoints of the default casURL are resolved once and copied for each call, so the caller
+// may change the query of the returned URL.
+func (validator *ServiceTicketValidator) endpointURL(endpoint string, ticket string) (*url.URL, error) {
+	if validator.TicketRouter != nil {
+		if routed, ok := validator.TicketRouter(ticket); ok && routed != nil {
+			return joinURLPath(baseURL(routed), endpoint), nil
+		}
+	}
+
+	validator.mu.Lock()
+	defer validator.mu.Unlock()
+
+	u, ok := validator.endpoints[endpoint]
+	if !ok {
+		u = joinURLPath(validator.casURL, endpoint)
+		if validator.endpoints == nil {
+			validator.endpoints = make(map[string]*url.URL)
+		}
+
+		validator.endpoints[endpoint] = u
+	}
+
+	c := *u
+	return &c, nil
+}
+
+// validationURL creates the url of the CAS >= 2 validation endpoint, with the service, ticket
+// and the configured format and pgtUrl parameters.
+func (validator *ServiceTicketValidator) validationURL(endpoint string, service string, ticket string) (string, error) {
+	u, err := validator.endpointURL(endpoint, ticket)
 	if err != nil {
 		return "", err
 	}
 
 	q := u.Query()
-	q.Add("service", sanitisedURLString(serviceURL))
+	q.Add("service", service)
 	q.Add("ticket", ticket)
+
+	if validator.ResponseFormat.query() {
+		q.Add("format", "JSON")
+	}
+
+	if pgtURL := validator.ProxyCallbackURL; pgtURL != nil {
+		if pgtURL.Scheme != "https" {
+			return "", ErrInsecureProxyCallbackURL
+		}
+
+		q.Add("pgtUrl", pgtURL.String())
+	}
+
 	u.RawQuery = q.Encode()
 
 	return u.String(), nil
 }
 
-func (validator *ServiceTicketValidator) validateTicketCas1(serviceURL *url.URL, ticket string) (*AuthenticationResponse, error) {
-	u, err := validator.ValidateUrl(serviceURL, ticket)
+func (validator *ServiceTicketValidator) validateTicketCas1(ctx context.Context, serviceURL *url.URL, ticket string) (*AuthenticationResponse, error) {
+	logger := requestLogger(validator.logger(), ctx)
+
+	u, err := validator.cas1ValidationURL(validator.serviceParameter(ctx, serviceURL), ticket)
 	if err != nil {
 		return nil, err
 	}
 
-	r, err := http.NewRequest("GET", u, nil)
+	r, err := http.NewRequestWithContext(ctx, "GET", u, nil)
 	if err != nil {
 		return nil, err
 	}
 
-	r.Header.Add("User-Agent", "Golang CAS client gopkg.in/cas")
+	if err := requireHTTPS(r.URL, validator.AllowInsecureCasURL); err != nil {
+		return nil, err
+	}
+
+	if validator.HostHeaderOverride != "" {
+		r.Host = validator.HostHeaderOverride
+	}
+
+	r.Header.Add("User-Agent", validator.userAgent())
+	setDefaultHeaders(r, validator.DefaultHeaders)
 
-	slog.Info("cas: attempting ticket validation", slog.Any("url", r.URL))
+	logger.Info("cas: attempting ticket validation", slog.String("url", redactedURL(r.URL)))
+	auditEndpoint(r)
 
-	resp, err := validator.client.Do(r)
+	resp, err := validator.do(r)
 	if err != nil {
-		return nil, err
+		return nil, requestError(r, err)
 	}
 
-	slog.Info("cas: request returned", slog.Any("method", r.Method), slog.Any("url", r.URL), slog.Any("status", resp.Status))
+	logger.Info("cas: request returned", slog.Any("method", r.Method), slog.String("url", redactedURL(r.URL)), slog.Any("status", resp.Status))
 
-	data, err := io.ReadAll(resp.Body)
-	resp.Body.Close()
+	data, err := io.ReadAll(validator.responseBody(resp))
+	closeErr := validator.closeBody(logger, resp)
 
 	if err != nil {
 		return nil, err
 	}
 
+	captureResponse(resp, data)
+
+	data, err = toUTF8(data, charsetFromContentType(resp.Header.Get("Content-Type")), validator.CharsetReader)
+	if err != nil {
+		return nil, err
+	}
+
+	if validator.inMaintenance(resp.StatusCode, data) {
+		return nil, ErrCASMaintenance
+	}
+
 	body := string(data)
 
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("cas: validate ticket: %v", body)
+	if !validator.acceptableStatus(resp.StatusCode) {
+		return nil, statusError(resp, body)
+	}
+
+	if isHTMLContentType(resp.Header.Get("Content-Type")) || isHTML(data) {
+		return nil, ErrUnexpectedHTMLResponse
 	}
 
-	slog.Info("cas: received authentication response", slog.Any("response", body))
+	validator.traceResponse(FormatCAS1, data)
+
+	logger.Info("cas: received authentication response", slog.Int("length", len(body)))
+	logger.Debug("cas: authentication response body", slog.String("response", body))
 
-	if body == "no\n\n" {
-		return nil, nil // not logged in
+	success, err := parseCas1Response(body)
+	if err != nil || success == nil {
+		return nil, err
 	}
 
-	success := &AuthenticationResponse{
-		User: body[4 : len(body)-1],
+	if closeErr != nil {
+		return nil, closeErr
 	}
 
-	slog.Info("cas: parsed service response", slog.Any("response", success))
+	logger.Info("cas: parsed service response", slog.String("user", userOf(success)))
 
 	return success, nil
 }
@@ -146,13 +1001,18 @@ func (validator *ServiceTicketValidator) validateTicketCas1(serviceURL *url.URL,
 // ValidateUrl creates the validation url for the cas >= 1 protocol.
 // TODO the function is only exposed, because of the clients ValidateUrl function
 func (validator *ServiceTicketValidator) ValidateUrl(serviceURL *url.URL, ticket string) (string, error) {
-	u, err := validator.casURL.Parse(path.Join(validator.casURL.Path, "validate"))
+	return validator.cas1ValidationURL(validator.serviceString(serviceURL), ticket)
+}
+
+// cas1ValidationURL creates the url of the CAS 1 validate endpoint with the service and ticket.
+func (validator *ServiceTicketValidator) cas1ValidationURL(service string, ticket string) (string, error) {
+	u, err := validator.endpointURL("validate", ticket)
 	if err != nil {
 		return "", err
 	}
 
 	q := u.Query()
-	q.Add("service", sanitisedURLString(serviceURL))
+	q.Add("service", service)
 	q.Add("ticket", ticket)
 	u.RawQuery = q.Encode()
 
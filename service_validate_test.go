@@ -0,0 +1,1335 @@
+package cas
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestValidateTicketServiceMismatch(t *testing.T) {
+	echoed := "http://example.com/"
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `<cas:serviceResponse xmlns:cas="http://www.yale.edu/tp/cas">
+  <cas:authenticationSuccess>
+    <cas:user>enoch.root</cas:user>
+    <cas:service>%s</cas:service>
+  </cas:authenticationSuccess>
+</cas:serviceResponse>`, echoed)
+	}))
+	defer server.Close()
+
+	casURL, _ := url.Parse(server.URL)
+	validator := NewServiceTicketValidator(server.Client(), casURL)
+
+	serviceURL, _ := url.Parse("http://example.com/")
+	success, err := validator.ValidateTicket(serviceURL, "ST-123")
+	if err != nil {
+		t.Fatalf("Expected ValidateTicket to succeed, got error: %v", err)
+	}
+
+	if success.Service != echoed {
+		t.Errorf("Expected Service to be <%s>, got <%s>", echoed, success.Service)
+	}
+
+	serviceURL, _ = url.Parse("http://internal.example.com:8080/")
+	if _, err := validator.ValidateTicket(serviceURL, "ST-123"); err != ErrServiceMismatch {
+		t.Errorf("Expected ErrServiceMismatch, got %v", err)
+	}
+}
+
+func TestValidateTicketWithoutEchoedService(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `<cas:serviceResponse xmlns:cas="http://www.yale.edu/tp/cas">
+  <cas:authenticationSuccess>
+    <cas:user>enoch.root</cas:user>
+  </cas:authenticationSuccess>
+</cas:serviceResponse>`)
+	}))
+	defer server.Close()
+
+	casURL, _ := url.Parse(server.URL)
+	validator := NewServiceTicketValidator(server.Client(), casURL)
+
+	serviceURL, _ := url.Parse("http://internal.example.com:8080/")
+	if _, err := validator.ValidateTicket(serviceURL, "ST-123"); err != nil {
+		t.Errorf("Expected ValidateTicket to skip the service check, got error: %v", err)
+	}
+}
+
+func TestValidateTicketRequiresHTTPS(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		fmt.Fprint(w, `<cas:serviceResponse xmlns:cas="http://www.yale.edu/tp/cas">
+  <cas:authenticationSuccess>
+    <cas:user>enoch.root</cas:user>
+  </cas:authenticationSuccess>
+</cas:serviceResponse>`)
+	}))
+	defer server.Close()
+
+	casURL, _ := url.Parse(server.URL)
+	validator := NewServiceTicketValidator(server.Client(), casURL)
+
+	serviceURL, _ := url.Parse("http://example.com/")
+	if _, err := validator.ValidateTicket(serviceURL, "ST-123"); err != ErrInsecureCasURL {
+		t.Errorf("Expected ErrInsecureCasURL, got %v", err)
+	}
+
+	if requests != 0 {
+		t.Errorf("Expected no request to be sent to an insecure CAS URL, got %d", requests)
+	}
+
+	validator.AllowInsecureCasURL = true
+	if _, err := validator.ValidateTicket(serviceURL, "ST-123"); err != nil {
+		t.Errorf("Expected ValidateTicket to succeed when insecure URLs are allowed, got error: %v", err)
+	}
+}
+
+func TestValidateTicketPrincipalMapper(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `<cas:serviceResponse xmlns:cas="http://www.yale.edu/tp/cas">
+  <cas:authenticationSuccess>
+    <cas:user>Enoch.Root</cas:user>
+  </cas:authenticationSuccess>
+</cas:serviceResponse>`)
+	}))
+	defer server.Close()
+
+	casURL, _ := url.Parse(server.URL)
+	validator := NewServiceTicketValidator(server.Client(), casURL)
+	validator.PrincipalMapper = func(r *AuthenticationResponse) error {
+		r.User = "EXAMPLE\\" + strings.ToLower(r.User)
+		return nil
+	}
+
+	serviceURL, _ := url.Parse("http://example.com/")
+	success, err := validator.ValidateTicket(serviceURL, "ST-123")
+	if err != nil {
+		t.Fatalf("Expected ValidateTicket to succeed, got error: %v", err)
+	}
+
+	if success.User != "EXAMPLE\\enoch.root" {
+		t.Errorf("Expected User to be mapped to <EXAMPLE\\enoch.root>, got <%s>", success.User)
+	}
+
+	rejected := errors.New("user not in directory")
+	validator.PrincipalMapper = func(r *AuthenticationResponse) error {
+		return rejected
+	}
+
+	if _, err := validator.ValidateTicket(serviceURL, "ST-123"); err != rejected {
+		t.Errorf("Expected the mapper error to be returned, got %v", err)
+	}
+}
+
+func TestValidateTicketPrincipalAttribute(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `<cas:serviceResponse xmlns:cas="http://www.yale.edu/tp/cas">
+  <cas:authenticationSuccess>
+    <cas:user>a7f3c2e1</cas:user>
+    <cas:attributes>
+      <cas:uid>enoch.root</cas:uid>
+    </cas:attributes>
+  </cas:authenticationSuccess>
+</cas:serviceResponse>`)
+	}))
+	defer server.Close()
+
+	casURL, _ := url.Parse(server.URL)
+	validator := NewServiceTicketValidator(server.Client(), casURL)
+	validator.PrincipalAttribute = "uid"
+
+	serviceURL, _ := url.Parse("http://example.com/")
+	success, err := validator.ValidateTicket(serviceURL, "ST-123")
+	if err != nil {
+		t.Fatalf("Expected ValidateTicket to succeed, got error: %v", err)
+	}
+
+	if success.User != "enoch.root" {
+		t.Errorf("Expected User to be overridden with <enoch.root>, got <%s>", success.User)
+	}
+
+	validator.PrincipalAttribute = "eduPersonPrincipalName"
+	success, err = validator.ValidateTicket(serviceURL, "ST-123")
+	if err != nil {
+		t.Fatalf("Expected ValidateTicket to succeed, got error: %v", err)
+	}
+
+	if success.User != "a7f3c2e1" {
+		t.Errorf("Expected User to fall back to <a7f3c2e1>, got <%s>", success.User)
+	}
+}
+
+func TestValidateTicketHTMLResponse(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html;charset=UTF-8")
+		fmt.Fprint(w, `<!DOCTYPE html><html><body><form id="fm1" method="post"></form></body></html>`)
+	}))
+	defer server.Close()
+
+	casURL, _ := url.Parse(server.URL + "/cas/login")
+	validator := NewServiceTicketValidator(server.Client(), casURL)
+
+	serviceURL, _ := url.Parse("http://example.com/")
+	if _, err := validator.ValidateTicket(serviceURL, "ST-123"); err != ErrUnexpectedHTMLResponse {
+		t.Errorf("Expected ErrUnexpectedHTMLResponse, got %v", err)
+	}
+}
+
+func TestValidateTicketEmptyResponse(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/xml;charset=UTF-8")
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	casURL, _ := url.Parse(server.URL)
+	serviceURL, _ := url.Parse("http://example.com/")
+
+	for _, strict := range []bool{false, true} {
+		validator := NewServiceTicketValidator(server.Client(), casURL)
+		validator.StrictParsing = strict
+
+		if _, err := validator.ValidateTicket(serviceURL, "ST-123"); err != ErrEmptyResponse {
+			t.Errorf("Expected error to be <%v> with StrictParsing <%v>, got <%v>", ErrEmptyResponse, strict, err)
+		}
+	}
+}
+
+func TestValidateTicketFailureWithStatusOK(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/xml;charset=UTF-8")
+		fmt.Fprint(w, `<cas:serviceResponse xmlns:cas="http://www.yale.edu/tp/cas">
+  <cas:authenticationFailure code="INVALID_TICKET">
+    Ticket ST-123 not recognized
+  </cas:authenticationFailure>
+</cas:serviceResponse>`)
+	}))
+	defer server.Close()
+
+	casURL, _ := url.Parse(server.URL)
+	validator := NewServiceTicketValidator(server.Client(), casURL)
+
+	serviceURL, _ := url.Parse("http://example.com/")
+	success, err := validator.ValidateTicket(serviceURL, "ST-123")
+	if success != nil {
+		t.Errorf("Expected no AuthenticationResponse for a failure, got %+v", success)
+	}
+
+	var authErr *AuthenticationError
+	if !errors.As(err, &authErr) {
+		t.Fatalf("Expected an *AuthenticationError, got %T: %v", err, err)
+	}
+
+	if authErr.Code != INVALID_TICKET {
+		t.Errorf("Expected Code to be <%s>, got <%s>", INVALID_TICKET, authErr.Code)
+	}
+
+	if authErr.Message != "Ticket ST-123 not recognized" {
+		t.Errorf("Expected Message to be <Ticket ST-123 not recognized>, got <%s>", authErr.Message)
+	}
+}
+
+func TestValidateTicketEmptyServiceResponse(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `<cas:serviceResponse xmlns:cas="http://www.yale.edu/tp/cas"></cas:serviceResponse>`)
+	}))
+	defer server.Close()
+
+	casURL, _ := url.Parse(server.URL)
+	validator := NewServiceTicketValidator(server.Client(), casURL)
+
+	serviceURL, _ := url.Parse("http://example.com/")
+	if success, err := validator.ValidateTicket(serviceURL, "ST-123"); err == nil {
+		t.Errorf("Expected an error for a response without success or failure, got %+v", success)
+	}
+}
+
+func TestServiceValidateUrlProxyCallback(t *testing.T) {
+	casURL, _ := url.Parse("https://cas.example.com/cas/")
+	validator := NewServiceTicketValidator(nil, casURL)
+	serviceURL, _ := url.Parse("https://example.com/")
+
+	validator.ProxyCallbackURL, _ = url.Parse("https://example.com/pgtCallback")
+	u, err := validator.ServiceValidateUrl(serviceURL, "ST-123")
+	if err != nil {
+		t.Fatalf("Expected ServiceValidateUrl to succeed, got error: %v", err)
+	}
+
+	expected := "https://cas.example.com/cas/serviceValidate?pgtUrl=https%3A%2F%2Fexample.com%2FpgtCallback&service=https%3A%2F%2Fexample.com%2F&ticket=ST-123"
+	if u != expected {
+		t.Errorf("Expected URL to be <%s>, got <%s>", expected, u)
+	}
+
+	validator.ProxyCallbackURL, _ = url.Parse("http://example.com/pgtCallback")
+	if _, err := validator.ServiceValidateUrl(serviceURL, "ST-123"); err != ErrInsecureProxyCallbackURL {
+		t.Errorf("Expected ErrInsecureProxyCallbackURL, got %v", err)
+	}
+}
+
+func TestValidateTicketJSONNegotiation(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("format") == "JSON" || r.Header.Get("Accept") == "application/json" {
+			w.Header().Set("Content-Type", "application/json;charset=UTF-8")
+			fmt.Fprint(w, `{"serviceResponse":{"authenticationSuccess":{"user":"json.user"}}}`)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/xml;charset=UTF-8")
+		fmt.Fprint(w, `<cas:serviceResponse xmlns:cas="http://www.yale.edu/tp/cas">
+  <cas:authenticationSuccess>
+    <cas:user>xml.user</cas:user>
+  </cas:authenticationSuccess>
+</cas:serviceResponse>`)
+	}))
+	defer server.Close()
+
+	casURL, _ := url.Parse(server.URL)
+	serviceURL, _ := url.Parse("http://example.com/")
+
+	cases := []struct {
+		negotiation FormatNegotiation
+		expected    string
+	}{
+		{NegotiateQuery, "json.user"},
+		{NegotiateAccept, "json.user"},
+		{NegotiateQueryAccept, "json.user"},
+		{NegotiateXML, "xml.user"},
+	}
+
+	for _, c := range cases {
+		validator := NewServiceTicketValidator(server.Client(), casURL)
+		validator.ResponseFormat = c.negotiation
+
+		success, err := validator.ValidateTicket(serviceURL, "ST-123")
+		if err != nil {
+			t.Errorf("%v: expected ValidateTicket to succeed, got error: %v", c.negotiation, err)
+			continue
+		}
+
+		if success.User != c.expected {
+			t.Errorf("%v: expected User to be <%s>, got <%s>", c.negotiation, c.expected, success.User)
+		}
+	}
+}
+
+func TestResponseFormat(t *testing.T) {
+	cases := []struct {
+		contentType string
+		body        string
+		expected    Format
+	}{
+		{"application/json;charset=UTF-8", `{}`, FormatJSON},
+		{"application/xml", `<cas:serviceResponse/>`, FormatXML},
+		{"text/xml; charset=ISO-8859-1", `<cas:serviceResponse/>`, FormatXML},
+		{"text/plain", ` {"serviceResponse":{}}`, FormatJSON},
+		{"", `<cas:serviceResponse/>`, FormatXML},
+	}
+
+	for _, c := range cases {
+		if f := responseFormat(c.contentType, []byte(c.body)); f != c.expected {
+			t.Errorf("Expected format of <%s> to be <%v>, got <%v>", c.contentType, c.expected, f)
+		}
+	}
+}
+
+func TestValidateTicketDrain(t *testing.T) {
+	started := make(chan struct{})
+	release := make(chan struct{})
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-release
+		fmt.Fprint(w, `<cas:serviceResponse xmlns:cas="http://www.yale.edu/tp/cas">
+  <cas:authenticationSuccess>
+    <cas:user>enoch.root</cas:user>
+  </cas:authenticationSuccess>
+</cas:serviceResponse>`)
+	}))
+	defer server.Close()
+
+	casURL, _ := url.Parse(server.URL)
+	validator := NewServiceTicketValidator(server.Client(), casURL)
+	serviceURL, _ := url.Parse("http://example.com/")
+
+	inflight := make(chan error)
+	go func() {
+		_, err := validator.ValidateTicket(serviceURL, "ST-123")
+		inflight <- err
+	}()
+
+	<-started
+	validator.Drain()
+
+	if _, err := validator.ValidateTicket(serviceURL, "ST-456"); err != ErrDraining {
+		t.Errorf("Expected ErrDraining, got %v", err)
+	}
+
+	close(release)
+	if err := <-inflight; err != nil {
+		t.Errorf("Expected the in-flight validation to complete, got error: %v", err)
+	}
+}
+
+func TestValidateTicketWarnOnEmptyAttributes(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `<cas:serviceResponse xmlns:cas="http://www.yale.edu/tp/cas">
+  <cas:authenticationSuccess>
+    <cas:user>enoch.root</cas:user>
+  </cas:authenticationSuccess>
+</cas:serviceResponse>`)
+	}))
+	defer server.Close()
+
+	var buf bytes.Buffer
+	casURL, _ := url.Parse(server.URL)
+	validator := NewServiceTicketValidator(server.Client(), casURL)
+	validator.Logger = slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{Level: slog.LevelWarn}))
+	serviceURL, _ := url.Parse("http://example.com/")
+
+	if _, err := validator.ValidateTicket(serviceURL, "ST-123"); err != nil {
+		t.Fatalf("Expected ValidateTicket to succeed, got error: %v", err)
+	}
+
+	if out := buf.String(); out != "" {
+		t.Errorf("Expected no warning by default, got:\n%s", out)
+	}
+
+	validator.WarnOnEmptyAttributes = true
+	if _, err := validator.ValidateTicket(serviceURL, "ST-456"); err != nil {
+		t.Fatalf("Expected ValidateTicket to succeed, got error: %v", err)
+	}
+
+	out := buf.String()
+	if !strings.Contains(out, "level=WARN") || !strings.Contains(out, "user=enoch.root") ||
+		!strings.Contains(out, "endpoint="+server.URL+"/serviceValidate") {
+		t.Errorf("Expected a warning with the user and endpoint, got:\n%s", out)
+	}
+
+	if strings.Contains(out, "ST-456") {
+		t.Errorf("Expected the ticket not to be logged with the endpoint, got:\n%s", out)
+	}
+}
+
+func TestValidateTicketStreamingAndMaxResponseBytes(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/xml; charset=ISO-8859-1")
+		w.Write(latin1ServiceResponse)
+	}))
+	defer server.Close()
+
+	casURL, _ := url.Parse(server.URL)
+	validator := NewServiceTicketValidator(server.Client(), casURL)
+	validator.StrictParsing = true
+	serviceURL, _ := url.Parse("http://example.com/")
+
+	r, err := validator.ValidateTicket(serviceURL, "ST-123")
+	if err != nil {
+		t.Fatalf("Expected ValidateTicket to succeed, got error: %v", err)
+	}
+
+	if v := r.Attributes.Get("displayName"); v != "José Müller" {
+		t.Errorf("Expected displayName to be <José Müller>, got <%s>", v)
+	}
+
+	for _, strict := range []bool{true, false} {
+		validator.StrictParsing = strict
+		validator.MaxResponseBytes = int64(len(latin1ServiceResponse))
+		if _, err := validator.ValidateTicket(serviceURL, "ST-123"); err != nil {
+			t.Errorf("Expected a response of MaxResponseBytes to be read with strict <%v>, got error: %v", strict, err)
+		}
+
+		validator.MaxResponseBytes = 64
+		if _, err := validator.ValidateTicket(serviceURL, "ST-123"); !errors.Is(err, ErrResponseTooLarge) {
+			t.Errorf("Expected error with strict <%v> to be <%v>, got <%v>", strict, ErrResponseTooLarge, err)
+		}
+	}
+}
+
+func TestValidateTicketMaxResponseBytesChunked(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/xml")
+		fmt.Fprint(w, `<cas:serviceResponse xmlns:cas="http://www.yale.edu/tp/cas">
+  <cas:authenticationSuccess>
+    <cas:user>enoch.root</cas:user>
+    <cas:attributes>`)
+		w.(http.Flusher).Flush()
+
+		for i := 0; i < 64; i++ {
+			fmt.Fprintf(w, "<cas:group>group-%d</cas:group>\n", i)
+			w.(http.Flusher).Flush()
+		}
+
+		fmt.Fprint(w, `</cas:attributes>
+  </cas:authenticationSuccess>
+</cas:serviceResponse>`)
+	}))
+	defer server.Close()
+
+	casURL, _ := url.Parse(server.URL)
+	serviceURL, _ := url.Parse("http://example.com/")
+
+	for _, strict := range []bool{true, false} {
+		validator := NewServiceTicketValidator(server.Client(), casURL)
+		validator.StrictParsing = strict
+		validator.MaxResponseBytes = 512
+
+		if _, err := validator.ValidateTicket(serviceURL, "ST-123"); !errors.Is(err, ErrResponseTooLarge) {
+			t.Errorf("Expected error for a chunked response with strict <%v> to be <%v>, got <%v>", strict, ErrResponseTooLarge, err)
+		}
+	}
+
+	// A Content-Length understating the body is not trusted either
+	validator := NewServiceTicketValidator(&http.Client{Transport: roundTripFunc(func(r *http.Request) (*http.Response, error) {
+		body := strings.Repeat(" ", 1024) + `<cas:serviceResponse xmlns:cas="http://www.yale.edu/tp/cas"/>`
+		return &http.Response{
+			StatusCode:    http.StatusOK,
+			Header:        http.Header{"Content-Type": {"application/xml"}},
+			ContentLength: 16,
+			Body:          io.NopCloser(strings.NewReader(body)),
+			Request:       r,
+		}, nil
+	})}, casURL)
+	validator.MaxResponseBytes = 512
+
+	if _, err := validator.ValidateTicket(serviceURL, "ST-123"); !errors.Is(err, ErrResponseTooLarge) {
+		t.Errorf("Expected error with a wrong Content-Length to be <%v>, got <%v>", ErrResponseTooLarge, err)
+	}
+}
+
+// closeErrorBody is a response body whose Close fails
+type closeErrorBody struct {
+	*strings.Reader
+}
+
+func (closeErrorBody) Close() error {
+	return errors.New("connection reset")
+}
+
+// roundTripFunc is an http.RoundTripper answering requests with a function
+type roundTripFunc func(r *http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(r *http.Request) (*http.Response, error) {
+	return f(r)
+}
+
+type closeErrorTransport struct {
+	body string
+}
+
+func (t closeErrorTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	return &http.Response{
+		StatusCode: http.StatusOK,
+		Header:     http.Header{"Content-Type": {"text/xml"}},
+		Body:       closeErrorBody{strings.NewReader(t.body)},
+		Request:    r,
+	}, nil
+}
+
+func TestValidateTicketBodyCloseError(t *testing.T) {
+	client := &http.Client{Transport: closeErrorTransport{body: `<cas:serviceResponse xmlns:cas="http://www.yale.edu/tp/cas">
+  <cas:authenticationSuccess>
+    <cas:user>enoch.root</cas:user>
+  </cas:authenticationSuccess>
+</cas:serviceResponse>`}}
+
+	var buf bytes.Buffer
+	casURL, _ := url.Parse("https://cas.example.com/")
+	validator := NewServiceTicketValidator(client, casURL)
+	validator.Logger = slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	serviceURL, _ := url.Parse("http://example.com/")
+
+	if _, err := validator.ValidateTicket(serviceURL, "ST-123"); err != nil {
+		t.Errorf("Expected the close error to be ignored by default, got error: %v", err)
+	}
+
+	if !strings.Contains(buf.String(), "cas: error closing response body") {
+		t.Errorf("Expected the close error to be logged, got:\n%s", buf.String())
+	}
+
+	validator.StrictParsing = true
+	if _, err := validator.ValidateTicket(serviceURL, "ST-123"); err == nil || !strings.Contains(err.Error(), "connection reset") {
+		t.Errorf("Expected the close error to be returned in strict mode, got <%v>", err)
+	}
+}
+
+func TestValidateTicketRequireFreshLogin(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `<cas:serviceResponse xmlns:cas="http://www.yale.edu/tp/cas">
+  <cas:authenticationSuccess>
+    <cas:user>enoch.root</cas:user>
+    <cas:attributes>
+      <cas:authenticationDate>2015-02-10T14:28:42Z</cas:authenticationDate>
+      <cas:isFromNewLogin>%v</cas:isFromNewLogin>
+    </cas:attributes>
+  </cas:authenticationSuccess>
+</cas:serviceResponse>`, r.URL.Query().Get("ticket") == "ST-fresh")
+	}))
+	defer server.Close()
+
+	casURL, _ := url.Parse(server.URL)
+	validator := NewServiceTicketValidator(server.Client(), casURL)
+	serviceURL, _ := url.Parse("http://example.com/")
+
+	if _, err := validator.ValidateTicket(serviceURL, "ST-sso"); err != nil {
+		t.Errorf("Expected an SSO ticket to be accepted by default, got error: %v", err)
+	}
+
+	validator.RequireFreshLogin = true
+	if _, err := validator.ValidateTicket(serviceURL, "ST-sso"); err != ErrStaleAuthentication {
+		t.Errorf("Expected error to be <%v>, got <%v>", ErrStaleAuthentication, err)
+	}
+
+	success, err := validator.ValidateTicket(serviceURL, "ST-fresh")
+	if err != nil {
+		t.Fatalf("Expected a ticket from a new login to be accepted, got error: %v", err)
+	}
+
+	if !success.IsNewLogin {
+		t.Errorf("Expected IsNewLogin to be true")
+	}
+}
+
+func TestValidateTicketRequiredAttributes(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `<cas:serviceResponse xmlns:cas="http://www.yale.edu/tp/cas">
+  <cas:authenticationSuccess>
+    <cas:user>enoch.root</cas:user>
+    <cas:attributes>
+      <cas:mail>enoch.root@example.com</cas:mail>
+    </cas:attributes>
+  </cas:authenticationSuccess>
+</cas:serviceResponse>`)
+	}))
+	defer server.Close()
+
+	casURL, _ := url.Parse(server.URL)
+	validator := NewServiceTicketValidator(server.Client(), casURL)
+	serviceURL, _ := url.Parse("http://example.com/")
+
+	validator.RequiredAttributes = []string{"mail"}
+	if _, err := validator.ValidateTicket(serviceURL, "ST-123"); err != nil {
+		t.Errorf("Expected a response with the required attribute to be accepted, got error: %v", err)
+	}
+
+	validator.RequiredAttributes = []string{"mail", "eduPersonPrincipalName"}
+	_, err := validator.ValidateTicket(serviceURL, "ST-123")
+	if !errors.Is(err, ErrMissingRequiredAttribute) {
+		t.Fatalf("Expected error to be <%v>, got <%v>", ErrMissingRequiredAttribute, err)
+	}
+
+	if !strings.Contains(err.Error(), "eduPersonPrincipalName") {
+		t.Errorf("Expected error to name the missing attribute, got <%v>", err)
+	}
+}
+
+func TestValidateTicketResponseTee(t *testing.T) {
+	body := `<cas:serviceResponse xmlns:cas="http://www.yale.edu/tp/cas">
+  <cas:authenticationSuccess>
+    <cas:user>enoch.root</cas:user>
+  </cas:authenticationSuccess>
+</cas:serviceResponse>
+`
+
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/xml")
+		fmt.Fprint(w, body)
+	}))
+	defer server.Close()
+
+	casURL, _ := url.Parse(server.URL)
+	validator := NewServiceTicketValidator(server.Client(), casURL)
+	serviceURL, _ := url.Parse("http://example.com/")
+
+	for _, strict := range []bool{false, true} {
+		var buf bytes.Buffer
+		validator.StrictParsing = strict
+		validator.ResponseTee = func(resp *http.Response) io.Writer {
+			return &buf
+		}
+
+		success, err := validator.ValidateTicket(serviceURL, "ST-123")
+		if err != nil {
+			t.Fatalf("Expected ValidateTicket with strict <%v> to succeed, got error: %v", strict, err)
+		}
+
+		if success.User != "enoch.root" {
+			t.Errorf("Expected User to be <enoch.root>, got <%s>", success.User)
+		}
+
+		if buf.String() != body {
+			t.Errorf("Expected the tee with strict <%v> to receive the body, got <%s>", strict, buf.String())
+		}
+	}
+}
+
+func TestValidateTicketHostHeaderOverride(t *testing.T) {
+	var hosts []string
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hosts = append(hosts, r.Host)
+		if r.URL.Path == "/serviceValidate" {
+			http.NotFound(w, r)
+			return
+		}
+
+		fmt.Fprint(w, "yes\nenoch.root\n")
+	}))
+	defer server.Close()
+
+	casURL, _ := url.Parse(server.URL)
+	validator := NewServiceTicketValidator(server.Client(), casURL)
+	validator.HostHeaderOverride = "cas.example.com"
+	serviceURL, _ := url.Parse("http://example.com/")
+
+	if _, err := validator.ValidateTicket(serviceURL, "ST-123"); err != nil {
+		t.Fatalf("Expected ValidateTicket to succeed, got error: %v", err)
+	}
+
+	if len(hosts) != 2 {
+		t.Fatalf("Expected serviceValidate and validate to be requested, got <%v>", hosts)
+	}
+
+	for _, host := range hosts {
+		if host != "cas.example.com" {
+			t.Errorf("Expected Host header to be <cas.example.com>, got <%s>", host)
+		}
+	}
+}
+
+func TestValidateTicketDefaultHeaders(t *testing.T) {
+	var keys, agents []string
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		keys = append(keys, r.Header.Get("X-Api-Key"))
+		agents = append(agents, r.Header.Get("User-Agent"))
+		if r.URL.Path == "/serviceValidate" {
+			http.NotFound(w, r)
+			return
+		}
+
+		fmt.Fprint(w, "yes\nenoch.root\n")
+	}))
+	defer server.Close()
+
+	casURL, _ := url.Parse(server.URL)
+	validator := NewServiceTicketValidator(server.Client(), casURL)
+	validator.DefaultHeaders = http.Header{
+		"x-api-key":  {"secret"},
+		"User-Agent": {"example-app"},
+	}
+	serviceURL, _ := url.Parse("http://example.com/")
+
+	if _, err := validator.ValidateTicket(serviceURL, "ST-123"); err != nil {
+		t.Fatalf("Expected ValidateTicket to succeed, got error: %v", err)
+	}
+
+	if len(keys) != 2 {
+		t.Fatalf("Expected serviceValidate and validate to be requested, got <%v>", keys)
+	}
+
+	for i := range keys {
+		if keys[i] != "secret" {
+			t.Errorf("Expected X-Api-Key header to be <secret>, got <%s>", keys[i])
+		}
+
+		if agents[i] != "example-app" {
+			t.Errorf("Expected User-Agent header to be <example-app>, got <%s>", agents[i])
+		}
+	}
+}
+
+func TestValidateTicketAsync(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-r.Context().Done():
+			return
+		}
+
+		fmt.Fprint(w, `<cas:serviceResponse xmlns:cas="http://www.yale.edu/tp/cas">
+  <cas:authenticationSuccess>
+    <cas:user>enoch.root</cas:user>
+  </cas:authenticationSuccess>
+</cas:serviceResponse>`)
+	}))
+	defer server.Close()
+
+	casURL, _ := url.Parse(server.URL)
+	validator := NewServiceTicketValidator(server.Client(), casURL)
+	validator.Logger = NoopLogger()
+	serviceURL, _ := url.Parse("http://example.com/")
+
+	results := validator.ValidateTicketAsync(context.Background(), serviceURL, "ST-123")
+	close(release)
+
+	result := <-results
+	if result.Err != nil {
+		t.Fatalf("Expected the validation to succeed, got error: %v", result.Err)
+	}
+
+	if result.Response.User != "enoch.root" {
+		t.Errorf("Expected User to be <enoch.root>, got <%s>", result.Response.User)
+	}
+
+	if _, ok := <-results; ok {
+		t.Errorf("Expected the channel to be closed after the result")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	result = <-validator.ValidateTicketAsync(ctx, serviceURL, "ST-456")
+	if !errors.Is(result.Err, context.Canceled) {
+		t.Errorf("Expected error to be <%v>, got <%v>", context.Canceled, result.Err)
+	}
+}
+
+func TestValidateTicketAcceptableStatuses(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNonAuthoritativeInfo)
+		fmt.Fprint(w, `<cas:serviceResponse xmlns:cas="http://www.yale.edu/tp/cas">
+  <cas:authenticationSuccess>
+    <cas:user>enoch.root</cas:user>
+  </cas:authenticationSuccess>
+</cas:serviceResponse>`)
+	}))
+	defer server.Close()
+
+	casURL, _ := url.Parse(server.URL)
+	validator := NewServiceTicketValidator(server.Client(), casURL)
+	validator.Logger = NoopLogger()
+	serviceURL, _ := url.Parse("http://example.com/")
+
+	_, err := validator.ValidateTicket(serviceURL, "ST-123")
+	var validationErr *ValidationError
+	if !errors.As(err, &validationErr) || validationErr.StatusCode != http.StatusNonAuthoritativeInfo {
+		t.Fatalf("Expected a 203 to be rejected by default, got <%v>", err)
+	}
+
+	validator.AcceptableStatuses = []int{http.StatusNonAuthoritativeInfo}
+	for _, strict := range []bool{false, true} {
+		validator.StrictParsing = strict
+		success, err := validator.ValidateTicket(serviceURL, "ST-123")
+		if err != nil {
+			t.Fatalf("Expected a 203 to be accepted with strict <%v>, got error: %v", strict, err)
+		}
+
+		if success.User != "enoch.root" {
+			t.Errorf("Expected User to be <enoch.root>, got <%s>", success.User)
+		}
+	}
+}
+
+func TestValidateTicketMulti(t *testing.T) {
+	var services []string
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		service := r.URL.Query().Get("service")
+		services = append(services, service)
+
+		switch service {
+		case "https://b.example.com/":
+			fmt.Fprint(w, `<cas:serviceResponse xmlns:cas="http://www.yale.edu/tp/cas">
+  <cas:authenticationSuccess>
+    <cas:user>enoch.root</cas:user>
+  </cas:authenticationSuccess>
+</cas:serviceResponse>`)
+		case "https://c.example.com/":
+			fmt.Fprint(w, `<cas:serviceResponse xmlns:cas="http://www.yale.edu/tp/cas">
+  <cas:authenticationFailure code="INVALID_TICKET">Ticket ST-123 not recognized</cas:authenticationFailure>
+</cas:serviceResponse>`)
+		default:
+			fmt.Fprintf(w, `<cas:serviceResponse xmlns:cas="http://www.yale.edu/tp/cas">
+  <cas:authenticationFailure code="INVALID_SERVICE">Ticket ST-123 does not match supplied service %s</cas:authenticationFailure>
+</cas:serviceResponse>`, service)
+		}
+	}))
+	defer server.Close()
+
+	casURL, _ := url.Parse(server.URL)
+	validator := NewServiceTicketValidator(server.Client(), casURL)
+	validator.Logger = NoopLogger()
+	validator.ReplayGuard = NewReplayGuard(0)
+
+	a, _ := url.Parse("https://a.example.com/")
+	b, _ := url.Parse("https://b.example.com/")
+	c, _ := url.Parse("https://c.example.com/")
+
+	success, err := validator.ValidateTicketMulti(context.Background(), []*url.URL{a, b, c}, "ST-123")
+	if err != nil {
+		t.Fatalf("Expected the second candidate to validate, got error: %v", err)
+	}
+
+	if success.User != "enoch.root" {
+		t.Errorf("Expected User to be <enoch.root>, got <%s>", success.User)
+	}
+
+	if len(services) != 2 {
+		t.Errorf("Expected the candidates to be tried until one validates, got <%v>", services)
+	}
+
+	services = nil
+	_, err = validator.ValidateTicketMulti(context.Background(), []*url.URL{c, b}, "ST-456")
+	var authErr *AuthenticationError
+	if !errors.As(err, &authErr) || authErr.Code != INVALID_TICKET || len(services) != 1 {
+		t.Errorf("Expected INVALID_TICKET to stop at the first candidate, got <%v> after <%v>", err, services)
+	}
+
+	if _, err := validator.ValidateTicketMulti(context.Background(), nil, "ST-789"); err == nil {
+		t.Errorf("Expected an error without candidates")
+	}
+}
+
+func TestValidateTicketTicketRouter(t *testing.T) {
+	response := `<cas:serviceResponse xmlns:cas="http://www.yale.edu/tp/cas">
+  <cas:authenticationSuccess>
+    <cas:user>%s</cas:user>
+  </cas:authenticationSuccess>
+</cas:serviceResponse>`
+
+	node1 := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, response, "node1")
+	}))
+	defer node1.Close()
+
+	node2 := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/cas/serviceValidate" {
+			http.NotFound(w, r)
+			return
+		}
+
+		fmt.Fprintf(w, response, "node2")
+	}))
+	defer node2.Close()
+
+	casURL, _ := url.Parse(node1.URL)
+	validator := NewServiceTicketValidator(node1.Client(), casURL)
+	validator.TicketRouter = func(ticket string) (*url.URL, bool) {
+		if strings.HasSuffix(ticket, "-node2") {
+			u, _ := url.Parse(node2.URL + "/cas/")
+			return u, true
+		}
+
+		return nil, false
+	}
+	serviceURL, _ := url.Parse("http://example.com/")
+
+	for ticket, expected := range map[string]string{"ST-1-node1": "node1", "ST-2-node2": "node2", "ST-3": "node1"} {
+		success, err := validator.ValidateTicket(serviceURL, ticket)
+		if err != nil {
+			t.Errorf("Expected ValidateTicket of <%s> to succeed, got error: %v", ticket, err)
+			continue
+		}
+
+		if success.User != expected {
+			t.Errorf("Expected <%s> to be validated by <%s>, got <%s>", ticket, expected, success.User)
+		}
+	}
+}
+
+func TestServiceValidateUrlNormaliseTrailingSlash(t *testing.T) {
+	casURL, _ := url.Parse("https://cas.example.com/")
+	validator := NewServiceTicketValidator(nil, casURL)
+	validator.NormaliseTrailingSlash = true
+
+	cases := [][]string{
+		{"https://app", "https://app/"},
+		{"https://app/a", "https://app/a/"},
+		{"https://app/a?ticket=ST-1", "https://app/a/"},
+	}
+
+	for _, c := range cases {
+		var urls []string
+		for _, service := range c {
+			serviceURL, _ := url.Parse(service)
+			u, err := validator.ServiceValidateUrl(serviceURL, "ST-123")
+			if err != nil {
+				t.Fatalf("ServiceValidateUrl returned an error: %v", err)
+			}
+
+			urls = append(urls, u)
+		}
+
+		if urls[0] != urls[1] {
+			t.Errorf("Expected <%s> and <%s> to validate the same service, got <%s> and <%s>", c[0], c[1], urls[0], urls[1])
+		}
+	}
+
+	serviceURL, _ := url.Parse("https://app")
+	u, _ := validator.ServiceValidateUrl(serviceURL, "ST-123")
+	if exp := "https://cas.example.com/serviceValidate?service=https%3A%2F%2Fapp%2F&ticket=ST-123"; u != exp {
+		t.Errorf("Expected the root service to be canonicalised to <%s>, got <%s>", exp, u)
+	}
+
+	client := NewClient(&Options{URL: casURL, NormaliseTrailingSlash: true})
+	loc, err := client.LoginUrlForRequest(httptest.NewRequest("GET", "https://app/a/", nil))
+	if err != nil {
+		t.Fatalf("LoginUrlForRequest returned an error: %v", err)
+	}
+
+	if exp := "https://cas.example.com/login?service=https%3A%2F%2Fapp%2Fa"; loc != exp {
+		t.Errorf("Expected login url to be <%s>, got <%s>", exp, loc)
+	}
+}
+
+func TestValidateTicketOperationTimeout(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `<cas:serviceResponse xmlns:cas="http://www.yale.edu/tp/cas">
+  <cas:authenticationSuccess>
+    <cas:user>enoch.root</cas:user>`)
+		w.(http.Flusher).Flush()
+
+		// Stall while sending the body
+		select {
+		case <-r.Context().Done():
+		case <-time.After(time.Second):
+		}
+	}))
+	defer server.Close()
+
+	casURL, _ := url.Parse(server.URL)
+	validator := NewServiceTicketValidator(server.Client(), casURL)
+	validator.OperationTimeout = 50 * time.Millisecond
+	serviceURL, _ := url.Parse("http://example.com/")
+
+	start := time.Now()
+	if _, err := validator.ValidateTicket(serviceURL, "ST-123"); err != context.DeadlineExceeded {
+		t.Errorf("Expected error to be <%v>, got <%v>", context.DeadlineExceeded, err)
+	}
+
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("Expected the validation to be cut short by the timeout, took %v", elapsed)
+	}
+}
+
+func TestValidateTicketClockSkew(t *testing.T) {
+	var authenticationDate time.Time
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `<cas:serviceResponse xmlns:cas="http://www.yale.edu/tp/cas">
+  <cas:authenticationSuccess>
+    <cas:user>enoch.root</cas:user>
+    <cas:attributes>
+      <cas:authenticationDate>%s</cas:authenticationDate>
+      <cas:isFromNewLogin>true</cas:isFromNewLogin>
+    </cas:attributes>
+  </cas:authenticationSuccess>
+</cas:serviceResponse>`, authenticationDate.Format(time.RFC3339Nano))
+	}))
+	defer server.Close()
+
+	casURL, _ := url.Parse(server.URL)
+	validator := NewServiceTicketValidator(server.Client(), casURL)
+	serviceURL, _ := url.Parse("http://example.com/")
+
+	// The CAS clock is five minutes ahead
+	authenticationDate = time.Now().Add(5 * time.Minute)
+	success, err := validator.ValidateTicket(serviceURL, "ST-123")
+	if err != nil {
+		t.Fatalf("Expected ValidateTicket to succeed, got error: %v", err)
+	}
+
+	if d := success.ClockSkew - 5*time.Minute; d > time.Second || d < -time.Second {
+		t.Errorf("Expected ClockSkew to be about <5m0s>, got <%v>", success.ClockSkew)
+	}
+}
+
+func TestEndpointURLCached(t *testing.T) {
+	casURL, _ := url.Parse("https://cas.example.com/cas/")
+	validator := NewServiceTicketValidator(http.DefaultClient, casURL)
+
+	u, err := validator.endpointURL("serviceValidate", "ST-123")
+	if err != nil {
+		t.Fatalf("Expected endpointURL to succeed, got error: %v", err)
+	}
+
+	u.RawQuery = "ticket=ST-123"
+
+	u, err = validator.endpointURL("serviceValidate", "ST-456")
+	if err != nil {
+		t.Fatalf("Expected endpointURL to succeed, got error: %v", err)
+	}
+
+	if want := "https://cas.example.com/cas/serviceValidate"; u.String() != want {
+		t.Errorf("Expected endpoint URL to be <%s>, got <%s>", want, u)
+	}
+
+	migrated, _ := url.Parse("https://sso.example.com/")
+	validator.SetCasURL(migrated)
+
+	u, _ = validator.endpointURL("serviceValidate", "ST-789")
+	if want := "https://sso.example.com/serviceValidate"; u.String() != want {
+		t.Errorf("Expected endpoint URL to be <%s> after SetCasURL, got <%s>", want, u)
+	}
+}
+
+func TestValidateTicketMaintenance(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("ticket") == "ST-unavailable" {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			fmt.Fprint(w, "Service Unavailable")
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/html")
+		fmt.Fprint(w, `<html><body><h1 class="maintenance">SSO is being upgraded</h1></body></html>`)
+	}))
+	defer server.Close()
+
+	casURL, _ := url.Parse(server.URL)
+	validator := NewServiceTicketValidator(server.Client(), casURL)
+	serviceURL, _ := url.Parse("http://example.com/")
+
+	if _, err := validator.ValidateTicket(serviceURL, "ST-unavailable"); err != ErrCASMaintenance {
+		t.Errorf("Expected error to be <%v> for a 503 by default, got <%v>", ErrCASMaintenance, err)
+	}
+
+	if _, err := validator.ValidateTicket(serviceURL, "ST-123"); err != ErrUnexpectedHTMLResponse {
+		t.Errorf("Expected error to be <%v> without a detector, got <%v>", ErrUnexpectedHTMLResponse, err)
+	}
+
+	validator.MaintenanceDetector = func(statusCode int, body []byte) bool {
+		return bytes.Contains(body, []byte(`class="maintenance"`))
+	}
+
+	if _, err := validator.ValidateTicket(serviceURL, "ST-123"); err != ErrCASMaintenance {
+		t.Errorf("Expected error to be <%v> with a body marker, got <%v>", ErrCASMaintenance, err)
+	}
+}
+
+func TestValidateTicketSessionExpiresAt(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hint := `<cas:sessionExpiresAt>2015-02-10T22:28:42Z</cas:sessionExpiresAt>`
+		switch r.URL.Query().Get("ticket") {
+		case "ST-ttl":
+			hint = `<cas:maxTimeToLiveInSeconds>28800</cas:maxTimeToLiveInSeconds>`
+		case "ST-none":
+			hint = ""
+		}
+
+		fmt.Fprintf(w, `<cas:serviceResponse xmlns:cas="http://www.yale.edu/tp/cas">
+  <cas:authenticationSuccess>
+    <cas:user>enoch.root</cas:user>
+    <cas:attributes>
+      <cas:authenticationDate>2015-02-10T14:28:42Z</cas:authenticationDate>
+      %s
+    </cas:attributes>
+  </cas:authenticationSuccess>
+</cas:serviceResponse>`, hint)
+	}))
+	defer server.Close()
+
+	casURL, _ := url.Parse(server.URL)
+	validator := NewServiceTicketValidator(server.Client(), casURL)
+	serviceURL, _ := url.Parse("http://example.com/")
+	expected := time.Date(2015, 2, 10, 22, 28, 42, 0, time.UTC)
+
+	for _, ticket := range []string{"ST-date", "ST-ttl"} {
+		success, err := validator.ValidateTicket(serviceURL, ticket)
+		if err != nil {
+			t.Fatalf("Expected ValidateTicket to succeed, got error: %v", err)
+		}
+
+		if !success.SessionExpiresAt.Equal(expected) {
+			t.Errorf("Expected SessionExpiresAt for %s to be <%v>, got <%v>", ticket, expected, success.SessionExpiresAt)
+		}
+	}
+
+	success, err := validator.ValidateTicket(serviceURL, "ST-none")
+	if err != nil {
+		t.Fatalf("Expected ValidateTicket to succeed, got error: %v", err)
+	}
+
+	if !success.SessionExpiresAt.IsZero() {
+		t.Errorf("Expected SessionExpiresAt to be zero without a hint, got <%v>", success.SessionExpiresAt)
+	}
+}
+
+func TestValidateTicketWithServiceString(t *testing.T) {
+	var received string
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = r.URL.Query().Get("service")
+		fmt.Fprintf(w, `<cas:serviceResponse xmlns:cas="http://www.yale.edu/tp/cas">
+  <cas:authenticationSuccess>
+    <cas:user>enoch.root</cas:user>
+    <cas:service>%s</cas:service>
+  </cas:authenticationSuccess>
+</cas:serviceResponse>`, html.EscapeString(received))
+	}))
+	defer server.Close()
+
+	casURL, _ := url.Parse(server.URL)
+	validator := NewServiceTicketValidator(server.Client(), casURL)
+	validator.NormaliseTrailingSlash = true
+	service := "https://example.com/app/?b=2&a=1"
+
+	success, err := validator.ValidateTicketWithServiceString(context.Background(), service, "ST-123")
+	if err != nil {
+		t.Fatalf("Expected ValidateTicketWithServiceString to succeed, got error: %v", err)
+	}
+
+	if received != service {
+		t.Errorf("Expected the service to be sent as <%s>, got <%s>", service, received)
+	}
+
+	if success.Service != service {
+		t.Errorf("Expected Service to be <%s>, got <%s>", service, success.Service)
+	}
+
+	serviceURL, _ := url.Parse(service)
+	if _, err := validator.ValidateTicket(serviceURL, "ST-123"); err != nil {
+		t.Fatalf("Expected ValidateTicket to succeed, got error: %v", err)
+	}
+
+	if received == service {
+		t.Errorf("Expected ValidateTicket to sanitise the service, got <%s>", received)
+	}
+}
+
+func TestValidateTicketSubpath(t *testing.T) {
+	var paths []string
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.URL.EscapedPath())
+		fmt.Fprint(w, `<cas:serviceResponse xmlns:cas="http://www.yale.edu/tp/cas">
+  <cas:authenticationSuccess>
+    <cas:user>enoch.root</cas:user>
+  </cas:authenticationSuccess>
+</cas:serviceResponse>`)
+	}))
+	defer server.Close()
+
+	serviceURL, _ := url.Parse("http://example.com/")
+	subpaths := map[string]string{
+		"/sso/cas":    "/sso/cas/serviceValidate",
+		"/sso/cas/":   "/sso/cas/serviceValidate",
+		"/":           "/serviceValidate",
+		"":            "/serviceValidate",
+		"/sso%2Fcas/": "/sso%2Fcas/serviceValidate",
+	}
+
+	for subpath, expected := range subpaths {
+		paths = nil
+		casURL, _ := url.Parse(server.URL + subpath)
+		validator := NewServiceTicketValidator(server.Client(), casURL)
+
+		if _, err := validator.ValidateTicket(serviceURL, "ST-123"); err != nil {
+			t.Errorf("Expected ValidateTicket to succeed for %q, got error: %v", subpath, err)
+			continue
+		}
+
+		if len(paths) != 1 || paths[0] != expected {
+			t.Errorf("Expected the CAS URL %q to request <%s>, got <%v>", subpath, expected, paths)
+		}
+	}
+}
+
+func TestValidateTicketContextCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	release := make(chan struct{})
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		cancel() // the client disconnects while CAS is answering
+		select {
+		case <-r.Context().Done():
+		case <-release:
+		}
+	}))
+	defer server.Close()
+	defer close(release) // runs before Close, which waits for the handlers
+
+	casURL, _ := url.Parse(server.URL)
+	validator := NewServiceTicketValidator(server.Client(), casURL)
+	validator.Logger = NoopLogger()
+	serviceURL, _ := url.Parse("https://example.com/")
+
+	if _, err := validator.ValidateTicketContext(ctx, serviceURL, "ST-123"); err != context.Canceled {
+		t.Errorf("Expected error to be <%v> unchanged, got <%v>", context.Canceled, err)
+	}
+
+	validator.ProtocolVersion = ProtocolVersion1
+	if _, err := validator.ValidateTicketContext(ctx, serviceURL, "ST-123"); err != context.Canceled {
+		t.Errorf("Expected CAS 1 error to be <%v> unchanged, got <%v>", context.Canceled, err)
+	}
+}
+
+func TestValidateTicketLenientParsing(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `<cas:serviceResponse xmlns:cas="http://www.yale.edu/tp/cas">
+  <cas:authenticationSuccess>
+    <cas:user>enoch.root</cas:user>
+    <cas:attributes>
+      <cas:mail>enoch.root@example.com</cas:mail>
+      <cas:stray>Enoch<br></cas:stray>
+    </cas:attributes>
+  </cas:authenticationSuccess>
+</cas:serviceResponse>`)
+	}))
+	defer server.Close()
+
+	casURL, _ := url.Parse(server.URL)
+	validator := NewServiceTicketValidator(server.Client(), casURL)
+	validator.Logger = NoopLogger()
+
+	serviceURL, _ := url.Parse("https://example.com/")
+	var parseErr *ParseError
+	if _, err := validator.ValidateTicket(serviceURL, "ST-123"); !errors.As(err, &parseErr) {
+		t.Errorf("Expected a ParseError without LenientParsing, got %v", err)
+	}
+
+	validator.LenientParsing = true
+	success, err := validator.ValidateTicket(serviceURL, "ST-124")
+	if err != nil {
+		t.Fatalf("Expected LenientParsing to skip the malformed attribute, got error: %v", err)
+	}
+
+	if v := success.Attributes.Get("mail"); v != "enoch.root@example.com" {
+		t.Errorf("Expected mail to be <enoch.root@example.com>, got <%s>", v)
+	}
+}
+
+func TestValidateTicketVendorRootLenientParsing(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `<idp:response xmlns:idp="urn:example:idp:1.0" xmlns:cas="http://www.yale.edu/tp/cas">
+  <cas:authenticationSuccess>
+    <cas:user>enoch.root</cas:user>
+  </cas:authenticationSuccess>
+</idp:response>`)
+	}))
+	defer server.Close()
+
+	casURL, _ := url.Parse(server.URL)
+	serviceURL, _ := url.Parse("https://example.com/")
+
+	cases := []struct {
+		strict  bool
+		lenient bool
+		ok      bool
+	}{
+		{false, false, false},
+		{false, true, true},
+		{true, true, false},
+	}
+
+	for _, c := range cases {
+		validator := NewServiceTicketValidator(server.Client(), casURL)
+		validator.Logger = NoopLogger()
+		validator.StrictParsing = c.strict
+		validator.LenientParsing = c.lenient
+
+		success, err := validator.ValidateTicket(serviceURL, "ST-123")
+		if c.ok && (err != nil || success.User != "enoch.root") {
+			t.Errorf("Expected the vendor root to be read with LenientParsing, got <%v> and error <%v>", success, err)
+		}
+
+		if !c.ok && err == nil {
+			t.Errorf("Expected the vendor root to be rejected with StrictParsing <%v> and LenientParsing <%v>", c.strict, c.lenient)
+		}
+	}
+}
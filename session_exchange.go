@@ -0,0 +1,70 @@
+package cas
+
+import (
+	"context"
+	"net/url"
+)
+
+// SessionIssuer mints an application session, in a format defined by the application, for a
+// user validated by ExchangeTicketForSession.
+type SessionIssuer interface {
+	IssueSession(ctx context.Context, r *AuthenticationResponse) (token string, err error)
+}
+
+// SessionIssuerFunc adapts a function to the SessionIssuer interface
+type SessionIssuerFunc func(ctx context.Context, r *AuthenticationResponse) (string, error)
+
+// IssueSession calls f(ctx, r)
+func (f SessionIssuerFunc) IssueSession(ctx context.Context, r *AuthenticationResponse) (string, error) {
+	return f(ctx, r)
+}
+
+// ExchangeTicketForSession validates the ticket for serviceURL and returns the application
+// session token minted by issuer for the user, for applications which manage their own sessions
+// instead of using Handle.
+//
+// The response is recorded in the TicketStore and the token in the SessionStore, so a single
+// logout request for the ticket revokes the session, which LookupSession then reports.
+func (c *Client) ExchangeTicketForSession(ctx context.Context, serviceURL *url.URL, ticket string, issuer SessionIssuer) (string, error) {
+	success, err := c.validator.ValidateTicketContext(ctx, serviceURL, ticket)
+	if err != nil {
+		return "", err
+	}
+
+	if success == nil {
+		return "", &AuthenticationError{Code: INVALID_TICKET, Message: "ticket not validated"}
+	}
+
+	if err := c.tickets.Write(ticket, success); err != nil {
+		return "", err
+	}
+
+	token, err := issuer.IssueSession(ctx, success)
+	if err != nil {
+		c.tickets.Delete(ticket)
+		return "", err
+	}
+
+	if err := c.sessions.Set(token, ticket); err != nil {
+		c.tickets.Delete(ticket)
+		return "", err
+	}
+
+	return token, nil
+}
+
+// LookupSession returns the response for a session token issued by ExchangeTicketForSession.
+// ok is false if the token is unknown or its ticket was revoked by a single logout request.
+func (c *Client) LookupSession(token string) (*AuthenticationResponse, bool) {
+	ticket, ok := c.sessions.Get(token)
+	if !ok {
+		return nil, false
+	}
+
+	success, err := c.tickets.Read(ticket)
+	if err != nil {
+		return nil, false
+	}
+
+	return cachedResponse(success), true
+}
@@ -0,0 +1,60 @@
+package cas
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"testing"
+)
+
+func TestExchangeTicketForSession(t *testing.T) {
+	u, _ := url.Parse("https://cas.example.com/")
+	client := NewClient(&Options{
+		URL:       u,
+		Validator: &fakeValidator{users: map[string]string{"ST-fake": "enoch.root"}},
+	})
+
+	issuer := SessionIssuerFunc(func(ctx context.Context, r *AuthenticationResponse) (string, error) {
+		return "session-" + r.User, nil
+	})
+
+	serviceURL, _ := url.Parse("https://example.com/")
+	token, err := client.ExchangeTicketForSession(context.Background(), serviceURL, "ST-fake", issuer)
+	if err != nil {
+		t.Fatalf("Expected ExchangeTicketForSession to succeed, got error: %v", err)
+	}
+
+	if token != "session-enoch.root" {
+		t.Errorf("Expected token to be <session-enoch.root>, got <%s>", token)
+	}
+
+	if r, ok := client.LookupSession(token); !ok || r.User != "enoch.root" {
+		t.Errorf("Expected LookupSession to return the user, got <%v, %v>", r, ok)
+	}
+
+	// A single logout request removes the ticket
+	if err := client.tickets.Delete("ST-fake"); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := client.LookupSession(token); ok {
+		t.Errorf("Expected the session to be revoked with its ticket")
+	}
+
+	var authErr *AuthenticationError
+	if _, err := client.ExchangeTicketForSession(context.Background(), serviceURL, "ST-unknown", issuer); !errors.As(err, &authErr) {
+		t.Errorf("Expected an *AuthenticationError for an unknown ticket, got %v", err)
+	}
+
+	failing := SessionIssuerFunc(func(ctx context.Context, r *AuthenticationResponse) (string, error) {
+		return "", errors.New("session store unavailable")
+	})
+
+	if _, err := client.ExchangeTicketForSession(context.Background(), serviceURL, "ST-fake", failing); err == nil {
+		t.Errorf("Expected the issuer error to be returned")
+	}
+
+	if _, err := client.tickets.Read("ST-fake"); err == nil {
+		t.Errorf("Expected the ticket not to be kept when no session was issued")
+	}
+}
@@ -0,0 +1,45 @@
+package cas
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// singleLogoutHandler handles CAS single logout requests in front of an application which
+// manages its sessions itself
+type singleLogoutHandler struct {
+	h        http.Handler
+	onLogout func(ticket string)
+}
+
+// SingleLogoutHandler wraps h to handle the back-channel single logout requests of the CAS
+// server, for applications which do not use Client.Handle. A POST with a logoutRequest form
+// parameter is answered with 200 once onLogout has been called with the service ticket of the
+// SessionIndex, so the application can end the session it created for the ticket. A logout
+// request which can not be parsed is answered with 400. Other requests are passed to h.
+//
+// Unlike Client.Handle it does not check the age, ID or source of logout requests, see
+// Options.LogoutRequestMaxAge and Options.VerifyLogoutSource.
+func SingleLogoutHandler(h http.Handler, onLogout func(ticket string)) http.Handler {
+	return &singleLogoutHandler{h: h, onLogout: onLogout}
+}
+
+// ServeHTTP handles single logout requests and passes the other requests to the child
+// http.Handler.
+func (sh *singleLogoutHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !isSingleLogoutRequest(r) {
+		sh.h.ServeHTTP(w, r)
+		return
+	}
+
+	logoutRequest, err := ParseLogoutRequest([]byte(r.FormValue("logoutRequest")))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	sh.onLogout(logoutRequest.SessionIndex)
+
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintln(w, "OK")
+}
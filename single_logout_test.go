@@ -0,0 +1,70 @@
+package cas
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestSingleLogoutHandler(t *testing.T) {
+	var loggedOut []string
+	var served int
+	handler := SingleLogoutHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		served++
+	}), func(ticket string) {
+		loggedOut = append(loggedOut, ticket)
+	})
+
+	post := func(logoutRequest string) int {
+		form := make(url.Values)
+		form.Set("logoutRequest", logoutRequest)
+		req := httptest.NewRequest("POST", "http://example.com/", strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	valid, _ := xmlLogoutRequest("ST-123")
+	if code := post(string(valid)); code != http.StatusOK {
+		t.Errorf("Expected a logout request to be answered with <%v>, got <%v>", http.StatusOK, code)
+	}
+
+	if len(loggedOut) != 1 || loggedOut[0] != "ST-123" {
+		t.Errorf("Expected the callback to be called with <ST-123>, got <%v>", loggedOut)
+	}
+
+	for _, malformed := range []string{"<samlp:LogoutRequest", "<html></html>", `<samlp:LogoutRequest xmlns:samlp="urn:oasis:names:tc:SAML:2.0:protocol" ID="1" IssueInstant="2018-03-22T10:52:57Z"></samlp:LogoutRequest>`} {
+		if code := post(malformed); code != http.StatusBadRequest {
+			t.Errorf("Expected malformed logout request %q to be answered with <%v>, got <%v>", malformed, http.StatusBadRequest, code)
+		}
+	}
+
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "http://example.com/?logoutRequest=x", nil))
+	if served != 1 || len(loggedOut) != 1 {
+		t.Errorf("Expected a GET to be passed on, got %d served and %d logouts", served, len(loggedOut))
+	}
+}
+
+func TestParseLogoutRequestExported(t *testing.T) {
+	l, err := ParseLogoutRequest([]byte(`<samlp:LogoutRequest xmlns:samlp="urn:oasis:names:tc:SAML:2.0:protocol"
+  ID="LR-1" Version="2.0" IssueInstant="2018-03-22T10:52:57Z">
+  <saml:NameID xmlns:saml="urn:oasis:names:tc:SAML:2.0:assertion">@NOT_USED@</saml:NameID>
+  <samlp:SessionIndex> ST-123 </samlp:SessionIndex>
+</samlp:LogoutRequest>`))
+	if err != nil {
+		t.Fatalf("Expected ParseLogoutRequest to succeed, got error: %v", err)
+	}
+
+	if l.ID != "LR-1" || l.SessionIndex != "ST-123" || l.IssueInstant.IsZero() {
+		t.Errorf("Expected ID <LR-1> and SessionIndex <ST-123>, got %+v", l)
+	}
+
+	if _, err := ParseLogoutRequest([]byte("not xml")); !errors.Is(err, ErrMalformedLogoutRequest) {
+		t.Errorf("Expected error to be <%v>, got <%v>", ErrMalformedLogoutRequest, err)
+	}
+}
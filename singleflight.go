@@ -0,0 +1,106 @@
+package cas
+
+import (
+	"errors"
+	"sync"
+)
+
+// validationCall is an in-flight or completed validation shared by validationGroup
+type validationCall struct {
+	wg       sync.WaitGroup
+	success  *AuthenticationResponse
+	err      error
+	panicked interface{} // value fn panicked with, handed on to the waiters
+}
+
+// errValidationAborted is the error of waiters whose shared validation exited without returning,
+// such as with runtime.Goexit
+var errValidationAborted = errors.New("cas: shared validation aborted")
+
+// validationGroup deduplicates concurrent validations of the same key, in the manner of
+// golang.org/x/sync/singleflight.
+type validationGroup struct {
+	mu    sync.Mutex
+	calls map[string]*validationCall
+}
+
+// do calls fn for key unless a call for key is already in flight, in which case it waits for
+// that call. Every caller, including the one calling fn, gets its own copy of the result, as
+// the waiters clone it while the caller of fn may already be changing its copy. If fn panics,
+// the call is released and the panic repeated in every caller, so no later validation of key
+// waits forever.
+func (g *validationGroup) do(key string, fn func() (*AuthenticationResponse, error)) (*AuthenticationResponse, error) {
+	g.mu.Lock()
+	if g.calls == nil {
+		g.calls = make(map[string]*validationCall)
+	}
+
+	if c, ok := g.calls[key]; ok {
+		g.mu.Unlock()
+		c.wg.Wait()
+
+		if c.panicked != nil {
+			panic(c.panicked)
+		}
+
+		return c.success.clone(), c.err
+	}
+
+	c := &validationCall{}
+	c.wg.Add(1)
+	g.calls[key] = c
+	g.mu.Unlock()
+
+	returned := false
+	defer func() {
+		if !returned {
+			if c.panicked = recover(); c.panicked == nil {
+				c.err = errValidationAborted
+			}
+		}
+
+		g.mu.Lock()
+		delete(g.calls, key)
+		g.mu.Unlock()
+
+		c.wg.Done()
+
+		if c.panicked != nil {
+			panic(c.panicked)
+		}
+	}()
+
+	c.success, c.err = fn()
+	returned = true
+
+	return c.success.clone(), c.err
+}
+
+// clone returns a copy of r which shares no slices or maps with it
+func (r *AuthenticationResponse) clone() *AuthenticationResponse {
+	if r == nil {
+		return nil
+	}
+
+	c := *r
+	c.Proxies = append([]string(nil), r.Proxies...)
+	c.MemberOf = append([]string(nil), r.MemberOf...)
+	c.Warnings = append([]string(nil), r.Warnings...)
+	c.orderedAttributes = append([]Attribute(nil), r.orderedAttributes...)
+
+	if r.attributeTypes != nil {
+		c.attributeTypes = make(map[string]string, len(r.attributeTypes))
+		for name, t := range r.attributeTypes {
+			c.attributeTypes[name] = t
+		}
+	}
+
+	if r.Attributes != nil {
+		c.Attributes = make(UserAttributes, len(r.Attributes))
+		for name, values := range r.Attributes {
+			c.Attributes[name] = append([]string(nil), values...)
+		}
+	}
+
+	return &c
+}
@@ -0,0 +1,195 @@
+package cas
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestDeduplicateValidations(t *testing.T) {
+	var requests int32
+	release := make(chan struct{})
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&requests, 1) > 1 {
+			fmt.Fprint(w, `<cas:serviceResponse xmlns:cas="http://www.yale.edu/tp/cas">
+  <cas:authenticationFailure code="INVALID_TICKET">Ticket ST-123 already consumed</cas:authenticationFailure>
+</cas:serviceResponse>`)
+			return
+		}
+
+		<-release
+		fmt.Fprint(w, `<cas:serviceResponse xmlns:cas="http://www.yale.edu/tp/cas">
+  <cas:authenticationSuccess>
+    <cas:user>enoch.root</cas:user>
+    <cas:attributes><cas:role>reader</cas:role></cas:attributes>
+  </cas:authenticationSuccess>
+</cas:serviceResponse>`)
+	}))
+	defer server.Close()
+
+	casURL, _ := url.Parse(server.URL)
+	validator := NewServiceTicketValidator(server.Client(), casURL)
+	validator.DeduplicateValidations = true
+	serviceURL, _ := url.Parse("http://example.com/")
+
+	const n = 4
+	results := make([]*AuthenticationResponse, n)
+	errs := make([]error, n)
+
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			results[i], errs[i] = validator.ValidateTicket(serviceURL, "ST-123")
+		}(i)
+	}
+
+	time.Sleep(100 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	if r := atomic.LoadInt32(&requests); r != 1 {
+		t.Errorf("Expected one request to the CAS server, got %d", r)
+	}
+
+	for i := 0; i < n; i++ {
+		if errs[i] != nil {
+			t.Errorf("Expected validation %d to succeed, got error: %v", i, errs[i])
+			continue
+		}
+
+		if results[i].User != "enoch.root" {
+			t.Errorf("Expected User to be <enoch.root>, got <%s>", results[i].User)
+		}
+	}
+
+	results[0].Attributes.Add("role", "admin")
+	for i := 1; i < n; i++ {
+		if len(results[i].Attributes["role"]) != 1 {
+			t.Errorf("Expected shared results not to share attributes, got %v", results[i].Attributes["role"])
+		}
+	}
+}
+
+func TestValidationGroupCopiesResult(t *testing.T) {
+	var g validationGroup
+	var once sync.Once
+	started := make(chan struct{})
+	release := make(chan struct{})
+
+	fn := func() (*AuthenticationResponse, error) {
+		once.Do(func() { close(started) })
+		<-release
+
+		r := &AuthenticationResponse{User: "enoch.root", Attributes: make(UserAttributes)}
+		r.addAttribute("role", "reader")
+		return r, nil
+	}
+
+	const n = 8
+	results := make([]*AuthenticationResponse, n)
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		results[0], _ = g.do("ST-123", fn)
+		results[0].Attributes.Add("role", "admin")
+		results[0].Warnings = append(results[0].Warnings, "changed")
+	}()
+
+	<-started
+	for i := 1; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			results[i], _ = g.do("ST-123", fn)
+			results[i].Attributes.Add("role", "writer")
+		}(i)
+	}
+
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	if roles := results[0].Attributes["role"]; len(roles) != 2 || roles[1] != "admin" {
+		t.Errorf("Expected the roles of the caller of fn to be <[reader admin]>, got %v", roles)
+	}
+
+	for i := 1; i < n; i++ {
+		if results[i] == results[0] {
+			t.Errorf("Expected result %d not to be the result of the caller of fn", i)
+		}
+
+		if roles := results[i].Attributes["role"]; len(roles) != 2 || roles[1] != "writer" {
+			t.Errorf("Expected the roles of result %d to be <[reader writer]>, got %v", i, roles)
+		}
+	}
+}
+
+func TestValidationGroupPanic(t *testing.T) {
+	var g validationGroup
+	started := make(chan struct{})
+	release := make(chan struct{})
+
+	// recovered calls do for ST-123 with fn, returning the value it panics with
+	recovered := func(fn func() (*AuthenticationResponse, error)) <-chan interface{} {
+		ch := make(chan interface{}, 1)
+		go func() {
+			defer func() {
+				ch <- recover()
+			}()
+
+			g.do("ST-123", fn)
+		}()
+
+		return ch
+	}
+
+	leader := recovered(func() (*AuthenticationResponse, error) {
+		close(started)
+		<-release
+		panic("mapper failed")
+	})
+
+	<-started
+	waiter := recovered(func() (*AuthenticationResponse, error) {
+		t.Errorf("Expected the waiter not to call fn")
+		return nil, nil
+	})
+
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+
+	if p := <-leader; p != "mapper failed" {
+		t.Errorf("Expected the caller of fn to panic with <mapper failed>, got <%v>", p)
+	}
+
+	if p := <-waiter; p != "mapper failed" {
+		t.Errorf("Expected the waiter to panic with <mapper failed>, got <%v>", p)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		success, err := g.do("ST-123", func() (*AuthenticationResponse, error) {
+			return &AuthenticationResponse{User: "enoch.root"}, nil
+		})
+
+		if err != nil || success.User != "enoch.root" {
+			t.Errorf("Expected a later validation to succeed, got <%v> and error <%v>", success, err)
+		}
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatalf("Expected a later validation not to wait for the panicked one")
+	}
+}
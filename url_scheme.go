@@ -3,6 +3,7 @@ package cas
 import (
 	"net/url"
 	"path"
+	"strings"
 )
 
 // URLScheme creates the url which are required to handle the cas protocol.
@@ -19,7 +20,7 @@ type URLScheme interface {
 // NewDefaultURLScheme creates a URLScheme which uses the cas default urls
 func NewDefaultURLScheme(base *url.URL) *DefaultURLScheme {
 	return &DefaultURLScheme{
-		base:                base,
+		base:                baseURL(base),
 		LoginPath:           "login",
 		LogoutPath:          "logout",
 		ValidatePath:        "validate",
@@ -75,5 +76,36 @@ func (scheme *DefaultURLScheme) RestLogout(tgt string) (*url.URL, error) {
 }
 
 func (scheme *DefaultURLScheme) createURL(urlPath string) (*url.URL, error) {
-	return scheme.base.Parse(path.Join(scheme.base.Path, urlPath))
+	return joinURLPath(scheme.base, urlPath), nil
+}
+
+// joinURLPath returns base with p appended to its path, whether or not the path ends with a
+// slash. The path of base is taken as escaped, so a CAS server mounted at a subpath with
+// escaped characters, such as %2F, is not resolved to another path.
+func joinURLPath(base *url.URL, p string) *url.URL {
+	u := base.JoinPath(p)
+	if !strings.HasPrefix(u.Path, "/") {
+		u.Path = "/" + u.Path
+		if u.RawPath != "" {
+			u.RawPath = "/" + u.RawPath
+		}
+	}
+
+	return u
+}
+
+// baseURL returns a copy of the CAS URL without any query or fragment, which would otherwise
+// be carried into the URLs built relative to it.
+func baseURL(u *url.URL) *url.URL {
+	if u == nil {
+		return nil
+	}
+
+	base := *u
+	base.RawQuery = ""
+	base.ForceQuery = false
+	base.Fragment = ""
+	base.RawFragment = ""
+
+	return &base
 }
@@ -34,3 +34,65 @@ func assertURL(t *testing.T, expected string, u *url.URL, err error) {
 		t.Errorf("%s should be equal to %s", u.Path, expected)
 	}
 }
+
+func TestCasURLWithQueryAndFragment(t *testing.T) {
+	service, _ := url.Parse("https://app.example.edu/")
+
+	for _, raw := range []string{
+		"https://sso.example.edu/cas?foo=bar",
+		"https://sso.example.edu/cas/?foo=bar#login",
+		"https://sso.example.edu/cas#login",
+	} {
+		casURL, _ := url.Parse(raw)
+
+		login, err := NewDefaultURLScheme(casURL).Login()
+		if err != nil {
+			t.Fatalf("Expected Login to succeed for %s, got error: %v", raw, err)
+		}
+
+		if login.String() != "https://sso.example.edu/cas/login" {
+			t.Errorf("Expected login URL for %s to be <https://sso.example.edu/cas/login>, got <%s>", raw, login)
+		}
+
+		validator := NewServiceTicketValidator(nil, casURL)
+		u, err := validator.ServiceValidateUrl(service, "ST-123")
+		if err != nil {
+			t.Fatalf("Expected ServiceValidateUrl to succeed for %s, got error: %v", raw, err)
+		}
+
+		expected := "https://sso.example.edu/cas/serviceValidate?service=https%3A%2F%2Fapp.example.edu%2F&ticket=ST-123"
+		if u != expected {
+			t.Errorf("Expected service validate URL for %s to be <%s>, got <%s>", raw, expected, u)
+		}
+	}
+
+	casURL, _ := url.Parse("https://sso.example.edu/cas?foo=bar")
+	NewDefaultURLScheme(casURL)
+	if casURL.RawQuery != "foo=bar" {
+		t.Errorf("Expected the configured URL not to be modified, got <%s>", casURL)
+	}
+}
+
+func TestDefaultURLSchemeSubpath(t *testing.T) {
+	urls := map[string]string{
+		"https://edu.example.org/sso/cas":      "https://edu.example.org/sso/cas/login",
+		"https://edu.example.org/sso/cas/":     "https://edu.example.org/sso/cas/login",
+		"https://edu.example.org/":             "https://edu.example.org/login",
+		"https://edu.example.org":              "https://edu.example.org/login",
+		"https://edu.example.org/sso%2Fcas/":   "https://edu.example.org/sso%2Fcas/login",
+		"https://edu.example.org/sso/cas%3F1/": "https://edu.example.org/sso/cas%3F1/login",
+	}
+
+	for casURL, expected := range urls {
+		base, _ := url.Parse(casURL)
+
+		u, err := NewDefaultURLScheme(base).Login()
+		if err != nil {
+			t.Fatalf("Expected Login to succeed for %s, got error: %v", casURL, err)
+		}
+
+		if u.String() != expected {
+			t.Errorf("Expected the login URL for %s to be <%s>, got <%s>", casURL, expected, u)
+		}
+	}
+}
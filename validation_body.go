@@ -0,0 +1,175 @@
+package cas
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"mime"
+	"net/url"
+	"strings"
+)
+
+// Format identifies the format of a validation response body
+type Format int
+
+// Format values
+const (
+	FormatXML  Format = iota // CAS 2.0 and 3.0 XML serviceResponse
+	FormatCAS1               // CAS 1.0 plain text yes/no response
+	FormatJSON               // CAS 3.0 JSON serviceResponse
+)
+
+// String returns the name of the Format
+func (f Format) String() string {
+	switch f {
+	case FormatXML:
+		return "XML"
+	case FormatCAS1:
+		return "CAS1"
+	case FormatJSON:
+		return "JSON"
+	default:
+		return fmt.Sprintf("Format(%d)", int(f))
+	}
+}
+
+// FormatNegotiation selects how a validator asks the CAS server for a CAS 3.0 JSON response
+type FormatNegotiation int
+
+// FormatNegotiation values
+const (
+	NegotiateXML         FormatNegotiation = iota // No JSON is requested, the CAS default
+	NegotiateQuery                                // format=JSON query parameter
+	NegotiateAccept                               // "Accept: application/json" header, which some servers respect instead
+	NegotiateQueryAccept                          // Both the query parameter and the Accept header
+)
+
+// String returns the name of the FormatNegotiation
+func (n FormatNegotiation) String() string {
+	switch n {
+	case NegotiateXML:
+		return "XML"
+	case NegotiateQuery:
+		return "Query"
+	case NegotiateAccept:
+		return "Accept"
+	case NegotiateQueryAccept:
+		return "QueryAccept"
+	default:
+		return fmt.Sprintf("FormatNegotiation(%d)", int(n))
+	}
+}
+
+// query reports whether the format=JSON query parameter is sent
+func (n FormatNegotiation) query() bool {
+	return n == NegotiateQuery || n == NegotiateQueryAccept
+}
+
+// accept reports whether the "Accept: application/json" header is sent
+func (n FormatNegotiation) accept() bool {
+	return n == NegotiateAccept || n == NegotiateQueryAccept
+}
+
+// ParseValidationBody parses a captured validation response body without performing any
+// requests, for example when testing, auditing or replaying a CAS exchange.
+//
+// A CAS 1.0 "no" response returns a nil AuthenticationResponse and a nil error, matching
+// ServiceTicketValidator.ValidateTicket. Nothing is logged, attributes which can not be
+// parsed are skipped silently.
+func ParseValidationBody(body []byte, format Format) (*AuthenticationResponse, error) {
+	return parseValidationBody(body, format, parseOptions{logger: NoopLogger()})
+}
+
+// ValidateCapturedResponse performs the checks and mapping of ValidateTicket on a captured
+// response body instead of a request, such as one saved with ResponseTrace. As tickets are
+// single use, this allows the PrincipalAttribute, PrincipalMapper and service check of the
+// validator to be debugged repeatedly against one real exchange.
+func (validator *ServiceTicketValidator) ValidateCapturedResponse(serviceURL *url.URL, body []byte, format Format) (*AuthenticationResponse, error) {
+	success, err := parseValidationBody(body, format, validator.parseOptions())
+	if err != nil || success == nil {
+		return nil, err
+	}
+
+	if err := validator.processResponse(context.Background(), serviceURL, success); err != nil {
+		return nil, err
+	}
+
+	return success, nil
+}
+
+// parseValidationBody parses body as format according to opts
+func parseValidationBody(body []byte, format Format, opts parseOptions) (*AuthenticationResponse, error) {
+	switch format {
+	case FormatXML:
+		return parseServiceResponse(body, opts)
+	case FormatCAS1:
+		body, err := toUTF8(body, opts.charset, opts.charsetReader)
+		if err != nil {
+			return nil, err
+		}
+
+		return parseCas1Response(string(body))
+	case FormatJSON:
+		return parseJSONServiceResponse(body, opts)
+	default:
+		return nil, fmt.Errorf("cas: parse validation body: unknown format %v", format)
+	}
+}
+
+// responseFormat determines the format of a serviceValidate response from its Content-Type,
+// or from its first character when the Content-Type is missing or generic.
+func responseFormat(contentType string, body []byte) Format {
+	if mediaType, _, err := mime.ParseMediaType(contentType); err == nil {
+		if mediaType == "application/json" || strings.HasSuffix(mediaType, "+json") {
+			return FormatJSON
+		}
+
+		if strings.HasSuffix(mediaType, "/xml") || strings.HasSuffix(mediaType, "+xml") {
+			return FormatXML
+		}
+	}
+
+	if trimmed := bytes.TrimSpace(body); len(trimmed) > 0 && trimmed[0] == '{' {
+		return FormatJSON
+	}
+
+	return FormatXML
+}
+
+// hasXMLContentType reports whether the Content-Type header value is an XML media type.
+func hasXMLContentType(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	return err == nil && (strings.HasSuffix(mediaType, "/xml") || strings.HasSuffix(mediaType, "+xml"))
+}
+
+// parseCas1Response parses the CAS 1.0 "yes\n<user>\n" or "no\n\n" response. Lines may end with
+// \r\n, and the lines are trimmed of surrounding whitespace, so a trailing space or a missing
+// final newline is accepted. A yes response without a user is an error.
+func parseCas1Response(body string) (*AuthenticationResponse, error) {
+	if strings.TrimSpace(body) == "" {
+		return nil, ErrEmptyResponse
+	}
+
+	lines := strings.Split(body, "\n")
+	for i := range lines {
+		lines[i] = strings.TrimSpace(lines[i])
+	}
+
+	switch lines[0] {
+	case "no":
+		return nil, nil // not logged in
+	case "yes":
+	default:
+		return nil, fmt.Errorf("cas: validate ticket: unexpected CAS 1 response %q", body)
+	}
+
+	if len(lines) < 2 || lines[1] == "" {
+		return nil, fmt.Errorf("cas: validate ticket: CAS 1 response without a user %q", body)
+	}
+
+	return &AuthenticationResponse{
+		User:            lines[1],
+		Attributes:      make(UserAttributes),
+		ProtocolVersion: ProtocolVersion1,
+	}, nil
+}
@@ -0,0 +1,298 @@
+package cas
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestParseValidationBodyXML(t *testing.T) {
+	s := `<cas:serviceResponse xmlns:cas="http://www.yale.edu/tp/cas">
+  <cas:authenticationSuccess>
+    <cas:user>username</cas:user>
+    <cas:attributes>
+      <cas:email>jdoe@example.org</cas:email>
+    </cas:attributes>
+  </cas:authenticationSuccess>
+</cas:serviceResponse>`
+
+	sr, err := ParseValidationBody([]byte(s), FormatXML)
+	if err != nil {
+		t.Fatalf("Expected ParseValidationBody to succeed, got error: %v", err)
+	}
+
+	if sr.User != "username" {
+		t.Errorf("Expected User to be <username>, got <%s>", sr.User)
+	}
+
+	if v := sr.Attributes.Get("email"); v != "jdoe@example.org" {
+		t.Errorf("Expected email to be <jdoe@example.org>, got <%s>", v)
+	}
+}
+
+func TestParseValidationBodyRubycasNil(t *testing.T) {
+	var logs bytes.Buffer
+	previous := slog.Default()
+	slog.SetDefault(slog.New(slog.NewTextHandler(&logs, nil)))
+	defer slog.SetDefault(previous)
+
+	s := `<cas:serviceResponse xmlns:cas="http://www.yale.edu/tp/cas">
+  <cas:authenticationSuccess>
+    <cas:user>username</cas:user>
+    <cas:empty>---</cas:empty>
+    <cas:null>--- ~</cas:null>
+    <cas:roles>--- [~, admin]</cas:roles>
+    <cas:limits>--- {a: 1}</cas:limits>
+  </cas:authenticationSuccess>
+</cas:serviceResponse>`
+
+	sr, err := ParseValidationBody([]byte(s), FormatXML)
+	if err != nil {
+		t.Fatalf("Expected ParseValidationBody to succeed, got error: %v", err)
+	}
+
+	if v, ok := sr.Attributes["null"]; !ok || len(v) != 1 || v[0] != "" {
+		t.Errorf("Expected null to be an empty value, got <%v>", v)
+	}
+
+	if v := sr.Attributes["roles"]; len(v) != 1 || v[0] != "admin" {
+		t.Errorf("Expected roles to be <[admin]>, got <%v>", v)
+	}
+
+	if logs.Len() != 0 {
+		t.Errorf("Expected ParseValidationBody not to log, got <%s>", logs.String())
+	}
+}
+
+func TestParseValidationBodyCAS1(t *testing.T) {
+	sr, err := ParseValidationBody([]byte("yes\nusername\n"), FormatCAS1)
+	if err != nil {
+		t.Fatalf("Expected ParseValidationBody to succeed, got error: %v", err)
+	}
+
+	if sr.User != "username" {
+		t.Errorf("Expected User to be <username>, got <%s>", sr.User)
+	}
+
+	sr, err = ParseValidationBody([]byte("no\n\n"), FormatCAS1)
+	if sr != nil || err != nil {
+		t.Errorf("Expected a no response to return nil, nil, got %v, %v", sr, err)
+	}
+
+	if _, err := ParseValidationBody([]byte("yes\n"), FormatCAS1); err == nil {
+		t.Errorf("Expected a truncated response to return an error")
+	}
+}
+
+func TestParseCas1Response(t *testing.T) {
+	cases := []struct {
+		body     string
+		user     string
+		loggedIn bool
+		err      bool
+	}{
+		{"yes\nalice\n", "alice", true, false},
+		{"yes\nalice", "alice", true, false},
+		{"yes\r\nalice\r\n", "alice", true, false},
+		{"yes \nalice \n", "alice", true, false},
+		{"no\n\n", "", false, false},
+		{"no\n", "", false, false},
+		{"no\r\n\r\n", "", false, false},
+		{"yes\n\n", "", false, true},
+		{"yes\n", "", false, true},
+		{"yes", "", false, true},
+		{"maybe\nalice\n", "", false, true},
+		{"", "", false, true},
+	}
+
+	for _, c := range cases {
+		sr, err := parseCas1Response(c.body)
+		if c.err {
+			if err == nil {
+				t.Errorf("Expected %q to return an error, got %v", c.body, sr)
+			}
+
+			continue
+		}
+
+		if err != nil {
+			t.Errorf("Expected %q to succeed, got error: %v", c.body, err)
+			continue
+		}
+
+		if !c.loggedIn {
+			if sr != nil {
+				t.Errorf("Expected %q to return nil, got %v", c.body, sr)
+			}
+
+			continue
+		}
+
+		if sr == nil || sr.User != c.user {
+			t.Errorf("Expected User of %q to be <%s>, got %v", c.body, c.user, sr)
+		}
+	}
+}
+
+func TestParseValidationBodyJSON(t *testing.T) {
+	s := `{
+  "serviceResponse" : {
+    "authenticationSuccess" : {
+      "user" : "username",
+      "proxyGrantingTicket" : "PGTIOU-84678-8a9d",
+      "proxies" : [ "https://proxy2/pgtUrl", "https://proxy1/pgtUrl" ],
+      "attributes" : {
+        "authenticationDate" : [ "2015-02-10T14:28:42Z" ],
+        "isFromNewLogin" : [ true ],
+        "memberOf" : [ "Group1", "Group2" ],
+        "firstname" : [ "John" ],
+        "affiliation" : [ "staff", "faculty" ],
+        "title" : "Mr."
+      }
+    }
+  }
+}`
+
+	sr, err := ParseValidationBody([]byte(s), FormatJSON)
+	if err != nil {
+		t.Fatalf("Expected ParseValidationBody to succeed, got error: %v", err)
+	}
+
+	if sr.User != "username" {
+		t.Errorf("Expected User to be <username>, got <%s>", sr.User)
+	}
+
+	if sr.ProxyGrantingTicket != "PGTIOU-84678-8a9d" {
+		t.Errorf("Expected ProxyGrantingTicket to be <PGTIOU-84678-8a9d>, got <%s>", sr.ProxyGrantingTicket)
+	}
+
+	if len(sr.Proxies) != 2 || sr.Proxies[0] != "https://proxy2/pgtUrl" {
+		t.Errorf("Expected 2 proxies, got %v", sr.Proxies)
+	}
+
+	if authDate := time.Date(2015, 2, 10, 14, 28, 42, 0, time.UTC); !sr.AuthenticationDate.Equal(authDate) {
+		t.Errorf("Expected AuthenticationDate to be <%v>, got <%v>", authDate, sr.AuthenticationDate)
+	}
+
+	if !sr.IsNewLogin {
+		t.Errorf("Expected IsNewLogin to be true")
+	}
+
+	if len(sr.MemberOf) != 2 {
+		t.Errorf("Expected MemberOf to have 2 groups, got %v", sr.MemberOf)
+	}
+
+	if v := sr.Attributes["affiliation"]; len(v) != 2 || v[0] != "staff" || v[1] != "faculty" {
+		t.Errorf("Expected affiliation to be [staff faculty], got %v", v)
+	}
+
+	if v := sr.Attributes.Get("title"); v != "Mr." {
+		t.Errorf("Expected title to be <Mr.>, got <%s>", v)
+	}
+
+	failure := `{"serviceResponse":{"authenticationFailure":{"code":"INVALID_TICKET","description":"Ticket ST-1856339 not recognized"}}}`
+	_, err = ParseValidationBody([]byte(failure), FormatJSON)
+
+	var authErr *AuthenticationError
+	if !errors.As(err, &authErr) {
+		t.Fatalf("Expected an *AuthenticationError, got %v", err)
+	}
+
+	if authErr.Code != INVALID_TICKET {
+		t.Errorf("Expected Code to be <INVALID_TICKET>, got <%s>", authErr.Code)
+	}
+}
+
+func TestValidateCapturedResponse(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `<cas:serviceResponse xmlns:cas="http://www.yale.edu/tp/cas">
+  <cas:authenticationSuccess>
+    <cas:user>a7f3c2e1</cas:user>
+    <cas:attributes>
+      <cas:uid>enoch.root</cas:uid>
+    </cas:attributes>
+  </cas:authenticationSuccess>
+</cas:serviceResponse>`)
+	}))
+	defer server.Close()
+
+	casURL, _ := url.Parse(server.URL)
+	validator := NewServiceTicketValidator(server.Client(), casURL)
+
+	var captured []byte
+	var capturedFormat Format
+	validator.ResponseTrace = func(format Format, body []byte) {
+		capturedFormat, captured = format, body
+	}
+
+	serviceURL, _ := url.Parse("http://example.com/")
+	if _, err := validator.ValidateTicket(serviceURL, "ST-123"); err != nil {
+		t.Fatalf("Expected ValidateTicket to succeed, got error: %v", err)
+	}
+
+	if capturedFormat != FormatXML || len(captured) == 0 {
+		t.Fatalf("Expected the XML response to be traced, got %v with %d bytes", capturedFormat, len(captured))
+	}
+
+	server.Close()
+
+	for _, attribute := range []string{"uid", ""} {
+		validator.PrincipalAttribute = attribute
+
+		success, err := validator.ValidateCapturedResponse(serviceURL, captured, capturedFormat)
+		if err != nil {
+			t.Fatalf("Expected ValidateCapturedResponse to succeed, got error: %v", err)
+		}
+
+		expected := "enoch.root"
+		if attribute == "" {
+			expected = "a7f3c2e1"
+		}
+
+		if success.User != expected {
+			t.Errorf("Expected User to be <%s>, got <%s>", expected, success.User)
+		}
+	}
+}
+
+func FuzzParseValidationBody(f *testing.F) {
+	f.Add([]byte(`<cas:serviceResponse xmlns:cas="http://www.yale.edu/tp/cas">
+  <cas:authenticationSuccess>
+    <cas:user>username</cas:user>
+    <cas:attributes>
+      <cas:email>jdoe@example.org</cas:email>
+    </cas:attributes>
+  </cas:authenticationSuccess>
+</cas:serviceResponse>`))
+	f.Add([]byte(`<cas:serviceResponse xmlns:cas="http://www.yale.edu/tp/cas">
+  <cas:authenticationFailure code="INVALID_TICKET">Ticket ST-123 not recognized</cas:authenticationFailure>
+</cas:serviceResponse>`))
+	f.Add([]byte("yes\nusername\n"))
+	f.Add([]byte("no\n\n"))
+	f.Add([]byte("yes\n"))
+	f.Add([]byte(`{"serviceResponse":{"authenticationSuccess":{"user":"username","attributes":{"email":["jdoe@example.org"]}}}}`))
+	f.Add([]byte(""))
+	for _, value := range []string{"---", "--- ~", "--- [~]"} {
+		f.Add([]byte(`<cas:serviceResponse xmlns:cas="http://www.yale.edu/tp/cas">
+  <cas:authenticationSuccess>
+    <cas:user>username</cas:user>
+    <cas:roles>` + value + `</cas:roles>
+  </cas:authenticationSuccess>
+</cas:serviceResponse>`))
+	}
+
+	f.Fuzz(func(t *testing.T, body []byte) {
+		for _, format := range []Format{FormatXML, FormatCAS1, FormatJSON} {
+			sr, err := ParseValidationBody(body, format)
+			if err != nil && sr != nil {
+				t.Errorf("Expected no response alongside error <%v> for %v", err, format)
+			}
+		}
+	})
+}
@@ -0,0 +1,109 @@
+package cas
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// validationEndpoints are the validation endpoints of the CAS protocol, longest first
+var validationEndpoints = []string{"p3/serviceValidate", "p3/proxyValidate", "serviceValidate", "proxyValidate", "validate"}
+
+// ValidationError is returned when the request to a validation endpoint of the CAS server fails,
+// or is answered with an unexpected status code. It tells which endpoint, and so which protocol
+// version, was contacted at which URL.
+type ValidationError struct {
+	Endpoint   string // Validation endpoint, such as serviceValidate or validate for CAS 1
+	URL        string // URL of the request, with the ticket redacted
+	StatusCode int    // Status code of the response, zero if no response was received
+	Err        error  // Underlying error
+}
+
+// Error returns the ValidationError as a string
+func (e *ValidationError) Error() string {
+	return fmt.Sprintf("cas: validate ticket: %s %s: %v", e.Endpoint, e.URL, e.Err)
+}
+
+// Unwrap returns the underlying error
+func (e *ValidationError) Unwrap() error {
+	return e.Err
+}
+
+// newValidationError returns a ValidationError for the request to u. The *url.Error returned by
+// http.Client.Do is unwrapped, as it repeats the URL with the ticket.
+func newValidationError(u *url.URL, statusCode int, err error) *ValidationError {
+	if urlErr, ok := err.(*url.Error); ok {
+		err = urlErr.Err
+	}
+
+	e := &ValidationError{StatusCode: statusCode, Err: err}
+	if u != nil {
+		e.Endpoint = validationEndpoint(u.Path)
+		e.URL = redactedURL(u)
+	}
+
+	return e
+}
+
+// requestError returns the error of the context of r unchanged if the request failed because
+// it was cancelled or its deadline passed, so callers can compare it with context.Canceled,
+// and otherwise a ValidationError for err.
+func requestError(r *http.Request, err error) error {
+	if ctxErr := r.Context().Err(); ctxErr != nil {
+		return ctxErr
+	}
+
+	return newValidationError(r.URL, 0, err)
+}
+
+// statusError returns a ValidationError for a response with an unexpected status code.
+func statusError(resp *http.Response, body string) *ValidationError {
+	var u *url.URL
+	if resp.Request != nil {
+		u = resp.Request.URL
+	}
+
+	return newValidationError(u, resp.StatusCode, fmt.Errorf("unexpected status code %d: %s", resp.StatusCode, body))
+}
+
+// validationEndpoint returns the validation endpoint the path ends with, or the last segment
+// of the path if it is not a known endpoint.
+func validationEndpoint(p string) string {
+	for _, endpoint := range validationEndpoints {
+		if p == endpoint || strings.HasSuffix(p, "/"+endpoint) {
+			return endpoint
+		}
+	}
+
+	return p[strings.LastIndexByte(p, '/')+1:]
+}
+
+// redactedParameters are the query parameters whose values grant access and are redacted from
+// the URLs of errors and logs
+var redactedParameters = []string{"ticket", "pgt", "pgtIou", "pgtId", "SAMLart"}
+
+// redactedURL returns u as a string with the values of the ticket and other secret parameters
+// redacted.
+func redactedURL(u *url.URL) string {
+	if u == nil {
+		return ""
+	}
+
+	q := u.Query()
+	redacted := false
+	for _, name := range redactedParameters {
+		if q.Get(name) != "" {
+			q.Set(name, "REDACTED")
+			redacted = true
+		}
+	}
+
+	if !redacted {
+		return u.String()
+	}
+
+	r := *u
+	r.RawQuery = q.Encode()
+	return r.String()
+}
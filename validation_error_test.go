@@ -0,0 +1,82 @@
+package cas
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestValidationErrorStatus(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	casURL, _ := url.Parse(server.URL + "/cas/")
+	validator := NewServiceTicketValidator(server.Client(), casURL)
+	serviceURL, _ := url.Parse("http://example.com/")
+
+	_, err := validator.ValidateTicket(serviceURL, "ST-secret")
+
+	var validationErr *ValidationError
+	if !errors.As(err, &validationErr) {
+		t.Fatalf("Expected a *ValidationError, got <%v>", err)
+	}
+
+	if validationErr.Endpoint != "serviceValidate" {
+		t.Errorf("Expected Endpoint to be <serviceValidate>, got <%s>", validationErr.Endpoint)
+	}
+
+	if validationErr.StatusCode != http.StatusInternalServerError {
+		t.Errorf("Expected StatusCode to be <%d>, got <%d>", http.StatusInternalServerError, validationErr.StatusCode)
+	}
+
+	if !strings.HasPrefix(validationErr.URL, server.URL+"/cas/serviceValidate?") || !strings.Contains(validationErr.URL, "ticket=REDACTED") {
+		t.Errorf("Expected URL to be the redacted serviceValidate URL, got <%s>", validationErr.URL)
+	}
+
+	if strings.Contains(err.Error(), "ST-secret") || !strings.Contains(err.Error(), "serviceValidate") {
+		t.Errorf("Expected the message to name the endpoint without the ticket, got <%v>", err)
+	}
+}
+
+func TestValidationErrorRequestFailed(t *testing.T) {
+	server := httptest.NewTLSServer(http.NotFoundHandler())
+	casURL, _ := url.Parse(server.URL + "/cas/")
+	server.Close()
+
+	validator := NewServiceTicketValidator(server.Client(), casURL)
+	serviceURL, _ := url.Parse("http://example.com/")
+
+	_, err := validator.ValidateTicket(serviceURL, "ST-secret")
+
+	var validationErr *ValidationError
+	if !errors.As(err, &validationErr) {
+		t.Fatalf("Expected a *ValidationError, got <%v>", err)
+	}
+
+	if validationErr.StatusCode != 0 || validationErr.Endpoint != "serviceValidate" {
+		t.Errorf("Expected a failed serviceValidate request, got <%+v>", validationErr)
+	}
+
+	if strings.Contains(err.Error(), "ST-secret") {
+		t.Errorf("Expected the message not to contain the ticket, got <%v>", err)
+	}
+}
+
+func TestValidationEndpoint(t *testing.T) {
+	for p, expected := range map[string]string{
+		"/cas/p3/serviceValidate": "p3/serviceValidate",
+		"/serviceValidate":        "serviceValidate",
+		"/sso/cas/proxyValidate":  "proxyValidate",
+		"/validate":               "validate",
+		"/cas/login":              "login",
+	} {
+		if endpoint := validationEndpoint(p); endpoint != expected {
+			t.Errorf("Expected the endpoint of %s to be <%s>, got <%s>", p, expected, endpoint)
+		}
+	}
+}
@@ -0,0 +1,97 @@
+package cas
+
+import (
+	"log/slog"
+	"net/http"
+	"net/url"
+)
+
+// Option configures a ServiceTicketValidator created with New.
+type Option func(validator *ServiceTicketValidator)
+
+// New creates a ServiceTicketValidator for the CAS server at casURL, configured by the
+// options. Without WithHTTPClient the client of NewHTTPClient with its defaults is used.
+//
+// NewServiceTicketValidator remains for existing callers, and fields of the validator can
+// still be set after New returns, for those without an Option.
+func New(casURL *url.URL, opts ...Option) *ServiceTicketValidator {
+	validator := NewServiceTicketValidator(nil, casURL)
+	for _, opt := range opts {
+		opt(validator)
+	}
+
+	if validator.client == nil {
+		validator.client = NewHTTPClient(nil)
+	}
+
+	return validator
+}
+
+// WithHTTPClient sets the client used for requests to the CAS server.
+func WithHTTPClient(client *http.Client) Option {
+	return func(validator *ServiceTicketValidator) {
+		validator.client = client
+	}
+}
+
+// WithLogger sets the Logger of the validator.
+func WithLogger(logger *slog.Logger) Option {
+	return func(validator *ServiceTicketValidator) {
+		validator.Logger = logger
+	}
+}
+
+// WithProtocolVersion sets the ProtocolVersion spoken by the CAS server.
+func WithProtocolVersion(version ProtocolVersion) Option {
+	return func(validator *ServiceTicketValidator) {
+		validator.ProtocolVersion = version
+	}
+}
+
+// WithUserAgent sets the UserAgent sent to the CAS server.
+func WithUserAgent(userAgent string) Option {
+	return func(validator *ServiceTicketValidator) {
+		validator.UserAgent = userAgent
+	}
+}
+
+// WithHeader adds a header to the DefaultHeaders sent with every request to the CAS server.
+func WithHeader(name, value string) Option {
+	return func(validator *ServiceTicketValidator) {
+		if validator.DefaultHeaders == nil {
+			validator.DefaultHeaders = make(http.Header)
+		}
+
+		validator.DefaultHeaders.Add(name, value)
+	}
+}
+
+// WithCircuitBreaker sets the CircuitBreaker of the validator.
+func WithCircuitBreaker(breaker *CircuitBreaker) Option {
+	return func(validator *ServiceTicketValidator) {
+		validator.CircuitBreaker = breaker
+	}
+}
+
+// WithStrictParsing sets StrictParsing, failing validation on malformed JSON attributes and
+// ignoring LenientParsing.
+func WithStrictParsing() Option {
+	return func(validator *ServiceTicketValidator) {
+		validator.StrictParsing = true
+	}
+}
+
+// WithLenientParsing sets LenientParsing, recovering responses with malformed attribute
+// elements or an unexpected root element.
+func WithLenientParsing() Option {
+	return func(validator *ServiceTicketValidator) {
+		validator.LenientParsing = true
+	}
+}
+
+// WithCounters sets the Counters of the validator.
+func WithCounters(counters *ExpvarCounters) Option {
+	return func(validator *ServiceTicketValidator) {
+		validator.Counters = counters
+	}
+}
@@ -0,0 +1,53 @@
+package cas
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+func TestNewWithOptions(t *testing.T) {
+	var userAgent, apiKey string
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userAgent, apiKey = r.Header.Get("User-Agent"), r.Header.Get("X-Api-Key")
+		fmt.Fprint(w, `<cas:serviceResponse xmlns:cas="http://www.yale.edu/tp/cas">
+  <cas:authenticationSuccess>
+    <cas:user>enoch.root</cas:user>
+  </cas:authenticationSuccess>
+</cas:serviceResponse>`)
+	}))
+	defer server.Close()
+
+	casURL, _ := url.Parse(server.URL)
+	validator := New(casURL,
+		WithHTTPClient(server.Client()),
+		WithLogger(NoopLogger()),
+		WithProtocolVersion(ProtocolVersion3),
+		WithUserAgent("example-app/1.0"),
+		WithHeader("X-Api-Key", "secret"),
+	)
+
+	if validator.ProtocolVersion != ProtocolVersion3 {
+		t.Errorf("Expected ProtocolVersion to be <%v>, got <%v>", ProtocolVersion3, validator.ProtocolVersion)
+	}
+
+	serviceURL, _ := url.Parse("http://example.com/")
+	success, err := validator.ValidateTicket(serviceURL, "ST-123")
+	if err != nil {
+		t.Fatalf("Expected ValidateTicket to succeed, got error: %v", err)
+	}
+
+	if success.User != "enoch.root" {
+		t.Errorf("Expected User to be <enoch.root>, got <%s>", success.User)
+	}
+
+	if userAgent != "example-app/1.0" || apiKey != "secret" {
+		t.Errorf("Expected the User-Agent and X-Api-Key headers to be sent, got <%s> and <%s>", userAgent, apiKey)
+	}
+
+	if New(casURL).client == nil {
+		t.Errorf("Expected New to default the HTTP client")
+	}
+}
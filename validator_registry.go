@@ -0,0 +1,39 @@
+package cas
+
+import (
+	"sync"
+)
+
+// ValidatorRegistry holds the validators of an application fronting several services, keyed
+// by service name. It is safe for concurrent use and the zero value is ready to use.
+type ValidatorRegistry struct {
+	mu         sync.RWMutex
+	validators map[string]*ServiceTicketValidator
+}
+
+// NewValidatorRegistry creates a new, empty *ValidatorRegistry
+func NewValidatorRegistry() *ValidatorRegistry {
+	return &ValidatorRegistry{}
+}
+
+// Register stores the validator for the named service, replacing any validator registered
+// before under the same name.
+func (r *ValidatorRegistry) Register(name string, validator *ServiceTicketValidator) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.validators == nil {
+		r.validators = make(map[string]*ServiceTicketValidator)
+	}
+
+	r.validators[name] = validator
+}
+
+// Get returns the validator registered for the named service. ok is false if there is none.
+func (r *ValidatorRegistry) Get(name string) (validator *ServiceTicketValidator, ok bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	validator, ok = r.validators[name]
+	return validator, ok
+}
@@ -0,0 +1,55 @@
+package cas
+
+import (
+	"fmt"
+	"net/url"
+	"sync"
+	"testing"
+)
+
+func TestValidatorRegistry(t *testing.T) {
+	r := NewValidatorRegistry()
+
+	if _, ok := r.Get("billing"); ok {
+		t.Errorf("Expected Get on an empty registry to return ok <false>")
+	}
+
+	casURL, _ := url.Parse("https://cas.example.com/")
+	billing := NewServiceTicketValidator(nil, casURL)
+	r.Register("billing", billing)
+
+	if v, ok := r.Get("billing"); !ok || v != billing {
+		t.Errorf("Expected Get to return the registered validator, got <%v, %v>", v, ok)
+	}
+
+	replacement := NewServiceTicketValidator(nil, casURL)
+	r.Register("billing", replacement)
+
+	if v, _ := r.Get("billing"); v != replacement {
+		t.Errorf("Expected Register to replace the validator")
+	}
+}
+
+func TestValidatorRegistryConcurrent(t *testing.T) {
+	var r ValidatorRegistry
+	var wg sync.WaitGroup
+
+	for i := 0; i < 16; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			name := fmt.Sprintf("service-%d", i%4)
+			r.Register(name, &ServiceTicketValidator{})
+			r.Get(name)
+		}(i)
+	}
+
+	wg.Wait()
+
+	for i := 0; i < 4; i++ {
+		if _, ok := r.Get(fmt.Sprintf("service-%d", i)); !ok {
+			t.Errorf("Expected service-%d to be registered", i)
+		}
+	}
+}
@@ -8,19 +8,21 @@ import (
 type xmlServiceResponse struct {
 	XMLName xml.Name `xml:"http://www.yale.edu/tp/cas serviceResponse"`
 
-	Failure *xmlAuthenticationFailure
-	Success *xmlAuthenticationSuccess
+	Failure  *xmlAuthenticationFailure
+	Success  *xmlAuthenticationSuccess
+	Warnings []string `xml:"warning"`
 }
 
 type xmlAuthenticationFailure struct {
 	XMLName xml.Name `xml:"authenticationFailure"`
 	Code    string   `xml:"code,attr"`
-	Message string   `xml:",innerxml"`
+	Message string   `xml:",chardata"`
 }
 
 type xmlAuthenticationSuccess struct {
 	XMLName             xml.Name           `xml:"authenticationSuccess"`
 	User                string             `xml:"user"`
+	Service             string             `xml:"service,omitempty"`
 	ProxyGrantingTicket string             `xml:"proxyGrantingTicket,omitempty"`
 	Proxies             *xmlProxies        `xml:"proxies"`
 	Attributes          *xmlAttributes     `xml:"attributes"`
@@ -55,11 +57,13 @@ type xmlUserAttributes struct {
 type xmlNamedAttribute struct {
 	XMLName xml.Name `xml:"attribute"`
 	Name    string   `xml:"name,attr,omitempty"`
-	Value   string   `xml:",innerxml"`
+	Type    string   `xml:"http://www.w3.org/2001/XMLSchema-instance type,attr,omitempty"`
+	Value   string   `xml:",chardata"`
 }
 
 type xmlAnyAttribute struct {
 	XMLName xml.Name
+	Type    string `xml:"http://www.w3.org/2001/XMLSchema-instance type,attr,omitempty"`
 	Value   string `xml:",chardata"`
 }
 